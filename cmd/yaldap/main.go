@@ -20,6 +20,7 @@ func main() {
 
 	yaldap.Server.Base = &yaldap.Base
 	yaldap.Tools.Base = &yaldap.Base
+	cmd.PlugBackends(&yaldap)
 
 	// Parse command-line arguments using kong.
 	ctx := kong.Parse(
@@ -116,8 +116,36 @@ func (sessions Sessions) GC() {
 	})
 }
 
+// Refresh updates the LDAP object of all sessions using the given directory,
+// after it has been reloaded. Sessions whose object no longer exists or whose
+// credentials have changed are removed.
+func (sessions *Sessions) Refresh(directory ldap.Directory) {
+	sessions.reg.Range(func(key int, session *Session) bool {
+		session.sync.Lock()
+		defer session.sync.Unlock()
+
+		obj := directory.BaseDN(session.obj.DN())
+		if obj == nil {
+			sessions.reg.Delete(key)
+			return true
+		}
+
+		// NOTE: credentials can only be compared on objects supporting it;
+		//       other objects are kept as long as they exist.
+		if previous, ok := session.obj.(interface{ SameCredentials(ldap.Object) bool }); ok && !previous.SameCredentials(obj) {
+			sessions.reg.Delete(key)
+			return true
+		}
+
+		session.obj = obj
+		return true
+	})
+}
+
 // Object returns the LDAP object associated with the given session.
 func (session *Session) Object() ldap.Object {
+	session.sync.RLock()
+	defer session.sync.RUnlock()
 	return session.obj
 }
 
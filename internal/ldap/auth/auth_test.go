@@ -2,11 +2,14 @@ package auth
 
 import (
 	"context"
+	"io"
+	"log/slog"
 	"sync"
 	"testing"
 	"time"
 
 	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
 	"github.com/jimlambrt/gldap"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -14,11 +17,18 @@ import (
 
 type mockLDAPObject map[string][]string
 
-func (o mockLDAPObject) DN() string                                        { return "" }
-func (o mockLDAPObject) Attributes() ldap.Attributes                       { return ldap.Attributes(o) }
-func (o mockLDAPObject) Search(gldap.Scope, string) ([]ldap.Object, error) { return nil, nil }
-func (o mockLDAPObject) Bind(string) (bool, error)                         { return false, nil }
-func (o mockLDAPObject) CanSearchOn(string) bool                           { return true }
+func (o mockLDAPObject) DN() string                  { return "" }
+func (o mockLDAPObject) Attributes() ldap.Attributes { return ldap.Attributes(o) }
+func (o mockLDAPObject) Search(gldap.Scope, string, ...ldap.SearchOption) ([]ldap.Object, error) {
+	return nil, nil
+}
+func (o mockLDAPObject) Bind(string) (bool, error)                     { return false, nil }
+func (o mockLDAPObject) CanSearchOn(ldap.Object) bool                  { return true }
+func (o mockLDAPObject) CanSearchBelow(ldap.Object) bool               { return true }
+func (o mockLDAPObject) CanProxyAs(ldap.Object) bool                   { return false }
+func (o mockLDAPObject) CanReadAttribute(ldap.Object, string) bool     { return true }
+func (o mockLDAPObject) CanFilterOnAttribute(ldap.Object, string) bool { return true }
+func (o mockLDAPObject) CanCompareAttribute(ldap.Object, string) bool  { return true }
 
 func TestSessions_NewSession(t *testing.T) {
 	sessions := NewSessions(context.Background(), time.Second)
@@ -136,6 +146,80 @@ func TestSessions_GC(t *testing.T) {
 	})
 }
 
+type mockDirectory map[string]ldap.Object
+
+func (d mockDirectory) BaseDN(dn string) ldap.Object { return d[dn] }
+
+func TestSessions_Refresh(t *testing.T) {
+	alice := func(password string) *common.Object {
+		return &common.Object{ImplObject: common.ImplObject{DN: "cn=alice,dc=org", BindPasswords: []string{password}}}
+	}
+	bob := &common.Object{ImplObject: common.ImplObject{DN: "cn=bob,dc=org", BindPasswords: []string{"bob"}}}
+
+	sessions := NewSessions(context.Background(), time.Hour)
+	_ = sessions.NewSession(0, alice("alice"))
+	_ = sessions.NewSession(1, alice("alice"))
+	_ = sessions.NewSession(2, bob)
+
+	t.Run("SameCredentials", func(t *testing.T) {
+		reloaded := alice("alice")
+		sessions.Refresh(mockDirectory{"cn=alice,dc=org": reloaded, "cn=bob,dc=org": bob})
+
+		require.NotNil(t, sessions.Session(0))
+		assert.Same(t, reloaded, sessions.Session(0).Object())
+		assert.Same(t, reloaded, sessions.Session(1).Object())
+		assert.NotNil(t, sessions.Session(2))
+	})
+
+	t.Run("ChangedCredentials", func(t *testing.T) {
+		sessions.Refresh(mockDirectory{"cn=alice,dc=org": alice("secret"), "cn=bob,dc=org": bob})
+
+		assert.Nil(t, sessions.Session(0))
+		assert.Nil(t, sessions.Session(1))
+		assert.NotNil(t, sessions.Session(2))
+	})
+
+	t.Run("RemovedObject", func(t *testing.T) {
+		sessions.Refresh(mockDirectory{})
+
+		assert.Nil(t, sessions.Session(2))
+	})
+}
+
+type mockPasswordStore map[string]string
+
+func (store mockPasswordStore) UpdateBindPassword(dn string, hash string) error {
+	store[dn] = hash
+	return nil
+}
+
+func TestSessions_Refresh_RehashedPassword(t *testing.T) {
+	store := mockPasswordStore{}
+	policy := &common.PasswordPolicy{
+		MinStrength: common.PasswordStrong,
+		Hasher:      common.PasswordHashers["bcrypt"],
+		Store:       store,
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	alice := &common.Object{ImplObject: common.ImplObject{DN: "cn=alice,dc=org", BindPasswords: []string{"alice"}, PasswordPolicy: policy}}
+
+	valid, err := alice.Bind("alice")
+	require.NoError(t, err)
+	require.True(t, valid)
+	require.Contains(t, store, "cn=alice,dc=org")
+
+	sessions := NewSessions(context.Background(), time.Hour)
+	_ = sessions.NewSession(0, alice)
+
+	// NOTE: the rehashed password stored by the bind triggers a reload, which
+	//       must not be considered as a change of credentials.
+	reloaded := &common.Object{ImplObject: common.ImplObject{DN: "cn=alice,dc=org", BindPasswords: []string{store["cn=alice,dc=org"]}, PasswordPolicy: policy}}
+	sessions.Refresh(mockDirectory{"cn=alice,dc=org": reloaded})
+
+	require.NotNil(t, sessions.Session(0))
+	assert.Same(t, reloaded, sessions.Session(0).Object())
+}
+
 func TestSession_Session(t *testing.T) {
 	sessions := NewSessions(context.Background(), time.Millisecond)
 	obj := &mockLDAPObject{}
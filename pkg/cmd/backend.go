@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	compositedir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/composite"
+
+	// Stock backends, registered on import.
+	_ "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/ldif"
+	_ "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/passwd"
+	_ "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/proxy"
+	_ "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/sqlite"
+	_ "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+)
+
+type Backend struct {
+	Name string `name:"name" help:"Backend which stores the data (see the list of backends below); guessed from the URL scheme if not set" placeholder:"BACKEND"`
+	URL  string `name:"url" help:"URL used to connect to the backend" required:"" placeholder:"URL"`
+
+	Mounts []string `name:"mount" help:"Additional backend serving all entries below a naming context, as 'SUFFIX=[BACKEND:]URL [OPTION=VALUE ...]' (e.g. 'dc=legacy,dc=org=yaml:legacy.yaml key-file=legacy.key'); without options, the mount uses the backend options" sep:"none" placeholder:"SUFFIX=[BACKEND:]URL [OPTION=VALUE ...]"`
+
+	// Options contains the options of all registered backends, prefixed by
+	// their name (see PlugBackends).
+	Options  kong.Plugins                 `embed:""`
+	backends map[string]directory.Backend `kong:"-"`
+}
+
+// PlugBackends adds the options of all registered backends to all backend
+// configurations found inside the given command line structure. It must be
+// called before parsing the command line.
+func PlugBackends(cli any) {
+	plugBackends(reflect.ValueOf(cli))
+}
+
+func plugBackends(v reflect.Value) {
+	v = reflect.Indirect(v)
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	if backend, ok := v.Addr().Interface().(*Backend); ok {
+		backend.plug()
+		return
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		// NOTE: pointers are not followed, in order to avoid walking twice
+		//       on the shared Base structure.
+		if field := v.Field(i); field.Kind() == reflect.Struct && field.CanSet() {
+			plugBackends(field)
+		}
+	}
+}
+
+// plug adds the options of all registered backends to the configuration.
+func (b *Backend) plug() {
+	b.Options, b.backends = nil, map[string]directory.Backend{}
+	for _, info := range directory.Backends() {
+		typ := reflect.StructOf([]reflect.StructField{{
+			Name: "Options",
+			Type: reflect.TypeOf(info.New()).Elem(),
+			Tag:  reflect.StructTag(fmt.Sprintf(`embed:"" prefix:"%[1]s." group:"Backend %[1]s"`, info.Name)),
+		}})
+
+		options := reflect.New(typ)
+		b.Options = append(b.Options, options.Interface())
+		b.backends[info.Name] = options.Elem().Field(0).Addr().Interface().(directory.Backend)
+	}
+}
+
+// backend returns the backend serving the given URL, with the options parsed
+// from the command line (or the zero-valued options if they are not plugged).
+// If options are given (as `OPTION=VALUE`), a dedicated backend is configured
+// with them instead.
+func (b Backend) backend(name, url string, options ...string) (string, directory.Backend, error) {
+	info, err := directory.LookupBackend(name, url)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(options) > 0 {
+		backend, err := newBackend(info, options)
+		return info.Name, backend, err
+	}
+	if backend, exists := b.backends[info.Name]; exists {
+		return info.Name, backend, nil
+	}
+	return info.Name, info.New(), nil
+}
+
+// newBackend returns a new backend configured with the given options,
+// formatted as `OPTION=VALUE` (e.g. `key-file=legacy.key`).
+func newBackend(info directory.BackendInfo, options []string) (directory.Backend, error) {
+	backend := info.New()
+	parser, err := kong.New(backend, kong.Name(info.Name), kong.Exit(func(int) {}))
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure backend '%s': %w", info.Name, err)
+	}
+
+	args := make([]string, 0, len(options))
+	for _, option := range options {
+		args = append(args, "--"+option)
+	}
+	if _, err := parser.Parse(args); err != nil {
+		return nil, fmt.Errorf("invalid options for backend '%s': %w", info.Name, err)
+	}
+	return backend, nil
+}
+
+// NewDirectory creates the directory described by the backend configuration.
+// If other backends are mounted, all of them are served through a single
+// directory routing requests based on the DN suffix.
+// All backends are validated before creating any directory.
+func (b Backend) NewDirectory(ctx context.Context) (directory.Directory, error) {
+	_, main, err := b.backend(b.Name, b.URL)
+	if err != nil {
+		return nil, err
+	}
+	if err := main.Validate(b.URL); err != nil {
+		return nil, err
+	}
+
+	type mount struct {
+		suffix, url string
+		backend     directory.Backend
+	}
+	mounts := make([]mount, 0, len(b.Mounts))
+	for _, definition := range b.Mounts {
+		suffix, name, url, options, err := parseMount(definition)
+		if err != nil {
+			return nil, err
+		}
+
+		_, backend, err := b.backend(name, url, options...)
+		if err == nil {
+			err = backend.Validate(url)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to mount '%s': %w", suffix, err)
+		}
+		mounts = append(mounts, mount{suffix: suffix, url: url, backend: backend})
+	}
+
+	dir, err := main.NewDirectory(ctx, b.URL)
+	if err != nil || len(mounts) == 0 {
+		return dir, err
+	}
+
+	// NOTE: directories already created are closed if another one cannot be
+	//       created or mounted.
+	created := []directory.Directory{dir}
+	closeCreated := func() {
+		for _, dir := range created {
+			_ = directory.Close(dir)
+		}
+	}
+
+	opts := make([]compositedir.Option, 0, len(mounts))
+	for _, mount := range mounts {
+		mounted, err := mount.backend.NewDirectory(ctx, mount.url)
+		if err != nil {
+			closeCreated()
+			return nil, fmt.Errorf("unable to mount '%s': %w", mount.suffix, err)
+		}
+		created = append(created, mounted)
+		opts = append(opts, compositedir.WithMount(mount.suffix, mounted))
+	}
+
+	composite, err := compositedir.NewDirectory(dir, opts...)
+	if err != nil {
+		closeCreated()
+		return nil, err
+	}
+	return composite, nil
+}
+
+// parseMount parses the given mount definition, formatted as
+// `SUFFIX=[BACKEND:]URL [OPTION=VALUE ...]`. Because the suffix contains `=`,
+// the definition is split on the first `=` followed by a registered backend
+// name or URL scheme; the URL and the options are separated by spaces.
+func parseMount(mount string) (suffix, name, url string, options []string, err error) {
+	for i, c := range mount {
+		if c != '=' {
+			continue
+		}
+
+		rest := mount[i+1:]
+		for _, info := range directory.Backends() {
+			if target, found := strings.CutPrefix(rest, info.Name+":"); found {
+				url, options := splitMountOptions(target)
+				return mount[:i], info.Name, url, options, nil
+			}
+			for _, scheme := range info.Schemes {
+				if strings.HasPrefix(rest, scheme+"://") {
+					url, options := splitMountOptions(rest)
+					return mount[:i], "", url, options, nil
+				}
+			}
+		}
+	}
+	return "", "", "", nil, fmt.Errorf("invalid mount '%s': must be formatted as 'SUFFIX=[BACKEND:]URL [OPTION=VALUE ...]'", mount)
+}
+
+// splitMountOptions splits the URL of a mount from its options.
+func splitMountOptions(target string) (url string, options []string) {
+	fields := strings.Fields(target)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], fields[1:]
+}
+
+// backendsHelp describes all registered backends.
+func backendsHelp() string {
+	var help strings.Builder
+
+	help.WriteString("Backends:\n")
+	for _, info := range directory.Backends() {
+		schemes := make([]string, 0, len(info.Schemes))
+		for _, scheme := range info.Schemes {
+			schemes = append(schemes, scheme+"://")
+		}
+		fmt.Fprintf(&help, "  %s (%s): %s\n", info.Name, strings.Join(schemes, ", "), info.Description)
+	}
+	return help.String()
+}
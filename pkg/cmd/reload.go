@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+)
+
+type (
+	Reload struct {
+		WatchInterval time.Duration `name:"watch-interval" help:"Interval between two checks of the files the directory is built from (including the ones read by YAML templates) and of the trigger file; 0 disables these checks" default:"5s"`
+		TriggerFile   string        `name:"trigger-file" help:"File whose modification (e.g. using 'touch') reloads the directory" placeholder:"PATH"`
+	}
+
+	// fileState contains the information used to detect changes on a file.
+	fileState struct {
+		exists  bool
+		size    int64
+		modTime time.Time
+	}
+
+	// reloadableStore persists rehashed passwords inside the directory
+	// currently served.
+	reloadableStore struct{ *directory.ReloadableDirectory }
+)
+
+// Watch reloads the given directory each time SIGHUP is received, one of the
+// files it is built from changes or the trigger file is modified, until the
+// context is done. If the new directory cannot be loaded, the current one is
+// kept and the error is logged.
+func (r Reload) Watch(ctx context.Context, logger *slog.Logger, reloadable *directory.ReloadableDirectory) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	var tick <-chan time.Time
+	if r.WatchInterval > 0 {
+		ticker := time.NewTicker(r.WatchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	reload := func(reason string) {
+		log := logger.With(slog.String("reason", reason))
+		if err := reloadable.Reload(); err != nil {
+			log.Error("unable to reload the directory, the previous one is kept", slog.String("error", err.Error()))
+			return
+		}
+		log.Info("directory reloaded")
+	}
+
+	files := r.watchedFiles(reloadable)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+			reload("SIGHUP received")
+		case <-tick:
+			current := r.watchedFiles(reloadable)
+			changed := changedFile(files, current)
+			if changed == "" {
+				continue
+			}
+
+			reload(fmt.Sprintf("'%s' changed", changed))
+			// NOTE: the reloaded directory may be built from other files.
+			files = r.watchedFiles(reloadable)
+		}
+	}
+}
+
+// watchedFiles returns the state of the trigger file and of all files the
+// directory is built from.
+func (r Reload) watchedFiles(reloadable *directory.ReloadableDirectory) map[string]fileState {
+	paths := reloadable.WatchedFiles()
+	if r.TriggerFile != "" {
+		paths = append(paths, r.TriggerFile)
+	}
+
+	files := make(map[string]fileState, len(paths))
+	for _, path := range paths {
+		var state fileState
+		if info, err := os.Stat(path); err == nil {
+			state = fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+		}
+		files[path] = state
+	}
+	return files
+}
+
+// changedFile returns the first file whose state differs between the given
+// snapshots, or an empty string if none changed.
+func changedFile(previous, current map[string]fileState) string {
+	for path, state := range current {
+		if prev, exists := previous[path]; !exists || prev != state {
+			return path
+		}
+	}
+	return ""
+}
+
+// UpdateBindPassword replaces the bind password of the given object, if the
+// directory currently served is still writable.
+func (s reloadableStore) UpdateBindPassword(dn string, hash string) error {
+	current, release := s.Acquire()
+	defer release()
+
+	store, writable := current.(common.PasswordStore)
+	if !writable {
+		return fmt.Errorf("unable to update the bind password of '%s': the directory is no longer writable", dn)
+	}
+	return store.UpdateBindPassword(dn, hash)
+}
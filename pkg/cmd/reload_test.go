@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload_Watch(t *testing.T) {
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, "directory.yaml")
+	description := filepath.Join(tmp, "description.txt")
+	trigger := filepath.Join(tmp, "reload")
+
+	require.NoError(t, os.WriteFile(description, []byte("first"), 0o600))
+	require.NoError(t, os.WriteFile(path, []byte(`
+dc:org:
+  description: {{ readFile "`+description+`" }}
+  cn:alice:
+    userPassword: !!ldap/bind:password alice
+`), 0o600))
+
+	var loads atomic.Int32
+	reloadable, err := directory.NewReloadableDirectory(func() (directory.Directory, error) {
+		loads.Add(1)
+		return yamldir.NewDirectory(path)
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reload := Reload{WatchInterval: 10 * time.Millisecond, TriggerFile: trigger}
+	go reload.Watch(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)), reloadable)
+
+	// NOTE: the watcher must take its first snapshot before any change.
+	time.Sleep(50 * time.Millisecond)
+
+	t.Run("ReadFile", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(description, []byte("second"), 0o600))
+
+		assert.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual([]string{"second"}, reloadable.BaseDN("dc=org").Attributes()["description"])
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("InvalidDirectory", func(t *testing.T) {
+		previous := reloadable.Current()
+		count := loads.Load()
+		require.NoError(t, os.WriteFile(path, []byte("invalid: [yaml"), 0o600))
+
+		assert.Eventually(t, func() bool { return loads.Load() > count }, time.Second, 10*time.Millisecond)
+		assert.Same(t, previous, reloadable.Current())
+	})
+
+	t.Run("TriggerFile", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("dc:org: {}\n"), 0o600))
+		// NOTE: wait for the reload caused by the directory change.
+		assert.Eventually(t, func() bool {
+			return reloadable.BaseDN("cn=alice,dc=org") == nil
+		}, time.Second, 10*time.Millisecond)
+
+		count := loads.Load()
+		require.NoError(t, os.WriteFile(trigger, nil, 0o600))
+
+		assert.Eventually(t, func() bool { return loads.Load() > count }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("SIGHUP", func(t *testing.T) {
+		count := loads.Load()
+		require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+
+		assert.Eventually(t, func() bool { return loads.Load() > count }, time.Second, 10*time.Millisecond)
+	})
+}
@@ -6,7 +6,9 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"log/slog"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,21 +16,37 @@ import (
 	"github.com/chezmoi-sh/yaldap/internal/ldap/auth"
 	"github.com/chezmoi-sh/yaldap/pkg/ldap"
 	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
-	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
 	"github.com/chezmoi-sh/yaldap/pkg/utils"
+	goldap "github.com/go-ldap/ldap/v3"
 	"github.com/jimlambrt/gldap"
 	"golang.org/x/sync/errgroup"
 )
 
+type (
+	BindNameResolution struct {
+		SearchBase string   `name:"search-base" help:"Base DN under which bind names that are not DNs (e.g. 'alice') are resolved" placeholder:"DN"`
+		Filters    []string `name:"filter" help:"Ordered LDAP filters used to resolve bind names that are not DNs, where '%s' is replaced by the bind name (e.g. '(uid=%s)')" sep:"none" placeholder:"FILTER"`
+	}
+
+	PasswordPolicy struct {
+		MinStrength string `name:"min-strength" help:"Minimal strength expected from bind passwords; a warning is emitted when a weaker one is used" enum:"plaintext,insecure,weak,strong" default:"strong"`
+		Rehash      string `name:"rehash" help:"Algorithm used to rehash weaker bind passwords, if the backend is writable" enum:"none,argon2,bcrypt,pbkdf2,scrypt" default:"none"`
+	}
+)
+
 type Server struct {
 	*Base `kong:"-"`
 
 	ListenAddr string `name:"listen-address" help:"Address to listen on" default:":389"`
 
-	Backend struct {
-		Name string `name:"name" help:"Backend which stores the data" enum:"yaml" required:"" placeholder:"BACKEND"`
-		URL  string `name:"url" help:"URL used to connect to the backend" required:"" placeholder:"URL"`
-	} `embed:"" prefix:"backend."`
+	Backend Backend `embed:"" prefix:"backend."`
+
+	BindNameResolution BindNameResolution `embed:"" prefix:"bind."`
+	PasswordPolicy     PasswordPolicy     `embed:"" prefix:"password-policy."`
+
+	HideUnauthorizedBases bool     `name:"hide-unauthorized-bases" help:"Reject searches on bases the client is not allowed to see as if they did not exist" default:"false" negatable:""`
+	DefaultReferrals      []string `name:"default-referral" help:"LDAP URL searches outside all naming contexts are referred to (e.g. 'ldap://ldap.example.org')" sep:"none" placeholder:"URL"`
 
 	TLS struct {
 		Enable    bool   `name:"tls" help:"Enable TLS" default:"false" negatable:""`
@@ -39,13 +57,43 @@ type Server struct {
 	} `embed:""`
 
 	SessionTTL time.Duration `name:"session-ttl" help:"Duration of a BIND session before it expires" default:"168h"`
+
+	Reload Reload `embed:"" prefix:"reload."`
 }
 
 // Run starts the yaLDAP server using the configuration passed to the command.
 func (s Server) Run(_ *kong.Context) error {
 	logger := s.Logger()
 
-	directory, err := s.NewDirectory()
+	policy, err := s.PasswordPolicy.Policy(logger)
+	if err != nil {
+		return err
+	}
+
+	for _, url := range s.DefaultReferrals {
+		if err := directory.ValidateReferralURL(url); err != nil {
+			return fmt.Errorf("invalid default referral: %w", err)
+		}
+	}
+
+	ctx, _ := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+
+	// NOTE: the directory is fully built and validated on each reload, before
+	//       replacing the one used to serve requests.
+	reloadable, err := directory.NewReloadableDirectory(func() (directory.Directory, error) {
+		return s.Backend.NewDirectory(common.ContextWithPasswordPolicy(ctx, policy))
+	})
+	if err != nil {
+		return err
+	}
+	if _, writable := reloadable.Current().(common.PasswordStore); writable {
+		policy.Store = reloadableStore{reloadable}
+	}
+
+	sessions := auth.NewSessions(ctx, s.SessionTTL)
+	reloadable.OnReload(sessions.Refresh)
+
+	resolvers, err := s.BindNameResolution.Resolvers()
 	if err != nil {
 		return err
 	}
@@ -62,9 +110,14 @@ func (s Server) Run(_ *kong.Context) error {
 		return err
 	}
 
-	ctx, _ := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
-
-	err = server.Router(ldap.NewMux(logger, directory, auth.NewSessions(ctx, s.SessionTTL)))
+	err = server.Router(ldap.NewMux(
+		logger,
+		reloadable,
+		sessions,
+		ldap.WithBindNameResolvers(resolvers...),
+		ldap.WithHiddenUnauthorizedBases(s.HideUnauthorizedBases),
+		ldap.WithDefaultReferrals(s.DefaultReferrals...),
+	))
 	if err != nil {
 		return err
 	}
@@ -73,6 +126,10 @@ func (s Server) Run(_ *kong.Context) error {
 	g.Go(func() error {
 		return server.Run(s.ListenAddr, gldap.WithTLSConfig(tlsConfig))
 	})
+	g.Go(func() error {
+		s.Reload.Watch(ctx, logger, reloadable)
+		return nil
+	})
 
 	// Graceful shutdown.
 	<-ctx.Done()
@@ -82,14 +139,44 @@ func (s Server) Run(_ *kong.Context) error {
 	return g.Wait()
 }
 
-func (s Server) NewDirectory() (directory.Directory, error) {
-	// Get the directory builder based on the backend name.
-	switch s.Backend.Name {
-	case "yaml": //nolint:goconst
-		return yamldir.NewDirectory(s.Backend.URL)
-	default:
-		return nil, fmt.Errorf("unknown backend: %s, only `yaml` is supported", s.Backend.Name)
+// Help describes the registered backends.
+func (s Server) Help() string { return backendsHelp() }
+
+// Resolvers creates the bind name resolvers described by the configuration.
+func (b BindNameResolution) Resolvers() ([]ldap.BindNameResolver, error) {
+	resolvers := make([]ldap.BindNameResolver, 0, len(b.Filters))
+	for _, filter := range b.Filters {
+		if !strings.Contains(filter, "%s") {
+			return nil, fmt.Errorf("invalid bind filter '%s': must contain '%%s'", filter)
+		}
+		if _, err := goldap.CompileFilter(strings.ReplaceAll(filter, "%s", "username")); err != nil {
+			return nil, fmt.Errorf("invalid bind filter '%s': %w", filter, err)
+		}
+
+		resolvers = append(resolvers, ldap.BindNameResolver{BaseDN: b.SearchBase, Filter: filter})
+	}
+	return resolvers, nil
+}
+
+// Policy creates the password policy described by the configuration.
+func (p PasswordPolicy) Policy(logger *slog.Logger) (*common.PasswordPolicy, error) {
+	minStrength := common.PasswordStrong
+	if p.MinStrength != "" {
+		var err error
+		if minStrength, err = common.ParsePasswordStrength(p.MinStrength); err != nil {
+			return nil, err
+		}
+	}
+
+	policy := &common.PasswordPolicy{MinStrength: minStrength, Logger: logger}
+	if p.Rehash != "" && p.Rehash != "none" {
+		hasher, exists := common.PasswordHashers[p.Rehash]
+		if !exists {
+			return nil, fmt.Errorf("unknown rehash algorithm: %s", p.Rehash)
+		}
+		policy.Hasher = hasher
 	}
+	return policy, nil
 }
 
 func (s Server) TLSConfig() (*tls.Config, error) {
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
@@ -9,6 +10,8 @@ import (
 	"time"
 
 	"github.com/alecthomas/kong"
+	yaldap "github.com/chezmoi-sh/yaldap/pkg/ldap"
+	proxydir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/proxy"
 	"github.com/go-ldap/ldap/v3"
 	"github.com/madflojo/testcerts"
 	"github.com/stretchr/testify/assert"
@@ -19,6 +22,7 @@ func TestServer_Defaults(t *testing.T) {
 	var actual, expected Server
 	actual.Base = &Base{}
 	expected.Base = &Base{}
+	PlugBackends(&actual)
 
 	expected.ListenAddr = ":389"
 	expected.Backend.Name = "yaml"
@@ -26,9 +30,17 @@ func TestServer_Defaults(t *testing.T) {
 	expected.SessionTTL = 168 * time.Hour
 	expected.TLS.Enable = false
 	expected.TLS.MutualTLS = false
+	expected.PasswordPolicy.MinStrength = "strong"
+	expected.PasswordPolicy.Rehash = "none"
+	expected.Reload.WatchInterval = 5 * time.Second
 
 	os.Args = []string{"...", "--backend.name", "yaml", "--backend.url", "file://../ldap/directory/yaml/fixtures/basic.yaml"}
 	kong.Parse(&actual)
+
+	// NOTE: backend options are checked separately because they are built
+	//       dynamically.
+	assert.Equal(t, &proxydir.Backend{CacheTTL: 30 * time.Second}, actual.Backend.backends["proxy"])
+	actual.Backend.Options, actual.Backend.backends = nil, nil
 	assert.Equal(t, expected, actual)
 }
 
@@ -141,6 +153,155 @@ func TestServer_YAML_WithMutualTLS(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestBindNameResolution_Resolvers(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		resolution := BindNameResolution{SearchBase: "dc=example,dc=org", Filters: []string{"(uid=%s)", "(|(mail=%s)(mailAlias=%s))"}}
+
+		resolvers, err := resolution.Resolvers()
+		require.NoError(t, err)
+		assert.Equal(t,
+			[]yaldap.BindNameResolver{
+				{BaseDN: "dc=example,dc=org", Filter: "(uid=%s)"},
+				{BaseDN: "dc=example,dc=org", Filter: "(|(mail=%s)(mailAlias=%s))"},
+			},
+			resolvers,
+		)
+	})
+
+	t.Run("Invalid/NoPlaceholder", func(t *testing.T) {
+		resolution := BindNameResolution{Filters: []string{"(uid=alice)"}}
+
+		_, err := resolution.Resolvers()
+		assert.EqualError(t, err, "invalid bind filter '(uid=alice)': must contain '%s'")
+	})
+
+	t.Run("Invalid/Filter", func(t *testing.T) {
+		resolution := BindNameResolution{Filters: []string{"uid=%s)"}}
+
+		_, err := resolution.Resolvers()
+		assert.EqualError(t, err, "invalid bind filter 'uid=%s)': LDAP Result Code 201 \"Filter Compile Error\": ldap: filter does not start with an '('")
+	})
+}
+
+func TestBackend_Mounts(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		backend := Backend{
+			Name:   "yaml",
+			URL:    "file://../ldap/directory/yaml/fixtures/basic.yaml",
+			Mounts: []string{"c=fr,dc=example,dc=org=yaml:file://../ldap/directory/yaml/fixtures/basic.yaml"},
+		}
+
+		directory, err := backend.NewDirectory(context.Background())
+		require.NoError(t, err)
+		assert.NotNil(t, directory.BaseDN("cn=alice,ou=people,c=fr,dc=example,dc=org"))
+		assert.Equal(t,
+			[]string{"c=fr,dc=example,dc=org", "dc=org"},
+			directory.BaseDN("").Attributes()["namingContexts"],
+		)
+	})
+
+	t.Run("GuessedFromScheme", func(t *testing.T) {
+		backend := Backend{
+			Name:   "yaml",
+			URL:    "file://../ldap/directory/yaml/fixtures/basic.yaml",
+			Mounts: []string{"c=fr,dc=example,dc=org=file://../ldap/directory/yaml/fixtures/basic.yaml"},
+		}
+
+		directory, err := backend.NewDirectory(context.Background())
+		require.NoError(t, err)
+		assert.NotNil(t, directory.BaseDN("cn=alice,ou=people,c=fr,dc=example,dc=org"))
+	})
+
+	t.Run("WithOptions", func(t *testing.T) {
+		backend := Backend{
+			Name: "yaml",
+			URL:  "file://../ldap/directory/yaml/fixtures/basic.yaml",
+			Mounts: []string{
+				"dc=staging,dc=org=file://../ldap/directory/yaml/fixtures/values/directory.yaml values=../ldap/directory/yaml/fixtures/values/values.yaml",
+				"dc=qa,dc=org=file://../ldap/directory/yaml/fixtures/values/directory.yaml values=../ldap/directory/yaml/fixtures/values/values.yaml set=organization=qa",
+			},
+		}
+		backend.plug()
+
+		directory, err := backend.NewDirectory(context.Background())
+		require.NoError(t, err)
+		assert.NotNil(t, directory.BaseDN("cn=alice,ou=people,dc=staging,dc=org"))
+		assert.NotNil(t, directory.BaseDN("cn=alice,ou=people,dc=qa,dc=org"))
+	})
+
+	t.Run("Invalid/Options", func(t *testing.T) {
+		backend := Backend{
+			Name:   "yaml",
+			URL:    "file://../ldap/directory/yaml/fixtures/basic.yaml",
+			Mounts: []string{"c=fr,dc=example,dc=org=file://../ldap/directory/yaml/fixtures/basic.yaml unknown=value"},
+		}
+
+		_, err := backend.NewDirectory(context.Background())
+		assert.EqualError(t, err, "unable to mount 'c=fr,dc=example,dc=org': invalid options for backend 'yaml': unknown flag --unknown")
+	})
+
+	t.Run("Invalid/Format", func(t *testing.T) {
+		backend := Backend{
+			Name:   "yaml",
+			URL:    "file://../ldap/directory/yaml/fixtures/basic.yaml",
+			Mounts: []string{"dc=legacy,dc=org=csv:legacy.csv"},
+		}
+
+		_, err := backend.NewDirectory(context.Background())
+		assert.EqualError(t, err, "invalid mount 'dc=legacy,dc=org=csv:legacy.csv': must be formatted as 'SUFFIX=[BACKEND:]URL [OPTION=VALUE ...]'")
+	})
+
+	t.Run("Invalid/Backend", func(t *testing.T) {
+		backend := Backend{
+			Name:   "yaml",
+			URL:    "file://../ldap/directory/yaml/fixtures/basic.yaml",
+			Mounts: []string{"dc=legacy,dc=org=yaml:unknown.yaml"},
+		}
+
+		_, err := backend.NewDirectory(context.Background())
+		assert.EqualError(t, err, "unable to mount 'dc=legacy,dc=org': unable to read YAML directory file: stat unknown.yaml: no such file or directory")
+	})
+}
+
+func TestBackend_NewDirectory(t *testing.T) {
+	t.Run("GuessedFromScheme", func(t *testing.T) {
+		backend := Backend{URL: "file://../ldap/directory/yaml/fixtures/basic.yaml"}
+
+		directory, err := backend.NewDirectory(context.Background())
+		require.NoError(t, err)
+		assert.NotNil(t, directory.BaseDN("cn=alice,ou=people,c=fr,dc=example,dc=org"))
+	})
+
+	t.Run("Invalid/NoScheme", func(t *testing.T) {
+		backend := Backend{URL: "../ldap/directory/yaml/fixtures/basic.yaml"}
+
+		_, err := backend.NewDirectory(context.Background())
+		assert.EqualError(t, err, "unable to guess the backend of '../ldap/directory/yaml/fixtures/basic.yaml': the URL has no scheme, the backend name is required")
+	})
+
+	t.Run("Invalid/Options", func(t *testing.T) {
+		var server Server
+		PlugBackends(&server)
+		server.Backend.URL = "ldap://ldap.example.org/dc=example,dc=org"
+		server.Backend.backends["proxy"].(*proxydir.Backend).PasswordFile = []byte("secret")
+
+		_, err := server.Backend.NewDirectory(context.Background())
+		assert.EqualError(t, err, "invalid service account: a password is given without bind DN")
+	})
+}
+
+func TestServer_Help(t *testing.T) {
+	assert.Equal(t,
+		"Backends:\n"+
+			"  ldif (ldif://): Directory described by an LDIF file (e.g. 'ldif:///etc/yaldap/directory.ldif')\n"+
+			"  passwd (passwd://): Directory built from passwd, shadow, group and htpasswd files (e.g. 'passwd:///etc/passwd')\n"+
+			"  proxy (ldap://, ldaps://): Mirror of an upstream LDAP server, below the base DN of the URL (e.g. 'ldap://ldap.example.org/dc=example,dc=org')\n"+
+			"  sqlite (sqlite://): Directory mapped from the tables of an SQLite database (e.g. 'sqlite:///var/lib/yaldap/directory.db')\n"+
+			"  yaml (file://, dir://, http://, https://): Directory described by a YAML file, a directory of YAML files or a YAML file served over HTTP(S) (e.g. 'file:///etc/yaldap/directory.yaml' or 'dir:///etc/yaldap/conf.d')\n",
+		Server{}.Help(),
+	)
+}
+
 // freePort returns a free port number.
 func freePort(t *testing.T) int {
 	addr, err := net.ResolveTCPAddr("tcp", "localhost:0")
@@ -15,7 +15,13 @@ type (
 	Tools struct {
 		*Base `kong:"-"`
 
-		Hash Hash `cmd:"" help:"Hashing tool"`
+		Hash    Hash    `cmd:"" help:"Hashing tool"`
+		Report  Report  `cmd:"" help:"Reporting tool"`
+		ACL     ACL     `cmd:"" name:"acl" help:"ACL debugging tool"`
+		TOTP    TOTP    `cmd:"" name:"totp" help:"TOTP second factor tool"`
+		Secrets Secrets `cmd:"" help:"Encrypted secrets tool"`
+		Export  Export  `cmd:"" help:"Export the directory served by a backend"`
+		Import  Import  `cmd:"" help:"Convert a directory from another format into YAML"`
 	}
 
 	Hash struct {
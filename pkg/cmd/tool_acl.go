@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	allow_fmt "fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	"github.com/jimlambrt/gldap"
+)
+
+type (
+	ACL struct {
+		Explain ACLExplain `cmd:"" name:"explain" help:"Explain why an identity can (or cannot) access some entries"`
+		Matrix  ACLMatrix  `cmd:"" name:"matrix" help:"Report the access of all bind identities on all subtrees"`
+	}
+
+	ACLExplain struct {
+		Backend Backend `embed:"" prefix:"backend."`
+
+		BindDN     string `name:"bind-dn" help:"DN of the identity whose access is explained" required:"" placeholder:"DN"`
+		Target     string `name:"target" help:"DN of the target entry" xor:"target" required:"" placeholder:"DN"`
+		Filter     string `name:"filter" help:"LDAP filter selecting the target entries" xor:"target" required:"" placeholder:"FILTER"`
+		Capability string `name:"capability" help:"Capability to explain" enum:"search,proxy,read,filter,compare" default:"search"`
+		Attribute  string `name:"attribute" help:"Attribute to explain, required by the read, filter and compare capabilities" placeholder:"ATTRIBUTE"`
+
+		// This is a workaround to allow fmt.Println to be mocked in tests.
+		writer io.Writer `kong:"-"`
+	}
+
+	ACLMatrix struct {
+		Backend Backend `embed:"" prefix:"backend."`
+
+		Capability string `name:"capability" help:"Capability to report" enum:"search,proxy" default:"search"`
+		Format     string `name:"format" help:"Output format" enum:"table,csv,json" default:"table"`
+
+		// This is a workaround to allow fmt.Println to be mocked in tests.
+		writer io.Writer `kong:"-"`
+	}
+
+	// aclMatrixCell represents the access of a bind identity on a subtree:
+	// the number of entries of the subtree it can access over all of them.
+	aclMatrixCell struct {
+		Identity string `json:"identity"`
+		Subtree  string `json:"subtree"`
+		Allowed  int    `json:"allowed"`
+		Total    int    `json:"total"`
+	}
+)
+
+// aclCapabilities maps the capability names used by the ACL tools to their
+// value.
+var aclCapabilities = map[string]common.ACLCapability{
+	"search":  common.ACLSearch,
+	"proxy":   common.ACLProxy,
+	"read":    common.ACLRead,
+	"filter":  common.ACLFilter,
+	"compare": common.ACLCompare,
+}
+
+func (e *ACLExplain) Run() error {
+	if e.writer == nil {
+		e.writer = os.Stdout
+	}
+
+	capability := aclCapabilities[e.Capability]
+	attributeLevel := capability == common.ACLRead || capability == common.ACLFilter || capability == common.ACLCompare
+	if attributeLevel && e.Attribute == "" {
+		return allow_fmt.Errorf("capability '%s' requires an attribute", e.Capability)
+	}
+
+	directory, root, err := e.Backend.newObjectDirectory("ACL explanations")
+	if err != nil {
+		return err
+	}
+
+	identity, valid := directory.BaseDN(e.BindDN).(*common.Object)
+	if !valid {
+		return allow_fmt.Errorf("unknown bind DN '%s'", e.BindDN)
+	}
+
+	var entries []ldap.Object
+	if e.Target != "" {
+		entry := directory.BaseDN(e.Target)
+		if entry == nil {
+			return allow_fmt.Errorf("unknown target DN '%s'", e.Target)
+		}
+		entries = append(entries, entry)
+	} else {
+		entries, err = root.Search(gldap.WholeSubtree, e.Filter)
+		if err != nil {
+			return err
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].DN() < entries[j].DN() })
+	}
+
+	w := tabwriter.NewWriter(e.writer, 0, 0, 2, ' ', 0)
+	allow_fmt.Fprintln(w, "DN\tDECISION\tRULE\tORIGIN")
+	for _, entry := range entries {
+		decision := identity.ExplainACL(capability, entry, e.Attribute)
+
+		verdict := "denied"
+		if decision.Allowed {
+			verdict = "allowed"
+		}
+
+		rule, origin := decision.Reason, "-"
+		if decision.Rule != nil {
+			rule = decision.Rule.String()
+			if decision.Rule.Origin != "" {
+				origin = decision.Rule.Origin
+			}
+		}
+		allow_fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.DN(), verdict, rule, origin)
+	}
+	return w.Flush()
+}
+
+func (m *ACLMatrix) Run() error {
+	if m.writer == nil {
+		m.writer = os.Stdout
+	}
+
+	_, root, err := m.Backend.newObjectDirectory("ACL matrices")
+	if err != nil {
+		return err
+	}
+
+	var identities, subtrees []*common.Object
+	common.WalkObjects(root, func(obj *common.Object) {
+		if obj.BindPasswords.IsSome() {
+			identities = append(identities, obj)
+		}
+		if obj != root && len(obj.SubObjects) > 0 {
+			subtrees = append(subtrees, obj)
+		}
+	})
+	sort.Slice(identities, func(i, j int) bool { return identities[i].DN() < identities[j].DN() })
+	sort.Slice(subtrees, func(i, j int) bool { return subtrees[i].DN() < subtrees[j].DN() })
+
+	capability := aclCapabilities[m.Capability]
+	cells := make([]aclMatrixCell, 0, len(identities)*len(subtrees))
+	for _, identity := range identities {
+		for _, subtree := range subtrees {
+			cell := aclMatrixCell{Identity: identity.DN(), Subtree: subtree.DN()}
+			common.WalkObjects(subtree, func(entry *common.Object) {
+				cell.Total++
+				if identity.ExplainACL(capability, entry, "").Allowed {
+					cell.Allowed++
+				}
+			})
+			cells = append(cells, cell)
+		}
+	}
+
+	switch m.Format {
+	case "json":
+		encoder := json.NewEncoder(m.writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(cells)
+	case "csv":
+		w := csv.NewWriter(m.writer)
+		_ = w.Write([]string{"identity", "subtree", "allowed", "total"})
+		for _, cell := range cells {
+			_ = w.Write([]string{cell.Identity, cell.Subtree, allow_fmt.Sprint(cell.Allowed), allow_fmt.Sprint(cell.Total)})
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		w := tabwriter.NewWriter(m.writer, 0, 0, 2, ' ', 0)
+		allow_fmt.Fprint(w, "IDENTITY")
+		for _, subtree := range subtrees {
+			allow_fmt.Fprintf(w, "\t%s", subtree.DN())
+		}
+		allow_fmt.Fprintln(w)
+
+		for i, identity := range identities {
+			allow_fmt.Fprint(w, identity.DN())
+			for _, cell := range cells[i*len(subtrees) : (i+1)*len(subtrees)] {
+				allow_fmt.Fprintf(w, "\t%d/%d", cell.Allowed, cell.Total)
+			}
+			allow_fmt.Fprintln(w)
+		}
+		return w.Flush()
+	}
+}
+
+// newObjectDirectory creates the directory described by the backend
+// configuration and returns it with its root object, if the backend is based
+// on common objects (required by the given feature).
+func (b Backend) newObjectDirectory(feature string) (ldap.Directory, *common.Object, error) {
+	directory, err := b.NewDirectory(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	root, valid := directory.BaseDN("").(*common.Object)
+	if !valid {
+		name, _, _ := b.backend(b.Name, b.URL)
+		return nil, nil, allow_fmt.Errorf("backend '%s' doesn't support %s", name, feature)
+	}
+	return directory, root, nil
+}
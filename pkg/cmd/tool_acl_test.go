@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACLExplain_Target(t *testing.T) {
+	buff := bytes.NewBuffer(nil)
+	tool := ACLExplain{
+		BindDN:     "cn=charlie,ou=people,c=de,dc=example,dc=org",
+		Target:     "cn=owner,ou=group,dc=example,dc=org",
+		Capability: "search",
+		writer:     buff,
+	}
+	tool.Backend.Name = "yaml"
+	tool.Backend.URL = "file://../ldap/directory/yaml/fixtures/basic.yaml"
+
+	err := tool.Run()
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		"DN                                   DECISION  RULE                                                  ORIGIN\n"+
+			"cn=owner,ou=group,dc=example,dc=org  denied    deny search on 'cn=owner,ou=group,dc=example,dc=org'  line 71, column 15\n",
+		buff.String(),
+	)
+}
+
+func TestACLExplain_Filter(t *testing.T) {
+	buff := bytes.NewBuffer(nil)
+	tool := ACLExplain{
+		BindDN:     "cn=bob,ou=people,c=fr,dc=example,dc=org",
+		Filter:     "(|(cn=owner)(cn=alice))",
+		Capability: "read",
+		Attribute:  "userPassword",
+		writer:     buff,
+	}
+	tool.Backend.Name = "yaml"
+	tool.Backend.URL = "file://../ldap/directory/yaml/fixtures/basic.yaml"
+
+	err := tool.Run()
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		"DN                                         DECISION  RULE                                                               ORIGIN\n"+
+			"cn=alice,ou=people,c=fr,dc=example,dc=org  denied    no matching read rule and secret attributes are hidden by default  -\n"+
+			"cn=owner,ou=group,dc=example,dc=org        denied    no matching read rule and secret attributes are hidden by default  -\n",
+		buff.String(),
+	)
+}
+
+func TestACLExplain_Files(t *testing.T) {
+	tmp := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "10-people.yaml"), []byte(`
+dc:org:
+  ou:people:
+    cn:alice:
+      .#acl: !!ldap/acl:allow-on ou=people,dc=org
+      userPassword: !!ldap/bind:password alice
+    cn:bob: {}
+    cn:charlie: {}
+`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "20-acl.yaml"), []byte(`
+dc:org:
+  ou:people:
+    cn:alice:
+      .#deny: !!ldap/acl:deny-on cn=charlie,ou=people,dc=org
+`), 0o600))
+
+	buff := bytes.NewBuffer(nil)
+	tool := ACLExplain{
+		BindDN:     "cn=alice,ou=people,dc=org",
+		Filter:     "(|(cn=bob)(cn=charlie))",
+		Capability: "search",
+		writer:     buff,
+	}
+	tool.Backend.Name = "yaml"
+	tool.Backend.URL = "dir://" + tmp
+
+	err := tool.Run()
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		"DN                           DECISION  RULE                                          ORIGIN\n"+
+			"cn=bob,ou=people,dc=org      allowed   allow search on 'ou=people,dc=org'            '"+filepath.Join(tmp, "10-people.yaml")+"' at line 5, column 14\n"+
+			"cn=charlie,ou=people,dc=org  denied    deny search on 'cn=charlie,ou=people,dc=org'  '"+filepath.Join(tmp, "20-acl.yaml")+"' at line 5, column 15\n",
+		buff.String(),
+	)
+}
+
+func TestACLExplain_Errors(t *testing.T) {
+	tests := []struct {
+		Name          string
+		Tool          ACLExplain
+		ExpectedError string
+	}{
+		{
+			Name:          "MissingAttribute",
+			Tool:          ACLExplain{BindDN: "cn=bob,ou=people,c=fr,dc=example,dc=org", Target: "dc=org", Capability: "read"},
+			ExpectedError: "capability 'read' requires an attribute",
+		},
+		{
+			Name:          "UnknownBindDN",
+			Tool:          ACLExplain{BindDN: "cn=mallory,dc=org", Target: "dc=org", Capability: "search"},
+			ExpectedError: "unknown bind DN 'cn=mallory,dc=org'",
+		},
+		{
+			Name:          "UnknownTarget",
+			Tool:          ACLExplain{BindDN: "cn=bob,ou=people,c=fr,dc=example,dc=org", Target: "dc=com", Capability: "search"},
+			ExpectedError: "unknown target DN 'dc=com'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.Tool.writer = bytes.NewBuffer(nil)
+			tt.Tool.Backend.Name = "yaml"
+			tt.Tool.Backend.URL = "file://../ldap/directory/yaml/fixtures/basic.yaml"
+
+			err := tt.Tool.Run()
+			assert.EqualError(t, err, tt.ExpectedError)
+		})
+	}
+}
+
+func TestACLMatrix_Table(t *testing.T) {
+	buff := bytes.NewBuffer(nil)
+	tool := ACLMatrix{Capability: "search", Format: "table", writer: buff}
+	tool.Backend.Name = "yaml"
+	tool.Backend.URL = "file://../ldap/directory/yaml/fixtures/basic.yaml"
+
+	err := tool.Run()
+	require.NoError(t, err)
+
+	lines := bytes.Split(bytes.TrimSpace(buff.Bytes()), []byte("\n"))
+	require.Len(t, lines, 4)
+	assert.Regexp(t, `^IDENTITY\s+c=de,dc=example,dc=org\s+c=fr,dc=example,dc=org\s+`, string(lines[0]))
+	assert.Regexp(t, `^cn=bob,ou=people,c=fr,dc=example,dc=org\s+0/3\s+0/4\s+0/3\s+5/16\s+5/17\s+5/5\s+`, string(lines[2]))
+}
+
+func TestACLMatrix_CSV(t *testing.T) {
+	buff := bytes.NewBuffer(nil)
+	tool := ACLMatrix{Capability: "search", Format: "csv", writer: buff}
+	tool.Backend.Name = "yaml"
+	tool.Backend.URL = "file://../ldap/directory/yaml/fixtures/basic.yaml"
+
+	err := tool.Run()
+	require.NoError(t, err)
+
+	assert.Contains(t, buff.String(), "identity,subtree,allowed,total\n")
+	assert.Contains(t, buff.String(), "\"cn=charlie,ou=people,c=de,dc=example,dc=org\",\"ou=group,dc=example,dc=org\",4,5\n")
+}
+
+func TestACLMatrix_JSON(t *testing.T) {
+	buff := bytes.NewBuffer(nil)
+	tool := ACLMatrix{Capability: "proxy", Format: "json", writer: buff}
+	tool.Backend.Name = "yaml"
+	tool.Backend.URL = "file://../ldap/directory/yaml/fixtures/basic.yaml"
+
+	err := tool.Run()
+	require.NoError(t, err)
+
+	var cells []aclMatrixCell
+	require.NoError(t, json.Unmarshal(buff.Bytes(), &cells))
+	assert.Len(t, cells, 3*9)
+	assert.Contains(t, cells, aclMatrixCell{
+		Identity: "cn=alice,ou=people,c=fr,dc=example,dc=org",
+		Subtree:  "dc=org",
+		Allowed:  0,
+		Total:    17,
+	})
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+
+	ldifdir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/ldif"
+)
+
+type (
+	Export struct {
+		Backend Backend `embed:"" prefix:"backend."`
+
+		Format string `name:"format" help:"Output format" enum:"ldif" default:"ldif"`
+
+		// This is a workaround to allow fmt.Println to be mocked in tests.
+		writer io.Writer `kong:"-"`
+	}
+)
+
+func (e *Export) Run() error {
+	if e.writer == nil {
+		e.writer = os.Stdout
+	}
+
+	directory, err := e.Backend.NewDirectory(context.Background())
+	if err != nil {
+		return err
+	}
+
+	// NOTE: LDIF is the only format supported for now (see the enum above).
+	return ldifdir.Export(e.writer, directory)
+}
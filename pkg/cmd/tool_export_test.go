@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	ldifdir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/ldif"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport_LDIF(t *testing.T) {
+	buff := bytes.NewBuffer(nil)
+	tool := Export{Format: "ldif", writer: buff}
+	tool.Backend.Name = "yaml"
+	tool.Backend.URL = "file://../ldap/directory/yaml/fixtures/basic.yaml"
+
+	err := tool.Run()
+	require.NoError(t, err)
+
+	assert.Contains(t, buff.String(), "version: 1\n\ndn: dc=org\n")
+	assert.Contains(t, buff.String(), "\ndn: cn=alice,ou=people,c=fr,dc=example,dc=org\n# yaldap: !!ldap/acl:allow-on dc=org\n")
+
+	directory, err := ldifdir.NewDirectoryFromLDIF(buff.Bytes())
+	require.NoError(t, err)
+
+	alice := directory.BaseDN("cn=alice,ou=people,c=fr,dc=example,dc=org")
+	require.NotNil(t, alice)
+	valid, err := alice.Bind("alice")
+	require.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestExport_UnknownBackend(t *testing.T) {
+	tool := Export{Format: "ldif", writer: bytes.NewBuffer(nil)}
+	tool.Backend.Name = "unknown"
+
+	err := tool.Run()
+	assert.EqualError(t, err, "unknown backend: unknown, supported backends are `ldif`, `passwd`, `proxy`, `sqlite`, `yaml`")
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	ldifdir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/ldif"
+)
+
+type (
+	Import struct {
+		LDIF ImportLDIF `cmd:"" name:"ldif" help:"Convert LDIF files (e.g. dumped by slapcat) into a YAML directory"`
+	}
+
+	ImportLDIF struct {
+		Files     []string `arg:"" name:"file" help:"LDIF files to convert ('-' to read from stdin)"`
+		OLCAccess bool     `name:"olc-access" help:"Translate the simple olcAccess rules of the cn=config entries into the ACL policy"`
+
+		// This is a workaround to allow fmt.Println to be mocked in tests.
+		reader io.Reader `kong:"-"`
+		writer io.Writer `kong:"-"`
+	}
+)
+
+func (i *ImportLDIF) Run() error {
+	if i.reader == nil {
+		i.reader = os.Stdin
+	}
+	if i.writer == nil {
+		i.writer = os.Stdout
+	}
+
+	documents := make([][]byte, 0, len(i.Files))
+	for _, file := range i.Files {
+		var raw []byte
+		var err error
+		if file == "-" {
+			raw, err = io.ReadAll(i.reader)
+		} else {
+			raw, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read LDIF file: %w", err)
+		}
+		documents = append(documents, raw)
+	}
+
+	var opts []ldifdir.ConvertOption
+	if i.OLCAccess {
+		opts = append(opts, ldifdir.WithOLCAccess())
+	}
+	return ldifdir.Convert(i.writer, documents, opts...)
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportLDIF(t *testing.T) {
+	buff := bytes.NewBuffer(nil)
+	tool := ImportLDIF{
+		Files:     []string{"../ldap/directory/ldif/fixtures/slapcat.ldif", "-"},
+		OLCAccess: true,
+		reader:    strings.NewReader("dn: olcDatabase={1}mdb,cn=config\nolcSuffix: dc=example,dc=org\nolcAccess: {0}to * by users read\n"),
+		writer:    buff,
+	}
+
+	err := tool.Run()
+	require.NoError(t, err)
+
+	assert.Contains(t, buff.String(), "      uid:alice: #dn: uid=alice,ou=people,dc=example,dc=org\n        <<: &inetOrgPerson\n")
+	assert.True(t, strings.HasSuffix(buff.String(), "---\n!!ldap/acl:policy\n'*': !!ldap/acl:allow-on dc=example,dc=org\n"), buff.String())
+}
+
+func TestImportLDIF_NoFile(t *testing.T) {
+	tool := ImportLDIF{Files: []string{"does-not-exist.ldif"}, writer: bytes.NewBuffer(nil)}
+
+	err := tool.Run()
+	assert.EqualError(t, err, "unable to read LDIF file: open does-not-exist.ldif: no such file or directory")
+}
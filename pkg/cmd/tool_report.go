@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	allow_fmt "fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+)
+
+type (
+	Report struct {
+		Passwords PasswordReport `cmd:"" name:"passwords" help:"List all bindable entries by password hash algorithm and strength"`
+	}
+
+	PasswordReport struct {
+		Backend Backend `embed:"" prefix:"backend."`
+
+		// This is a workaround to allow fmt.Println to be mocked in tests.
+		writer io.Writer `kong:"-"`
+	}
+
+	// passwordReportEntry represents a single line of the password report.
+	passwordReportEntry struct {
+		dn string
+		common.PasswordHashInfo
+	}
+)
+
+func (r *PasswordReport) Run() error {
+	if r.writer == nil {
+		r.writer = os.Stdout
+	}
+
+	_, root, err := r.Backend.newObjectDirectory("password reports")
+	if err != nil {
+		return err
+	}
+
+	var entries []passwordReportEntry
+	common.WalkObjects(root, func(obj *common.Object) {
+		if obj.BindPasswords.IsSome() {
+			entries = append(entries, passwordReportEntry{
+				dn:               obj.DN(),
+				PasswordHashInfo: common.AnalyzePassword(obj.BindPasswords.Unwrap()),
+			})
+		}
+	})
+
+	// NOTE: weakest passwords first, grouped by algorithm.
+	sort.Slice(entries, func(i, j int) bool {
+		switch {
+		case entries[i].Strength != entries[j].Strength:
+			return entries[i].Strength < entries[j].Strength
+		case entries[i].Algorithm != entries[j].Algorithm:
+			return entries[i].Algorithm < entries[j].Algorithm
+		default:
+			return entries[i].dn < entries[j].dn
+		}
+	})
+
+	w := tabwriter.NewWriter(r.writer, 0, 0, 2, ' ', 0)
+	allow_fmt.Fprintln(w, "STRENGTH\tALGORITHM\tDN")
+	for _, entry := range entries {
+		allow_fmt.Fprintf(w, "%s\t%s\t%s\n", entry.Strength, entry.Algorithm, entry.dn)
+	}
+	return w.Flush()
+}
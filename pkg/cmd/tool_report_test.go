@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordReport(t *testing.T) {
+	buff := bytes.NewBuffer(nil)
+	tool := PasswordReport{writer: buff}
+	tool.Backend.Name = "yaml"
+	tool.Backend.URL = "file://../ldap/directory/yaml/fixtures/basic.yaml"
+
+	err := tool.Run()
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		"STRENGTH   ALGORITHM  DN\n"+
+			"plaintext  plaintext  cn=alice,ou=people,c=fr,dc=example,dc=org\n"+
+			"plaintext  plaintext  cn=bob,ou=people,c=fr,dc=example,dc=org\n"+
+			"plaintext  plaintext  cn=charlie,ou=people,c=de,dc=example,dc=org\n",
+		buff.String(),
+	)
+}
+
+func TestPasswordReport_UnknownBackend(t *testing.T) {
+	tool := PasswordReport{writer: bytes.NewBuffer(nil)}
+	tool.Backend.Name = "unknown"
+
+	err := tool.Run()
+	assert.EqualError(t, err, "unknown backend: unknown, supported backends are `ldif`, `passwd`, `proxy`, `sqlite`, `yaml`")
+}
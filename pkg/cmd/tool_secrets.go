@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	allow_fmt "fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+	"github.com/chezmoi-sh/yaldap/pkg/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	Secrets struct {
+		Keygen  SecretsKeygen  `cmd:"" name:"keygen" help:"Generate a new age identity"`
+		Encrypt SecretsEncrypt `cmd:"" name:"encrypt" help:"Encrypt a value as a '!!ldap/encrypted' YAML value"`
+		Rotate  SecretsRotate  `cmd:"" name:"rotate" help:"Encrypt again all secrets of YAML files (SOPS data key and '!!ldap/encrypted' values) for new recipients"`
+	}
+
+	SecretsKeygen struct {
+		// This is a workaround to allow fmt.Println to be mocked in tests.
+		writer io.Writer `kong:"-"`
+	}
+
+	SecretsEncrypt struct {
+		Value      string   `arg:"" name:"value" help:"Value to encrypt ('-' to read it from stdin)" required:""`
+		Tag        string   `name:"tag" help:"YAML tag of the value once decrypted (e.g. '!!ldap/bind:password')" placeholder:"TAG"`
+		Recipients []string `name:"recipient" short:"r" help:"age recipient able to decrypt the value" required:"" placeholder:"age1..."`
+
+		// This is a workaround to allow fmt.Println to be mocked in tests.
+		reader io.Reader `kong:"-"`
+		writer io.Writer `kong:"-"`
+	}
+
+	SecretsRotate struct {
+		Files      []string `arg:"" name:"file" help:"YAML files to rotate, rewritten in place" type:"existingfile"`
+		KeyFile    []string `name:"key-file" help:"Path to a file containing age identities or a PGP private key, used to decrypt the current secrets" env:"YALDAP_KEY_FILE" placeholder:"PATH"`
+		Key        string   `name:"key" help:"age identity used to decrypt the current secrets (prefer the environment variable)" env:"YALDAP_KEY" placeholder:"AGE-SECRET-KEY-1..."`
+		Recipients []string `name:"recipient" short:"r" help:"age recipient able to decrypt the rotated secrets" required:"" placeholder:"age1..."`
+
+		// This is a workaround to allow fmt.Println to be mocked in tests.
+		writer io.Writer `kong:"-"`
+	}
+)
+
+func (k *SecretsKeygen) Run() error {
+	if k.writer == nil {
+		k.writer = os.Stdout
+	}
+
+	identity, err := secrets.GenerateIdentity()
+	if err != nil {
+		return err
+	}
+
+	allow_fmt.Fprintf(k.writer, "# created: %s\n", time.Now().Format(time.RFC3339))
+	allow_fmt.Fprintf(k.writer, "# public key: %s\n", identity.Recipient())
+	allow_fmt.Fprintln(k.writer, identity)
+	return nil
+}
+
+func (e *SecretsEncrypt) Run() error {
+	if e.reader == nil {
+		e.reader = os.Stdin
+	}
+	if e.writer == nil {
+		e.writer = os.Stdout
+	}
+
+	recipients, err := parseRecipients(e.Recipients)
+	if err != nil {
+		return err
+	}
+
+	// Handle value from stdin (- argument)
+	if e.Value == "-" {
+		raw, err := io.ReadAll(e.reader)
+		if err != nil {
+			return err
+		}
+		e.Value = strings.TrimSuffix(string(raw), "\n")
+	}
+
+	// NOTE: the value is encoded as YAML, so it is decrypted exactly as given
+	//       (e.g. a password looking like a number stays a string).
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: e.Value}
+	if e.Tag != "" {
+		node.Tag = e.Tag
+	}
+	plaintext, err := yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+
+	value, err := secrets.EncryptValue(plaintext, recipients...)
+	if err != nil {
+		return err
+	}
+	allow_fmt.Fprintf(e.writer, "!!ldap/encrypted %s\n", value)
+	return nil
+}
+
+func (r *SecretsRotate) Run() error {
+	if r.writer == nil {
+		r.writer = os.Stdout
+	}
+
+	recipients, err := parseRecipients(r.Recipients)
+	if err != nil {
+		return err
+	}
+	keys, err := secrets.LoadKeys(r.KeyFile...)
+	if err != nil {
+		return err
+	}
+	if r.Key != "" {
+		// NOTE: the key itself must never be part of the error.
+		parsed, err := secrets.ParseKeys([]byte(r.Key))
+		if err != nil {
+			return errors.New("invalid decryption key: not a valid age identity")
+		}
+		keys.Add(parsed)
+	}
+
+	for _, file := range r.Files {
+		count, err := rotateFile(file, keys, recipients)
+		if err != nil {
+			return allow_fmt.Errorf("unable to rotate the secrets of '%s': %w", file, err)
+		}
+		allow_fmt.Fprintf(r.writer, "%s: %d secret(s) rotated\n", file, count)
+	}
+	return nil
+}
+
+// rotateFile rotates all secrets of the given YAML file, rewriting it in
+// place if any secret has been rotated.
+func rotateFile(file string, keys *secrets.Keys, recipients []*secrets.Recipient) (int, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+
+	var documents, roots []*yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return 0, allow_fmt.Errorf("invalid YAML file (templated files cannot be rotated): %w", err)
+		}
+		documents = append(documents, &document)
+		roots = append(roots, document.Content...)
+	}
+
+	// NOTE: files encrypted by SOPS are entirely rewritten by SOPS.
+	if secrets.IsSOPS(roots) {
+		rotated, count, err := secrets.RotateSOPS(raw, keys, recipients...)
+		if err != nil {
+			return 0, err
+		}
+		return count, os.WriteFile(file, rotated, info.Mode())
+	}
+
+	count, err := yamldir.RotateSecrets(roots, keys, recipients...)
+	if err != nil || count == 0 {
+		return 0, err
+	}
+
+	out := bytes.NewBuffer(nil)
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	for _, document := range documents {
+		if err := encoder.Encode(document); err != nil {
+			return 0, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return 0, err
+	}
+	return count, os.WriteFile(file, out.Bytes(), info.Mode())
+}
+
+// parseRecipients parses all given age recipients.
+func parseRecipients(values []string) ([]*secrets.Recipient, error) {
+	recipients := make([]*secrets.Recipient, 0, len(values))
+	for _, value := range values {
+		recipient, err := secrets.ParseRecipient(value)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
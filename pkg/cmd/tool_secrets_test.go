@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+	"github.com/chezmoi-sh/yaldap/pkg/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretsKeygen(t *testing.T) {
+	buff := bytes.NewBuffer(nil)
+	tool := SecretsKeygen{writer: buff}
+
+	err := tool.Run()
+	require.NoError(t, err)
+
+	keys, err := secrets.ParseKeys(buff.Bytes())
+	require.NoError(t, err)
+	require.Len(t, keys.Identities, 1)
+	assert.Contains(t, buff.String(), "# public key: "+keys.Identities[0].Recipient().String()+"\n")
+}
+
+func TestSecretsEncrypt(t *testing.T) {
+	identity, err := secrets.GenerateIdentity()
+	require.NoError(t, err)
+	keys := &secrets.Keys{Identities: []*secrets.Identity{identity}}
+
+	tests := []struct {
+		Name     string
+		Tool     SecretsEncrypt
+		Expected []string
+	}{
+		{
+			Name:     "Value",
+			Tool:     SecretsEncrypt{Value: "1234"},
+			Expected: []string{"1234"},
+		},
+		{
+			Name:     "TaggedValueFromStdin",
+			Tool:     SecretsEncrypt{Value: "-", Tag: "!!ldap/bind:password", reader: strings.NewReader("alice\n")},
+			Expected: []string{"alice"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			buff := bytes.NewBuffer(nil)
+			tool := tt.Tool
+			tool.Recipients, tool.writer = []string{identity.Recipient().String()}, buff
+
+			err := tool.Run()
+			require.NoError(t, err)
+
+			value := regexp.MustCompile(`^!!ldap/encrypted ([A-Za-z0-9+/=]+)\n$`).FindStringSubmatch(buff.String())
+			require.Len(t, value, 2)
+
+			directory, err := yamldir.NewDirectoryFromYAML(
+				[]byte("cn:alice:\n  userPassword: !!ldap/encrypted "+value[1]+"\n"),
+				yamldir.WithDecryptionKeys(keys),
+			)
+			require.NoError(t, err)
+
+			alice := directory.BaseDN("cn=alice")
+			require.NotNil(t, alice)
+			assert.Equal(t, tt.Expected, alice.Attributes()["userPassword"])
+			if tt.Tool.Tag != "" {
+				valid, err := alice.Bind("alice")
+				require.NoError(t, err)
+				assert.True(t, valid)
+			}
+		})
+	}
+
+	t.Run("InvalidRecipient", func(t *testing.T) {
+		tool := SecretsEncrypt{Value: "alice", Recipients: []string{"age1invalid"}, writer: bytes.NewBuffer(nil)}
+		assert.ErrorContains(t, tool.Run(), "invalid age recipient 'age1invalid': ")
+	})
+}
+
+func TestSecretsRotate(t *testing.T) {
+	rotated, err := secrets.GenerateIdentity()
+	require.NoError(t, err)
+
+	tmp := t.TempDir()
+	var files []string
+	for _, name := range []string{"sops.yaml", "encrypted.yaml"} {
+		raw, err := os.ReadFile(filepath.Join("../ldap/directory/yaml/fixtures/secrets", name))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, name), raw, 0o600))
+		files = append(files, filepath.Join(tmp, name))
+	}
+
+	buff := bytes.NewBuffer(nil)
+	tool := SecretsRotate{
+		Files:      files,
+		KeyFile:    []string{"../ldap/directory/yaml/fixtures/secrets/age.key"},
+		Recipients: []string{rotated.Recipient().String()},
+		writer:     buff,
+	}
+	err = tool.Run()
+	require.NoError(t, err)
+	assert.Equal(t, files[0]+": 6 secret(s) rotated\n"+files[1]+": 2 secret(s) rotated\n", buff.String())
+
+	info, err := os.Stat(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode())
+
+	previous, err := secrets.LoadKeys(tool.KeyFile...)
+	require.NoError(t, err)
+	for _, file := range files {
+		_, err := yamldir.NewDirectory(file, yamldir.WithDecryptionKeys(previous))
+		assert.Error(t, err)
+
+		directory, err := yamldir.NewDirectory(file, yamldir.WithDecryptionKeys(&secrets.Keys{Identities: []*secrets.Identity{rotated}}))
+		require.NoError(t, err)
+		assert.NotNil(t, directory.BaseDN("cn=alice,dc=org"))
+	}
+
+	t.Run("InvalidKey", func(t *testing.T) {
+		tool := SecretsRotate{Files: files, Key: "AGE-SECRET-KEY-1INVALID", Recipients: tool.Recipients, writer: bytes.NewBuffer(nil)}
+		assert.EqualError(t, tool.Run(), "invalid decryption key: not a valid age identity")
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		tool := SecretsRotate{Files: files[1:], KeyFile: tool.KeyFile, Recipients: tool.Recipients, writer: bytes.NewBuffer(nil)}
+		assert.EqualError(t, tool.Run(), "unable to rotate the secrets of '"+files[1]+"': unable to decrypt the value at line 7, column 19: no age identity matches any of the recipients")
+	})
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	allow_fmt "fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	"rsc.io/qr"
+)
+
+type (
+	TOTP struct {
+		Generate TOTPGenerate `cmd:"" name:"generate" help:"Generate a new TOTP secret and its otpauth:// URI"`
+		Verify   TOTPVerify   `cmd:"" name:"verify" help:"Verify a TOTP code against a secret"`
+	}
+
+	TOTPGenerate struct {
+		Account string `arg:"" name:"account" help:"Account name displayed by the authenticator application (e.g. the bind DN)" required:""`
+		Issuer  string `name:"issuer" help:"Issuer displayed by the authenticator application" default:"yaLDAP"`
+		NoQR    bool   `name:"no-qrcode" help:"Don't print the QR code"`
+
+		// This is a workaround to allow fmt.Println to be mocked in tests.
+		writer io.Writer `kong:"-"`
+	}
+
+	TOTPVerify struct {
+		Secret string `arg:"" name:"secret" help:"Base32 encoded TOTP secret" required:""`
+		Code   string `arg:"" name:"code" help:"TOTP code to verify" required:""`
+
+		// This is a workaround to allow fmt.Println to be mocked in tests.
+		writer io.Writer `kong:"-"`
+	}
+)
+
+func (g *TOTPGenerate) Run() error {
+	if g.writer == nil {
+		g.writer = os.Stdout
+	}
+
+	secret, err := common.GenerateTOTPSecret()
+	if err != nil {
+		return err
+	}
+	uri := common.TOTPKeyURI(g.Issuer, g.Account, secret)
+
+	allow_fmt.Fprintf(g.writer, "Secret: %s\n", secret)
+	allow_fmt.Fprintf(g.writer, "URI:    %s\n", uri)
+	if !g.NoQR {
+		code, err := qr.Encode(uri, qr.M)
+		if err != nil {
+			return err
+		}
+		allow_fmt.Fprintln(g.writer)
+		allow_fmt.Fprint(g.writer, renderQRCode(code))
+	}
+	allow_fmt.Fprintf(g.writer, "\nAdd the following attribute to the entry to enable it:\n  .#totp: !!ldap/bind:totp %s\n", secret)
+	return nil
+}
+
+func (v *TOTPVerify) Run() error {
+	if v.writer == nil {
+		v.writer = os.Stdout
+	}
+
+	totp, err := common.NewTOTP(v.Secret)
+	if err != nil {
+		return err
+	}
+	if !totp.Validate(v.Code) {
+		return allow_fmt.Errorf("invalid TOTP code")
+	}
+
+	allow_fmt.Fprintln(v.writer, "valid TOTP code")
+	return nil
+}
+
+// renderQRCode renders the given QR code using Unicode half blocks, two QR
+// rows per line. Light modules are drawn, so the code is readable on
+// terminals with a dark background.
+func renderQRCode(code *qr.Code) string {
+	const quietZone = 2
+	dark := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= code.Size || y >= code.Size {
+			return false
+		}
+		return code.Black(x, y)
+	}
+
+	var out strings.Builder
+	for y := -quietZone; y < code.Size+quietZone; y += 2 {
+		for x := -quietZone; x < code.Size+quietZone; x++ {
+			switch top, bottom := !dark(x, y), !dark(x, y+1); {
+			case top && bottom:
+				out.WriteRune('█')
+			case top:
+				out.WriteRune('▀')
+			case bottom:
+				out.WriteRune('▄')
+			default:
+				out.WriteRune(' ')
+			}
+		}
+		out.WriteRune('\n')
+	}
+	return out.String()
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPGenerate(t *testing.T) {
+	buff := bytes.NewBuffer(nil)
+	tool := TOTPGenerate{Account: "alice", Issuer: "yaLDAP", writer: buff}
+
+	err := tool.Run()
+	require.NoError(t, err)
+
+	output := buff.String()
+	secret := regexp.MustCompile(`Secret: ([A-Z2-7]+)\n`).FindStringSubmatch(output)
+	require.Len(t, secret, 2)
+
+	assert.Contains(t, output, "URI:    otpauth://totp/yaLDAP:alice?algorithm=SHA1&digits=6&issuer=yaLDAP&period=30&secret="+secret[1]+"\n")
+	assert.Contains(t, output, "█")
+	assert.Contains(t, output, ".#totp: !!ldap/bind:totp "+secret[1]+"\n")
+
+	_, err = common.NewTOTP(secret[1])
+	assert.NoError(t, err)
+}
+
+func TestTOTPVerify(t *testing.T) {
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	totp, err := common.NewTOTP(secret)
+	require.NoError(t, err)
+
+	t.Run("Valid", func(t *testing.T) {
+		buff := bytes.NewBuffer(nil)
+		tool := TOTPVerify{Secret: secret, Code: totp.Code(time.Now()), writer: buff}
+
+		err := tool.Run()
+		require.NoError(t, err)
+		assert.Equal(t, "valid TOTP code\n", buff.String())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tool := TOTPVerify{Secret: secret, Code: totp.Code(time.Now().Add(-time.Hour)), writer: bytes.NewBuffer(nil)}
+
+		err := tool.Run()
+		assert.EqualError(t, err, "invalid TOTP code")
+	})
+}
@@ -0,0 +1,59 @@
+package directory
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrAliasProblem is returned when an alias cannot be dereferenced, because it
+// names no object or is part of an alias loop.
+var ErrAliasProblem = errors.New("alias problem")
+
+// IsAlias returns true if the given entry is an alias entry (RFC 4512 §2.6),
+// i.e. an entry of the `alias` object class.
+func IsAlias(entry Object) bool { return hasObjectClass(entry, "alias") }
+
+// AliasedObjectName returns the DN of the entry the given alias refers to, or
+// an empty string if the alias doesn't define exactly one.
+func AliasedObjectName(alias Object) string {
+	for name, values := range alias.Attributes() {
+		if strings.EqualFold(name, "aliasedObjectName") && len(values) == 1 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// DerefAlias returns the entry the given alias refers to, following chained
+// aliases. If the given entry is not an alias, it is returned as is.
+// It returns an error wrapping ErrAliasProblem if one alias of the chain
+// names no object or if the chain loops.
+func DerefAlias(directory Directory, entry Object) (Object, error) {
+	seen := map[string]bool{}
+	for IsAlias(entry) {
+		dn, _ := NormalizeDN(entry.DN())
+		if seen[dn] {
+			return nil, fmt.Errorf("%w: alias loop detected on '%s'", ErrAliasProblem, entry.DN())
+		}
+		seen[dn] = true
+
+		name := AliasedObjectName(entry)
+		target := directory.BaseDN(name)
+		if name == "" || target == nil {
+			return nil, fmt.Errorf("%w: alias '%s' names no object", ErrAliasProblem, entry.DN())
+		}
+		entry = target
+	}
+	return entry, nil
+}
+
+// WithAliasDereferencing dereferences, using the given directory, all alias
+// entries found below the search base; their targets (and, for subtree
+// searches, the targets' subordinates) are searched instead of them.
+// Aliases that cannot be dereferenced are ignored.
+func WithAliasDereferencing(directory Directory) SearchOption {
+	return func(opts *SearchOptions) {
+		opts.DerefAlias = func(alias Object) (Object, error) { return DerefAlias(directory, alias) }
+	}
+}
@@ -0,0 +1,133 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type (
+	// Backend creates directories from their URL. Backends are structures
+	// whose exported fields, tagged like kong flags, describe their own
+	// options; these options are exposed by the `yaldap` command under the
+	// `--backend.<name>.` prefix.
+	Backend interface {
+		// Validate checks the backend options and the given URL before any
+		// directory is created.
+		Validate(url string) error
+		// NewDirectory creates the directory located at the given URL.
+		NewDirectory(ctx context.Context, url string) (Directory, error)
+	}
+
+	// BackendInfo describes a registered backend.
+	BackendInfo struct {
+		// Name identifies the backend (e.g. `yaml`).
+		Name string
+		// Description explains what the backend serves, displayed in the
+		// command line help.
+		Description string
+		// Schemes lists the URL schemes (e.g. `file`) used to select the
+		// backend when its name is not given.
+		Schemes []string
+
+		backend reflect.Type
+	}
+)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]BackendInfo{}
+)
+
+// RegisterBackend makes the given backend available under the given name and
+// URL schemes. The backend must be a pointer to a structure, used as
+// prototype: each configuration gets its own zero-valued copy.
+// It panics if the name or one of the schemes is already registered, like
+// database/sql drivers.
+func RegisterBackend(info BackendInfo, backend Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	typ := reflect.TypeOf(backend)
+	if typ == nil || typ.Kind() != reflect.Pointer || typ.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("backend '%s' must be a pointer to a structure", info.Name))
+	}
+	if _, exists := backends[info.Name]; exists {
+		panic(fmt.Sprintf("backend '%s' is already registered", info.Name))
+	}
+	for _, registered := range backends {
+		for _, scheme := range info.Schemes {
+			if registered.handles(scheme) {
+				panic(fmt.Sprintf("URL scheme '%s' is already registered by backend '%s'", scheme, registered.Name))
+			}
+		}
+	}
+
+	info.backend = typ.Elem()
+	backends[info.Name] = info
+}
+
+// Backends returns all registered backends, sorted by name.
+func Backends() []BackendInfo {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	infos := make([]BackendInfo, 0, len(backends))
+	for _, info := range backends {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// LookupBackend returns the backend registered under the given name or, if no
+// name is given, the one handling the scheme of the given URL.
+func LookupBackend(name, rawURL string) (BackendInfo, error) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	if name != "" {
+		info, exists := backends[name]
+		if !exists {
+			return BackendInfo{}, fmt.Errorf("unknown backend: %s, supported backends are %s", name, backendNames())
+		}
+		return info, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" {
+		return BackendInfo{}, fmt.Errorf("unable to guess the backend of '%s': the URL has no scheme, the backend name is required", rawURL)
+	}
+	for _, info := range backends {
+		if info.handles(u.Scheme) {
+			return info, nil
+		}
+	}
+	return BackendInfo{}, fmt.Errorf("unable to guess the backend of '%s': no backend handles the '%s' scheme", rawURL, u.Scheme)
+}
+
+// New returns a new zero-valued backend.
+func (info BackendInfo) New() Backend {
+	return reflect.New(info.backend).Interface().(Backend)
+}
+
+// handles returns true if the backend handles the given URL scheme.
+func (info BackendInfo) handles(scheme string) bool {
+	return slices.ContainsFunc(info.Schemes, func(s string) bool { return strings.EqualFold(s, scheme) })
+}
+
+// backendNames returns the name of all registered backends, formatted for
+// error messages.
+func backendNames() string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, "`"+name+"`")
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
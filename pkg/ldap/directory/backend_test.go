@@ -0,0 +1,68 @@
+package directory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockBackend struct {
+	Option string `name:"option"`
+}
+
+func (mockBackend) Validate(string) error { return nil }
+func (mockBackend) NewDirectory(context.Context, string) (Directory, error) {
+	return nil, nil
+}
+
+//nolint:gochecknoinits
+func init() {
+	RegisterBackend(BackendInfo{Name: "mock", Description: "Mock backend", Schemes: []string{"mock", "mocks"}}, &mockBackend{})
+}
+
+func TestRegisterBackend_Invalid(t *testing.T) {
+	assert.PanicsWithValue(t, "backend 'invalid' must be a pointer to a structure", func() {
+		RegisterBackend(BackendInfo{Name: "invalid"}, mockBackend{})
+	})
+	assert.PanicsWithValue(t, "backend 'mock' is already registered", func() {
+		RegisterBackend(BackendInfo{Name: "mock"}, &mockBackend{})
+	})
+	assert.PanicsWithValue(t, "URL scheme 'MOCKS' is already registered by backend 'mock'", func() {
+		RegisterBackend(BackendInfo{Name: "other", Schemes: []string{"MOCKS"}}, &mockBackend{})
+	})
+}
+
+func TestLookupBackend(t *testing.T) {
+	tests := []struct {
+		Name          string
+		URL           string
+		ExpectedError string
+	}{
+		{Name: "mock"},
+		{URL: "mock://localhost"},
+		{URL: "MOCKS://localhost"},
+		{Name: "unknown", ExpectedError: "unknown backend: unknown, supported backends are `mock`"},
+		{URL: "/etc/directory", ExpectedError: "unable to guess the backend of '/etc/directory': the URL has no scheme, the backend name is required"},
+		{URL: "http://localhost", ExpectedError: "unable to guess the backend of 'http://localhost': no backend handles the 'http' scheme"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name+tt.URL, func(t *testing.T) {
+			info, err := LookupBackend(tt.Name, tt.URL)
+			if tt.ExpectedError != "" {
+				assert.EqualError(t, err, tt.ExpectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "mock", info.Name)
+
+			// NOTE: each backend gets its own options.
+			backend := info.New()
+			assert.Equal(t, &mockBackend{}, backend)
+			assert.NotSame(t, backend, info.New())
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+)
+
+// ACLDecision describes whether a capability is granted on an entry and why.
+type ACLDecision struct {
+	Allowed bool
+	// Rule is the rule which produced the decision, or nil if the decision
+	// comes from the default behavior (see Reason).
+	Rule *ACLRule
+	// Reason explains the decision when no rule produced it.
+	Reason string
+}
+
+// ExplainACL returns the decision about the given capability of the current
+// object on the given entry (and attribute for attribute-level capabilities),
+// with the rule which produced it.
+func (obj Object) ExplainACL(capability ACLCapability, entry ldap.Object, attribute string) ACLDecision {
+	if _, err := ldap.ParseDN(entry.DN()); err != nil {
+		return ACLDecision{Reason: fmt.Sprintf("invalid entry DN: %s", err)}
+	}
+
+	if rule, found := obj.ACLs.Match(obj, capability, entry, attribute); found {
+		return ACLDecision{Allowed: rule.Allowed, Rule: &rule}
+	}
+
+	switch capability {
+	case ACLSearch, ACLProxy:
+		return ACLDecision{Reason: "no matching " + capability.String() + " rule"}
+	case ACLFilter, ACLCompare:
+		decision := obj.ExplainACL(ACLRead, entry, attribute)
+		if decision.Rule == nil {
+			decision.Reason = "no matching " + capability.String() + " rule; " + decision.Reason
+		}
+		return decision
+	}
+
+	if isSecretAttribute(entry, attribute) {
+		return ACLDecision{Reason: "no matching read rule and secret attributes are hidden by default"}
+	}
+	return ACLDecision{Allowed: true, Reason: "no matching read rule and attributes are readable by default"}
+}
+
+// String returns the name of the capability, as used in the ACL tags.
+func (capability ACLCapability) String() string {
+	switch capability {
+	case ACLSearch:
+		return "search"
+	case ACLProxy:
+		return "proxy"
+	case ACLRead:
+		return "read"
+	case ACLFilter:
+		return "filter"
+	case ACLCompare:
+		return "compare"
+	}
+	return fmt.Sprintf("unknown(%d)", int(capability))
+}
+
+// String returns a human readable representation of the rule, like
+// `allow read on ou=people,dc=org (attributes: cn, mail)`.
+func (rule ACLRule) String() string {
+	var str strings.Builder
+
+	if rule.Allowed {
+		str.WriteString("allow ")
+	} else {
+		str.WriteString("deny ")
+	}
+	str.WriteString(rule.Capability.String())
+
+	var targets []string
+	if rule.DistinguishedNameSuffix != "" || rule.Relation == ACLRelationAny && rule.Filter == "" {
+		targets = append(targets, fmt.Sprintf("'%s'", rule.DistinguishedNameSuffix))
+	}
+	switch rule.Relation {
+	case ACLRelationAny:
+		// Nothing to do
+	case ACLRelationSelf:
+		targets = append(targets, "self")
+	case ACLRelationMemberOf:
+		targets = append(targets, "member-of")
+	}
+	if rule.Filter != "" {
+		targets = append(targets, rule.Filter)
+	}
+	fmt.Fprintf(&str, " on %s", strings.Join(targets, " and "))
+
+	if len(rule.Attributes) > 0 {
+		fmt.Fprintf(&str, " (attributes: %s)", strings.Join(rule.Attributes, ", "))
+	}
+
+	switch rule.Source {
+	case ACLSourceSelf:
+		// Nothing to do
+	case ACLSourceGroup:
+		str.WriteString(", inherited from a group")
+	case ACLSourceSubtree:
+		str.WriteString(", inherited from an ancestor")
+	case ACLSourcePolicy:
+		str.WriteString(", inherited from the policy")
+	}
+	return str.String()
+}
@@ -0,0 +1,81 @@
+package common
+
+import (
+	"testing"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectExplainACL(t *testing.T) {
+	alice := &Object{ImplObject: ImplObject{
+		DN:         "uid=alice,ou=people,dc=org",
+		Attributes: ldap.Attributes{"cn": {"alice"}, "userPassword": {"alice"}},
+	}}
+	obj := Object{}
+	obj.AddACLRule(
+		ACLRule{DistinguishedNameSuffix: "ou=people,dc=org", Allowed: true, Origin: "line 1, column 1"},
+		ACLRule{DistinguishedNameSuffix: "dc=org", Allowed: false, Capability: ACLRead, Attributes: []string{"cn"}},
+	)
+
+	t.Run("Test with matching rule", func(t *testing.T) {
+		decision := obj.ExplainACL(ACLSearch, alice, "")
+
+		assert.True(t, decision.Allowed)
+		assert.Equal(t, &obj.ACLs[0], decision.Rule)
+	})
+
+	t.Run("Test without matching rule", func(t *testing.T) {
+		assert.Equal(t, ACLDecision{Reason: "no matching proxy rule"}, obj.ExplainACL(ACLProxy, alice, ""))
+		assert.Equal(t,
+			ACLDecision{Reason: "no matching read rule and secret attributes are hidden by default"},
+			obj.ExplainACL(ACLRead, alice, "userPassword"),
+		)
+		assert.Equal(t,
+			ACLDecision{Allowed: true, Reason: "no matching compare rule; no matching read rule and attributes are readable by default"},
+			obj.ExplainACL(ACLCompare, alice, "sn"),
+		)
+	})
+
+	t.Run("Test with read rule fallback", func(t *testing.T) {
+		decision := obj.ExplainACL(ACLFilter, alice, "cn")
+
+		assert.False(t, decision.Allowed)
+		assert.Equal(t, &obj.ACLs[1], decision.Rule)
+	})
+
+	t.Run("Test with invalid entry DN", func(t *testing.T) {
+		decision := obj.ExplainACL(ACLSearch, objectWithDN("alice"), "")
+
+		assert.False(t, decision.Allowed)
+		assert.Equal(t, "invalid entry DN: invalid DN 'alice': missing '=' in 'alice'", decision.Reason)
+	})
+}
+
+func TestACLRuleString(t *testing.T) {
+	tests := []struct {
+		Rule     ACLRule
+		Expected string
+	}{
+		{Rule: ACLRule{DistinguishedNameSuffix: "dc=org", Allowed: true}, Expected: "allow search on 'dc=org'"},
+		{Rule: ACLRule{Capability: ACLProxy}, Expected: "deny proxy on ''"},
+		{Rule: ACLRule{Allowed: true, Capability: ACLRead, Relation: ACLRelationSelf}, Expected: "allow read on self"},
+		{
+			Rule: ACLRule{
+				DistinguishedNameSuffix: "ou=group,dc=org",
+				Capability:              ACLCompare,
+				Relation:                ACLRelationMemberOf,
+				Filter:                  "(objectClass=posixGroup)",
+				Attributes:              []string{"cn", "memberUid"},
+				Source:                  ACLSourcePolicy,
+			},
+			Expected: "deny compare on 'ou=group,dc=org' and member-of and (objectClass=posixGroup) (attributes: cn, memberUid), inherited from the policy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Expected, func(t *testing.T) {
+			assert.Equal(t, tt.Expected, tt.Rule.String())
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package common
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+)
+
+type (
+	// ACLSource represents where an ACL rule comes from. Rules from a more
+	// precise source always take precedence over the others, whatever their
+	// DN suffix.
+	ACLSource int
+
+	// ACLPolicyRule applies ACL rules to all objects matching its subject.
+	ACLPolicyRule struct {
+		// Subject defines the objects on which the rules are applied:
+		// - `*` for all objects
+		// - `<dn>` for the object with this DN and all objects below it
+		// - `group:<dn>` for all members of the group with this DN
+		Subject string
+		Rules   ACLRuleSet
+	}
+
+	// ACLPolicyProvider is implemented by directories defining ACL rules
+	// applying to the whole directory.
+	ACLPolicyProvider interface {
+		// ACLPolicy returns the ACL policy of the directory.
+		ACLPolicy() []ACLPolicyRule
+	}
+)
+
+const (
+	// ACLSourceSelf is used for rules defined on the object itself.
+	ACLSourceSelf ACLSource = iota
+	// ACLSourceGroup is used for rules inherited from a group the object is
+	// member of.
+	ACLSourceGroup
+	// ACLSourceSubtree is used for rules inherited from an ancestor of the
+	// object.
+	ACLSourceSubtree
+	// ACLSourcePolicy is used for rules inherited from the directory policy.
+	ACLSourcePolicy
+)
+
+// ValidateACLPolicySubject returns an error if the given policy subject is
+// invalid.
+func ValidateACLPolicySubject(subject string) error {
+	if subject == "*" {
+		return nil
+	}
+
+	if _, err := ldap.ParseDN(strings.TrimPrefix(subject, "group:")); err != nil {
+		return fmt.Errorf("invalid ACL policy subject '%s': %w", subject, err)
+	}
+	return nil
+}
+
+// ResolveACLs computes the effective ACL rules of the given object and of all
+// objects below it, merging their own rules with the ones inherited from their
+// groups, their ancestors and the given policy.
+func ResolveACLs(root *Object, policy []ACLPolicyRule) {
+	objects := map[string]*Object{}
+	var groups []*Object
+	WalkObjects(root, func(obj *Object) {
+		dn, _ := ldap.NormalizeDN(obj.DN())
+		objects[dn] = obj
+		if len(obj.MemberACLs) > 0 {
+			groups = append(groups, obj)
+		}
+	})
+
+	var resolve func(obj *Object, inherited ACLRuleSet)
+	resolve = func(obj *Object, inherited ACLRuleSet) {
+		dn, _ := ldap.ParseDN(obj.DN())
+
+		// NOTE: only the rules defined on the object itself are kept, in order
+		//       to be able to resolve ACLs several times.
+		var acls ACLRuleSet
+		for _, rule := range obj.ACLs {
+			if rule.Source == ACLSourceSelf {
+				acls = append(acls, rule)
+			}
+		}
+
+		for _, group := range groups {
+			if hasMember(group, obj) {
+				acls = append(acls, group.MemberACLs.withSource(ACLSourceGroup)...)
+			}
+		}
+		acls = append(acls, inherited...)
+
+		for _, rule := range policy {
+			if rule.appliesTo(obj, dn, objects) {
+				acls = append(acls, rule.Rules.withSource(ACLSourcePolicy)...)
+			}
+		}
+
+		// NOTE: rules not compiled by their parser (e.g. added by an overlay)
+		//       are compiled here, once for all evaluations.
+		for i := range acls {
+			if acls[i].compiled == nil {
+				_ = acls[i].Compile()
+			}
+		}
+		sort.Stable(acls)
+		obj.ACLs = acls
+
+		inherited = append(obj.SubtreeACLs.withSource(ACLSourceSubtree), inherited...)
+		for _, child := range obj.SubObjects {
+			resolve(child, inherited)
+		}
+	}
+	resolve(root, nil)
+}
+
+// hasMember returns true if the given member is a direct member of the given
+// group, through its `member`, `uniqueMember` (DN) or `memberUid` (uid)
+// attributes.
+func hasMember(group, member ldap.Object) bool {
+	memberDN, err := ldap.ParseDN(member.DN())
+	if err != nil {
+		return false
+	}
+
+	for name, values := range group.Attributes() {
+		switch strings.ToLower(name) {
+		case "member", "uniquemember":
+			for _, value := range values {
+				if dn, err := ldap.ParseDN(value); err == nil && dn.Equal(memberDN) {
+					return true
+				}
+			}
+		case "memberuid":
+			for attr, uids := range member.Attributes() {
+				if strings.EqualFold(attr, "uid") && slices.ContainsFunc(uids, func(uid string) bool { return slices.Contains(values, uid) }) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// appliesTo returns true if the policy rule applies to the given object.
+func (rule ACLPolicyRule) appliesTo(obj *Object, dn ldap.DN, objects map[string]*Object) bool {
+	if rule.Subject == "*" {
+		return true
+	}
+
+	if group, isGroup := strings.CutPrefix(rule.Subject, "group:"); isGroup {
+		groupDN, _ := ldap.NormalizeDN(group)
+		return objects[groupDN] != nil && hasMember(objects[groupDN], obj)
+	}
+
+	subject, err := ldap.ParseDN(rule.Subject)
+	return err == nil && dn.HasSuffix(subject)
+}
+
+// withSource returns a copy of the rule set with the given source.
+func (set ACLRuleSet) withSource(source ACLSource) ACLRuleSet {
+	rules := slices.Clone(set)
+	for i := range rules {
+		rules[i].Source = source
+	}
+	return rules
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"testing"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateACLPolicySubject(t *testing.T) {
+	assert.NoError(t, ValidateACLPolicySubject("*"))
+	assert.NoError(t, ValidateACLPolicySubject("ou=people,dc=org"))
+	assert.NoError(t, ValidateACLPolicySubject("group:cn=admins,dc=org"))
+	assert.EqualError(t, ValidateACLPolicySubject("admins"), "invalid ACL policy subject 'admins': invalid DN 'admins': missing '=' in 'admins'")
+}
+
+func TestResolveACLs(t *testing.T) {
+	alice := &Object{ImplObject: ImplObject{
+		DN:         "uid=alice,ou=people,dc=org",
+		Attributes: ldap.Attributes{"uid": {"alice"}},
+		ACLs:       ACLRuleSet{{DistinguishedNameSuffix: "cn=admins,ou=group,dc=org", Allowed: true}},
+	}}
+	bob := &Object{ImplObject: ImplObject{
+		DN:         "uid=bob,ou=people,dc=org",
+		Attributes: ldap.Attributes{"uid": {"bob"}},
+	}}
+	people := &Object{ImplObject: ImplObject{
+		DN:          "ou=people,dc=org",
+		SubObjects:  map[string]*Object{"uid=alice": alice, "uid=bob": bob},
+		SubtreeACLs: ACLRuleSet{{DistinguishedNameSuffix: "cn=admins,ou=group,dc=org", Allowed: true}},
+	}}
+	admins := &Object{ImplObject: ImplObject{
+		DN:         "cn=admins,ou=group,dc=org",
+		Attributes: ldap.Attributes{"memberUid": {"alice"}},
+		MemberACLs: ACLRuleSet{{DistinguishedNameSuffix: "ou=people,dc=org", Allowed: false}},
+	}}
+	group := &Object{ImplObject: ImplObject{
+		DN:         "ou=group,dc=org",
+		SubObjects: map[string]*Object{"cn=admins": admins},
+	}}
+	org := &Object{ImplObject: ImplObject{
+		DN:         "dc=org",
+		SubObjects: map[string]*Object{"ou=people": people, "ou=group": group},
+		SubtreeACLs: ACLRuleSet{
+			{DistinguishedNameSuffix: "ou=group,dc=org", Allowed: false},
+			{DistinguishedNameSuffix: "ou=people,dc=org", Allowed: true},
+		},
+	}}
+	root := &Object{ImplObject: ImplObject{SubObjects: map[string]*Object{"dc=org": org}}}
+	policy := []ACLPolicyRule{
+		{Subject: "group:cn=admins,ou=group,dc=org", Rules: ACLRuleSet{{DistinguishedNameSuffix: "dc=org", Allowed: true, Capability: ACLProxy}}},
+		{Subject: "ou=people,dc=org", Rules: ACLRuleSet{{DistinguishedNameSuffix: "dc=org", Allowed: true}}},
+		{Subject: "*", Rules: ACLRuleSet{{DistinguishedNameSuffix: "dc=org", Allowed: false}}},
+	}
+
+	ResolveACLs(root, policy)
+
+	t.Run("Test own rules take precedence", func(t *testing.T) {
+		assert.True(t, alice.CanSearchOn(objectWithDN("cn=admins,ou=group,dc=org")))
+	})
+
+	t.Run("Test group rules take precedence over subtree rules", func(t *testing.T) {
+		assert.False(t, alice.CanSearchOn(objectWithDN("ou=people,dc=org")))
+		assert.True(t, bob.CanSearchOn(objectWithDN("ou=people,dc=org")))
+	})
+
+	t.Run("Test subtree rules are inherited from all ancestors", func(t *testing.T) {
+		assert.True(t, bob.CanSearchOn(objectWithDN("cn=admins,ou=group,dc=org")))
+		assert.False(t, bob.CanSearchOn(objectWithDN("ou=group,dc=org")))
+		assert.False(t, people.CanSearchOn(objectWithDN("cn=admins,ou=group,dc=org")))
+	})
+
+	t.Run("Test subtree rules take precedence over policy rules", func(t *testing.T) {
+		assert.True(t, group.CanSearchOn(objectWithDN("ou=people,dc=org")))
+		assert.False(t, org.CanSearchOn(objectWithDN("ou=people,dc=org")))
+	})
+
+	t.Run("Test policy rules", func(t *testing.T) {
+		// NOTE: for the same DN, denying rules win.
+		assert.False(t, bob.CanSearchOn(objectWithDN("dc=org")))
+		assert.True(t, alice.CanProxyAs(objectWithDN("uid=bob,ou=people,dc=org")))
+		assert.False(t, bob.CanProxyAs(objectWithDN("uid=alice,ou=people,dc=org")))
+	})
+
+	t.Run("Test resolution is idempotent", func(t *testing.T) {
+		acls := alice.ACLs
+		ResolveACLs(root, policy)
+		assert.Equal(t, acls, alice.ACLs)
+	})
+}
@@ -0,0 +1,194 @@
+package common
+
+import (
+	"crypto/md5"  //nolint:gosec // required by the {MD5} and {SMD5} schemes
+	"crypto/sha1" //nolint:gosec // required by the {SHA}, {SSHA} and {PBKDF2} schemes
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aldy505/phc-crypto/argon2"
+	"github.com/aldy505/phc-crypto/bcrypt"
+	"github.com/aldy505/phc-crypto/pbkdf2"
+	"github.com/aldy505/phc-crypto/scrypt"
+	"go.pact.im/x/phcformat"
+	xpbkdf2 "golang.org/x/crypto/pbkdf2"
+)
+
+// rfc2307SchemeRegex matches RFC 2307 style password values (e.g. `{SSHA}...`).
+var rfc2307SchemeRegex = regexp.MustCompile(`^\{([A-Za-z0-9._-]+)\}(.*)$`)
+
+// rfc2307Schemes lists all supported RFC 2307 password schemes, indexed by
+// their upper-cased name.
+var rfc2307Schemes = map[string]func(value, password string) (bool, error){
+	"MD5":     digestVerifier(md5.New, false),
+	"SMD5":    digestVerifier(md5.New, true),
+	"SHA":     digestVerifier(sha1.New, false),
+	"SSHA":    digestVerifier(sha1.New, true),
+	"SHA256":  digestVerifier(sha256.New, false),
+	"SSHA256": digestVerifier(sha256.New, true),
+	"SHA384":  digestVerifier(sha512.New384, false),
+	"SSHA384": digestVerifier(sha512.New384, true),
+	"SHA512":  digestVerifier(sha512.New, false),
+	"SSHA512": digestVerifier(sha512.New, true),
+
+	"CRYPT": verifyCrypt,
+
+	"PBKDF2":        pbkdf2Verifier(sha1.New),
+	"PBKDF2-SHA1":   pbkdf2Verifier(sha1.New),
+	"PBKDF2-SHA256": pbkdf2Verifier(sha256.New),
+	"PBKDF2-SHA512": pbkdf2Verifier(sha512.New),
+	"PBKDF2_SHA256": verify389PBKDF2SHA256,
+}
+
+// verifyPassword returns true if the given password matches the stored bind
+// password. The stored password can be a PHC string, a RFC 2307 `{SCHEME}`
+// value with a supported scheme or, as a last resort, a plain text password
+// (including values starting with an unknown `{word}`).
+func verifyPassword(stored, password string) (bool, error) {
+	if match := rfc2307SchemeRegex.FindStringSubmatch(stored); match != nil {
+		// NOTE: values with an unknown scheme are compared as plain text
+		//       passwords, like before RFC 2307 schemes were supported.
+		if verify, exists := rfc2307Schemes[strings.ToUpper(match[1])]; exists {
+			valid, err := verify(match[2], password)
+			if err != nil {
+				return false, fmt.Errorf("invalid {%s} password: %w", match[1], err)
+			}
+			return valid, nil
+		}
+	}
+
+	phcInfo, ok := phcformat.Parse(stored)
+	if !ok {
+		// NOTE: if the password is not a valid PHC string, we assume it's a plain text password
+		// and we compare it directly with the stored password.
+		// NOT RECOMMENDED
+		return stored == password, nil
+	}
+
+	switch {
+	case strings.HasPrefix(phcInfo.ID, "argon2"):
+		return argon2.Verify(stored, password)
+	case phcInfo.ID == "bcrypt":
+		return bcrypt.Verify(stored, password)
+	case strings.HasPrefix(phcInfo.ID, "pbkdf2"):
+		return pbkdf2.Verify(stored, password)
+	case phcInfo.ID == "scrypt":
+		return scrypt.Verify(stored, password)
+	default:
+		return false, fmt.Errorf("unsupported PHC algorithm: %s", phcInfo.ID)
+	}
+}
+
+// ConvertPasswordHash returns the given password, as stored by another LDAP
+// server (e.g. a `userPassword` value dumped by OpenLDAP), in the format
+// verified by yaLDAP: RFC 2307 schemes are upper-cased and the OpenLDAP
+// `{ARGON2}` scheme is replaced by the PHC string it contains. Other values
+// (PHC strings or plain text passwords) are returned as is.
+func ConvertPasswordHash(stored string) (string, error) {
+	match := rfc2307SchemeRegex.FindStringSubmatch(stored)
+	if match == nil {
+		return stored, nil
+	}
+
+	scheme, value := strings.ToUpper(match[1]), match[2]
+	switch _, exists := rfc2307Schemes[scheme]; {
+	case scheme == "ARGON2" && strings.HasPrefix(value, "$argon2"):
+		return value, nil
+	case !exists:
+		return stored, fmt.Errorf("unsupported password scheme: %s", match[1])
+	case scheme == "CRYPT" && !isSupportedCrypt(value):
+		return stored, fmt.Errorf("unsupported crypt algorithm")
+	}
+	return "{" + scheme + "}" + value, nil
+}
+
+// digestVerifier returns a verifier for the `{<DIGEST>}` (unsalted) and
+// `{S<DIGEST>}` (salted) schemes, where the value is the base64 encoding of
+// the digest followed, for salted schemes only, by the salt.
+func digestVerifier(newHash func() hash.Hash, salted bool) func(value, password string) (bool, error) {
+	return func(value, password string) (bool, error) {
+		raw, err := decodeBase64(value)
+		if err != nil {
+			return false, err
+		}
+
+		digest := newHash()
+		switch {
+		case salted && len(raw) < digest.Size():
+			return false, fmt.Errorf("digest too short: expected at least %d bytes, got %d", digest.Size(), len(raw))
+		case !salted && len(raw) != digest.Size():
+			return false, fmt.Errorf("invalid digest size: expected %d bytes, got %d", digest.Size(), len(raw))
+		}
+
+		expected, salt := raw[:digest.Size()], raw[digest.Size():]
+		digest.Write([]byte(password))
+		digest.Write(salt)
+		return subtle.ConstantTimeCompare(digest.Sum(nil), expected) == 1, nil
+	}
+}
+
+// pbkdf2Verifier returns a verifier for the OpenLDAP `{PBKDF2-<DIGEST>}`
+// schemes, where the value is formatted as `<iterations>$<salt>$<hash>` using
+// the adapted base64 encoding (`.` instead of `+`, without padding).
+func pbkdf2Verifier(newHash func() hash.Hash) func(value, password string) (bool, error) {
+	return func(value, password string) (bool, error) {
+		parts := strings.Split(value, "$")
+		if len(parts) != 3 {
+			return false, fmt.Errorf("expected '<iterations>$<salt>$<hash>' format")
+		}
+
+		iterations, err := strconv.Atoi(parts[0])
+		if err != nil || iterations < 1 {
+			return false, fmt.Errorf("invalid iterations count: %s", parts[0])
+		}
+		salt, err := decodeBase64(strings.ReplaceAll(parts[1], ".", "+"))
+		if err != nil {
+			return false, err
+		}
+		expected, err := decodeBase64(strings.ReplaceAll(parts[2], ".", "+"))
+		if err != nil {
+			return false, err
+		}
+
+		computed := xpbkdf2.Key([]byte(password), salt, iterations, len(expected), newHash)
+		return subtle.ConstantTimeCompare(computed, expected) == 1, nil
+	}
+}
+
+// verify389PBKDF2SHA256 verifies the 389-ds `{PBKDF2_SHA256}` scheme, where the
+// value is the base64 encoding of the iterations count (4 bytes, big endian),
+// the salt (64 bytes) and the hash (256 bytes).
+func verify389PBKDF2SHA256(value, password string) (bool, error) {
+	const saltLen, hashLen = 64, 256
+
+	raw, err := decodeBase64(value)
+	if err != nil {
+		return false, err
+	}
+	if len(raw) != 4+saltLen+hashLen {
+		return false, fmt.Errorf("invalid length: expected %d bytes, got %d", 4+saltLen+hashLen, len(raw))
+	}
+
+	iterations := binary.BigEndian.Uint32(raw[:4])
+	salt, expected := raw[4:4+saltLen], raw[4+saltLen:]
+
+	computed := xpbkdf2.Key([]byte(password), salt, int(iterations), hashLen, sha256.New)
+	return subtle.ConstantTimeCompare(computed, expected) == 1, nil
+}
+
+// decodeBase64 decodes a standard base64 string, with or without padding.
+func decodeBase64(value string) ([]byte, error) {
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 value: %w", err)
+	}
+	return raw, nil
+}
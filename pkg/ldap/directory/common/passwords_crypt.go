@@ -0,0 +1,263 @@
+package common
+
+import (
+	"crypto/md5" //nolint:gosec // required by the MD5-crypt algorithm
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cryptAlphabet is the alphabet used by crypt(3) to encode hashes.
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// sha256CryptPermutation and sha512CryptPermutation describe the order in
+// which the final digest bytes are encoded by the SHA-crypt algorithm.
+var (
+	sha256CryptPermutation = [][3]int{
+		{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+		{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+	}
+	sha512CryptPermutation = [][3]int{
+		{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+		{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+		{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+		{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+		{62, 20, 41},
+	}
+)
+
+// verifyCrypt compares the given password with a crypt(3) hash. Only the
+// MD5 ($1$ and the Apache $apr1$ variant), SHA-256 ($5$), SHA-512 ($6$) and
+// bcrypt ($2a$, $2b$, $2y$) variants are supported.
+func verifyCrypt(hashed, password string) (bool, error) {
+	var computed string
+	var err error
+
+	switch {
+	case strings.HasPrefix(hashed, "$1$"):
+		computed, err = md5Crypt(password, hashed, "$1$")
+	case strings.HasPrefix(hashed, "$apr1$"):
+		computed, err = md5Crypt(password, hashed, "$apr1$")
+	case strings.HasPrefix(hashed, "$5$"):
+		computed, err = shaCrypt(sha256.New, sha256CryptPermutation, password, hashed, "$5$")
+	case strings.HasPrefix(hashed, "$6$"):
+		computed, err = shaCrypt(sha512.New, sha512CryptPermutation, password, hashed, "$6$")
+	case strings.HasPrefix(hashed, "$2a$"), strings.HasPrefix(hashed, "$2b$"), strings.HasPrefix(hashed, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password))
+		switch {
+		case err == nil:
+			return true, nil
+		case err == bcrypt.ErrMismatchedHashAndPassword: //nolint:errorlint
+			return false, nil
+		default:
+			return false, fmt.Errorf("invalid bcrypt hash: %w", err)
+		}
+	default:
+		return false, fmt.Errorf("unsupported crypt algorithm")
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hashed)) == 1, nil
+}
+
+// cryptPrefixes lists the prefixes of all crypt(3) hashes supported by
+// verifyCrypt.
+var cryptPrefixes = []string{"$1$", "$apr1$", "$5$", "$6$", "$2a$", "$2b$", "$2y$"}
+
+// isSupportedCrypt returns true if the given crypt(3) hash can be verified by
+// verifyCrypt.
+func isSupportedCrypt(hashed string) bool {
+	for _, prefix := range cryptPrefixes {
+		if strings.HasPrefix(hashed, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// errInvalidCrypt is returned when a crypt(3) hash doesn't contain both a
+// salt and a hash.
+var errInvalidCrypt = errors.New("invalid crypt hash: expected '<salt>$<hash>' format")
+
+// bcryptCost returns the cost of the given bcrypt hash, or false if the hash
+// is malformed.
+func bcryptCost(hashed string) (int, bool) {
+	cost, err := bcrypt.Cost([]byte(hashed))
+	return cost, err == nil
+}
+
+// md5Crypt computes the MD5-crypt hash of the given password, using the salt
+// contained in the given hash and the given magic prefix.
+func md5Crypt(password, hashed, magic string) (string, error) {
+	salt, _, found := strings.Cut(strings.TrimPrefix(hashed, magic), "$")
+	if !found {
+		return "", errInvalidCrypt
+	}
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	alternate := md5.New() //nolint:gosec
+	alternate.Write([]byte(password + salt + password))
+	altSum := alternate.Sum(nil)
+
+	digest := md5.New() //nolint:gosec
+	digest.Write([]byte(password + magic + salt))
+	for i := len(password); i > 0; i -= md5.Size {
+		digest.Write(altSum[:min(i, md5.Size)])
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			digest.Write([]byte{0})
+		} else {
+			digest.Write([]byte(password[:1]))
+		}
+	}
+	sum := digest.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New() //nolint:gosec
+		if i&1 != 0 {
+			round.Write([]byte(password))
+		} else {
+			round.Write(sum)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write([]byte(password))
+		}
+		if i&1 != 0 {
+			round.Write(sum)
+		} else {
+			round.Write([]byte(password))
+		}
+		sum = round.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString(magic + salt + "$")
+	for _, group := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		cryptEncode(&out, sum[group[0]], sum[group[1]], sum[group[2]], 4)
+	}
+	cryptEncode(&out, 0, 0, sum[11], 2)
+	return out.String(), nil
+}
+
+// shaCrypt computes the SHA-crypt hash (as defined by Ulrich Drepper) of the
+// given password, using the salt and the rounds contained in the given hash.
+func shaCrypt(newHash func() hash.Hash, permutation [][3]int, password, hashed, magic string) (string, error) {
+	const defaultRounds, minRounds, maxRounds = 5000, 1000, 999999999
+
+	params := strings.Split(strings.TrimPrefix(hashed, magic), "$")
+	rounds, customRounds := defaultRounds, false
+	if strings.HasPrefix(params[0], "rounds=") {
+		if n, err := strconv.Atoi(strings.TrimPrefix(params[0], "rounds=")); err == nil {
+			rounds, customRounds = min(max(n, minRounds), maxRounds), true
+		}
+		params = params[1:]
+	}
+	if len(params) != 2 {
+		return "", errInvalidCrypt
+	}
+	salt := params[0]
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+
+	alternate := newHash()
+	alternate.Write([]byte(password + salt + password))
+	altSum := alternate.Sum(nil)
+
+	digest := newHash()
+	digest.Write([]byte(password + salt))
+	for i := len(password); i > 0; i -= len(altSum) {
+		digest.Write(altSum[:min(i, len(altSum))])
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			digest.Write(altSum)
+		} else {
+			digest.Write([]byte(password))
+		}
+	}
+	sum := digest.Sum(nil)
+
+	passwordDigest := newHash()
+	for i := 0; i < len(password); i++ {
+		passwordDigest.Write([]byte(password))
+	}
+	pSeq := cryptRepeat(passwordDigest.Sum(nil), len(password))
+
+	saltDigest := newHash()
+	for i := 0; i < 16+int(sum[0]); i++ {
+		saltDigest.Write([]byte(salt))
+	}
+	sSeq := cryptRepeat(saltDigest.Sum(nil), len(salt))
+
+	for i := 0; i < rounds; i++ {
+		round := newHash()
+		if i&1 != 0 {
+			round.Write(pSeq)
+		} else {
+			round.Write(sum)
+		}
+		if i%3 != 0 {
+			round.Write(sSeq)
+		}
+		if i%7 != 0 {
+			round.Write(pSeq)
+		}
+		if i&1 != 0 {
+			round.Write(sum)
+		} else {
+			round.Write(pSeq)
+		}
+		sum = round.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString(magic)
+	if customRounds {
+		out.WriteString("rounds=" + strconv.Itoa(rounds) + "$")
+	}
+	out.WriteString(salt + "$")
+	for _, group := range permutation {
+		cryptEncode(&out, sum[group[0]], sum[group[1]], sum[group[2]], 4)
+	}
+	if len(sum) == sha512.Size {
+		cryptEncode(&out, 0, 0, sum[63], 2)
+	} else {
+		cryptEncode(&out, 0, sum[31], sum[30], 3)
+	}
+	return out.String(), nil
+}
+
+// cryptRepeat returns a sequence of the given length built by repeating the
+// given digest.
+func cryptRepeat(digest []byte, length int) []byte {
+	seq := make([]byte, 0, length)
+	for len(seq) < length {
+		seq = append(seq, digest[:min(len(digest), length-len(seq))]...)
+	}
+	return seq
+}
+
+// cryptEncode encodes 3 bytes into n characters using the crypt(3) alphabet.
+func cryptEncode(out *strings.Builder, b2, b1, b0 byte, n int) {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for ; n > 0; n-- {
+		out.WriteByte(cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+}
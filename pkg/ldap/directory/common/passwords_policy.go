@@ -0,0 +1,302 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aldy505/phc-crypto/argon2"
+	"github.com/aldy505/phc-crypto/bcrypt"
+	"github.com/aldy505/phc-crypto/pbkdf2"
+	"github.com/aldy505/phc-crypto/scrypt"
+	"go.pact.im/x/phcformat"
+)
+
+type (
+	// PasswordStrength represents how hard it is to recover a password from
+	// its stored representation.
+	PasswordStrength int
+
+	// PasswordHashInfo describes the algorithm and the strength of a stored
+	// bind password.
+	PasswordHashInfo struct {
+		Algorithm string
+		Strength  PasswordStrength
+	}
+
+	// PasswordPolicy defines the minimal strength expected from stored bind
+	// passwords and how to upgrade weaker ones after a successful bind.
+	PasswordPolicy struct {
+		// MinStrength is the minimal strength expected; a warning is emitted
+		// each time a weaker password is used to bind.
+		MinStrength PasswordStrength
+		// Hasher is used to rehash weak passwords. If nil, passwords are
+		// never rehashed.
+		Hasher func(password string) (string, error)
+		// Store is used to persist rehashed passwords. If nil (read-only
+		// backend), passwords are never rehashed.
+		Store PasswordStore
+
+		Logger *slog.Logger
+
+		// rehashed contains the passwords rehashed and stored since the
+		// directory was loaded, indexed by rehashedKey, so that they are used
+		// until the directory is reloaded with them.
+		rehashed sync.Map
+
+		// totpSteps contains the last TOTP time step accepted for each DN;
+		// it is kept here, and not on the TOTP validators, because the
+		// policy outlives the directories replaced on reload.
+		totpSteps map[string]uint64
+		totpMu    sync.Mutex
+	}
+
+	// rehashedKey identifies a stored bind password replaced by a rehashed
+	// one; the previous password is part of the key so that a password
+	// changed in the meantime is never replaced.
+	rehashedKey struct {
+		dn, stored string
+	}
+
+	// PasswordStore is implemented by writable backends able to replace the
+	// bind password of an object.
+	PasswordStore interface {
+		// UpdateBindPassword replaces the bind password of the object
+		// identified by the given DN with the given hash.
+		UpdateBindPassword(dn string, hash string) error
+	}
+)
+
+const (
+	// PasswordPlaintext is used for passwords stored without any hashing.
+	PasswordPlaintext PasswordStrength = iota
+	// PasswordInsecure is used for unsalted or trivially breakable hashes.
+	PasswordInsecure
+	// PasswordWeak is used for salted fast digests and key derivation
+	// functions configured with a low cost.
+	PasswordWeak
+	// PasswordStrong is used for key derivation functions configured with a
+	// cost matching the current recommendations.
+	PasswordStrong
+)
+
+var passwordStrengthNames = map[PasswordStrength]string{
+	PasswordPlaintext: "plaintext",
+	PasswordInsecure:  "insecure",
+	PasswordWeak:      "weak",
+	PasswordStrong:    "strong",
+}
+
+// PasswordHashers contains the hashers that can be used to rehash weak
+// passwords, configured with the currently recommended parameters.
+var PasswordHashers = map[string]func(password string) (string, error){
+	"argon2": func(password string) (string, error) {
+		return argon2.Hash(password, argon2.Config{Time: 3, Memory: 64 * 1024, Parallelism: 1, Variant: argon2.ID})
+	},
+	"bcrypt": func(password string) (string, error) {
+		return bcrypt.Hash(password, bcrypt.Config{Rounds: 12})
+	},
+	"pbkdf2": func(password string) (string, error) {
+		return pbkdf2.Hash(password, pbkdf2.Config{Rounds: 210000, HashFunc: pbkdf2.SHA512})
+	},
+	"scrypt": func(password string) (string, error) {
+		return scrypt.Hash(password, scrypt.Config{Cost: 32768, Rounds: 8, Parallelism: 1})
+	},
+}
+
+// String returns the name of the password strength.
+func (s PasswordStrength) String() string { return passwordStrengthNames[s] }
+
+// ParsePasswordStrength returns the password strength matching the given name.
+func ParsePasswordStrength(name string) (PasswordStrength, error) {
+	for strength, sname := range passwordStrengthNames {
+		if strings.EqualFold(sname, name) {
+			return strength, nil
+		}
+	}
+	return PasswordPlaintext, fmt.Errorf("unknown password strength: %s", name)
+}
+
+// AnalyzePassword returns the algorithm and the strength of the given stored
+// bind password.
+func AnalyzePassword(stored string) PasswordHashInfo {
+	if match := rfc2307SchemeRegex.FindStringSubmatch(stored); match != nil {
+		return analyzeRFC2307(strings.ToUpper(match[1]), match[2])
+	}
+
+	phcInfo, ok := phcformat.Parse(stored)
+	if !ok {
+		return PasswordHashInfo{Algorithm: "plaintext", Strength: PasswordPlaintext}
+	}
+
+	info := PasswordHashInfo{Algorithm: phcInfo.ID, Strength: PasswordWeak}
+	params := phcParameters(stored)
+	switch {
+	case strings.HasPrefix(phcInfo.ID, "argon2"):
+		if params["m"] >= 19*1024 {
+			info.Strength = PasswordStrong
+		}
+	case phcInfo.ID == "bcrypt":
+		if params["r"] >= 10 {
+			info.Strength = PasswordStrong
+		}
+	case strings.HasPrefix(phcInfo.ID, "pbkdf2"):
+		if params["i"] >= 100000 && phcInfo.ID != "pbkdf2md5" && phcInfo.ID != "pbkdf2sha1" {
+			info.Strength = PasswordStrong
+		}
+	case phcInfo.ID == "scrypt":
+		// NOTE: the `ln` parameter contains the CPU/memory cost itself, not
+		//       its logarithm.
+		if params["ln"] >= 16384 {
+			info.Strength = PasswordStrong
+		}
+	}
+	return info
+}
+
+// analyzeRFC2307 returns the algorithm and the strength of a RFC 2307
+// `{SCHEME}` password.
+func analyzeRFC2307(scheme, value string) PasswordHashInfo {
+	switch scheme {
+	case "MD5", "SMD5", "SHA", "SHA256", "SHA384", "SHA512":
+		return PasswordHashInfo{Algorithm: strings.ToLower(scheme), Strength: PasswordInsecure}
+	case "SSHA", "SSHA256", "SSHA384", "SSHA512":
+		return PasswordHashInfo{Algorithm: strings.ToLower(scheme), Strength: PasswordWeak}
+	case "PBKDF2", "PBKDF2-SHA1", "PBKDF2-SHA256", "PBKDF2-SHA512":
+		info := PasswordHashInfo{Algorithm: strings.ToLower(scheme), Strength: PasswordWeak}
+		iterations, _ := strconv.Atoi(strings.SplitN(value, "$", 2)[0])
+		if iterations >= 100000 && scheme != "PBKDF2" && scheme != "PBKDF2-SHA1" {
+			info.Strength = PasswordStrong
+		}
+		return info
+	case "PBKDF2_SHA256":
+		return PasswordHashInfo{Algorithm: "pbkdf2_sha256", Strength: PasswordWeak}
+	case "CRYPT":
+		switch {
+		case strings.HasPrefix(value, "$1$"):
+			return PasswordHashInfo{Algorithm: "md5-crypt", Strength: PasswordInsecure}
+		case strings.HasPrefix(value, "$5$"):
+			return PasswordHashInfo{Algorithm: "sha256-crypt", Strength: PasswordWeak}
+		case strings.HasPrefix(value, "$6$"):
+			return PasswordHashInfo{Algorithm: "sha512-crypt", Strength: PasswordWeak}
+		case strings.HasPrefix(value, "$2"):
+			// NOTE: malformed bcrypt hashes are reported like unknown crypt
+			//       algorithms.
+			cost, valid := bcryptCost(value)
+			if !valid {
+				break
+			}
+			info := PasswordHashInfo{Algorithm: "bcrypt", Strength: PasswordWeak}
+			if cost >= 10 {
+				info.Strength = PasswordStrong
+			}
+			return info
+		}
+		return PasswordHashInfo{Algorithm: "crypt", Strength: PasswordInsecure}
+	}
+	return PasswordHashInfo{Algorithm: strings.ToLower(scheme), Strength: PasswordInsecure}
+}
+
+// phcParameters extracts all numeric parameters of the given PHC string.
+func phcParameters(stored string) map[string]int {
+	params := map[string]int{}
+
+	for _, field := range strings.Split(stored, "$")[2:] {
+		if !strings.Contains(field, "=") || strings.HasPrefix(field, "v=") {
+			continue
+		}
+
+		for _, param := range strings.Split(field, ",") {
+			name, value, _ := strings.Cut(param, "=")
+			if n, err := strconv.Atoi(value); err == nil {
+				params[name] = n
+			}
+		}
+	}
+	return params
+}
+
+// passwordPolicyKey is the context key of the password policy.
+type passwordPolicyKey struct{}
+
+// ContextWithPasswordPolicy returns a copy of the given context carrying the
+// password policy to enforce on the directories created with it.
+func ContextWithPasswordPolicy(ctx context.Context, policy *PasswordPolicy) context.Context {
+	return context.WithValue(ctx, passwordPolicyKey{}, policy)
+}
+
+// PasswordPolicyFromContext returns the password policy carried by the given
+// context, or nil if there is none.
+func PasswordPolicyFromContext(ctx context.Context) *PasswordPolicy {
+	policy, _ := ctx.Value(passwordPolicyKey{}).(*PasswordPolicy)
+	return policy
+}
+
+// enforce checks the given stored password against the policy once the bind
+// succeeded, warns about weak passwords and rehashes them if possible.
+func (policy *PasswordPolicy) enforce(dn, stored, password string) {
+	info := AnalyzePassword(stored)
+	if info.Strength >= policy.MinStrength {
+		return
+	}
+
+	log := policy.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	log = log.With(
+		slog.String("bind_dn", dn),
+		slog.Group("password",
+			slog.String("algorithm", info.Algorithm),
+			slog.String("strength", info.Strength.String()),
+			slog.String("min_strength", policy.MinStrength.String()),
+		),
+	)
+	log.Warn("bind password is weaker than the password policy")
+
+	if policy.Hasher == nil || policy.Store == nil {
+		return
+	}
+
+	hash, err := policy.Hasher(password)
+	if err != nil {
+		log.Error("unable to rehash bind password", slog.String("error", err.Error()))
+		return
+	}
+	if err := policy.Store.UpdateBindPassword(dn, hash); err != nil {
+		log.Error("unable to store rehashed bind password", slog.String("error", err.Error()))
+		return
+	}
+	policy.rehashed.Store(rehashedKey{dn: dn, stored: stored}, hash)
+	log.Info("bind password rehashed")
+}
+
+// storedPassword returns the bind password of the given DN, replacing the
+// given stored password by its rehashed version if it has been rehashed.
+func (policy *PasswordPolicy) storedPassword(dn, stored string) string {
+	if hash, rehashed := policy.rehashed.Load(rehashedKey{dn: dn, stored: stored}); rehashed {
+		return hash.(string)
+	}
+	return stored
+}
+
+// validateTOTP returns true if the given code is valid for the given TOTP
+// validator of the given DN and no code of the same (or a later) time step
+// has already been accepted for this DN, even by a previous validator.
+func (policy *PasswordPolicy) validateTOTP(dn string, totp *TOTP, code string) bool {
+	policy.totpMu.Lock()
+	defer policy.totpMu.Unlock()
+
+	lastStep := policy.totpSteps[dn]
+	if !totp.validate(code, &lastStep) {
+		return false
+	}
+	if policy.totpSteps == nil {
+		policy.totpSteps = map[string]uint64{}
+	}
+	policy.totpSteps[dn] = lastStep
+	return true
+}
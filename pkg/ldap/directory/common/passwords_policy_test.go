@@ -0,0 +1,233 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/aldy505/phc-crypto/bcrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockPasswordStore map[string]string
+
+func (store mockPasswordStore) UpdateBindPassword(dn string, hash string) error {
+	if dn == "cn=readonly" {
+		return fmt.Errorf("read-only object")
+	}
+	store[dn] = hash
+	return nil
+}
+
+func TestAnalyzePassword(t *testing.T) {
+	tests := []struct {
+		Name           string
+		HashedPassword string
+		ExpectedInfo   PasswordHashInfo
+	}{
+		{
+			Name:           "Test with plain text",
+			HashedPassword: "password123",
+			ExpectedInfo:   PasswordHashInfo{Algorithm: "plaintext", Strength: PasswordPlaintext},
+		},
+		{
+			Name:           "Test with {SHA}",
+			HashedPassword: "{SHA}y/2sYAj5yrQIN4TL0YdPdmGNKpc=",
+			ExpectedInfo:   PasswordHashInfo{Algorithm: "sha", Strength: PasswordInsecure},
+		},
+		{
+			Name:           "Test with {SSHA512}",
+			HashedPassword: "{SSHA512}DMgrmJeH73Q97ncWYaetxo8HsdJiMKFsq4bsjZ43T3BugAV3KBlzUXilvsILVGxCHrNdB1Ur26iJGV4IO+VH83NhbHRzYWx0",
+			ExpectedInfo:   PasswordHashInfo{Algorithm: "ssha512", Strength: PasswordWeak},
+		},
+		{
+			Name:           "Test with {CRYPT} MD5",
+			HashedPassword: "{CRYPT}$1$saltsalt$4WS.Uhxmahm1YZiMsUNcc0",
+			ExpectedInfo:   PasswordHashInfo{Algorithm: "md5-crypt", Strength: PasswordInsecure},
+		},
+		{
+			Name:           "Test with {CRYPT} low-cost bcrypt",
+			HashedPassword: "{CRYPT}$2y$04$um6xZmCw09RE5JaJ5d1LvOm2bBRZfIQCGFFvQ4L454I9/7DGITOLq",
+			ExpectedInfo:   PasswordHashInfo{Algorithm: "bcrypt", Strength: PasswordWeak},
+		},
+		{
+			Name:           "Test with truncated {CRYPT} bcrypt",
+			HashedPassword: "{CRYPT}$2y",
+			ExpectedInfo:   PasswordHashInfo{Algorithm: "crypt", Strength: PasswordInsecure},
+		},
+		{
+			Name:           "Test with malformed {CRYPT} bcrypt",
+			HashedPassword: "{CRYPT}$2y$12$um6xZmCw09RE5JaJ5d1LvO",
+			ExpectedInfo:   PasswordHashInfo{Algorithm: "crypt", Strength: PasswordInsecure},
+		},
+		{
+			Name:           "Test with {PBKDF2-SHA512} high-cost",
+			HashedPassword: "{PBKDF2-SHA512}210000$c2FsdHNhbHQ$Wd5sraT46Axq1OIhMGM9Wg35YROtj",
+			ExpectedInfo:   PasswordHashInfo{Algorithm: "pbkdf2-sha512", Strength: PasswordStrong},
+		},
+		{
+			Name:           "Test with argon2id",
+			HashedPassword: "$argon2id$v=19$m=65536,t=10,p=1$fc833b1da8729366224df547834badc7914906b7add02b6e709e1ffe4de56ed3$cbfe0dce36ac1d0db8d869b60cb0f264ea44b2e50d1376cfc4ff3412d73e38c7eebc9d07674b9337297edfe2f64877769b09bbb7f80ef974dc7263eb48002b9f",
+			ExpectedInfo:   PasswordHashInfo{Algorithm: "argon2id", Strength: PasswordStrong},
+		},
+		{
+			Name:           "Test with low-cost bcrypt",
+			HashedPassword: "$bcrypt$v=0$r=8$$243261243038244e4e78745643644d4f7a33442f6a37534e72345a7075586b772f416d58456a2f6e544856706f784b45656446547570332f41474743",
+			ExpectedInfo:   PasswordHashInfo{Algorithm: "bcrypt", Strength: PasswordWeak},
+		},
+		{
+			Name:           "Test with low-cost pbkdf2",
+			HashedPassword: "$pbkdf2sha256$v=0$i=10$67447629899eeb0d6fdb1e4d784a8a78$b467bb3ec3a9c4d46cf0fabb8207f4da139022836168fd29f1258f85f3c4bd6f",
+			ExpectedInfo:   PasswordHashInfo{Algorithm: "pbkdf2sha256", Strength: PasswordWeak},
+		},
+		{
+			Name:           "Test with low-cost scrypt",
+			HashedPassword: "$scrypt$v=0$ln=16,r=8,p=1$fca08f0f4120c4fd2b2d5e36a114d4fb$fd3db2ea0f59d547d0687ef64c7b2afcdc6f98cbd416442f3ccda41f62a66348",
+			ExpectedInfo:   PasswordHashInfo{Algorithm: "scrypt", Strength: PasswordWeak},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.ExpectedInfo, AnalyzePassword(tt.HashedPassword))
+		})
+	}
+}
+
+func TestParsePasswordStrength(t *testing.T) {
+	strength, err := ParsePasswordStrength("Weak")
+	assert.NoError(t, err)
+	assert.Equal(t, PasswordWeak, strength)
+
+	_, err = ParsePasswordStrength("unbreakable")
+	assert.EqualError(t, err, "unknown password strength: unbreakable")
+}
+
+func TestObjectBindWithPasswordPolicy(t *testing.T) {
+	logs := bytes.NewBuffer(nil)
+	store := mockPasswordStore{}
+	policy := &PasswordPolicy{
+		MinStrength: PasswordStrong,
+		Hasher:      func(password string) (string, error) { return "{TEST}" + password, nil },
+		Store:       store,
+		Logger:      slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{ReplaceAttr: dropTimeAttr})),
+	}
+
+	t.Run("Test with weak password", func(t *testing.T) {
+		logs.Reset()
+		obj := Object{ImplObject: ImplObject{DN: "cn=alice", BindPasswords: []string{"password123"}, PasswordPolicy: policy}}
+
+		valid, err := obj.Bind("password123")
+		require.NoError(t, err)
+		assert.True(t, valid)
+
+		assert.Equal(t, mockPasswordStore{"cn=alice": "{TEST}password123"}, store)
+		assert.Equal(t,
+			"level=WARN msg=\"bind password is weaker than the password policy\" bind_dn=\"cn=alice\" password.algorithm=plaintext password.strength=plaintext password.min_strength=strong\n"+
+				"level=INFO msg=\"bind password rehashed\" bind_dn=\"cn=alice\" password.algorithm=plaintext password.strength=plaintext password.min_strength=strong\n",
+			logs.String(),
+		)
+	})
+
+	t.Run("Test with wrong password", func(t *testing.T) {
+		logs.Reset()
+		obj := Object{ImplObject: ImplObject{DN: "cn=bob", BindPasswords: []string{"password123"}, PasswordPolicy: policy}}
+
+		valid, err := obj.Bind("password")
+		require.NoError(t, err)
+		assert.False(t, valid)
+
+		assert.NotContains(t, store, "cn=bob")
+		assert.Empty(t, logs.String())
+	})
+
+	t.Run("Test with strong password", func(t *testing.T) {
+		logs.Reset()
+		obj := Object{ImplObject: ImplObject{
+			DN:             "cn=charlie",
+			BindPasswords:  []string{"$argon2id$v=19$m=65536,t=10,p=1$fc833b1da8729366224df547834badc7914906b7add02b6e709e1ffe4de56ed3$cbfe0dce36ac1d0db8d869b60cb0f264ea44b2e50d1376cfc4ff3412d73e38c7eebc9d07674b9337297edfe2f64877769b09bbb7f80ef974dc7263eb48002b9f"},
+			PasswordPolicy: policy,
+		}}
+
+		valid, err := obj.Bind("password123")
+		require.NoError(t, err)
+		assert.True(t, valid)
+
+		assert.NotContains(t, store, "cn=charlie")
+		assert.Empty(t, logs.String())
+	})
+
+	t.Run("Test with read-only store", func(t *testing.T) {
+		logs.Reset()
+		obj := Object{ImplObject: ImplObject{DN: "cn=readonly", BindPasswords: []string{"password123"}, PasswordPolicy: policy}}
+
+		valid, err := obj.Bind("password123")
+		require.NoError(t, err)
+		assert.True(t, valid)
+
+		assert.Contains(t, logs.String(), "level=ERROR msg=\"unable to store rehashed bind password\"")
+	})
+
+	t.Run("Test without store", func(t *testing.T) {
+		logs.Reset()
+		policy := &PasswordPolicy{MinStrength: policy.MinStrength, Hasher: policy.Hasher, Logger: policy.Logger}
+		obj := Object{ImplObject: ImplObject{DN: "cn=eve", BindPasswords: []string{"password123"}, PasswordPolicy: policy}}
+
+		valid, err := obj.Bind("password123")
+		require.NoError(t, err)
+		assert.True(t, valid)
+
+		assert.NotContains(t, store, "cn=eve")
+		assert.Equal(t,
+			"level=WARN msg=\"bind password is weaker than the password policy\" bind_dn=\"cn=eve\" password.algorithm=plaintext password.strength=plaintext password.min_strength=strong\n",
+			logs.String(),
+		)
+	})
+
+	t.Run("Test with rehashed password", func(t *testing.T) {
+		logs.Reset()
+		store := mockPasswordStore{}
+		policy := &PasswordPolicy{
+			MinStrength: PasswordStrong,
+			Hasher:      func(password string) (string, error) { return bcrypt.Hash(password, bcrypt.Config{Rounds: 10}) },
+			Store:       store,
+			Logger:      policy.Logger,
+		}
+		obj := Object{ImplObject: ImplObject{DN: "cn=frank", BindPasswords: []string{"password123"}, PasswordPolicy: policy}}
+
+		valid, err := obj.Bind("password123")
+		require.NoError(t, err)
+		assert.True(t, valid)
+		require.Contains(t, store, "cn=frank")
+		rehashed := store["cn=frank"]
+
+		// NOTE: the rehashed password is used until the directory is
+		//       reloaded, so the password is neither reported nor rehashed
+		//       again.
+		logs.Reset()
+		valid, err = obj.Bind("password123")
+		require.NoError(t, err)
+		assert.True(t, valid)
+		assert.Equal(t, rehashed, store["cn=frank"])
+		assert.Empty(t, logs.String())
+
+		valid, err = obj.Bind("password")
+		require.NoError(t, err)
+		assert.False(t, valid)
+
+		// NOTE: a password changed in the meantime is not replaced.
+		changed := Object{ImplObject: ImplObject{DN: "cn=frank", BindPasswords: []string{"changed"}, PasswordPolicy: policy}}
+		valid, err = changed.Bind("password123")
+		require.NoError(t, err)
+		assert.False(t, valid)
+	})
+}
+
+func dropTimeAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && a.Key == slog.TimeKey {
+		return slog.Attr{}
+	}
+	return a
+}
@@ -0,0 +1,199 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyPasswordRFC2307(t *testing.T) {
+	tests := []struct {
+		Name           string
+		HashedPassword string
+		ExpectedResult bool
+		ExpectedError  string
+	}{
+		{
+			Name:           "Test with {SHA}",
+			HashedPassword: "{SHA}y/2sYAj5yrQIN4TL0YdPdmGNKpc=",
+			ExpectedResult: true,
+		},
+		{
+			Name:           "Test with {SSHA}",
+			HashedPassword: "{SSHA}Jt5wlBcHKJyCWtuyXiYVVGtEDalzYWx0c2FsdA==",
+			ExpectedResult: true,
+		},
+		{
+			Name:           "Test with lower-case {ssha}",
+			HashedPassword: "{ssha}Jt5wlBcHKJyCWtuyXiYVVGtEDalzYWx0c2FsdA==",
+			ExpectedResult: true,
+		},
+		{
+			Name:           "Test with {SSHA256}",
+			HashedPassword: "{SSHA256}UDMSD9f8B6PX1jg6NoBVTevz1jmH25RRKIkJxrWLnwFzYWx0c2FsdA==",
+			ExpectedResult: true,
+		},
+		{
+			Name:           "Test with {SSHA512}",
+			HashedPassword: "{SSHA512}DMgrmJeH73Q97ncWYaetxo8HsdJiMKFsq4bsjZ43T3BugAV3KBlzUXilvsILVGxCHrNdB1Ur26iJGV4IO+VH83NhbHRzYWx0",
+			ExpectedResult: true,
+		},
+		{
+			Name:           "Test with {SMD5}",
+			HashedPassword: "{SMD5}vPWVf/489ePdlmABoV/0F3NhbHRzYWx0",
+			ExpectedResult: true,
+		},
+		{
+			Name:           "Test with {CRYPT} MD5",
+			HashedPassword: "{CRYPT}$1$saltsalt$4WS.Uhxmahm1YZiMsUNcc0",
+			ExpectedResult: true,
+		},
+		{
+			Name:           "Test with {CRYPT} Apache MD5",
+			HashedPassword: "{CRYPT}$apr1$saltsalt$a7QwE7nhk.AbO/ZoOQ8CC0",
+			ExpectedResult: true,
+		},
+		{
+			Name:           "Test with {CRYPT} SHA-256",
+			HashedPassword: "{CRYPT}$5$rounds=10000$saltsalt$ns/y0Z5PMyRVFVnC9b/8Qfm/NPc8Jyd9Nep2s2LlXh.",
+			ExpectedResult: true,
+		},
+		{
+			Name:           "Test with {CRYPT} SHA-512",
+			HashedPassword: "{CRYPT}$6$saltsalt$I7sf08GTmo.lDz2v6I2Ond3d6r/aJcvBs6MtbEH7x6Z/objDGNAdsYVVcbbcf.vTCAI8Gg5tlfz3HAiw/6jGa1",
+			ExpectedResult: true,
+		},
+		{
+			Name:           "Test with {CRYPT} bcrypt",
+			HashedPassword: "{CRYPT}$2y$04$um6xZmCw09RE5JaJ5d1LvOm2bBRZfIQCGFFvQ4L454I9/7DGITOLq",
+			ExpectedResult: true,
+		},
+		{
+			Name:           "Test with {PBKDF2}",
+			HashedPassword: "{PBKDF2}1000$c2FsdHNhbHQ$IdHbLFVsCLfl4/Sx07LeHGJEjmk",
+			ExpectedResult: true,
+		},
+		{
+			Name:           "Test with {PBKDF2-SHA512}",
+			HashedPassword: "{PBKDF2-SHA512}10000$c2FsdHNhbHQ$Wd5sraT46Axq1OIhMGM9Wg35YROtj.d9IhzNw0PZ0IjNCTDPp99mmEHNUTIwGSoJF1Wd.y73RHN1pQnCovnPDA",
+			ExpectedResult: true,
+		},
+		{
+			Name:           "Test with {PBKDF2_SHA256}",
+			HashedPassword: "{PBKDF2_SHA256}AAAD6AABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4fICEiIyQlJicoKSorLC0uLzAxMjM0NTY3ODk6Ozw9Pj8jCtp6XT9zfwMFoBkQumGrg/tb7YPGtIfJTub5B6dsRSHbLH9TPfvB/oM3gb0r3zUKVyz+0zgHi2u8fzl0Olc0cEPv+NnjrzZSBlb5bciS9OEkTa+1jEsWSnHYhFUxGsABqenrXe77Gu/qeXJwjl2bXfIAet54jOvmB7WCl445xWWw0KH4YNT2eU9dqjWZ8iml+AlpQd4+ETB4m/wi7Gf2gWPUAOcFruYzc0KSpWPPCcSgzLbGsFhLMM3ZH3tSizxBat++eJbCCxgx+i4LuLa6sDBW2vc8rvkXcAo++xgrDVQZez4xCcT2pDssFQFoBch4eJh8xiUfURGGrSJBU7ky",
+			ExpectedResult: true,
+		},
+		{
+			Name:           "Test with wrong {SSHA} password",
+			HashedPassword: "{SSHA}UDMSD9f8B6PX1jg6NoBVTevz1jmH25RRKIkJxrWLnwFzYWx0c2FsdA==",
+			ExpectedResult: false,
+		},
+		{
+			Name:           "Test with wrong {CRYPT} password",
+			HashedPassword: "{CRYPT}$6$saltsalt$I7sf08GTmo.lDz2v6I2Ond3d6r/aJcvBs6MtbEH7x6Z/objDGNAdsYVVcbbcf.vTCAI8Gg5tlfz3HAiw/6jGa2",
+			ExpectedResult: false,
+		},
+		{
+			Name:           "Test with unknown scheme (plain text)",
+			HashedPassword: "{UNKNOWN}password123",
+			ExpectedResult: false,
+		},
+		{
+			Name:           "Test with unsupported crypt algorithm",
+			HashedPassword: "{CRYPT}abJnggxhB/yWI",
+			ExpectedError:  "invalid {CRYPT} password: unsupported crypt algorithm",
+		},
+		{
+			Name:           "Test with SHA-512 crypt without salt",
+			HashedPassword: "{CRYPT}$6$rounds=5000",
+			ExpectedError:  "invalid {CRYPT} password: invalid crypt hash: expected '<salt>$<hash>' format",
+		},
+		{
+			Name:           "Test with SHA-256 crypt without hash",
+			HashedPassword: "{CRYPT}$5$rounds=1000$saltsalt",
+			ExpectedError:  "invalid {CRYPT} password: invalid crypt hash: expected '<salt>$<hash>' format",
+		},
+		{
+			Name:           "Test with MD5 crypt without hash",
+			HashedPassword: "{CRYPT}$1$saltsalt",
+			ExpectedError:  "invalid {CRYPT} password: invalid crypt hash: expected '<salt>$<hash>' format",
+		},
+		{
+			Name:           "Test with invalid base64 value",
+			HashedPassword: "{SSHA}not base64",
+			ExpectedError:  "invalid {SSHA} password: invalid base64 value: illegal base64 data at input byte 3",
+		},
+		{
+			Name:           "Test with truncated digest",
+			HashedPassword: "{SSHA256}c2FsdA==",
+			ExpectedError:  "invalid {SSHA256} password: digest too short: expected at least 32 bytes, got 4",
+		},
+		{
+			Name:           "Test with salt on an unsalted scheme",
+			HashedPassword: "{SHA}y/2sYAj5yrQIN4TL0YdPdmGNKpdzYWx0",
+			ExpectedError:  "invalid {SHA} password: invalid digest size: expected 20 bytes, got 24",
+		},
+		{
+			Name:           "Test with invalid PBKDF2 format",
+			HashedPassword: "{PBKDF2-SHA256}10000$c2FsdA",
+			ExpectedError:  "invalid {PBKDF2-SHA256} password: expected '<iterations>$<salt>$<hash>' format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			actualResult, err := verifyPassword(tt.HashedPassword, "password123")
+
+			if tt.ExpectedError != "" {
+				assert.EqualError(t, err, tt.ExpectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.ExpectedResult, actualResult)
+		})
+	}
+}
+
+func TestVerifyPasswordPlainText(t *testing.T) {
+	actualResult, err := verifyPassword("password123", "password123")
+	assert.NoError(t, err)
+	assert.True(t, actualResult)
+
+	actualResult, err = verifyPassword("password123", "password")
+	assert.NoError(t, err)
+	assert.False(t, actualResult)
+
+	// NOTE: values starting with an unknown scheme are plain text passwords
+	actualResult, err = verifyPassword("{braces}password", "{braces}password")
+	assert.NoError(t, err)
+	assert.True(t, actualResult)
+}
+
+func TestConvertPasswordHash(t *testing.T) {
+	tests := []struct {
+		Name          string
+		Stored        string
+		Expected      string
+		ExpectedError string
+	}{
+		{Name: "PlainText", Stored: "alice", Expected: "alice"},
+		{Name: "PHC", Stored: "$argon2id$v=19$m=65536,t=2,p=1$c2FsdHNhbHQ$aGFzaA", Expected: "$argon2id$v=19$m=65536,t=2,p=1$c2FsdHNhbHQ$aGFzaA"},
+		{Name: "LowerCaseScheme", Stored: "{ssha}Jt5wlBcHKJyCWtuyXiYVVGtEDalzYWx0c2FsdA==", Expected: "{SSHA}Jt5wlBcHKJyCWtuyXiYVVGtEDalzYWx0c2FsdA=="},
+		{Name: "Crypt", Stored: "{crypt}$6$salt$hash", Expected: "{CRYPT}$6$salt$hash"},
+		{Name: "OpenLDAPArgon2", Stored: "{ARGON2}$argon2id$v=19$m=65536,t=2,p=1$c2FsdHNhbHQ$aGFzaA", Expected: "$argon2id$v=19$m=65536,t=2,p=1$c2FsdHNhbHQ$aGFzaA"},
+		{Name: "UnsupportedScheme", Stored: "{SASL}alice@EXAMPLE.ORG", Expected: "{SASL}alice@EXAMPLE.ORG", ExpectedError: "unsupported password scheme: SASL"},
+		{Name: "UnsupportedCrypt", Stored: "{CRYPT}$y$j9T$salt$hash", Expected: "{CRYPT}$y$j9T$salt$hash", ExpectedError: "unsupported crypt algorithm"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			actual, err := ConvertPasswordHash(tt.Stored)
+			if tt.ExpectedError != "" {
+				assert.EqualError(t, err, tt.ExpectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.Expected, actual)
+		})
+	}
+}
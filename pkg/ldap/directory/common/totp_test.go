@@ -0,0 +1,154 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfc6238Secret is the base32 encoded secret used by the RFC 6238 test vectors.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestNewTOTP(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		_, err := NewTOTP("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Secret", func(t *testing.T) {
+		totp, err := NewTOTP("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+		require.NoError(t, err)
+		assert.Equal(t, rfc6238Secret, totp.Secret())
+	})
+
+	t.Run("Invalid/NotBase32", func(t *testing.T) {
+		_, err := NewTOTP("not a base32 secret!")
+		assert.EqualError(t, err, "invalid base32 TOTP secret: illegal base32 data at input byte 16")
+	})
+
+	t.Run("Invalid/TooShort", func(t *testing.T) {
+		_, err := NewTOTP("GEZDGNBV")
+		assert.EqualError(t, err, "invalid TOTP secret: must be at least 80 bits long")
+	})
+}
+
+func TestTOTPCode(t *testing.T) {
+	totp, err := NewTOTP(rfc6238Secret)
+	require.NoError(t, err)
+
+	// NOTE: RFC 6238 test vectors, truncated to 6 digits
+	assert.Equal(t, "287082", totp.Code(time.Unix(59, 0)))
+	assert.Equal(t, "081804", totp.Code(time.Unix(1111111109, 0)))
+	assert.Equal(t, "005924", totp.Code(time.Unix(1234567890, 0)))
+}
+
+func TestTOTPValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	totp, err := NewTOTP(rfc6238Secret)
+	require.NoError(t, err)
+	totp.now = func() time.Time { return now }
+
+	t.Run("Test with previous period code", func(t *testing.T) {
+		assert.True(t, totp.Validate(totp.Code(now.Add(-TOTPPeriod))))
+	})
+
+	t.Run("Test with current code", func(t *testing.T) {
+		assert.True(t, totp.Validate("005924"))
+	})
+
+	t.Run("Test with replayed code", func(t *testing.T) {
+		assert.False(t, totp.Validate("005924"))
+	})
+
+	t.Run("Test with older code after a newer one", func(t *testing.T) {
+		assert.False(t, totp.Validate(totp.Code(now.Add(-TOTPPeriod))))
+	})
+
+	t.Run("Test with expired code", func(t *testing.T) {
+		assert.False(t, totp.Validate(totp.Code(now.Add(-3*TOTPPeriod))))
+	})
+
+	t.Run("Test with wrong code", func(t *testing.T) {
+		assert.False(t, totp.Validate("123456"))
+	})
+}
+
+func TestObjectBindWithTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	totp, err := NewTOTP(rfc6238Secret)
+	require.NoError(t, err)
+	totp.now = func() time.Time { return now }
+
+	obj := Object{ImplObject: ImplObject{BindPasswords: []string{"password123"}, BindTOTP: totp}}
+
+	t.Run("Test without TOTP code", func(t *testing.T) {
+		valid, err := obj.Bind("password123")
+		assert.NoError(t, err)
+		assert.False(t, valid)
+	})
+
+	t.Run("Test with wrong password", func(t *testing.T) {
+		valid, err := obj.Bind("password" + "005924")
+		assert.NoError(t, err)
+		assert.False(t, valid)
+	})
+
+	t.Run("Test with password and TOTP code", func(t *testing.T) {
+		valid, err := obj.Bind("password123" + "005924")
+		assert.NoError(t, err)
+		assert.True(t, valid)
+	})
+
+	t.Run("Test with replayed TOTP code", func(t *testing.T) {
+		valid, err := obj.Bind("password123" + "005924")
+		assert.NoError(t, err)
+		assert.False(t, valid)
+	})
+
+	t.Run("Test with too short password", func(t *testing.T) {
+		valid, err := obj.Bind("12345")
+		assert.NoError(t, err)
+		assert.False(t, valid)
+	})
+}
+
+func TestObjectBindWithTOTP_Reload(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	policy := &PasswordPolicy{}
+	load := func() Object {
+		totp, err := NewTOTP(rfc6238Secret)
+		require.NoError(t, err)
+		totp.now = func() time.Time { return now }
+
+		return Object{ImplObject: ImplObject{
+			DN:             "cn=alice,dc=org",
+			BindPasswords:  []string{"password123"},
+			BindTOTP:       totp,
+			PasswordPolicy: policy,
+		}}
+	}
+
+	valid, err := load().Bind("password123" + "005924")
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	// NOTE: the accepted code is remembered by the password policy, which
+	//       outlives the reloaded objects and their TOTP validators.
+	reloaded := load()
+	valid, err = reloaded.Bind("password123" + "005924")
+	require.NoError(t, err)
+	assert.False(t, valid)
+
+	valid, err = reloaded.Bind("password123" + reloaded.BindTOTP.Code(now.Add(TOTPPeriod)))
+	require.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestTOTPKeyURI(t *testing.T) {
+	assert.Equal(t,
+		"otpauth://totp/yaLDAP:cn=alice%2Cdc=org?algorithm=SHA1&digits=6&issuer=yaLDAP&period=30&secret="+rfc6238Secret,
+		TOTPKeyURI("yaLDAP", "cn=alice,dc=org", rfc6238Secret),
+	)
+}
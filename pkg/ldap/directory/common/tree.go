@@ -0,0 +1,106 @@
+package common
+
+import (
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+)
+
+// Tree is a tree of LDAP objects, starting from the root DSE, with an index
+// of all its objects by their normalized DN for quick node search. It
+// implements the ldap.Directory interface and is shared by all directories
+// loading their entries in memory.
+type Tree struct {
+	root  *Object
+	index map[string]*Object
+}
+
+// NewTree returns an empty tree, containing only the root DSE.
+func NewTree() *Tree {
+	return &Tree{
+		root: &Object{
+			ImplObject: ImplObject{
+				Attributes: ldap.Attributes{"objectClass": {"top", "yaLDAPRootDSE"}},
+				SubObjects: map[string]*Object{},
+			},
+		},
+		index: map[string]*Object{},
+	}
+}
+
+// Root returns the root DSE of the tree.
+func (tree *Tree) Root() *Object { return tree.root }
+
+// LookupOrCreate returns the object with the given DN, creating it (and its
+// missing ancestors) if needed. Objects are stored by their normalized RDN
+// inside their parent and created with their RDN values as attributes.
+func (tree *Tree) LookupOrCreate(dn ldap.DN) *Object {
+	obj := tree.root
+	for i := len(dn) - 1; i >= 0; i-- {
+		child, exists := obj.SubObjects[dn[i].Normalize()]
+		if !exists {
+			child = &Object{
+				ImplObject: ImplObject{
+					DN:         dn[i:].String(),
+					Attributes: ldap.Attributes{},
+					SubObjects: map[string]*Object{},
+				},
+			}
+			for _, atv := range dn[i] {
+				child.AddAttribute(atv.Type, atv.Value)
+			}
+			obj.SubObjects[dn[i].Normalize()] = child
+		}
+		obj = child
+	}
+	return obj
+}
+
+// Index indexes all objects of the tree by their normalized DN and, if the
+// given password policy is not nil, enforces it on all of them. It must be
+// called once all objects have been added to the tree.
+func (tree *Tree) Index(policy *PasswordPolicy) {
+	tree.index = map[string]*Object{}
+	WalkObjects(tree.root, func(obj *Object) {
+		if policy != nil {
+			obj.PasswordPolicy = policy
+		}
+		if obj == tree.root {
+			return
+		}
+
+		// NOTE: all DNs are generated from parsed ones and are always valid.
+		dn, _ := ldap.NormalizeDN(obj.DN())
+		tree.index[dn] = obj
+	})
+}
+
+// Lookup returns the indexed object with the given DN, the root DSE for an
+// empty DN or nil if there is no such object.
+func (tree *Tree) Lookup(dn string) *Object {
+	dn, err := ldap.NormalizeDN(dn)
+	switch {
+	case err != nil:
+		return nil
+	case dn == "":
+		return tree.root
+	}
+	return tree.index[dn]
+}
+
+// BaseDN returns the LDAP object represented by the given DN. If no object
+// found, it returns nil.
+func (tree *Tree) BaseDN(dn string) ldap.Object {
+	obj := tree.Lookup(dn)
+	if obj == nil {
+		return nil
+	}
+	return obj
+}
+
+// WalkObjects calls the given function on the given object and on all objects
+// below it.
+func WalkObjects(obj *Object, fn func(obj *Object)) {
+	fn(obj)
+	for _, child := range obj.SubObjects {
+		WalkObjects(child, fn)
+	}
+}
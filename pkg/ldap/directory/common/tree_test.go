@@ -0,0 +1,44 @@
+package common
+
+import (
+	"testing"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTree(t *testing.T) {
+	tree := NewTree()
+
+	dn, err := ldap.ParseDN("uid=alice,ou=people,dc=example,dc=org")
+	require.NoError(t, err)
+	alice := tree.LookupOrCreate(dn)
+	policy := &PasswordPolicy{}
+	tree.Index(policy)
+
+	t.Run("LookupOrCreate", func(t *testing.T) {
+		assert.Equal(t, "uid=alice,ou=people,dc=example,dc=org", alice.DN())
+		assert.Equal(t, ldap.Attributes{"uid": {"alice"}}, alice.Attributes())
+		assert.Same(t, alice, tree.LookupOrCreate(dn))
+
+		people := tree.Root().SubObjects["dc=org"].SubObjects["dc=example"].SubObjects["ou=people"]
+		require.NotNil(t, people)
+		assert.Equal(t, ldap.Attributes{"ou": {"people"}}, people.Attributes())
+	})
+
+	t.Run("BaseDN", func(t *testing.T) {
+		assert.Same(t, tree.Root(), tree.BaseDN(""))
+		assert.Same(t, alice, tree.BaseDN("UID=Alice, OU=People, DC=Example, DC=Org"))
+		assert.Nil(t, tree.BaseDN("uid=bob,ou=people,dc=example,dc=org"))
+		assert.Nil(t, tree.BaseDN("invalid"))
+	})
+
+	t.Run("PasswordPolicy", func(t *testing.T) {
+		assert.Same(t, policy, alice.PasswordPolicy)
+
+		// NOTE: a nil policy keeps the current ones.
+		tree.Index(nil)
+		assert.Same(t, policy, alice.PasswordPolicy)
+	})
+}
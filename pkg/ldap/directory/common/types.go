@@ -1,21 +1,18 @@
 package common
 
 import (
+	"bytes"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 
-	"github.com/aldy505/phc-crypto/argon2"
-	"github.com/aldy505/phc-crypto/bcrypt"
-	"github.com/aldy505/phc-crypto/pbkdf2"
-	"github.com/aldy505/phc-crypto/scrypt"
 	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
 	"github.com/chezmoi-sh/yaldap/pkg/ldap/filters"
 	ber "github.com/go-asn1-ber/asn1-ber"
 	goldap "github.com/go-ldap/ldap/v3"
 	"github.com/jimlambrt/gldap"
 	"github.com/moznion/go-optional"
-	"go.pact.im/x/phcformat"
 )
 
 type (
@@ -35,20 +32,105 @@ type (
 		Attributes ldap.Attributes
 		SubObjects map[string]*Object
 
-		BindPasswords optional.Option[string]
-		ACLs          ACLRuleSet
+		BindPasswords  optional.Option[string]
+		BindTOTP       *TOTP
+		PasswordPolicy *PasswordPolicy
+		ACLs           ACLRuleSet
+		// MemberACLs contains the ACL rules applied to all members of this
+		// object (through `member`, `uniqueMember` or `memberUid`).
+		MemberACLs ACLRuleSet
+		// SubtreeACLs contains the ACL rules applied to all objects below this
+		// object.
+		SubtreeACLs ACLRuleSet
+
+		// SecretAttributes contains the attributes holding bind secrets, which
+		// are hidden unless an ACL rule explicitly grants access to them.
+		SecretAttributes []string
+		// BindDelegate authenticates the object when no bind password is
+		// defined locally (e.g. objects mirrored from another LDAP server).
+		BindDelegate func(dn, password string) (bool, error)
+		// SearchIndex narrows the children visited when searching below this
+		// object: it returns the key of the children which may match the
+		// given filter (e.g. using a database index), or false if it cannot
+		// narrow the search.
+		SearchIndex func(filter *ber.Packet) (map[string]bool, bool)
 	}
 
 	// ACLRule represents an ACL rule used to determine if a object can make search on
-	// a specific DN.
+	// a specific DN (or use any other capability on it).
 	ACLRule struct {
 		DistinguishedNameSuffix string
 		Allowed                 bool
+		Capability              ACLCapability
+		// Attributes restricts attribute-level rules (read, filter and compare)
+		// to the given attributes. If empty, the rule applies to all attributes
+		// except the secret ones.
+		Attributes []string
+		// Filter restricts the rule to the objects matching the given LDAP
+		// filter (e.g. `(objectClass=posixGroup)`).
+		Filter string
+		// Relation restricts the rule to the objects having the given relation
+		// with the object owning the rule.
+		Relation ACLRelation
+		// Source defines where the rule comes from; it takes precedence over
+		// the DN suffix when rules are sorted.
+		Source ACLSource
+		// Origin describes where the rule has been defined (e.g. `line 12,
+		// column 7`, or `'conf.d/acl.yaml' at line 12, column 7` when the
+		// directory is made of several files), if known. It is only used to
+		// explain ACL decisions.
+		Origin string
+
+		// compiled contains the parsed DN suffix and filter of the rule, set
+		// by Compile when the rule is loaded.
+		compiled *compiledACLRule
 	}
+	// compiledACLRule contains the parsed form of an ACL rule target.
+	compiledACLRule struct {
+		suffix ldap.DN
+		filter *ber.Packet
+	}
+	// ACLRelation represents the relation between the object owning an ACL
+	// rule and the objects targeted by this rule.
+	ACLRelation int
+	// ACLCapability represents what an ACL rule grants (or denies) on the
+	// objects matching its DN suffix.
+	ACLCapability int
 	// ACLRuleSet is an ordered set of ACL rules, sorted by the most precise suffix.
 	ACLRuleSet []ACLRule
 )
 
+const (
+	// ACLSearch allows (or denies) to search objects.
+	ACLSearch ACLCapability = iota
+	// ACLProxy allows (or denies) to act on behalf of objects, using the
+	// proxied authorization control (RFC 4370).
+	ACLProxy
+	// ACLRead allows (or denies) to read attributes of objects.
+	ACLRead
+	// ACLFilter allows (or denies) to use attributes of objects inside search
+	// filters. If no rule matches, the read rules are used.
+	ACLFilter
+	// ACLCompare allows (or denies) to compare attributes of objects. If no
+	// rule matches, the read rules are used.
+	ACLCompare
+)
+
+const (
+	// ACLRelationAny targets all objects, whatever their relation with the
+	// object owning the rule.
+	ACLRelationAny ACLRelation = iota
+	// ACLRelationSelf only targets the object owning the rule.
+	ACLRelationSelf
+	// ACLRelationMemberOf only targets the groups the object owning the rule
+	// is member of.
+	ACLRelationMemberOf
+)
+
+// DefaultSecretAttributes contains the attributes that are always considered
+// as secret, whatever the object.
+var DefaultSecretAttributes = []string{"userPassword", "authPassword"}
+
 // DN returns the DN of the current object.
 func (obj Object) DN() string { return obj.ImplObject.DN }
 
@@ -65,62 +147,215 @@ func (obj Object) Attributes() ldap.Attributes {
 // - gldap.BaseObject: only the current object will be searched
 // - gldap.SingleLevel: the current object and its children will be searched
 // - gldap.WholeSubtree: the current object and all its descendants will be searched.
-func (obj Object) Search(scope gldap.Scope, filter string) ([]ldap.Object, error) {
+func (obj Object) Search(scope gldap.Scope, filter string, opts ...ldap.SearchOption) ([]ldap.Object, error) {
 	packet, err := goldap.CompileFilter(filter)
 	if nil != err {
-		return nil, fmt.Errorf("invalid search filter: %w", err)
+		return nil, fmt.Errorf("%w: %w", ldap.ErrInvalidFilter, err)
 	}
-	return obj.search(scope, packet)
+
+	var options ldap.SearchOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var seen map[string]bool
+	if options.DerefAlias != nil {
+		seen = map[string]bool{}
+	}
+	return obj.search(scope, packet, options, seen)
 }
 
 // Bind returns true if the current object is able to authenticate and the password is correct.
 // It returns false if the password is wrong or not set.
+// If a TOTP is defined, the password must be followed by the current TOTP code.
+// If no password is set but a bind delegate is, the delegate authenticates the object.
+// If a password policy is defined, it is enforced after each successful bind.
 func (obj Object) Bind(password string) (bool, error) {
-	if obj.BindPasswords.IsNone() {
+	switch {
+	case obj.BindPasswords.IsNone() && obj.BindDelegate != nil:
+		return obj.BindDelegate(obj.DN(), password)
+	case obj.BindPasswords.IsNone():
 		return false, nil
 	}
 	bindPassword := obj.BindPasswords.Unwrap()
+	if obj.PasswordPolicy != nil {
+		bindPassword = obj.PasswordPolicy.storedPassword(obj.DN(), bindPassword)
+	}
 
-	phcInfo, ok := phcformat.Parse(bindPassword)
-	if !ok {
-		// NOTE: if the password is not a valid PHC string, we assume it's a plain text password
-		// and we compare it directly with the stored password.
-		// NOT RECOMMENDED
-		return bindPassword == password, nil
+	// NOTE: if a TOTP is defined, the code is appended to the password.
+	var code string
+	if obj.BindTOTP != nil {
+		if len(password) < TOTPDigits {
+			return false, nil
+		}
+		password, code = password[:len(password)-TOTPDigits], password[len(password)-TOTPDigits:]
 	}
 
-	switch {
-	case strings.HasPrefix(phcInfo.ID, "argon2"):
-		return argon2.Verify(bindPassword, password)
-	case phcInfo.ID == "bcrypt":
-		return bcrypt.Verify(bindPassword, password)
-	case strings.HasPrefix(phcInfo.ID, "pbkdf2"):
-		return pbkdf2.Verify(bindPassword, password)
-	case phcInfo.ID == "scrypt":
-		return scrypt.Verify(bindPassword, password)
+	valid, err := verifyPassword(bindPassword, password)
+	if !valid || err != nil {
+		return false, err
+	}
+
+	// NOTE: the TOTP code is only checked once the password is valid to avoid
+	//       consuming a code with a wrong password.
+	if obj.BindTOTP != nil && !obj.validateTOTP(code) {
+		return false, nil
+	}
+
+	if obj.PasswordPolicy != nil {
+		obj.PasswordPolicy.enforce(obj.DN(), bindPassword, password)
+	}
+	return true, nil
+}
+
+// validateTOTP returns true if the given TOTP code is valid and has not
+// already been used. Accepted codes are remembered by the password policy, if
+// any, in order to reject them even once the directory has been reloaded.
+func (obj Object) validateTOTP(code string) bool {
+	if obj.PasswordPolicy != nil {
+		return obj.PasswordPolicy.validateTOTP(obj.DN(), obj.BindTOTP, code)
+	}
+	return obj.BindTOTP.Validate(code)
+}
+
+// SameCredentials returns true if the given object authenticates using the
+// same password and TOTP secret as the current object. Objects whose bind is
+// delegated are considered unchanged as long as they are still delegated, and
+// a password replaced by its rehashed version (see PasswordPolicy) is
+// considered unchanged.
+func (obj Object) SameCredentials(other ldap.Object) bool {
+	var impl ImplObject
+	switch other := other.(type) {
+	case *Object:
+		impl = other.ImplObject
+	case Object:
+		impl = other.ImplObject
 	default:
-		return false, fmt.Errorf("unsupported PHC algorithm: %s", phcInfo.ID)
+		return false
 	}
+
+	var password string
+	if obj.BindPasswords.IsSome() {
+		password = obj.BindPasswords.Unwrap()
+		if obj.PasswordPolicy != nil {
+			password = obj.PasswordPolicy.storedPassword(obj.DN(), password)
+		}
+	}
+
+	switch {
+	case obj.BindPasswords.IsSome() != impl.BindPasswords.IsSome():
+		return false
+	case obj.BindPasswords.IsSome() && password != impl.BindPasswords.Unwrap():
+		return false
+	case (obj.BindTOTP == nil) != (impl.BindTOTP == nil):
+		return false
+	case obj.BindTOTP != nil && !bytes.Equal(obj.BindTOTP.secret, impl.BindTOTP.secret):
+		return false
+	}
+	return (obj.BindDelegate == nil) == (impl.BindDelegate == nil)
 }
 
-// CanSearchOn returns true if the current object is able to perform a search on the given DN.
-func (obj Object) CanSearchOn(dn string) bool {
+// CanSearchOn returns true if the current object is able to perform a search on the given entry.
+func (obj Object) CanSearchOn(entry ldap.Object) bool {
+	return obj.ExplainACL(ACLSearch, entry, "").Allowed
+}
+
+// CanSearchBelow returns true if the current object may be able to perform a
+// search on at least one entry below the given entry. It only looks at the
+// ACL rules of the current object, without searching the entries below the
+// given one: restricted rules (by a filter or a relation) are considered as
+// matching at least one of them.
+func (obj Object) CanSearchBelow(entry ldap.Object) bool {
+	dn, err := ldap.ParseDN(entry.DN())
+	if err != nil {
+		return false
+	}
+
 	for _, rule := range obj.ACLs {
-		if strings.HasSuffix(dn, rule.DistinguishedNameSuffix) {
+		target, err := rule.target()
+		if rule.Capability != ACLSearch || err != nil {
+			continue
+		}
+
+		switch {
+		case !target.suffix.HasSuffix(dn) && !dn.HasSuffix(target.suffix):
+			// NOTE: the rule targets another subtree.
+			continue
+		case len(target.suffix) > len(dn):
+			// NOTE: the rule targets a subtree below the entry; denied
+			//       subtrees don't hide the other entries below it.
+			if rule.Allowed {
+				return true
+			}
+		case !rule.isRestricted():
+			// NOTE: the rule targets the entry and all entries below it, so
+			//       the following rules are never used on them.
 			return rule.Allowed
+		case rule.Relation == ACLRelationSelf:
+			if self, err := ldap.ParseDN(obj.DN()); err == nil && rule.Allowed && len(self) > len(dn) && self.HasSuffix(dn) {
+				return true
+			}
+		case rule.Allowed:
+			return true
 		}
 	}
 	return false
 }
 
+// CanProxyAs returns true if the current object is able to perform operations on
+// behalf of the given entry.
+func (obj Object) CanProxyAs(entry ldap.Object) bool {
+	return obj.ExplainACL(ACLProxy, entry, "").Allowed
+}
+
+// CanReadAttribute returns true if the current object is able to read the given
+// attribute of the given entry. Without any matching rule, all attributes are
+// readable except the secret ones.
+func (obj Object) CanReadAttribute(entry ldap.Object, attribute string) bool {
+	return obj.ExplainACL(ACLRead, entry, attribute).Allowed
+}
+
+// CanFilterOnAttribute returns true if the current object is able to use the
+// given attribute of the given entry inside a search filter.
+func (obj Object) CanFilterOnAttribute(entry ldap.Object, attribute string) bool {
+	return obj.ExplainACL(ACLFilter, entry, attribute).Allowed
+}
+
+// CanCompareAttribute returns true if the current object is able to compare the
+// given attribute of the given entry.
+func (obj Object) CanCompareAttribute(entry ldap.Object, attribute string) bool {
+	return obj.ExplainACL(ACLCompare, entry, attribute).Allowed
+}
+
+// isSecretAttribute returns true if the given attribute of the given entry
+// holds a bind secret.
+func isSecretAttribute(entry ldap.Object, attribute string) bool {
+	isAttribute := func(name string) bool { return strings.EqualFold(name, attribute) }
+
+	if obj, ok := entry.(*Object); ok && slices.ContainsFunc(obj.SecretAttributes, isAttribute) {
+		return true
+	}
+	return slices.ContainsFunc(DefaultSecretAttributes, isAttribute)
+}
+
 // search runs a search on the current object and its children, based on the
 // given scope and filter.
 // Depending on the scope, the search will be more or less precise :
 // - gldap.BaseObject: only the current object will be searched
 // - gldap.SingleLevel: the current object and its children will be searched
 // - gldap.WholeSubtree: the current object and all its descendants will be searched.
-func (obj Object) search(scope gldap.Scope, filter *ber.Packet) (objects []ldap.Object, err error) {
-	if match, err := filters.Match(&obj, filter); err != nil {
+// If aliases are dereferenced, seen contains the normalized DN of all objects
+// already visited, in order to avoid duplicated results and alias loops.
+func (obj Object) search(scope gldap.Scope, filter *ber.Packet, options ldap.SearchOptions, seen map[string]bool) (objects []ldap.Object, err error) {
+	if seen != nil {
+		dn, _ := ldap.NormalizeDN(obj.DN())
+		if seen[dn] {
+			return nil, nil
+		}
+		seen[dn] = true
+	}
+
+	if match, err := filters.Match(obj.filterable(options), filter); err != nil {
 		return nil, err
 	} else if match && scope != gldap.SingleLevel {
 		objects = append(objects, &obj)
@@ -135,8 +370,38 @@ func (obj Object) search(scope gldap.Scope, filter *ber.Packet) (objects []ldap.
 		// Nothing to do
 	}
 
-	for _, entry := range obj.SubObjects {
-		res, err := entry.search(scope, filter)
+	var candidates map[string]bool
+	narrowed := false
+	if obj.SearchIndex != nil {
+		candidates, narrowed = obj.SearchIndex(filter)
+	}
+
+	for key, entry := range obj.SubObjects {
+		// NOTE: aliases and referrals are not matched against the filter.
+		if narrowed && !candidates[key] && !ldap.IsAlias(entry) && !ldap.IsReferral(entry) {
+			continue
+		}
+
+		if options.DerefAlias != nil && ldap.IsAlias(entry) {
+			// NOTE: aliases that cannot be dereferenced are ignored, like
+			//       entries that don't exist.
+			target, err := options.DerefAlias(entry)
+			if err != nil {
+				continue
+			}
+			// NOTE: only objects of the same implementation can be searched
+			//       through an alias.
+			if entry, _ = target.(*Object); entry == nil {
+				continue
+			}
+		}
+
+		if options.OnReferral != nil && ldap.IsReferral(entry) {
+			options.OnReferral(entry)
+			continue
+		}
+
+		res, err := entry.search(scope, filter, options, seen)
 		switch {
 		case err != nil:
 			return nil, err
@@ -147,6 +412,32 @@ func (obj Object) search(scope gldap.Scope, filter *ber.Packet) (objects []ldap.
 	return objects, nil
 }
 
+// filterable returns the view of the current object used to evaluate search
+// filters, restricted to the attributes allowed by the given options.
+func (obj *Object) filterable(options ldap.SearchOptions) ldap.Object {
+	if options.FilterableAttribute == nil {
+		return obj
+	}
+
+	view := filterableObject{Object: obj, attributes: ldap.Attributes{}}
+	for name, values := range obj.Attributes() {
+		if options.FilterableAttribute(obj, name) {
+			view.attributes[name] = values
+		}
+	}
+	return view
+}
+
+// filterableObject is an object whose attributes are restricted to the ones
+// usable inside a search filter.
+type filterableObject struct {
+	*Object
+	attributes ldap.Attributes
+}
+
+// Attributes returns the list of filterable attributes of the object.
+func (obj filterableObject) Attributes() ldap.Attributes { return obj.attributes }
+
 // AddAttribute adds the given values to the named attribute of the current object.
 func (obj *ImplObject) AddAttribute(name string, values ...string) {
 	if obj.Attributes == nil {
@@ -159,21 +450,141 @@ func (obj *ImplObject) AddAttribute(name string, values ...string) {
 // following the DN suffix order.
 func (obj *ImplObject) AddACLRule(rule ...ACLRule) {
 	obj.ACLs = append(obj.ACLs, rule...)
-	sort.Sort(obj.ACLs)
+	sort.Stable(obj.ACLs)
+}
+
+// Compile parses the DN suffix and the filter of the rule once, so that they
+// are not parsed again each time the rule is evaluated. It returns an error if
+// one of them is invalid.
+func (rule *ACLRule) Compile() error {
+	suffix, err := ldap.ParseDN(rule.DistinguishedNameSuffix)
+	if err != nil {
+		return err
+	}
+
+	compiled := &compiledACLRule{suffix: suffix}
+	if rule.Filter != "" {
+		compiled.filter, err = goldap.CompileFilter(rule.Filter)
+		if err != nil {
+			return fmt.Errorf("invalid filter '%s': %w", rule.Filter, err)
+		}
+	}
+	rule.compiled = compiled
+	return nil
 }
 
-// Less returns true if the suffix of the rule at index i is more precise than
-// the one at index j.
+// target returns the parsed DN suffix and filter of the rule, parsing them if
+// the rule has not been compiled.
+func (rule ACLRule) target() (*compiledACLRule, error) {
+	if rule.compiled == nil {
+		if err := rule.Compile(); err != nil {
+			return nil, err
+		}
+	}
+	return rule.compiled, nil
+}
+
+// Less returns true if the rule at index i comes from a more precise source
+// (see ACLSource) or, for the same source, if it targets more precisely the
+// objects than the one at index j: `self` rules first, then rules with the
+// most precise suffix and, for the same suffix, rules restricted by a filter
+// or a relation.
 func (set ACLRuleSet) Less(i, j int) bool {
-	lhs, rhs := set[i].DistinguishedNameSuffix, set[j].DistinguishedNameSuffix
+	if set[i].Source != set[j].Source {
+		return set[i].Source < set[j].Source
+	}
+	if (set[i].Relation == ACLRelationSelf) != (set[j].Relation == ACLRelationSelf) {
+		return set[i].Relation == ACLRelationSelf
+	}
 
-	if strings.Count(lhs, ",") != strings.Count(rhs, ",") {
-		return strings.Count(lhs, ",") > strings.Count(rhs, ",")
+	// NOTE: invalid suffixes are rejected when the rules are parsed; they are
+	//       considered as empty here.
+	var lhs, rhs ldap.DN
+	if target, err := set[i].target(); err == nil {
+		lhs = target.suffix
 	}
-	if cmp := strings.Compare(lhs, rhs); cmp != 0 {
+	if target, err := set[j].target(); err == nil {
+		rhs = target.suffix
+	}
+
+	if len(lhs) != len(rhs) {
+		return len(lhs) > len(rhs)
+	}
+	if cmp := strings.Compare(lhs.Normalize(), rhs.Normalize()); cmp != 0 {
 		return cmp < 0
 	}
+	if set[i].isRestricted() != set[j].isRestricted() {
+		return set[i].isRestricted()
+	}
+	if (len(set[i].Attributes) == 0) != (len(set[j].Attributes) == 0) {
+		return len(set[i].Attributes) > 0
+	}
 	return !set[i].Allowed
 }
+
+// Match returns the most precise rule granting (or denying) the given
+// capability on the given entry, for the given subject owning the rules. For
+// attribute-level capabilities, the rule must also match the given attribute;
+// secret attributes are only matched by rules explicitly naming them.
+func (set ACLRuleSet) Match(subject ldap.Object, capability ACLCapability, entry ldap.Object, attribute string) (ACLRule, bool) {
+	target, err := ldap.ParseDN(entry.DN())
+	if err != nil {
+		return ACLRule{}, false
+	}
+
+	secret := attribute != "" && isSecretAttribute(entry, attribute)
+	for _, rule := range set {
+		if rule.Capability != capability || !rule.matches(subject, entry, target) {
+			continue
+		}
+
+		switch {
+		case attribute == "",
+			len(rule.Attributes) == 0 && !secret,
+			slices.ContainsFunc(rule.Attributes, func(name string) bool { return strings.EqualFold(name, attribute) }):
+			return rule, true
+		}
+	}
+	return ACLRule{}, false
+}
+
+// matches returns true if the given entry (with the given DN) is targeted by
+// the rule owned by the given subject: the entry must be inside the rule DN
+// suffix, have the rule relation with the subject and match the rule filter.
+func (rule ACLRule) matches(subject, entry ldap.Object, dn ldap.DN) bool {
+	// NOTE: invalid suffixes and filters are rejected when the rules are
+	//       parsed; they never match here.
+	target, err := rule.target()
+	if err != nil || !dn.HasSuffix(target.suffix) {
+		return false
+	}
+
+	switch rule.Relation {
+	case ACLRelationAny:
+		// Nothing to do
+	case ACLRelationSelf:
+		if self, err := ldap.ParseDN(subject.DN()); err != nil || !self.Equal(dn) {
+			return false
+		}
+	case ACLRelationMemberOf:
+		if !hasMember(entry, subject) {
+			return false
+		}
+	}
+
+	if target.filter == nil {
+		return true
+	}
+
+	match, err := filters.Match(entry, target.filter)
+	return err == nil && match
+}
+
+// isRestricted returns true if the rule only targets some objects inside its
+// DN suffix, through a filter or a relation.
+func (rule ACLRule) isRestricted() bool {
+	return rule.Filter != "" || rule.Relation != ACLRelationAny
+}
+
 func (set ACLRuleSet) Len() int      { return len(set) }
 func (set ACLRuleSet) Swap(i, j int) { set[i], set[j] = set[j], set[i] }
@@ -2,11 +2,15 @@
 package common
 
 import (
+	"io"
+	"log/slog"
 	"testing"
 
 	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	ber "github.com/go-asn1-ber/asn1-ber"
 	"github.com/jimlambrt/gldap"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestObjectDN(t *testing.T) {
@@ -124,7 +128,7 @@ func TestObjectSearch(t *testing.T) {
 		var expectedObjects []ldap.Object
 		actualObjects, err := obj.Search(scope, filter)
 
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ldap.ErrInvalidFilter)
 		assert.Equal(t, expectedObjects, actualObjects)
 	})
 
@@ -295,6 +299,51 @@ func TestObjectBindWithHashedPassword(t *testing.T) {
 	}
 }
 
+func TestObjectSameCredentials(t *testing.T) {
+	totp, err := NewTOTP("JBSWY3DPEHPK3PXPJBSWY3DP")
+	require.NoError(t, err)
+	otherTOTP, err := NewTOTP("GEZDGNBVGY3TQOJQGEZDGNBV")
+	require.NoError(t, err)
+
+	obj := &Object{ImplObject: ImplObject{BindPasswords: []string{"password123"}, BindTOTP: totp}}
+
+	tests := []struct {
+		Name           string
+		Other          ldap.Object
+		ExpectedResult bool
+	}{
+		{Name: "Same", Other: &Object{ImplObject: ImplObject{BindPasswords: []string{"password123"}, BindTOTP: totp}}, ExpectedResult: true},
+		{Name: "ChangedPassword", Other: &Object{ImplObject: ImplObject{BindPasswords: []string{"password456"}, BindTOTP: totp}}},
+		{Name: "RemovedPassword", Other: &Object{ImplObject: ImplObject{BindTOTP: totp}}},
+		{Name: "ChangedTOTP", Other: &Object{ImplObject: ImplObject{BindPasswords: []string{"password123"}, BindTOTP: otherTOTP}}},
+		{Name: "RemovedTOTP", Other: &Object{ImplObject: ImplObject{BindPasswords: []string{"password123"}}}},
+		{Name: "Missing", Other: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.ExpectedResult, obj.SameCredentials(tt.Other))
+		})
+	}
+
+	t.Run("RehashedPassword", func(t *testing.T) {
+		store := mockPasswordStore{}
+		policy := &PasswordPolicy{
+			MinStrength: PasswordStrong,
+			Hasher:      func(password string) (string, error) { return "{CRYPT}" + password + "-rehashed", nil },
+			Store:       store,
+			Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		}
+		obj := &Object{ImplObject: ImplObject{DN: "cn=alice", BindPasswords: []string{"password123"}, PasswordPolicy: policy}}
+		valid, err := obj.Bind("password123")
+		require.NoError(t, err)
+		require.True(t, valid)
+
+		assert.True(t, obj.SameCredentials(&Object{ImplObject: ImplObject{BindPasswords: []string{"{CRYPT}password123-rehashed"}}}))
+		assert.False(t, obj.SameCredentials(&Object{ImplObject: ImplObject{BindPasswords: []string{"{CRYPT}password456-rehashed"}}}))
+	})
+}
+
 func TestObjectCanSearchOn(t *testing.T) {
 	obj := Object{
 		ImplObject: ImplObject{
@@ -314,7 +363,7 @@ func TestObjectCanSearchOn(t *testing.T) {
 	t.Run("Test with allowed DN", func(t *testing.T) {
 		dn := "cn=alice,ou=users,dc=example,dc=com"
 		expectedResult := true
-		actualResult := obj.CanSearchOn(dn)
+		actualResult := obj.CanSearchOn(objectWithDN(dn))
 
 		assert.Equal(t, expectedResult, actualResult)
 	})
@@ -322,7 +371,7 @@ func TestObjectCanSearchOn(t *testing.T) {
 	t.Run("Test with disallowed DN", func(t *testing.T) {
 		dn := "cn=alice,dc=example,dc=com"
 		expectedResult := false
-		actualResult := obj.CanSearchOn(dn)
+		actualResult := obj.CanSearchOn(objectWithDN(dn))
 
 		assert.Equal(t, expectedResult, actualResult)
 	})
@@ -330,10 +379,281 @@ func TestObjectCanSearchOn(t *testing.T) {
 	t.Run("Test with no matching ACLs", func(t *testing.T) {
 		dn := "dc=com"
 		expectedResult := false
-		actualResult := obj.CanSearchOn(dn)
+		actualResult := obj.CanSearchOn(objectWithDN(dn))
 
 		assert.Equal(t, expectedResult, actualResult)
 	})
+
+	t.Run("Test with non-normalized DN", func(t *testing.T) {
+		assert.True(t, obj.CanSearchOn(objectWithDN("CN=Alice, OU=Users, DC=Example, DC=Com")))
+	})
+
+	t.Run("Test with partial RDN suffix", func(t *testing.T) {
+		assert.False(t, obj.CanSearchOn(objectWithDN("cn=alice,ou=otherusers,dc=example,dc=com")))
+		assert.False(t, obj.CanSearchOn(objectWithDN("cn=alice,dc=newexample,dc=com")))
+	})
+
+	t.Run("Test with invalid DN", func(t *testing.T) {
+		assert.False(t, obj.CanSearchOn(objectWithDN("alice")))
+	})
+}
+
+func TestObjectCanSearchBelow(t *testing.T) {
+	obj := Object{
+		ImplObject: ImplObject{
+			DN: "cn=alice,ou=users,dc=example,dc=com",
+		},
+	}
+	obj.AddACLRule(
+		ACLRule{DistinguishedNameSuffix: "ou=users,dc=example,dc=com", Allowed: true},
+		ACLRule{DistinguishedNameSuffix: "ou=admins,ou=users,dc=example,dc=com", Allowed: false},
+		ACLRule{DistinguishedNameSuffix: "ou=groups,dc=example,dc=com", Allowed: true, Filter: "(objectClass=posixGroup)"},
+		ACLRule{DistinguishedNameSuffix: "ou=hidden,dc=example,dc=com", Allowed: false},
+		ACLRule{DistinguishedNameSuffix: "ou=private,dc=example,dc=com", Allowed: true, Relation: ACLRelationSelf},
+	)
+
+	t.Run("Test with allowed subtree below", func(t *testing.T) {
+		assert.True(t, obj.CanSearchBelow(objectWithDN("dc=example,dc=com")))
+		assert.True(t, obj.CanSearchBelow(objectWithDN("dc=com")))
+	})
+
+	t.Run("Test with allowed entry", func(t *testing.T) {
+		assert.True(t, obj.CanSearchBelow(objectWithDN("ou=users,dc=example,dc=com")))
+	})
+
+	t.Run("Test with denied entry", func(t *testing.T) {
+		assert.False(t, obj.CanSearchBelow(objectWithDN("ou=admins,ou=users,dc=example,dc=com")))
+		assert.False(t, obj.CanSearchBelow(objectWithDN("ou=hidden,dc=example,dc=com")))
+	})
+
+	t.Run("Test with restricted rule", func(t *testing.T) {
+		assert.True(t, obj.CanSearchBelow(objectWithDN("ou=groups,dc=example,dc=com")))
+	})
+
+	t.Run("Test with self rule", func(t *testing.T) {
+		assert.False(t, obj.CanSearchBelow(objectWithDN("ou=private,dc=example,dc=com")))
+	})
+
+	t.Run("Test with no matching ACLs", func(t *testing.T) {
+		assert.False(t, obj.CanSearchBelow(objectWithDN("dc=org")))
+	})
+
+	t.Run("Test with invalid DN", func(t *testing.T) {
+		assert.False(t, obj.CanSearchBelow(objectWithDN("alice")))
+	})
+}
+
+func TestObjectCanProxyAs(t *testing.T) {
+	obj := Object{
+		ImplObject: ImplObject{
+			ACLs: ACLRuleSet{
+				ACLRule{
+					DistinguishedNameSuffix: "ou=users,dc=example,dc=com",
+					Allowed:                 true,
+					Capability:              ACLProxy,
+				},
+				ACLRule{
+					DistinguishedNameSuffix: "dc=example,dc=com",
+					Allowed:                 true,
+				},
+			},
+		},
+	}
+
+	t.Run("Test with allowed DN", func(t *testing.T) {
+		assert.True(t, obj.CanProxyAs(objectWithDN("cn=alice,ou=users,dc=example,dc=com")))
+	})
+
+	t.Run("Test with search only DN", func(t *testing.T) {
+		assert.False(t, obj.CanProxyAs(objectWithDN("cn=alice,dc=example,dc=com")))
+		assert.True(t, obj.CanSearchOn(objectWithDN("cn=alice,dc=example,dc=com")))
+	})
+
+	t.Run("Test with no matching ACLs", func(t *testing.T) {
+		assert.False(t, obj.CanProxyAs(objectWithDN("dc=com")))
+	})
+}
+
+func TestObjectAttributeACLs(t *testing.T) {
+	alice := &Object{ImplObject: ImplObject{
+		DN: "cn=alice,ou=users,dc=example,dc=com",
+		Attributes: ldap.Attributes{
+			"cn":           {"alice"},
+			"mail":         {"alice@example.com"},
+			"password":     {"alice"},
+			"userPassword": {"{SSHA}..."},
+		},
+		SecretAttributes: []string{"password"},
+	}}
+
+	t.Run("Test without rules", func(t *testing.T) {
+		obj := Object{}
+
+		assert.True(t, obj.CanReadAttribute(alice, "cn"))
+		assert.False(t, obj.CanReadAttribute(alice, "password"))
+		assert.False(t, obj.CanReadAttribute(alice, "USERPASSWORD"))
+		assert.True(t, obj.CanFilterOnAttribute(alice, "mail"))
+		assert.False(t, obj.CanFilterOnAttribute(alice, "userPassword"))
+		assert.False(t, obj.CanCompareAttribute(alice, "password"))
+	})
+
+	t.Run("Test with attribute rules", func(t *testing.T) {
+		obj := Object{}
+		obj.AddACLRule(
+			ACLRule{DistinguishedNameSuffix: "dc=example,dc=com", Allowed: false, Capability: ACLRead},
+			ACLRule{DistinguishedNameSuffix: "dc=example,dc=com", Allowed: true, Capability: ACLRead, Attributes: []string{"cn"}},
+			ACLRule{DistinguishedNameSuffix: "ou=users,dc=example,dc=com", Allowed: true, Capability: ACLFilter, Attributes: []string{"mail"}},
+		)
+
+		assert.True(t, obj.CanReadAttribute(alice, "cn"))
+		assert.False(t, obj.CanReadAttribute(alice, "mail"))
+		assert.True(t, obj.CanFilterOnAttribute(alice, "mail"))
+		assert.True(t, obj.CanFilterOnAttribute(alice, "CN"))
+		assert.False(t, obj.CanCompareAttribute(alice, "mail"))
+	})
+
+	t.Run("Test with wildcard rule on secret attributes", func(t *testing.T) {
+		obj := Object{}
+		obj.AddACLRule(ACLRule{DistinguishedNameSuffix: "dc=com", Allowed: true, Capability: ACLRead})
+
+		assert.True(t, obj.CanReadAttribute(alice, "mail"))
+		assert.False(t, obj.CanReadAttribute(alice, "password"))
+	})
+
+	t.Run("Test with explicit rule on secret attributes", func(t *testing.T) {
+		obj := Object{}
+		obj.AddACLRule(ACLRule{DistinguishedNameSuffix: "dc=com", Allowed: true, Capability: ACLCompare, Attributes: []string{"userPassword"}})
+
+		assert.False(t, obj.CanReadAttribute(alice, "userPassword"))
+		assert.True(t, obj.CanCompareAttribute(alice, "userPassword"))
+	})
+}
+
+func TestObjectACLTargets(t *testing.T) {
+	alice := &Object{ImplObject: ImplObject{
+		DN:         "uid=alice,ou=people,dc=org",
+		Attributes: ldap.Attributes{"uid": {"alice"}, "objectClass": {"posixAccount"}},
+	}}
+	bob := &Object{ImplObject: ImplObject{
+		DN:         "uid=bob,ou=people,dc=org",
+		Attributes: ldap.Attributes{"uid": {"bob"}, "objectClass": {"posixAccount"}},
+	}}
+	admins := &Object{ImplObject: ImplObject{
+		DN:         "cn=admins,ou=group,dc=org",
+		Attributes: ldap.Attributes{"objectClass": {"posixGroup"}, "memberUid": {"alice"}},
+	}}
+	users := &Object{ImplObject: ImplObject{
+		DN:         "cn=users,ou=group,dc=org",
+		Attributes: ldap.Attributes{"objectClass": {"groupOfNames"}, "member": {"UID=Bob, OU=People, DC=Org"}},
+	}}
+
+	t.Run("Test with self target", func(t *testing.T) {
+		alice.ACLs = ACLRuleSet{}
+		alice.AddACLRule(
+			ACLRule{DistinguishedNameSuffix: "dc=org", Allowed: false},
+			ACLRule{Allowed: true, Relation: ACLRelationSelf},
+		)
+
+		assert.True(t, alice.CanSearchOn(alice))
+		assert.True(t, alice.CanSearchOn(objectWithDN("UID=Alice,OU=People,DC=Org")))
+		assert.False(t, alice.CanSearchOn(bob))
+	})
+
+	t.Run("Test with member-of target", func(t *testing.T) {
+		obj := Object{}
+		obj.AddACLRule(ACLRule{DistinguishedNameSuffix: "ou=group,dc=org", Allowed: true, Relation: ACLRelationMemberOf})
+
+		alice.ACLs, bob.ACLs = obj.ACLs, obj.ACLs
+		assert.True(t, alice.CanSearchOn(admins))
+		assert.False(t, alice.CanSearchOn(users))
+		assert.True(t, bob.CanSearchOn(users))
+		assert.False(t, bob.CanSearchOn(admins))
+	})
+
+	t.Run("Test with filter target", func(t *testing.T) {
+		obj := Object{}
+		obj.AddACLRule(
+			ACLRule{DistinguishedNameSuffix: "dc=org", Allowed: true, Capability: ACLRead, Filter: "(objectClass=posixGroup)"},
+			ACLRule{DistinguishedNameSuffix: "dc=org", Allowed: false, Capability: ACLRead},
+		)
+
+		assert.True(t, obj.CanReadAttribute(admins, "cn"))
+		assert.False(t, obj.CanReadAttribute(users, "cn"))
+		assert.False(t, obj.CanReadAttribute(alice, "uid"))
+	})
+
+	t.Run("Test with invalid filter", func(t *testing.T) {
+		obj := Object{ImplObject: ImplObject{ACLs: ACLRuleSet{{Allowed: true, Filter: "(objectClass"}}}}
+
+		assert.False(t, obj.CanSearchOn(admins))
+	})
+}
+
+func TestObjectSearchWithFilterableAttributes(t *testing.T) {
+	obj := Object{ImplObject: ImplObject{
+		DN: "dc=example,dc=com",
+		SubObjects: map[string]*Object{
+			"cn=alice": {ImplObject: ImplObject{
+				DN: "cn=alice,dc=example,dc=com",
+				Attributes: ldap.Attributes{
+					"cn":           {"alice"},
+					"userPassword": {"alice"},
+				},
+			}},
+		},
+	}}
+	requester := Object{}
+
+	for _, filter := range []string{"(userPassword=*)", "(userPassword=alice)", "(&(cn=alice)(userPassword=a*))"} {
+		t.Run(filter, func(t *testing.T) {
+			entries, err := obj.Search(gldap.WholeSubtree, filter, ldap.WithFilterableAttributes(requester.CanFilterOnAttribute))
+			assert.NoError(t, err)
+			assert.Empty(t, entries)
+
+			// NOTE: without restriction, the hidden attribute is used
+			entries, err = obj.Search(gldap.WholeSubtree, filter)
+			assert.NoError(t, err)
+			assert.Len(t, entries, 1)
+		})
+	}
+
+	t.Run("(!(userPassword=alice))", func(t *testing.T) {
+		entries, err := obj.Search(gldap.WholeSubtree, "(&(cn=*)(!(userPassword=alice)))", ldap.WithFilterableAttributes(requester.CanFilterOnAttribute))
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+}
+
+func TestObjectSearchWithSearchIndex(t *testing.T) {
+	obj := Object{ImplObject: ImplObject{
+		DN: "dc=example,dc=com",
+		SubObjects: map[string]*Object{
+			"cn=alice": {ImplObject: ImplObject{DN: "cn=alice,dc=example,dc=com", Attributes: ldap.Attributes{"cn": {"alice"}}}},
+			"cn=bob":   {ImplObject: ImplObject{DN: "cn=bob,dc=example,dc=com", Attributes: ldap.Attributes{"cn": {"bob"}}}},
+		},
+	}}
+
+	t.Run("Narrowed", func(t *testing.T) {
+		obj.SearchIndex = func(*ber.Packet) (map[string]bool, bool) { return map[string]bool{"cn=bob": true}, true }
+
+		entries, err := obj.Search(gldap.WholeSubtree, "(cn=*)")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "cn=bob,dc=example,dc=com", entries[0].DN())
+
+		// NOTE: candidates must still match the filter
+		entries, err = obj.Search(gldap.SingleLevel, "(cn=alice)")
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("NotNarrowed", func(t *testing.T) {
+		obj.SearchIndex = func(*ber.Packet) (map[string]bool, bool) { return nil, false }
+
+		entries, err := obj.Search(gldap.WholeSubtree, "(cn=*)")
+		require.NoError(t, err)
+		assert.Len(t, entries, 2)
+	})
 }
 
 func TestImplObjectAddAttribute(t *testing.T) {
@@ -446,4 +766,54 @@ func TestImplObjectAddACLRule(t *testing.T) {
 
 		assert.Equal(t, expectedACLs, actualACLs)
 	})
+
+	t.Run("Test adding ACL rules with targets", func(t *testing.T) {
+		obj := ImplObject{}
+		obj.AddACLRule(
+			ACLRule{DistinguishedNameSuffix: "dc=com", Allowed: false},
+			ACLRule{DistinguishedNameSuffix: "dc=com", Allowed: true, Filter: "(objectClass=posixGroup)"},
+			ACLRule{DistinguishedNameSuffix: "dc=example,dc=com", Allowed: true, Relation: ACLRelationMemberOf},
+			ACLRule{Allowed: true, Relation: ACLRelationSelf},
+		)
+
+		expectedACLs := ACLRuleSet{
+			{Allowed: true, Relation: ACLRelationSelf},
+			{DistinguishedNameSuffix: "dc=example,dc=com", Allowed: true, Relation: ACLRelationMemberOf},
+			{DistinguishedNameSuffix: "dc=com", Allowed: true, Filter: "(objectClass=posixGroup)"},
+			{DistinguishedNameSuffix: "dc=com", Allowed: false},
+		}
+		assert.Equal(t, expectedACLs, obj.ACLs)
+	})
+}
+
+func TestACLRuleCompile(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		rule := ACLRule{DistinguishedNameSuffix: "ou=people,dc=example,dc=org", Allowed: true, Filter: "(uid=alice)"}
+		require.NoError(t, rule.Compile())
+		require.NotNil(t, rule.compiled)
+
+		alice := &Object{ImplObject: ImplObject{DN: "uid=alice,ou=people,dc=example,dc=org", Attributes: ldap.Attributes{"uid": {"alice"}}}}
+		bob := &Object{ImplObject: ImplObject{DN: "uid=bob,ou=people,dc=example,dc=org", Attributes: ldap.Attributes{"uid": {"bob"}}}}
+		_, match := ACLRuleSet{rule}.Match(alice, ACLSearch, alice, "")
+		assert.True(t, match)
+		_, match = ACLRuleSet{rule}.Match(alice, ACLSearch, bob, "")
+		assert.False(t, match)
+	})
+
+	t.Run("InvalidSuffix", func(t *testing.T) {
+		rule := ACLRule{DistinguishedNameSuffix: "invalid"}
+		assert.Error(t, rule.Compile())
+		assert.Nil(t, rule.compiled)
+	})
+
+	t.Run("InvalidFilter", func(t *testing.T) {
+		rule := ACLRule{Filter: "(uid=alice"}
+		assert.ErrorContains(t, rule.Compile(), "invalid filter '(uid=alice': ")
+		assert.Nil(t, rule.compiled)
+	})
+}
+
+// objectWithDN returns an empty object with the given DN.
+func objectWithDN(dn string) *Object {
+	return &Object{ImplObject: ImplObject{DN: dn}}
 }
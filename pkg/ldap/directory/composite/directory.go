@@ -0,0 +1,279 @@
+package compositedir
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/jimlambrt/gldap"
+)
+
+type (
+	// directory routes all requests to the directories mounted under distinct
+	// naming contexts, based on the DN suffix. Entries outside all mounted
+	// naming contexts are served by the main directory.
+	directory struct {
+		root   *common.Object
+		mounts []*mount
+	}
+
+	// mount is a directory serving all entries below the given suffix, except
+	// the ones below a more specific mount.
+	mount struct {
+		name      string
+		suffix    ldap.DN
+		directory ldap.Directory
+	}
+
+	// entry is an entry with directories mounted below it, whose searches
+	// span all these directories.
+	entry struct {
+		ldap.Object
+
+		dn        ldap.DN
+		owner     *mount
+		directory *directory
+	}
+
+	// Option customizes the composite directory.
+	Option func(directory *directory)
+)
+
+// WithMount mounts the given directory under the given naming context (e.g.
+// `dc=legacy,dc=org`): all entries below it are served by this directory.
+func WithMount(suffix string, dir ldap.Directory) Option {
+	return func(directory *directory) {
+		directory.mounts = append(directory.mounts, &mount{name: suffix, directory: dir})
+	}
+}
+
+// NewDirectory creates a directory serving the entries of the given main
+// directory and of all directories mounted using WithMount. Binds and
+// searches are routed to the directory owning the DN (the most specific
+// mount) and searches from a common parent span all mounted directories.
+// Mounted naming contexts are listed by the `namingContexts` attribute of the
+// root DSE.
+func NewDirectory(main ldap.Directory, opts ...Option) (ldap.Directory, error) {
+	directory := &directory{}
+	for _, opt := range opts {
+		opt(directory)
+	}
+
+	seen := map[string]bool{}
+	for _, mount := range directory.mounts {
+		var err error
+		if mount.suffix, err = ldap.ParseDN(mount.name); err != nil {
+			return nil, fmt.Errorf("invalid mount suffix '%s': %w", mount.name, err)
+		} else if len(mount.suffix) == 0 {
+			return nil, fmt.Errorf("invalid mount suffix '%s': the root DSE cannot be mounted", mount.name)
+		}
+
+		dn := mount.suffix.Normalize()
+		if seen[dn] {
+			return nil, fmt.Errorf("naming context '%s' is mounted several times", mount.name)
+		}
+		seen[dn] = true
+
+		if mount.directory.BaseDN(mount.name) == nil {
+			return nil, fmt.Errorf("invalid mount '%s': no such entry in the mounted directory", mount.name)
+		}
+	}
+
+	// NOTE: mounts are sorted from the most specific suffix in order to find
+	//       the owner of a DN using the first matching suffix. The main
+	//       directory, mounted on the root, always comes last.
+	sort.SliceStable(directory.mounts, func(i, j int) bool {
+		return len(directory.mounts[i].suffix) > len(directory.mounts[j].suffix)
+	})
+	directory.mounts = append(directory.mounts, &mount{suffix: ldap.DN{}, directory: main})
+
+	namingContexts, err := directory.namingContexts()
+	if err != nil {
+		return nil, err
+	}
+	directory.root = &common.Object{
+		ImplObject: common.ImplObject{
+			Attributes: ldap.Attributes{
+				"objectClass":    {"top", "yaLDAPRootDSE"},
+				"namingContexts": namingContexts,
+			},
+		},
+	}
+	return directory, nil
+}
+
+// BaseDN returns the LDAP object represented by the given DN, served by the
+// directory owning it. Entries above mounted naming contexts which don't
+// exist in the main directory are returned as empty glue entries, in order to
+// search from them.
+func (d *directory) BaseDN(dn string) ldap.Object {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return nil
+	}
+
+	owner := d.owner(parsed)
+	switch {
+	case len(parsed) == 0:
+		return &entry{Object: d.root, dn: parsed, owner: owner, directory: d}
+	case !d.hasMountBelow(parsed):
+		// NOTE: objects are returned as is when possible, in order to keep
+		//       their implementation specific behaviors.
+		return owner.directory.BaseDN(dn)
+	}
+
+	if obj := owner.directory.BaseDN(dn); obj != nil {
+		return &entry{Object: obj, dn: parsed, owner: owner, directory: d}
+	}
+	glue := &common.Object{
+		ImplObject: common.ImplObject{
+			DN:         parsed.String(),
+			Attributes: ldap.Attributes{"objectClass": {"top", "glue"}},
+		},
+	}
+	return &entry{Object: glue, dn: parsed, directory: d}
+}
+
+// WatchedFiles returns the files all mounted directories were built from.
+func (d *directory) WatchedFiles() []string {
+	var files []string
+	for _, mount := range d.mounts {
+		if watchable, ok := mount.directory.(ldap.Watchable); ok {
+			files = append(files, watchable.WatchedFiles()...)
+		}
+	}
+	return files
+}
+
+// Close closes all mounted directories.
+func (d *directory) Close() error {
+	errs := make([]error, 0, len(d.mounts))
+	for _, mount := range d.mounts {
+		errs = append(errs, ldap.Close(mount.directory))
+	}
+	return errors.Join(errs...)
+}
+
+// owner returns the mount owning the given DN.
+func (d *directory) owner(dn ldap.DN) *mount {
+	for _, mount := range d.mounts {
+		if dn.HasSuffix(mount.suffix) {
+			return mount
+		}
+	}
+	return nil
+}
+
+// hasMountBelow returns true if a directory is mounted strictly below the
+// given DN.
+func (d *directory) hasMountBelow(dn ldap.DN) bool {
+	for _, mount := range d.mounts {
+		if len(mount.suffix) > len(dn) && mount.suffix.HasSuffix(dn) {
+			return true
+		}
+	}
+	return false
+}
+
+// owned returns the given objects owned by the given mount, dropping the ones
+// served by a more specific mount and the root DSE of the main directory.
+func (d *directory) owned(mount *mount, objects []ldap.Object) []ldap.Object {
+	owned := objects[:0]
+	for _, obj := range objects {
+		dn, err := ldap.ParseDN(obj.DN())
+		if err == nil && len(dn) > 0 && d.owner(dn) == mount {
+			owned = append(owned, obj)
+		}
+	}
+	return owned
+}
+
+// namingContexts returns the DN of all mounted naming contexts and of the
+// top-level entries of the main directory.
+func (d *directory) namingContexts() ([]string, error) {
+	var namingContexts []string
+	for _, mount := range d.mounts[:len(d.mounts)-1] {
+		namingContexts = append(namingContexts, mount.suffix.String())
+	}
+
+	main := d.mounts[len(d.mounts)-1]
+	if root := main.directory.BaseDN(""); root != nil {
+		entries, err := root.Search(gldap.SingleLevel, ldap.MatchAllFilter)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the naming contexts of the main directory: %w", err)
+		}
+		for _, entry := range d.owned(main, entries) {
+			namingContexts = append(namingContexts, entry.DN())
+		}
+	}
+	sort.Strings(namingContexts)
+	return namingContexts, nil
+}
+
+// Search searches the entries below the current one, inside its own directory
+// and inside all directories mounted below it.
+func (e *entry) Search(scope gldap.Scope, filter string, opts ...ldap.SearchOption) ([]ldap.Object, error) {
+	if _, err := goldap.CompileFilter(filter); err != nil {
+		return nil, fmt.Errorf("%w: %w", ldap.ErrInvalidFilter, err)
+	}
+
+	var objects []ldap.Object
+	switch {
+	case len(e.dn) == 0:
+		// NOTE: the root DSE is replaced by the composite one, listing the
+		//       naming contexts of all directories.
+		if scope != gldap.SingleLevel {
+			res, err := e.Object.Search(gldap.BaseObject, filter, opts...)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, res...)
+		}
+		if root := e.owner.directory.BaseDN(""); root != nil {
+			res, err := root.Search(scope, filter, opts...)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, e.directory.owned(e.owner, res)...)
+		}
+	case e.owner != nil:
+		res, err := e.Object.Search(scope, filter, opts...)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, e.directory.owned(e.owner, res)...)
+	}
+
+	for _, mount := range e.directory.mounts {
+		if len(mount.suffix) <= len(e.dn) || !mount.suffix.HasSuffix(e.dn) {
+			continue
+		}
+
+		mountScope := scope
+		switch scope {
+		case gldap.BaseObject:
+			continue
+		case gldap.SingleLevel:
+			if len(mount.suffix) != len(e.dn)+1 {
+				continue
+			}
+			mountScope = gldap.BaseObject
+		case gldap.WholeSubtree:
+			// Nothing to do
+		}
+
+		base := mount.directory.BaseDN(mount.suffix.String())
+		if base == nil {
+			continue
+		}
+		res, err := base.Search(mountScope, filter, opts...)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, e.directory.owned(mount, res)...)
+	}
+	return objects, nil
+}
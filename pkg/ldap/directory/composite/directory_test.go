@@ -0,0 +1,293 @@
+package compositedir
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+	"github.com/jimlambrt/gldap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newYAMLDirectory creates a YAML directory from the given definition.
+func newYAMLDirectory(t *testing.T, raw string) ldap.Directory {
+	directory, err := yamldir.NewDirectoryFromYAML([]byte(raw))
+	require.NoError(t, err)
+	return directory
+}
+
+// newTestDirectory creates a directory where `dc=legacy,dc=home,dc=org` and
+// `dc=archive,dc=net` are mounted on top of the main directory.
+func newTestDirectory(t *testing.T) ldap.Directory {
+	main := newYAMLDirectory(t, `
+dc:org:
+  objectClass: domain
+  dc:home:
+    objectClass: domain
+    cn:alice:
+      objectClass: person
+      userPassword: !!ldap/bind:password alice
+    dc:legacy:
+      objectClass: domain
+      description: shadowed by the legacy directory
+      cn:ghost:
+        objectClass: person
+`)
+	legacy := newYAMLDirectory(t, `
+dc:org:
+  dc:home:
+    dc:legacy:
+      objectClass: domain
+      cn:bob:
+        objectClass: person
+        userPassword: !!ldap/bind:password bob
+`)
+	archive := newYAMLDirectory(t, `
+dc:net:
+  dc:archive:
+    objectClass: domain
+    cn:charlie:
+      objectClass: person
+`)
+
+	directory, err := NewDirectory(main,
+		WithMount("dc=legacy,dc=home,dc=org", legacy),
+		WithMount("DC=Archive,DC=Net", archive),
+	)
+	require.NoError(t, err)
+	return directory
+}
+
+// dns returns the DN of all given objects.
+func dns(objects []ldap.Object) []string {
+	dns := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		dns = append(dns, obj.DN())
+	}
+	return dns
+}
+
+func TestNewDirectory_InvalidMounts(t *testing.T) {
+	main := newYAMLDirectory(t, `
+dc:org:
+  objectClass: domain
+`)
+
+	tests := []struct {
+		Name          string
+		Options       []Option
+		ExpectedError string
+	}{
+		{
+			Name:          "InvalidSuffix",
+			Options:       []Option{WithMount("org", main)},
+			ExpectedError: "invalid mount suffix 'org': invalid DN 'org': missing '=' in 'org'",
+		},
+		{
+			Name:          "RootSuffix",
+			Options:       []Option{WithMount("", main)},
+			ExpectedError: "invalid mount suffix '': the root DSE cannot be mounted",
+		},
+		{
+			Name:          "DuplicatedSuffix",
+			Options:       []Option{WithMount("dc=org", main), WithMount("DC=Org", main)},
+			ExpectedError: "naming context 'DC=Org' is mounted several times",
+		},
+		{
+			Name:          "MissingEntry",
+			Options:       []Option{WithMount("dc=example,dc=org", main)},
+			ExpectedError: "invalid mount 'dc=example,dc=org': no such entry in the mounted directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := NewDirectory(main, tt.Options...)
+			assert.EqualError(t, err, tt.ExpectedError)
+		})
+	}
+}
+
+func TestDirectory_BaseDN(t *testing.T) {
+	directory := newTestDirectory(t)
+
+	tests := []struct {
+		DN       string
+		Expected string
+	}{
+		{DN: "cn=alice,dc=home,dc=org", Expected: "cn=alice,dc=home,dc=org"},
+		{DN: "cn=bob,dc=legacy,dc=home,dc=org", Expected: "cn=bob,dc=legacy,dc=home,dc=org"},
+		{DN: "CN=Charlie,DC=Archive,DC=Net", Expected: "cn=charlie,dc=archive,dc=net"},
+		{DN: "dc=net", Expected: "dc=net"},
+		{DN: "cn=ghost,dc=legacy,dc=home,dc=org"},
+		{DN: "cn=alice,dc=net"},
+		{DN: "dc=example,dc=com"},
+		{DN: "invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.DN, func(t *testing.T) {
+			obj := directory.BaseDN(tt.DN)
+			if tt.Expected == "" {
+				assert.Nil(t, obj)
+			} else {
+				require.NotNil(t, obj)
+				assert.Equal(t, tt.Expected, obj.DN())
+			}
+		})
+	}
+}
+
+func TestDirectory_Bind(t *testing.T) {
+	directory := newTestDirectory(t)
+
+	valid, err := directory.BaseDN("cn=alice,dc=home,dc=org").Bind("alice")
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	valid, err = directory.BaseDN("cn=bob,dc=legacy,dc=home,dc=org").Bind("bob")
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	valid, err = directory.BaseDN("cn=bob,dc=legacy,dc=home,dc=org").Bind("alice")
+	require.NoError(t, err)
+	assert.False(t, valid)
+}
+
+func TestDirectory_Search(t *testing.T) {
+	directory := newTestDirectory(t)
+
+	tests := []struct {
+		BaseDN   string
+		Scope    gldap.Scope
+		Filter   string
+		Expected []string
+	}{
+		{
+			BaseDN:   "",
+			Scope:    gldap.WholeSubtree,
+			Filter:   "(objectClass=person)",
+			Expected: []string{"cn=alice,dc=home,dc=org", "cn=bob,dc=legacy,dc=home,dc=org", "cn=charlie,dc=archive,dc=net"},
+		},
+		{
+			BaseDN:   "",
+			Scope:    gldap.SingleLevel,
+			Filter:   "(objectClass=*)",
+			Expected: []string{"dc=org"},
+		},
+		{
+			BaseDN:   "dc=org",
+			Scope:    gldap.WholeSubtree,
+			Filter:   "(objectClass=person)",
+			Expected: []string{"cn=alice,dc=home,dc=org", "cn=bob,dc=legacy,dc=home,dc=org"},
+		},
+		{
+			BaseDN:   "dc=home,dc=org",
+			Scope:    gldap.SingleLevel,
+			Filter:   "(objectClass=*)",
+			Expected: []string{"cn=alice,dc=home,dc=org", "dc=legacy,dc=home,dc=org"},
+		},
+		{
+			BaseDN:   "dc=home,dc=org",
+			Scope:    gldap.WholeSubtree,
+			Filter:   "(description=*)",
+			Expected: []string{},
+		},
+		{
+			BaseDN:   "dc=home,dc=org",
+			Scope:    gldap.BaseObject,
+			Filter:   "(objectClass=*)",
+			Expected: []string{"dc=home,dc=org"},
+		},
+		{
+			BaseDN:   "dc=net",
+			Scope:    gldap.WholeSubtree,
+			Filter:   "(objectClass=*)",
+			Expected: []string{"dc=archive,dc=net", "cn=charlie,dc=archive,dc=net"},
+		},
+		{
+			BaseDN:   "dc=legacy,dc=home,dc=org",
+			Scope:    gldap.WholeSubtree,
+			Filter:   "(objectClass=person)",
+			Expected: []string{"cn=bob,dc=legacy,dc=home,dc=org"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.BaseDN+tt.Filter, func(t *testing.T) {
+			entries, err := directory.BaseDN(tt.BaseDN).Search(tt.Scope, tt.Filter)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.Expected, dns(entries))
+		})
+	}
+
+	t.Run("InvalidFilter", func(t *testing.T) {
+		_, err := directory.BaseDN("dc=net").Search(gldap.WholeSubtree, "(objectClass=*")
+		assert.ErrorIs(t, err, ldap.ErrInvalidFilter)
+	})
+}
+
+func TestDirectory_RootDSE(t *testing.T) {
+	directory := newTestDirectory(t)
+
+	entries, err := directory.BaseDN("").Search(gldap.BaseObject, "(objectClass=*)")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t,
+		[]string{"DC=Archive,DC=Net", "dc=legacy,dc=home,dc=org", "dc=org"},
+		entries[0].Attributes()["namingContexts"],
+	)
+}
+
+func TestDirectory_WatchedFiles(t *testing.T) {
+	tmp := t.TempDir()
+	description := filepath.Join(tmp, "description.txt")
+	legacy := filepath.Join(tmp, "legacy.yaml")
+	require.NoError(t, os.WriteFile(description, []byte("legacy directory"), 0o600))
+	require.NoError(t, os.WriteFile(legacy, []byte(fmt.Sprintf(
+		"dc:org:\n  dc:legacy:\n    description: {{ readFile %q }}\n", description,
+	)), 0o600))
+
+	main, err := yamldir.NewDirectory("../yaml/fixtures/basic.yaml")
+	require.NoError(t, err)
+	mounted, err := yamldir.NewDirectory(legacy)
+	require.NoError(t, err)
+
+	directory, err := NewDirectory(main,
+		WithMount("dc=legacy,dc=org", mounted),
+		WithMount("dc=archive,dc=net", newYAMLDirectory(t, "dc:net:\n  dc:archive: {}\n")),
+	)
+	require.NoError(t, err)
+
+	require.Implements(t, (*ldap.Watchable)(nil), directory)
+	assert.ElementsMatch(t,
+		[]string{"../yaml/fixtures/basic.yaml", legacy, description},
+		directory.(ldap.Watchable).WatchedFiles(),
+	)
+}
+
+type closableDirectory struct {
+	ldap.Directory
+	closed bool
+}
+
+func (d *closableDirectory) Close() error { d.closed = true; return nil }
+
+func TestDirectory_Close(t *testing.T) {
+	main := &closableDirectory{Directory: newYAMLDirectory(t, "dc:org: {}\n")}
+	mounted := &closableDirectory{Directory: newYAMLDirectory(t, "dc:net:\n  dc:archive: {}\n")}
+
+	directory, err := NewDirectory(main,
+		WithMount("dc=archive,dc=net", mounted),
+		WithMount("dc=legacy,dc=org", newYAMLDirectory(t, "dc:org:\n  dc:legacy: {}\n")),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, ldap.Close(directory))
+	assert.True(t, main.closed)
+	assert.True(t, mounted.closed)
+}
@@ -0,0 +1,345 @@
+package directory
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+type (
+	// DN represents a distinguished name (RFC 4514), from the RDN of the entry
+	// itself to the RDN of the root entry.
+	DN []RDN
+
+	// RDN represents a relative distinguished name, composed of one or
+	// several (multi-valued RDN) attribute type and value pairs.
+	RDN []AttributeTypeAndValue
+
+	// AttributeTypeAndValue represents a single `type=value` pair of a RDN,
+	// with its value unescaped.
+	AttributeTypeAndValue struct {
+		Type  string
+		Value string
+	}
+)
+
+// attributeTypeAliases maps well-known attribute type long names and OIDs to
+// their short name, in order to compare them.
+var attributeTypeAliases = map[string]string{
+	"2.5.4.3":                    "cn",
+	"commonname":                 "cn",
+	"2.5.4.4":                    "sn",
+	"surname":                    "sn",
+	"2.5.4.6":                    "c",
+	"countryname":                "c",
+	"2.5.4.7":                    "l",
+	"localityname":               "l",
+	"2.5.4.8":                    "st",
+	"stateorprovincename":        "st",
+	"2.5.4.10":                   "o",
+	"organizationname":           "o",
+	"2.5.4.11":                   "ou",
+	"organizationalunitname":     "ou",
+	"0.9.2342.19200300.100.1.1":  "uid",
+	"userid":                     "uid",
+	"0.9.2342.19200300.100.1.25": "dc",
+	"domaincomponent":            "dc",
+	"0.9.2342.19200300.100.1.3":  "mail",
+	"rfc822mailbox":              "mail",
+}
+
+// attributeValueNormalizers maps attribute types to the function used to
+// normalize their values, following their equality matching rule. Attribute
+// types not listed here use the caseIgnoreMatch rule.
+var attributeValueNormalizers = map[string]func(string) string{
+	// caseExactIA5Match (RFC 2307)
+	"automountkey":  normalizeCaseExact,
+	"homedirectory": normalizeCaseExact,
+	"loginshell":    normalizeCaseExact,
+	"memberuid":     normalizeCaseExact,
+	// integerMatch (RFC 2307)
+	"gidnumber": normalizeNumeric,
+	"uidnumber": normalizeNumeric,
+	// telephoneNumberMatch
+	"telephonenumber": normalizeTelephoneNumber,
+}
+
+// ParseDN parses the given string representation of a distinguished name
+// (RFC 4514). Spaces around separators are ignored and `;` is accepted as RDN
+// separator (RFC 2253).
+func ParseDN(str string) (DN, error) {
+	dn := DN{}
+	if strings.TrimSpace(str) == "" {
+		return dn, nil
+	}
+
+	rdn := RDN{}
+	for i := 0; ; {
+		atv, n, err := parseAttributeTypeAndValue(str[i:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid DN '%s': %w", str, err)
+		}
+		rdn = append(rdn, atv)
+		i += n
+
+		if i >= len(str) {
+			return append(dn, rdn), nil
+		}
+
+		switch str[i] {
+		case '+':
+			// multi-valued RDN; nothing to do
+		case ',', ';':
+			dn = append(dn, rdn)
+			rdn = RDN{}
+		}
+		i++
+	}
+}
+
+// NormalizeDN returns the normalized form of the given string representation
+// of a distinguished name (see DN.Normalize).
+func NormalizeDN(str string) (string, error) {
+	dn, err := ParseDN(str)
+	if err != nil {
+		return "", err
+	}
+	return dn.Normalize(), nil
+}
+
+// parseAttributeTypeAndValue parses the first `type=value` pair of the given
+// string and returns it with the position of the separator that follows it
+// (or the end of the string).
+func parseAttributeTypeAndValue(str string) (AttributeTypeAndValue, int, error) {
+	eq := strings.IndexByte(str, '=')
+	if eq < 0 {
+		return AttributeTypeAndValue{}, 0, fmt.Errorf("missing '=' in '%s'", str)
+	}
+
+	atv := AttributeTypeAndValue{Type: strings.TrimSpace(str[:eq])}
+	if !isValidAttributeType(atv.Type) {
+		return AttributeTypeAndValue{}, 0, fmt.Errorf("invalid attribute type '%s'", atv.Type)
+	}
+
+	i := eq + 1
+	for i < len(str) && str[i] == ' ' {
+		i++
+	}
+
+	// NOTE: values starting with '#' are hex encoded BER values.
+	if i < len(str) && str[i] == '#' {
+		end := i + 1
+		for end < len(str) && isHexDigit(str[end]) {
+			end++
+		}
+
+		raw, err := hex.DecodeString(str[i+1 : end])
+		if err != nil {
+			return AttributeTypeAndValue{}, 0, fmt.Errorf("invalid hex value for '%s': %w", atv.Type, err)
+		}
+		packet, err := ber.DecodePacketErr(raw)
+		if err != nil {
+			return AttributeTypeAndValue{}, 0, fmt.Errorf("invalid BER value for '%s': %w", atv.Type, err)
+		}
+		atv.Value = packet.Data.String()
+
+		for end < len(str) && str[end] == ' ' {
+			end++
+		}
+		if end < len(str) && !strings.ContainsRune(",;+", rune(str[end])) {
+			return AttributeTypeAndValue{}, 0, fmt.Errorf("unexpected character '%c' after hex value of '%s'", str[end], atv.Type)
+		}
+		return atv, end, nil
+	}
+
+	var value strings.Builder
+	trailingSpaces := 0
+	for ; i < len(str); i++ {
+		switch char := str[i]; char {
+		case ',', ';', '+':
+			atv.Value = value.String()[:value.Len()-trailingSpaces]
+			return atv, i, nil
+		case '"', '<', '>':
+			return AttributeTypeAndValue{}, 0, fmt.Errorf("unescaped '%c' in value of '%s'", char, atv.Type)
+		case '\\':
+			if i+1 >= len(str) {
+				return AttributeTypeAndValue{}, 0, fmt.Errorf("unterminated escape sequence in value of '%s'", atv.Type)
+			}
+			trailingSpaces = 0
+
+			if strings.ContainsRune(` "#+,;<=>\`, rune(str[i+1])) {
+				value.WriteByte(str[i+1])
+				i++
+				continue
+			}
+
+			if i+2 >= len(str) || !isHexDigit(str[i+1]) || !isHexDigit(str[i+2]) {
+				return AttributeTypeAndValue{}, 0, fmt.Errorf("invalid escape sequence in value of '%s'", atv.Type)
+			}
+			b, _ := hex.DecodeString(str[i+1 : i+3])
+			value.Write(b)
+			i += 2
+		case ' ':
+			trailingSpaces++
+			value.WriteByte(char)
+		default:
+			trailingSpaces = 0
+			value.WriteByte(char)
+		}
+	}
+
+	atv.Value = value.String()[:value.Len()-trailingSpaces]
+	return atv, len(str), nil
+}
+
+// isValidAttributeType returns true if the given string is a valid attribute
+// type, either a descriptor (e.g. `cn`) or a numeric OID (e.g. `2.5.4.3`).
+func isValidAttributeType(typ string) bool {
+	typ = strings.TrimPrefix(strings.TrimPrefix(typ, "OID."), "oid.")
+	if typ == "" {
+		return false
+	}
+
+	if unicode.IsLetter(rune(typ[0])) {
+		return strings.IndexFunc(typ, func(r rune) bool {
+			return r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-')
+		}) < 0
+	}
+	return strings.IndexFunc(typ, func(r rune) bool { return !(r >= '0' && r <= '9' || r == '.') }) < 0 &&
+		!strings.Contains(typ, "..") && !strings.HasSuffix(typ, ".")
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// String returns the string representation (RFC 4514) of the DN, keeping the
+// attribute types and values as they were given.
+func (dn DN) String() string {
+	rdns := make([]string, len(dn))
+	for i, rdn := range dn {
+		rdns[i] = rdn.String()
+	}
+	return strings.Join(rdns, ",")
+}
+
+// Normalize returns the normalized string representation of the DN, used to
+// compare DNs: attribute types are lower-cased and resolved to their short
+// name, values are normalized following the matching rule of their type and
+// multi-valued RDNs are sorted.
+func (dn DN) Normalize() string {
+	rdns := make([]string, len(dn))
+	for i, rdn := range dn {
+		rdns[i] = rdn.Normalize()
+	}
+	return strings.Join(rdns, ",")
+}
+
+// Equal returns true if both DNs are the same once normalized.
+func (dn DN) Equal(other DN) bool {
+	return len(dn) == len(other) && dn.Normalize() == other.Normalize()
+}
+
+// HasSuffix returns true if the DN is equal to or a descendant of the given DN,
+// comparing whole RDNs (`dc=org` is not a suffix of `dc=neworg`).
+func (dn DN) HasSuffix(suffix DN) bool {
+	if len(suffix) > len(dn) {
+		return false
+	}
+	return dn[len(dn)-len(suffix):].Equal(suffix)
+}
+
+// Parent returns the DN of the parent entry, or an empty DN for the root entry.
+func (dn DN) Parent() DN {
+	if len(dn) == 0 {
+		return DN{}
+	}
+	return dn[1:]
+}
+
+// String returns the string representation (RFC 4514) of the RDN.
+func (rdn RDN) String() string {
+	atvs := make([]string, len(rdn))
+	for i, atv := range rdn {
+		atvs[i] = atv.String()
+	}
+	return strings.Join(atvs, "+")
+}
+
+// Normalize returns the normalized string representation of the RDN.
+func (rdn RDN) Normalize() string {
+	atvs := make([]string, len(rdn))
+	for i, atv := range rdn {
+		atvs[i] = atv.Normalize()
+	}
+	sort.Strings(atvs)
+	return strings.Join(atvs, "+")
+}
+
+// String returns the string representation (RFC 4514) of the pair, with its
+// value escaped.
+func (atv AttributeTypeAndValue) String() string {
+	return atv.Type + "=" + escapeDNValue(atv.Value)
+}
+
+// Normalize returns the normalized string representation of the pair.
+func (atv AttributeTypeAndValue) Normalize() string {
+	typ := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(atv.Type, "OID."), "oid."))
+	if alias, exists := attributeTypeAliases[typ]; exists {
+		typ = alias
+	}
+
+	normalize, exists := attributeValueNormalizers[typ]
+	if !exists {
+		normalize = normalizeCaseIgnore
+	}
+	return typ + "=" + escapeDNValue(normalize(atv.Value))
+}
+
+// escapeDNValue escapes the given attribute value following RFC 4514.
+func escapeDNValue(value string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch char := value[i]; {
+		case char == '"' || char == '+' || char == ',' || char == ';' || char == '<' || char == '>' || char == '\\':
+			escaped.WriteByte('\\')
+			escaped.WriteByte(char)
+		case i == 0 && (char == ' ' || char == '#'):
+			escaped.WriteByte('\\')
+			escaped.WriteByte(char)
+		case i == len(value)-1 && char == ' ':
+			escaped.WriteByte('\\')
+			escaped.WriteByte(char)
+		case char < ' ' || char == 0x7f:
+			fmt.Fprintf(&escaped, "\\%02x", char)
+		default:
+			escaped.WriteByte(char)
+		}
+	}
+	return escaped.String()
+}
+
+// normalizeCaseExact removes the insignificant spaces of the given value.
+func normalizeCaseExact(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// normalizeCaseIgnore removes the insignificant spaces of the given value and
+// folds its case.
+func normalizeCaseIgnore(value string) string {
+	return strings.ToLower(normalizeCaseExact(value))
+}
+
+// normalizeNumeric removes all spaces of the given value.
+func normalizeNumeric(value string) string {
+	return strings.Join(strings.Fields(value), "")
+}
+
+// normalizeTelephoneNumber removes all spaces and hyphens of the given value.
+func normalizeTelephoneNumber(value string) string {
+	return strings.ReplaceAll(normalizeNumeric(value), "-", "")
+}
@@ -0,0 +1,177 @@
+package directory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDN(t *testing.T) {
+	tests := []struct {
+		Name          string
+		DN            string
+		ExpectedDN    DN
+		ExpectedError string
+	}{
+		{
+			Name:       "Test with empty DN",
+			DN:         "",
+			ExpectedDN: DN{},
+		},
+		{
+			Name: "Test with simple DN",
+			DN:   "cn=alice,ou=people,dc=example,dc=org",
+			ExpectedDN: DN{
+				{{Type: "cn", Value: "alice"}},
+				{{Type: "ou", Value: "people"}},
+				{{Type: "dc", Value: "example"}},
+				{{Type: "dc", Value: "org"}},
+			},
+		},
+		{
+			Name: "Test with spaces around separators",
+			DN:   " CN = Alice Doe ,  OU=People ; dc=org ",
+			ExpectedDN: DN{
+				{{Type: "CN", Value: "Alice Doe"}},
+				{{Type: "OU", Value: "People"}},
+				{{Type: "dc", Value: "org"}},
+			},
+		},
+		{
+			Name: "Test with multi-valued RDN",
+			DN:   "cn=alice+uid=alice,dc=org",
+			ExpectedDN: DN{
+				{{Type: "cn", Value: "alice"}, {Type: "uid", Value: "alice"}},
+				{{Type: "dc", Value: "org"}},
+			},
+		},
+		{
+			Name: "Test with escaped characters",
+			DN:   `cn=Doe\, John \+ \"Jr\"\ ,cn=\#hash,cn=caf\c3\a9,dc=org`,
+			ExpectedDN: DN{
+				{{Type: "cn", Value: `Doe, John + "Jr" `}},
+				{{Type: "cn", Value: "#hash"}},
+				{{Type: "cn", Value: "café"}},
+				{{Type: "dc", Value: "org"}},
+			},
+		},
+		{
+			Name: "Test with hex encoded BER value",
+			DN:   "cn=#04056168656c6c,dc=org",
+			ExpectedDN: DN{
+				{{Type: "cn", Value: "ahell"}},
+				{{Type: "dc", Value: "org"}},
+			},
+		},
+		{
+			Name: "Test with OID attribute type",
+			DN:   "2.5.4.3=alice,dc=org",
+			ExpectedDN: DN{
+				{{Type: "2.5.4.3", Value: "alice"}},
+				{{Type: "dc", Value: "org"}},
+			},
+		},
+		{
+			Name:          "Test with missing value",
+			DN:            "alice",
+			ExpectedError: "invalid DN 'alice': missing '=' in 'alice'",
+		},
+		{
+			Name:          "Test with trailing separator",
+			DN:            "cn=alice,",
+			ExpectedError: "invalid DN 'cn=alice,': missing '=' in ''",
+		},
+		{
+			Name:          "Test with invalid attribute type",
+			DN:            "c n=alice",
+			ExpectedError: "invalid DN 'c n=alice': invalid attribute type 'c n'",
+		},
+		{
+			Name:          "Test with unescaped special character",
+			DN:            "cn=<alice>",
+			ExpectedError: "invalid DN 'cn=<alice>': unescaped '<' in value of 'cn'",
+		},
+		{
+			Name:          "Test with invalid escape sequence",
+			DN:            `cn=alice\zz`,
+			ExpectedError: `invalid DN 'cn=alice\zz': invalid escape sequence in value of 'cn'`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			dn, err := ParseDN(tt.DN)
+
+			if tt.ExpectedError != "" {
+				assert.EqualError(t, err, tt.ExpectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.ExpectedDN, dn)
+		})
+	}
+}
+
+func TestDN_String(t *testing.T) {
+	dn := DN{
+		{{Type: "cn", Value: `Doe, John + "Jr" `}, {Type: "uid", Value: "#jdoe"}},
+		{{Type: "OU", Value: "People"}},
+		{{Type: "dc", Value: "org"}},
+	}
+	assert.Equal(t, `cn=Doe\, John \+ \"Jr\"\ +uid=\#jdoe,OU=People,dc=org`, dn.String())
+
+	parsed, err := ParseDN(dn.String())
+	require.NoError(t, err)
+	assert.Equal(t, dn, parsed)
+}
+
+func TestDN_Normalize(t *testing.T) {
+	tests := []struct {
+		DN       string
+		Expected string
+	}{
+		{DN: "cn=alice,ou=people,dc=example,dc=org", Expected: "cn=alice,ou=people,dc=example,dc=org"},
+		{DN: "CN=Alice,  OU=People, DC=Example, DC=ORG", Expected: "cn=alice,ou=people,dc=example,dc=org"},
+		{DN: "commonName=Alice  Doe,2.5.4.11=people", Expected: "cn=alice doe,ou=people"},
+		{DN: "uid=alice+cn=Alice,dc=org", Expected: "cn=alice+uid=alice,dc=org"},
+		{DN: `cn=Doe\2c John,dc=org`, Expected: `cn=doe\, john,dc=org`},
+		{DN: "memberUid=Alice,dc=org", Expected: "memberuid=Alice,dc=org"},
+		{DN: "uidNumber= 1 000 ,dc=org", Expected: "uidnumber=1000,dc=org"},
+		{DN: `telephoneNumber=\+1 555-0100,dc=org`, Expected: `telephonenumber=\+15550100,dc=org`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.DN, func(t *testing.T) {
+			actual, err := NormalizeDN(tt.DN)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Expected, actual)
+		})
+	}
+}
+
+func TestDN_HasSuffix(t *testing.T) {
+	mustParse := func(str string) DN {
+		dn, err := ParseDN(str)
+		require.NoError(t, err)
+		return dn
+	}
+	dn := mustParse("cn=alice,ou=people,dc=example,dc=org")
+
+	assert.True(t, dn.HasSuffix(mustParse("dc=org")))
+	assert.True(t, dn.HasSuffix(mustParse("OU=People, DC=Example, DC=Org")))
+	assert.True(t, dn.HasSuffix(mustParse(dn.String())))
+	assert.True(t, dn.HasSuffix(mustParse("")))
+	assert.False(t, dn.HasSuffix(mustParse("cn=ice,ou=people,dc=example,dc=org")))
+	assert.False(t, mustParse("cn=x,dc=neworg").HasSuffix(mustParse("dc=org")))
+	assert.False(t, mustParse("dc=org").HasSuffix(dn))
+}
+
+func TestDN_Parent(t *testing.T) {
+	dn, err := ParseDN("cn=alice,ou=people,dc=org")
+	require.NoError(t, err)
+
+	assert.Equal(t, "ou=people,dc=org", dn.Parent().String())
+	assert.Equal(t, "", dn.Parent().Parent().Parent().String())
+	assert.Equal(t, DN{}, DN{}.Parent())
+}
@@ -0,0 +1,39 @@
+package ldifdir
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+)
+
+// Backend serves the directory described by an LDIF file.
+type Backend struct{}
+
+//nolint:gochecknoinits
+func init() {
+	ldap.RegisterBackend(
+		ldap.BackendInfo{
+			Name:        "ldif",
+			Description: "Directory described by an LDIF file (e.g. 'ldif:///etc/yaldap/directory.ldif')",
+			Schemes:     []string{"ldif"},
+		},
+		&Backend{},
+	)
+}
+
+// Validate checks that the LDIF file exists.
+func (Backend) Validate(url string) error {
+	if _, err := os.Stat(filePath(url)); err != nil {
+		return fmt.Errorf("unable to read LDIF file: %w", err)
+	}
+	return nil
+}
+
+// NewDirectory creates the directory described by the LDIF file located at
+// the given URL, enforcing the password policy carried by the given context.
+func (Backend) NewDirectory(ctx context.Context, url string) (ldap.Directory, error) {
+	return NewDirectory(url, WithPasswordPolicy(common.PasswordPolicyFromContext(ctx)))
+}
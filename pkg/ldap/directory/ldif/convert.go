@@ -0,0 +1,553 @@
+package ldifdir
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// converter converts LDIF records into a YAML directory definition.
+	converter struct {
+		translateOLCAccess bool
+
+		root    *yamlEntry
+		defined map[string]int
+
+		// policy contains the ACL rules applying to the whole directory,
+		// indexed by subject (in order of definition).
+		policy   map[string][]*yaml.Node
+		subjects []string
+
+		// databases contains the OpenLDAP databases (from `cn=config`
+		// entries) defining `olcAccess` rules.
+		databases []olcDatabase
+
+		// warnings contains what cannot be converted outside of the entries,
+		// written at the top of the YAML definition.
+		warnings []string
+	}
+
+	// ConvertOption customizes the conversion of LDIF records into YAML.
+	ConvertOption func(converter *converter)
+
+	// yamlEntry represents an LDAP entry, as described by the YAML format.
+	yamlEntry struct {
+		key      string
+		dn       string
+		defined  bool
+		merge    *yaml.Node
+		tags     []yamlAttribute
+		attrs    []yamlAttribute
+		children []*yamlEntry
+		index    map[string]*yamlEntry
+		warnings []string
+	}
+
+	// yamlAttribute represents an attribute of a YAML entry, with its values.
+	yamlAttribute struct {
+		name   string
+		values []*yaml.Node
+	}
+)
+
+// operationalAttributes lists the operational attributes dumped by LDAP
+// servers (e.g. by `slapcat`), which are maintained by the server itself and
+// therefore not converted.
+var operationalAttributes = []string{
+	"contextCSN", "createTimestamp", "creatorsName", "entryCSN", "entryDN", "entryUUID", "hasSubordinates",
+	"modifiersName", "modifyTimestamp", "pwdChangedTime", "structuralObjectClass", "subschemaSubentry",
+}
+
+// anchorNameRegex matches all characters not allowed inside a YAML anchor name
+// generated by the converter.
+var anchorNameRegex = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// WithOLCAccess translates the simple `olcAccess` rules of the OpenLDAP
+// databases (defined by `cn=config` entries) into the ACL policy.
+func WithOLCAccess() ConvertOption {
+	return func(converter *converter) { converter.translateOLCAccess = true }
+}
+
+// Convert writes the YAML directory definition describing all entries of the
+// given LDIF documents (e.g. dumped by `slapcat`). Entries are nested by RDN,
+// the `userPassword` attribute becomes the bind password (with its hash
+// converted by common.ConvertPasswordHash) and attribute blocks shared by
+// several entries are factored into YAML anchors. The `# yaldap:` directives
+// are kept as tagged values, so that an exported directory can be converted
+// back without loss.
+// Entries of the OpenLDAP configuration (`cn=config`) are never converted.
+func Convert(w io.Writer, documents [][]byte, opts ...ConvertOption) error {
+	converter := &converter{
+		root:    &yamlEntry{index: map[string]*yamlEntry{}},
+		defined: map[string]int{},
+		policy:  map[string][]*yaml.Node{},
+	}
+	for _, opt := range opts {
+		opt(converter)
+	}
+
+	for _, raw := range documents {
+		records, globals, err := parseLDIF(raw, new([]string))
+		if err != nil {
+			return err
+		}
+
+		for _, directive := range globals {
+			if _, err := yamldir.ParseACLPolicyValue(directive.value, directive.line, directive.column); err != nil {
+				return &ParseError{err: err, line: directive.line}
+			}
+
+			node, err := decodeDirective(directive)
+			if err != nil {
+				return err
+			}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				rules := []*yaml.Node{node.Content[i+1]}
+				if node.Content[i+1].Kind == yaml.SequenceNode {
+					rules = node.Content[i+1].Content
+				}
+				converter.addPolicyRules(node.Content[i].Value, rules...)
+			}
+		}
+
+		for _, record := range records {
+			if err := converter.convertRecord(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	if converter.translateOLCAccess {
+		for _, database := range converter.databases {
+			if len(database.access) > 0 && len(converter.warnings) == 0 {
+				converter.addWarning("NOTE: the ACL policy is translated from olcAccess rules; OpenLDAP applies the first matching rule\n" +
+					"#       while yaLDAP applies the most specific one, so it must be reviewed.")
+			}
+			database.translate(converter)
+		}
+	}
+	converter.factorAttributes()
+
+	document := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{converter.root.node()}}
+	for _, warning := range converter.warnings {
+		document.HeadComment += "# " + warning + "\n"
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	if len(converter.subjects) > 0 {
+		if err := encoder.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{converter.policyNode()}}); err != nil {
+			return err
+		}
+	}
+	return encoder.Close()
+}
+
+// addWarning adds the given warning at the top of the YAML definition.
+func (c *converter) addWarning(warning string) {
+	c.warnings = append(c.warnings, warning)
+}
+
+// addPolicyRules adds the given ACL rules to the policy of the given subject.
+func (c *converter) addPolicyRules(subject string, rules ...*yaml.Node) {
+	if _, exists := c.policy[subject]; !exists {
+		c.subjects = append(c.subjects, subject)
+	}
+	c.policy[subject] = append(c.policy[subject], rules...)
+}
+
+// policyNode returns the YAML node describing the ACL policy.
+func (c *converter) policyNode() *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!ldap/acl:policy"}
+	for _, subject := range c.subjects {
+		node.Content = append(node.Content, scalarNode(subject), yamlAttribute{values: c.policy[subject]}.node())
+	}
+	return node
+}
+
+// convertRecord adds the entry described by the given LDIF record inside the
+// YAML tree.
+func (c *converter) convertRecord(record record) error {
+	dn, err := ldap.ParseDN(record.dn)
+	switch {
+	case err != nil:
+		return &ParseError{err: fmt.Errorf("invalid DN '%s': %w", record.dn, err), line: record.line}
+	case len(dn) == 0:
+		return &ParseError{err: fmt.Errorf("invalid DN: the root DSE cannot be defined"), line: record.line}
+	case strings.EqualFold(dn[len(dn)-1].String(), "cn=config"):
+		// NOTE: the OpenLDAP configuration only describes the server, not the
+		//       directory itself.
+		c.databases = append(c.databases, newOLCDatabase(record))
+		return nil
+	}
+
+	if line, exists := c.defined[dn.Normalize()]; exists {
+		return &ParseError{err: fmt.Errorf("entry '%s' is already defined at line %d", record.dn, line), line: record.line}
+	}
+	c.defined[dn.Normalize()] = record.line
+
+	entry, err := c.lookupOrCreate(dn)
+	if err != nil {
+		return &ParseError{err: err, line: record.line}
+	}
+	entry.defined = true
+
+	rdn := dn[0][0]
+	for _, attr := range record.attributes {
+		switch {
+		case slices.ContainsFunc(operationalAttributes, func(name string) bool { return strings.EqualFold(name, attr.name) }):
+			continue
+		case !utf8.ValidString(attr.value):
+			entry.warnings = append(entry.warnings, fmt.Sprintf("WARNING: binary value of '%s' skipped, YAML can only describe UTF-8 values", attr.name))
+			continue
+		case strings.EqualFold(attr.name, rdn.Type):
+			// NOTE: the RDN value is already defined by the YAML key.
+			if attr.value == rdn.Value {
+				continue
+			}
+			attr.name = rdn.Type
+		}
+		entry.addValue(attr.name, scalarNode(attr.value))
+	}
+
+	bindPassword := false
+	for _, directive := range record.directives {
+		if err := yamldir.ParseTaggedValue(&common.Object{ImplObject: common.ImplObject{Attributes: ldap.Attributes{}}}, directive.value, directive.line, directive.column); err != nil {
+			return &ParseError{err: err, line: directive.line}
+		}
+
+		node, err := decodeDirective(directive)
+		if err != nil {
+			return err
+		}
+		switch {
+		case node.Kind == yaml.MappingNode:
+			entry.addValue(node.Content[0].Value, node.Content[1])
+			bindPassword = true
+		case node.Tag == "!!ldap/bind:password":
+			entry.tags = append(entry.tags, yamlAttribute{name: ".#password", values: []*yaml.Node{node}})
+			bindPassword = true
+		case node.Tag == "!!ldap/bind:totp":
+			entry.tags = append(entry.tags, yamlAttribute{name: ".#totp", values: []*yaml.Node{node}})
+		default:
+			entry.addTag(".#acl", node)
+		}
+	}
+
+	if !bindPassword {
+		entry.tagBindPassword()
+	}
+	return nil
+}
+
+// lookupOrCreate returns the YAML entry with the given DN, creating it (and
+// its missing ancestors) if needed.
+func (c *converter) lookupOrCreate(dn ldap.DN) (*yamlEntry, error) {
+	entry := c.root
+	for i := len(dn) - 1; i >= 0; i-- {
+		rdn := dn[i]
+		switch {
+		case len(rdn) > 1:
+			return nil, fmt.Errorf("unsupported DN '%s': multi-valued RDNs cannot be described in YAML", dn)
+		case strings.Contains(rdn[0].Type+rdn[0].Value, ":"):
+			return nil, fmt.Errorf("unsupported DN '%s': RDNs containing ':' cannot be described in YAML", dn)
+		}
+
+		child, exists := entry.index[rdn.Normalize()]
+		if !exists {
+			child = &yamlEntry{
+				key:   rdn[0].Type + ":" + rdn[0].Value,
+				dn:    dn[i:].String(),
+				index: map[string]*yamlEntry{},
+			}
+			entry.index[rdn.Normalize()] = child
+			entry.children = append(entry.children, child)
+		}
+		entry = child
+	}
+	return entry, nil
+}
+
+// hasChildren returns true if the entry with the given DN has been converted
+// with children.
+func (c *converter) hasChildren(dn string) bool {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return false
+	}
+
+	entry := c.root
+	for i := len(parsed) - 1; i >= 0; i-- {
+		child, exists := entry.index[parsed[i].Normalize()]
+		if !exists {
+			return false
+		}
+		entry = child
+	}
+	return len(entry.children) > 0
+}
+
+// factorAttributes factors the attribute blocks shared by several entries
+// into YAML anchors, merged into these entries. A block contains all
+// attributes of an entry (at least two) whose values are shared with other
+// entries of the same object classes.
+func (c *converter) factorAttributes() {
+	var entries []*yamlEntry
+	var walk func(entry *yamlEntry)
+	walk = func(entry *yamlEntry) {
+		if entry.defined {
+			entries = append(entries, entry)
+		}
+		for _, child := range entry.children {
+			walk(child)
+		}
+	}
+	walk(c.root)
+
+	shared := map[string]int{}
+	for _, entry := range entries {
+		for _, attr := range entry.attrs {
+			if key, ok := attr.blockKey(); ok {
+				shared[entry.objectClasses()+key]++
+			}
+		}
+	}
+	isShared := func(entry *yamlEntry, attr yamlAttribute) bool {
+		key, ok := attr.blockKey()
+		return ok && shared[entry.objectClasses()+key] > 1
+	}
+
+	blocks := map[string]int{}
+	entryBlocks := make([]string, len(entries))
+	for i, entry := range entries {
+		var keys []string
+		for _, attr := range entry.attrs {
+			if isShared(entry, attr) {
+				key, _ := attr.blockKey()
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) > 1 {
+			slices.Sort(keys)
+			entryBlocks[i] = strings.Join(keys, "\x01")
+			blocks[entryBlocks[i]]++
+		}
+	}
+
+	anchors := map[string]*yaml.Node{}
+	names := map[string]bool{}
+	for i, entry := range entries {
+		block := entryBlocks[i]
+		if block == "" || blocks[block] < 2 {
+			continue
+		}
+
+		var own, factored []yamlAttribute
+		for _, attr := range entry.attrs {
+			if isShared(entry, attr) {
+				factored = append(factored, attr)
+			} else {
+				own = append(own, attr)
+			}
+		}
+		entry.attrs = own
+
+		anchor, exists := anchors[block]
+		if !exists {
+			anchor = &yaml.Node{Kind: yaml.MappingNode, Anchor: anchorName(factored, names)}
+			for _, attr := range factored {
+				anchor.Content = append(anchor.Content, scalarNode(attr.name), attr.node())
+			}
+			anchors[block] = anchor
+			entry.merge = anchor
+			continue
+		}
+		entry.merge = &yaml.Node{Kind: yaml.AliasNode, Alias: anchor, Value: anchor.Anchor}
+	}
+}
+
+// anchorName returns a unique anchor name for the given attribute block,
+// based on its most specific object class if any.
+func anchorName(block []yamlAttribute, names map[string]bool) string {
+	name := "attributes"
+	for _, attr := range block {
+		if !isObjectClass(attr.name) {
+			continue
+		}
+		for _, value := range attr.values {
+			if !strings.EqualFold(value.Value, "top") {
+				name = anchorNameRegex.ReplaceAllString(value.Value, "-")
+				break
+			}
+		}
+		break
+	}
+
+	unique := name
+	for i := 2; names[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+	names[unique] = true
+	return unique
+}
+
+// addValue adds the given value to the attribute with the given name
+// (case-insensitive), skipping duplicated values.
+func (e *yamlEntry) addValue(name string, value *yaml.Node) {
+	for i, attr := range e.attrs {
+		if !strings.EqualFold(attr.name, name) {
+			continue
+		}
+
+		if !slices.ContainsFunc(attr.values, func(node *yaml.Node) bool { return node.Value == value.Value }) {
+			e.attrs[i].values = append(e.attrs[i].values, value)
+		}
+		return
+	}
+	e.attrs = append(e.attrs, yamlAttribute{name: name, values: []*yaml.Node{value}})
+}
+
+// objectClasses returns the key identifying the object classes of the entry.
+func (e *yamlEntry) objectClasses() string {
+	for _, attr := range e.attrs {
+		if isObjectClass(attr.name) {
+			key, _ := attr.blockKey()
+			return strings.ToLower(key) + "\x01"
+		}
+	}
+	return "\x01"
+}
+
+// addTag adds the given tagged value to the attribute with the given name,
+// used to carry tags only (like `.#acl`).
+func (e *yamlEntry) addTag(name string, value *yaml.Node) {
+	for i, attr := range e.tags {
+		if attr.name == name {
+			e.tags[i].values = append(e.tags[i].values, value)
+			return
+		}
+	}
+	e.tags = append(e.tags, yamlAttribute{name: name, values: []*yaml.Node{value}})
+}
+
+// tagBindPassword turns the first `userPassword` value of the entry into its
+// bind password, converted into a format verified by yaLDAP.
+func (e *yamlEntry) tagBindPassword() {
+	for _, attr := range e.attrs {
+		if !strings.EqualFold(attr.name, "userPassword") {
+			continue
+		}
+
+		password := attr.values[0]
+		converted, err := common.ConvertPasswordHash(password.Value)
+		if err != nil {
+			password.LineComment = fmt.Sprintf("# WARNING: %s", err)
+		}
+		password.Tag, password.Value = "!!ldap/bind:password", converted
+		if len(attr.values) > 1 {
+			e.warnings = append(e.warnings, "WARNING: only the first 'userPassword' value is used as bind password")
+		}
+		return
+	}
+}
+
+// node returns the YAML mapping node describing the entry: merged attributes
+// first, then tags, object classes, other attributes and children.
+func (e *yamlEntry) node() *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	if e.merge != nil {
+		node.Content = append(node.Content, scalarNode("<<"), e.merge)
+	}
+	for _, attr := range e.tags {
+		node.Content = append(node.Content, scalarNode(attr.name), attr.node())
+	}
+
+	attrs := slices.Clone(e.attrs)
+	slices.SortStableFunc(attrs, func(lhs, rhs yamlAttribute) int {
+		switch {
+		case isObjectClass(lhs.name) == isObjectClass(rhs.name):
+			return 0
+		case isObjectClass(lhs.name):
+			return -1
+		}
+		return 1
+	})
+	for _, attr := range attrs {
+		node.Content = append(node.Content, scalarNode(attr.name), attr.node())
+	}
+
+	for _, child := range e.children {
+		key := scalarNode(child.key)
+		key.LineComment = "#dn: " + child.dn
+		for _, warning := range child.warnings {
+			key.HeadComment += "# " + warning + "\n"
+		}
+		node.Content = append(node.Content, key, child.node())
+	}
+	return node
+}
+
+// node returns the YAML node describing the attribute values: a scalar node
+// for a single value, a sequence node otherwise (using the flow style if all
+// values are plain).
+func (a yamlAttribute) node() *yaml.Node {
+	if len(a.values) == 1 {
+		return a.values[0]
+	}
+
+	node := &yaml.Node{Kind: yaml.SequenceNode, Content: a.values}
+	if _, plain := a.blockKey(); plain {
+		node.Style = yaml.FlowStyle
+	}
+	return node
+}
+
+// blockKey returns the key identifying the attribute and its values, used to
+// find the attributes shared by several entries. Only attributes with plain
+// values can be shared.
+func (a yamlAttribute) blockKey() (string, bool) {
+	values := []string{strings.ToLower(a.name)}
+	for _, value := range a.values {
+		if value.Tag != "!!str" && value.Tag != "" || value.LineComment != "" {
+			return "", false
+		}
+		values = append(values, value.Value)
+	}
+	return strings.Join(values, "\x00"), true
+}
+
+// scalarNode returns the YAML scalar node describing the given string value.
+// Values not resolved as numbers, booleans or timestamps are explicitly
+// tagged as strings, so they are quoted when needed (e.g. empty values, which
+// would be resolved as null and ignored).
+func scalarNode(value string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	switch node.ShortTag() {
+	case "!!int", "!!float", "!!bool", "!!timestamp":
+	default:
+		node.Tag = "!!str"
+	}
+	return node
+}
+
+// decodeDirective decodes the YAML value of the given directive, already
+// validated by yamldir.ParseTaggedValue or yamldir.ParseACLPolicyValue.
+func decodeDirective(directive directive) (*yaml.Node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(directive.value), &document); err != nil {
+		return nil, &ParseError{err: fmt.Errorf("invalid YAML value: %w", err), line: directive.line}
+	}
+	return document.Content[0], nil
+}
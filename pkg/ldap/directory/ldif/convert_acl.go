@@ -0,0 +1,256 @@
+package ldifdir
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+)
+
+type (
+	// olcDatabase represents an OpenLDAP database, as defined inside the
+	// `cn=config` entries, with its access rules.
+	olcDatabase struct {
+		dn       string
+		suffixes []string
+		access   []string
+	}
+
+	// olcAccessClause represents a `by <who> <access>` clause of an
+	// `olcAccess` rule, translated into yaLDAP terms.
+	olcAccessClause struct {
+		subject string
+		self    bool
+		exact   bool
+		level   string
+	}
+)
+
+// olcAccessIndexRegex matches the `{<index>}` prefix of `olcAccess` values.
+var olcAccessIndexRegex = regexp.MustCompile(`^\{\d+\}`)
+
+// olcAccessLevels lists the OpenLDAP access levels, from the lowest to the
+// highest; each level implies all the lower ones.
+var olcAccessLevels = []string{"none", "disclose", "auth", "compare", "search", "read", "write", "add", "delete", "manage"}
+
+// newOLCDatabase returns the OpenLDAP database described by the given
+// `cn=config` record.
+func newOLCDatabase(record record) olcDatabase {
+	database := olcDatabase{dn: record.dn}
+	for _, attr := range record.attributes {
+		switch {
+		case strings.EqualFold(attr.name, "olcSuffix"):
+			database.suffixes = append(database.suffixes, attr.value)
+		case strings.EqualFold(attr.name, "olcAccess"):
+			database.access = append(database.access, olcAccessIndexRegex.ReplaceAllString(attr.value, ""))
+		}
+	}
+	return database
+}
+
+// translate adds the `olcAccess` rules of the database to the ACL policy of
+// the given converter. Only simple rules are translated: their target must be
+// `*` (the database suffix), `dn.subtree=<dn>`, `attrs=<attributes>` and/or
+// `filter=<filter>`, and each `by` clause must use `*`, `users`, `self`,
+// `dn[.exact|.base|.subtree]=<dn>` or `group[.exact]=<dn>` with an access
+// level. Because yaLDAP subjects always match the entries below their DN,
+// `dn[.exact|.base]=<dn>` clauses are only translated when `<dn>` has no
+// children. Other rules and clauses are reported as warnings.
+// Because OpenLDAP applies the first matching rule while yaLDAP applies the
+// most specific one, translated rules must always be reviewed.
+func (database olcDatabase) translate(converter *converter) {
+	for _, access := range database.access {
+		if err := database.translateRule(converter, access); err != nil {
+			converter.addWarning(fmt.Sprintf("WARNING: olcAccess '%s' of '%s' skipped: %s", access, database.dn, err))
+		}
+	}
+}
+
+// translateRule adds the given `olcAccess` rule to the ACL policy of the given
+// converter. Unsupported `by` clauses are skipped with a warning.
+func (database olcDatabase) translateRule(converter *converter, access string) error {
+	tokens := tokenizeOLCAccess(access)
+	if len(tokens) == 0 || tokens[0] != "to" {
+		return fmt.Errorf("expected 'to <what>'")
+	}
+
+	var suffixes, attributes []string
+	var filter string
+
+	i := 1
+	for ; i < len(tokens) && tokens[i] != "by"; i++ {
+		name, value, _ := strings.Cut(tokens[i], "=")
+		switch name {
+		case "*":
+			if len(database.suffixes) == 0 {
+				return fmt.Errorf("'*' requires a database suffix")
+			}
+			suffixes = append(suffixes, database.suffixes...)
+		case "dn.subtree":
+			if _, err := ldap.ParseDN(value); err != nil {
+				return fmt.Errorf("invalid DN '%s': %w", value, err)
+			}
+			suffixes = append(suffixes, value)
+		case "attrs":
+			attributes = strings.Split(value, ",")
+		case "filter":
+			filter = value
+		default:
+			return fmt.Errorf("unsupported target '%s'", tokens[i])
+		}
+	}
+	if len(suffixes) == 0 {
+		// NOTE: without DN, the rule applies to the whole database.
+		suffixes = database.suffixes
+	}
+	if len(suffixes) == 0 {
+		return fmt.Errorf("no target DN")
+	}
+
+	// NOTE: like OpenLDAP, only the first clause matching an object is used.
+	matched := map[olcAccessClause]bool{}
+	for ; i < len(tokens); i++ {
+		end := i + 1
+		for end < len(tokens) && tokens[end] != "by" {
+			end++
+		}
+
+		clause, err := parseOLCAccessClause(tokens[i+1 : end])
+		if err == nil && clause.exact && converter.hasChildren(clause.subject) {
+			err = fmt.Errorf("exact subject '%s' has children, which yaLDAP subjects always match", clause.subject)
+		}
+		switch {
+		case err != nil:
+			converter.addWarning(fmt.Sprintf("WARNING: clause '%s' of olcAccess '%s' skipped: %s", strings.Join(tokens[i:end], " "), access, err))
+		case clause.subject != "" && !matched[olcAccessClause{subject: clause.subject, self: clause.self}]:
+			matched[olcAccessClause{subject: clause.subject, self: clause.self}] = true
+			if clause.level == "none" && len(attributes) == 0 {
+				// NOTE: objects cannot be searched without matching rule.
+				break
+			}
+
+			for _, suffix := range suffixes {
+				node, err := yamldir.ACLRuleNode("!!ldap/acl", clause.rule(suffix, attributes, filter))
+				if err != nil {
+					return err
+				}
+				converter.addPolicyRules(clause.subject, node)
+			}
+		}
+		i = end - 1
+	}
+	return nil
+}
+
+// parseOLCAccessClause parses the given `by <who> <access> [<control>]`
+// clause (without `by`). Clauses granting only the `auth` or `disclose`
+// levels, or only applying to anonymous users, are returned without subject
+// because binds are always allowed by yaLDAP.
+func parseOLCAccessClause(tokens []string) (olcAccessClause, error) {
+	if len(tokens) < 2 {
+		return olcAccessClause{}, fmt.Errorf("expected 'by <who> <access>'")
+	}
+	if len(tokens) > 2 && tokens[2] != "stop" {
+		return olcAccessClause{}, fmt.Errorf("unsupported control '%s'", tokens[2])
+	}
+
+	var clause olcAccessClause
+	switch name, value, _ := strings.Cut(tokens[0], "="); name {
+	case "*", "users":
+		clause.subject = "*"
+	case "self":
+		clause.subject, clause.self = "*", true
+	case "anonymous":
+	case "dn", "dn.exact", "dn.base":
+		// NOTE: like OpenLDAP, `dn=<dn>` only matches the given DN.
+		clause.subject, clause.exact = value, true
+	case "dn.subtree":
+		clause.subject = value
+	case "group", "group.exact":
+		clause.subject = "group:" + value
+	default:
+		return olcAccessClause{}, fmt.Errorf("unsupported subject '%s'", tokens[0])
+	}
+	if clause.subject != "" {
+		if err := common.ValidateACLPolicySubject(clause.subject); err != nil {
+			return olcAccessClause{}, err
+		}
+	}
+
+	level := strings.TrimPrefix(tokens[1], "self")
+	switch level {
+	case "none", "compare", "search", "read", "write", "add", "delete", "manage":
+		clause.level = level
+	case "auth", "disclose":
+		clause.subject = ""
+	default:
+		return olcAccessClause{}, fmt.Errorf("unsupported access level '%s'", tokens[1])
+	}
+	if clause.subject == "" {
+		return olcAccessClause{}, nil
+	}
+	return clause, nil
+}
+
+// rule returns the yaLDAP ACL rule granting the access level of the clause
+// on the given DN suffix. The `read` level (and above) allows to search the
+// objects or to read the given attributes, the `search` level to search the
+// objects or to filter on the given attributes, the `compare` level to
+// compare attributes and `none` denies to search the objects or to read the
+// given attributes.
+func (clause olcAccessClause) rule(suffix string, attributes []string, filter string) common.ACLRule {
+	rule := common.ACLRule{
+		DistinguishedNameSuffix: suffix,
+		Allowed:                 clause.level != "none",
+		Attributes:              attributes,
+		Filter:                  filter,
+	}
+	if clause.self {
+		rule.Relation = common.ACLRelationSelf
+	}
+
+	level := slices.Index(olcAccessLevels, clause.level)
+	switch {
+	case len(attributes) == 0 && (!rule.Allowed || level >= slices.Index(olcAccessLevels, "search")):
+		rule.Capability = common.ACLSearch
+	case !rule.Allowed || level >= slices.Index(olcAccessLevels, "read"):
+		rule.Capability = common.ACLRead
+	case clause.level == "search":
+		rule.Capability = common.ACLFilter
+	default:
+		rule.Capability = common.ACLCompare
+	}
+	return rule
+}
+
+// tokenizeOLCAccess splits the given `olcAccess` rule on spaces, except inside
+// double-quoted values whose quotes are removed (e.g. `dn.subtree="ou=people,
+// dc=org"`).
+func tokenizeOLCAccess(access string) []string {
+	var tokens []string
+	var token strings.Builder
+	quoted, started := false, false
+	for _, char := range access {
+		switch {
+		case char == '"':
+			quoted, started = !quoted, true
+		case (char == ' ' || char == '\t') && !quoted:
+			if started {
+				tokens = append(tokens, token.String())
+				token.Reset()
+				started = false
+			}
+		default:
+			token.WriteRune(char)
+			started = true
+		}
+	}
+	if started {
+		tokens = append(tokens, token.String())
+	}
+	return tokens
+}
@@ -0,0 +1,186 @@
+package ldifdir_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	ldifdir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/ldif"
+	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert(t *testing.T) {
+	raw, err := os.ReadFile("fixtures/slapcat.ldif")
+	require.NoError(t, err)
+
+	buff := bytes.NewBuffer(nil)
+	require.NoError(t, ldifdir.Convert(buff, [][]byte{raw}))
+
+	assert.Equal(t, ""+
+		"dc:org: #dn: dc=org\n"+
+		"  dc:example: #dn: dc=example,dc=org\n"+
+		"    objectClass: [top, dcObject, organization]\n"+
+		"    o: Example\n"+
+		"    ou:people: #dn: ou=people,dc=example,dc=org\n"+
+		"      objectClass: organizationalUnit\n"+
+		"      # WARNING: binary value of 'jpegPhoto' skipped, YAML can only describe UTF-8 values\n"+
+		"      uid:alice: #dn: uid=alice,ou=people,dc=example,dc=org\n"+
+		"        <<: &inetOrgPerson\n"+
+		"          objectClass: [inetOrgPerson, posixAccount]\n"+
+		"          gidNumber: 100\n"+
+		"          loginShell: /bin/bash\n"+
+		"        cn: Alice\n"+
+		"        sn: Liddell\n"+
+		"        uidNumber: 1000\n"+
+		"        homeDirectory: /home/alice\n"+
+		"        userPassword: !!ldap/bind:password '{SSHA}uxDLcix/huUTx6aCVrrVAKa5hUR5YUxEQVAhIQ=='\n"+
+		"      uid:bob: #dn: uid=bob,ou=people,dc=example,dc=org\n"+
+		"        <<: *inetOrgPerson\n"+
+		"        cn: Bob\n"+
+		"        sn: Builder\n"+
+		"        uidNumber: 1001\n"+
+		"        homeDirectory: /home/bob\n"+
+		"        userPassword: !!ldap/bind:password '{SASL}bob@EXAMPLE.ORG' # WARNING: unsupported password scheme: SASL\n"+
+		"        description: \"\"\n"+
+		"    ou:groups: #dn: ou=groups,dc=example,dc=org\n"+
+		"      cn:admins: #dn: cn=admins,ou=groups,dc=example,dc=org\n"+
+		"        objectClass: posixGroup\n"+
+		"        gidNumber: 1000\n"+
+		"        memberUid: alice\n",
+		buff.String(),
+	)
+
+	directory, err := yamldir.NewDirectoryFromYAML(buff.Bytes())
+	require.NoError(t, err)
+
+	alice := directory.BaseDN("uid=alice,ou=people,dc=example,dc=org")
+	require.NotNil(t, alice)
+	assert.Equal(t, []string{"100"}, alice.Attributes()["gidNumber"])
+
+	valid, err := alice.Bind("alice")
+	require.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestConvert_OLCAccess(t *testing.T) {
+	raw, err := os.ReadFile("fixtures/slapcat-config.ldif")
+	require.NoError(t, err)
+
+	buff := bytes.NewBuffer(nil)
+	require.NoError(t, ldifdir.Convert(buff, [][]byte{raw}, ldifdir.WithOLCAccess()))
+
+	assert.Equal(t, ""+
+		"# NOTE: the ACL policy is translated from olcAccess rules; OpenLDAP applies the first matching rule\n"+
+		"#       while yaLDAP applies the most specific one, so it must be reviewed.\n"+
+		"# WARNING: olcAccess 'to dn.regex=\"^uid=.*\" by * read' of 'olcDatabase={1}mdb,cn=config' skipped: unsupported target 'dn.regex=^uid=.*'\n"+
+		"# WARNING: clause 'by * break' of olcAccess 'to * by self read by dn.exact=\"cn=admin,dc=example,dc=org\" manage by * break' skipped: unsupported access level 'break'\n"+
+		"\n"+
+		"{}\n"+
+		"---\n"+
+		"!!ldap/acl:policy\n"+
+		"'*':\n"+
+		"  - !!ldap/acl:allow-read-on {dn: 'dc=example,dc=org', target: self, attributes: [userPassword]}\n"+
+		"  - !!ldap/acl:deny-read-on {dn: 'dc=example,dc=org', attributes: [userPassword]}\n"+
+		"  - !!ldap/acl:allow-on ou=people,dc=example,dc=org\n"+
+		"  - !!ldap/acl:allow-on {dn: 'dc=example,dc=org', target: self}\n"+
+		"group:cn=admins,ou=groups,dc=example,dc=org: !!ldap/acl:allow-on ou=people,dc=example,dc=org\n"+
+		"cn=admin,dc=example,dc=org: !!ldap/acl:allow-on dc=example,dc=org\n",
+		buff.String(),
+	)
+
+	t.Run("Disabled", func(t *testing.T) {
+		buff := bytes.NewBuffer(nil)
+		require.NoError(t, ldifdir.Convert(buff, [][]byte{raw}))
+		assert.Equal(t, "{}\n", buff.String())
+	})
+
+	t.Run("ExactSubject", func(t *testing.T) {
+		raw := []byte("" +
+			"dn: olcDatabase={1}mdb,cn=config\n" +
+			"olcSuffix: dc=example,dc=org\n" +
+			"olcAccess: {0}to * by dn.exact=\"ou=people,dc=example,dc=org\" read by dn.base=\"uid=alice,ou=people,dc=example,dc=org\" read by dn.subtree=\"ou=groups,dc=example,dc=org\" read\n" +
+			"\n" +
+			"dn: uid=alice,ou=people,dc=example,dc=org\n" +
+			"objectClass: account\n" +
+			"uid: alice\n")
+
+		buff := bytes.NewBuffer(nil)
+		require.NoError(t, ldifdir.Convert(buff, [][]byte{raw}, ldifdir.WithOLCAccess()))
+		assert.Contains(t, buff.String(), ""+
+			"# WARNING: clause 'by dn.exact=ou=people,dc=example,dc=org read' of olcAccess 'to * by dn.exact=\"ou=people,dc=example,dc=org\" read by dn.base=\"uid=alice,ou=people,dc=example,dc=org\" read by dn.subtree=\"ou=groups,dc=example,dc=org\" read' "+
+			"skipped: exact subject 'ou=people,dc=example,dc=org' has children, which yaLDAP subjects always match\n")
+		assert.Contains(t, buff.String(), ""+
+			"---\n"+
+			"!!ldap/acl:policy\n"+
+			"uid=alice,ou=people,dc=example,dc=org: !!ldap/acl:allow-on dc=example,dc=org\n"+
+			"ou=groups,dc=example,dc=org: !!ldap/acl:allow-on dc=example,dc=org\n")
+	})
+}
+
+func TestConvert_RoundTrip(t *testing.T) {
+	raw, err := os.ReadFile("../yaml/fixtures/basic.yaml")
+	require.NoError(t, err)
+	directory, err := yamldir.NewDirectoryFromYAML(raw)
+	require.NoError(t, err)
+
+	exported := bytes.NewBuffer(nil)
+	require.NoError(t, ldifdir.Export(exported, directory))
+
+	converted := bytes.NewBuffer(nil)
+	require.NoError(t, ldifdir.Convert(converted, [][]byte{exported.Bytes()}))
+	assert.Contains(t, converted.String(), ""+
+		"      cn:ok: #dn: cn=ok,ou=group,dc=example,dc=org\n"+
+		"        <<: &posixGroup\n"+
+		"          objectClass: posixGroup\n"+
+		"          memberUid: alice\n")
+
+	directory, err = yamldir.NewDirectoryFromYAML(converted.Bytes())
+	require.NoError(t, err)
+
+	reexported := bytes.NewBuffer(nil)
+	require.NoError(t, ldifdir.Export(reexported, directory))
+	assert.Equal(t, exported.String(), reexported.String())
+}
+
+func TestConvert_Invalid(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Raw   string
+		Error string
+	}{
+		{
+			Name:  "MultiValuedRDN",
+			Raw:   "dn: cn=alice+uid=alice,dc=org\n",
+			Error: "invalid LDIF document at line 1: unsupported DN 'cn=alice+uid=alice,dc=org': multi-valued RDNs cannot be described in YAML",
+		},
+		{
+			Name:  "ColonInRDN",
+			Raw:   "dn: cn=alice:admin,dc=org\n",
+			Error: "invalid LDIF document at line 1: unsupported DN 'cn=alice:admin,dc=org': RDNs containing ':' cannot be described in YAML",
+		},
+		{
+			Name:  "DuplicatedEntry",
+			Raw:   "dn: cn=alice,dc=org\n\ndn: CN=Alice, DC=org\n",
+			Error: "invalid LDIF document at line 3: entry 'CN=Alice, DC=org' is already defined at line 1",
+		},
+		{
+			Name:  "UnsupportedDirective",
+			Raw:   "dn: cn=alice\n# yaldap: !!ldap/alias cn=bob\n",
+			Error: "invalid LDIF document at line 2: unsupported tag '!!ldap/alias': only bind and ACL tags are allowed",
+		},
+		{
+			Name:  "InvalidLDIF",
+			Raw:   "cn: alice\n",
+			Error: "invalid LDIF document at line 1: invalid record: expected a 'dn' line, got 'cn'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			err := ldifdir.Convert(bytes.NewBuffer(nil), [][]byte{[]byte(tt.Raw)})
+			assert.EqualError(t, err, tt.Error)
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package ldifdir
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+	"github.com/moznion/go-optional"
+)
+
+type (
+	// directory represents the LDAP directory described by an LDIF file. It
+	// contains all entries and an index for quick node search.
+	directory struct {
+		*common.Tree
+
+		passwordPolicy *common.PasswordPolicy
+		aclPolicy      []common.ACLPolicyRule
+
+		// files contains the LDIF file and all files referred by its
+		// `file://` URLs.
+		files []string
+	}
+
+	// Option customizes the directory built from the LDIF definition.
+	Option func(directory *directory)
+)
+
+// WithPasswordPolicy enforces the given password policy on all objects of the
+// directory.
+func WithPasswordPolicy(policy *common.PasswordPolicy) Option {
+	return func(directory *directory) { directory.passwordPolicy = policy }
+}
+
+// NewDirectory creates the directory described by the LDIF file located at
+// the given URL (e.g. `ldif:///etc/yaldap/directory.ldif`).
+func NewDirectory(url string, opts ...Option) (ldap.Directory, error) {
+	path := filePath(url)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read LDIF file: %w", err)
+	}
+
+	dir, err := newDirectory(raw, opts...)
+	if err != nil {
+		return nil, err
+	}
+	dir.files = append([]string{path}, dir.files...)
+	return dir, nil
+}
+
+// NewDirectoryFromLDIF creates the directory described by the given LDIF
+// definition.
+func NewDirectoryFromLDIF(raw []byte, opts ...Option) (ldap.Directory, error) {
+	return newDirectory(raw, opts...)
+}
+
+// filePath returns the path of the LDIF file located at the given URL.
+func filePath(url string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(url, "ldif://"), "file://")
+}
+
+// newDirectory creates the directory described by the given LDIF definition.
+// Entries are created like the YAML directory does: all `# yaldap:`
+// directives are applied on their entry (see yamldir.ParseTaggedValue) and,
+// without bind password directive, the `userPassword` attribute is the bind
+// password.
+func newDirectory(raw []byte, opts ...Option) (*directory, error) {
+	directory := &directory{
+		Tree: common.NewTree(),
+	}
+	for _, opt := range opts {
+		opt(directory)
+	}
+
+	records, globals, err := parseLDIF(raw, &directory.files)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, directive := range globals {
+		policy, err := yamldir.ParseACLPolicyValue(directive.value, directive.line, directive.column)
+		if err != nil {
+			return nil, &ParseError{err: err, line: directive.line}
+		}
+		directory.aclPolicy = append(directory.aclPolicy, policy...)
+	}
+
+	// NOTE: parents are created before their children, whatever their order
+	//       inside the LDIF file.
+	dns := make([]ldap.DN, len(records))
+	for i, record := range records {
+		if dns[i], err = ldap.ParseDN(record.dn); err != nil {
+			return nil, &ParseError{err: fmt.Errorf("invalid DN '%s': %w", record.dn, err), line: record.line}
+		} else if len(dns[i]) == 0 {
+			return nil, &ParseError{err: fmt.Errorf("invalid DN: the root DSE cannot be defined"), line: record.line}
+		}
+	}
+	order := make([]int, len(records))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return len(dns[order[i]]) < len(dns[order[j]]) })
+
+	defined := map[string]int{}
+	for _, i := range order {
+		record, dn := records[i], dns[i]
+		if line, exists := defined[dn.Normalize()]; exists {
+			return nil, &ParseError{err: fmt.Errorf("entry '%s' is already defined at line %d", record.dn, line), line: record.line}
+		}
+		defined[dn.Normalize()] = record.line
+
+		if err := parseEntry(directory.LookupOrCreate(dn), record); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, i := range order {
+		obj := directory.LookupOrCreate(dns[i])
+		if err := validateEntry(obj); err != nil {
+			return nil, &ParseError{err: err, line: records[i].line}
+		}
+	}
+
+	directory.Index(directory.passwordPolicy)
+	common.ResolveACLs(directory.Root(), directory.aclPolicy)
+	return directory, nil
+}
+
+// parseEntry fills the given object with the attributes and the directives
+// of the given record.
+func parseEntry(obj *common.Object, record record) error {
+	for _, attr := range record.attributes {
+		name := attr.name
+		for existing := range obj.Attributes() {
+			if strings.EqualFold(existing, attr.name) {
+				name = existing
+			}
+		}
+
+		// NOTE: the RDN values are already defined by LookupOrCreate.
+		if !slices.Contains(obj.ImplObject.Attributes[name], attr.value) {
+			obj.AddAttribute(name, attr.value)
+		}
+	}
+
+	for _, directive := range record.directives {
+		if err := yamldir.ParseTaggedValue(obj, directive.value, directive.line, directive.column); err != nil {
+			return &ParseError{err: err, line: directive.line}
+		}
+	}
+
+	if obj.BindPasswords.IsSome() {
+		return nil
+	}
+	for name, values := range obj.Attributes() {
+		switch {
+		case !strings.EqualFold(name, "userPassword"):
+			continue
+		case len(values) > 1:
+			return &ParseError{err: fmt.Errorf("invalid entry '%s': only one '%s' value is allowed as bind password", record.dn, name), line: record.line}
+		}
+
+		// NOTE: like with `userPassword: !!ldap/bind:password ...` in YAML.
+		obj.BindPasswords = optional.Some(values[0])
+		obj.SecretAttributes = append(obj.SecretAttributes, name)
+	}
+	return nil
+}
+
+// validateEntry checks that the given alias entry refers to exactly one
+// valid DN without subordinates, and that the given referral object refers to
+// at least one valid LDAP URL.
+func validateEntry(obj *common.Object) error {
+	if ldap.IsAlias(obj) {
+		name := ldap.AliasedObjectName(obj)
+		switch {
+		case name == "":
+			return fmt.Errorf("invalid alias '%s': exactly one 'aliasedObjectName' is required", obj.DN())
+		case len(obj.SubObjects) > 0:
+			return fmt.Errorf("invalid alias '%s': an alias entry cannot have subordinates", obj.DN())
+		}
+		if _, err := ldap.ParseDN(name); err != nil {
+			return fmt.Errorf("invalid alias '%s': '%s' is not a valid DN: %w", obj.DN(), name, err)
+		}
+	}
+
+	if ldap.IsReferral(obj) {
+		urls := ldap.ReferralURLs(obj)
+		if len(urls) == 0 {
+			return fmt.Errorf("invalid referral '%s': at least one 'ref' is required", obj.DN())
+		}
+		for _, url := range urls {
+			if err := ldap.ValidateReferralURL(url); err != nil {
+				return fmt.Errorf("invalid referral '%s': %w", obj.DN(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// ACLPolicy returns the ACL rules applying to the whole directory, defined by
+// the `# yaldap: !!ldap/acl:policy` directives.
+func (d directory) ACLPolicy() []common.ACLPolicyRule { return d.aclPolicy }
+
+// WatchedFiles returns the LDIF file and all files referred by its `file://`
+// URLs.
+func (d directory) WatchedFiles() []string { return d.files }
@@ -0,0 +1,198 @@
+package ldifdir_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	ldifdir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/ldif"
+	"github.com/jimlambrt/gldap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDirectory_NoFile(t *testing.T) {
+	directory, err := ldifdir.NewDirectory("ldif://fixtures/does-not-exist.ldif")
+
+	assert.EqualError(t, err, "unable to read LDIF file: open fixtures/does-not-exist.ldif: no such file or directory")
+	assert.Nil(t, directory)
+}
+
+func TestNewDirectory_Fixture(t *testing.T) {
+	directory, err := ldifdir.NewDirectory("ldif://fixtures/directory.ldif")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"fixtures/directory.ldif"}, directory.(ldap.Watchable).WatchedFiles())
+
+	t.Run("cn=alice,ou=people,dc=org", func(t *testing.T) {
+		alice, ok := directory.BaseDN("cn=alice,ou=people,dc=org").(*common.Object)
+		require.True(t, ok)
+
+		assert.Equal(t,
+			ldap.Attributes{
+				"cn":           {"alice"},
+				"objectclass":  {"posixAccount", "inetOrgPerson"},
+				"uid":          {"alice"},
+				"mail":         {"alice@example.org"},
+				"userPassword": {"{SSHA}uxDLcix/huUTx6aCVrrVAKa5hUR5YUxEQVAhIQ=="},
+				"description":  {"This description is long enough to be folded on several lines by the LDIF writer"},
+			},
+			alice.Attributes(),
+		)
+		assert.Equal(t, []string{"userPassword"}, alice.SecretAttributes)
+		require.NotNil(t, alice.BindTOTP)
+
+		valid, err := alice.Bind("alice" + alice.BindTOTP.Code(time.Now()))
+		require.NoError(t, err)
+		assert.True(t, valid)
+	})
+
+	t.Run("ACLs", func(t *testing.T) {
+		alice := directory.BaseDN("cn=alice,ou=people,dc=org")
+		dev := directory.BaseDN("cn=dev,ou=groups,dc=org")
+		require.NotNil(t, dev)
+
+		assert.True(t, alice.CanSearchOn(directory.BaseDN("dc=org")))
+		assert.False(t, alice.CanReadAttribute(alice, "mail"))
+		assert.Equal(t, "line 2, column 11", alice.(*common.Object).ExplainACL(common.ACLRead, alice, "mail").Rule.Origin)
+		assert.Equal(t, "Équipe de développement", dev.Attributes()["description"][0])
+	})
+
+	t.Run("ou=groups,dc=org", func(t *testing.T) {
+		// NOTE: missing parents are created with their RDN attributes only.
+		groups := directory.BaseDN("ou=groups,dc=org")
+		require.NotNil(t, groups)
+		assert.Equal(t, ldap.Attributes{"ou": {"groups"}}, groups.Attributes())
+	})
+
+	t.Run("AliasAndReferral", func(t *testing.T) {
+		assert.True(t, ldap.IsAlias(directory.BaseDN("cn=admin,dc=org")))
+		assert.True(t, ldap.IsReferral(directory.BaseDN("ou=legacy,dc=org")))
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		entries, err := directory.BaseDN("dc=org").Search(gldap.WholeSubtree, "(objectClass=posixAccount)")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "cn=alice,ou=people,dc=org", entries[0].DN())
+	})
+}
+
+func TestNewDirectoryFromLDIF_Invalid(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Raw   string
+		Error string
+	}{
+		{
+			Name:  "InvalidDN",
+			Raw:   "dn: alice\n",
+			Error: "invalid LDIF document at line 1: invalid DN 'alice': invalid DN 'alice': missing '=' in 'alice'",
+		},
+		{
+			Name:  "RootDSE",
+			Raw:   "dn:\nobjectClass: top\n",
+			Error: "invalid LDIF document at line 1: invalid DN: the root DSE cannot be defined",
+		},
+		{
+			Name:  "DuplicatedEntry",
+			Raw:   "dn: cn=alice,dc=org\n\ndn: CN=Alice, DC=org\n",
+			Error: "invalid LDIF document at line 3: entry 'CN=Alice, DC=org' is already defined at line 1",
+		},
+		{
+			Name:  "SeveralPasswords",
+			Raw:   "dn: cn=alice\nuserPassword: alice\nuserPassword: secret\n",
+			Error: "invalid LDIF document at line 1: invalid entry 'cn=alice': only one 'userPassword' value is allowed as bind password",
+		},
+		{
+			Name:  "UnsupportedDirective",
+			Raw:   "dn: cn=alice\n# yaldap: !!ldap/alias cn=bob\n",
+			Error: "invalid LDIF document at line 2: unsupported tag '!!ldap/alias': only bind and ACL tags are allowed",
+		},
+		{
+			Name:  "InvalidDirective",
+			Raw:   "dn: cn=alice\n# yaldap: !!ldap/acl:allow-on alice\n",
+			Error: "invalid LDIF document at line 2: invalid '!!ldap/acl:allow-on' tag: invalid DN 'alice': missing '=' in 'alice'",
+		},
+		{
+			Name:  "EntryDirectiveOutsideRecord",
+			Raw:   "# yaldap: !!ldap/acl:allow-on dc=org\n",
+			Error: "invalid LDIF document at line 1: unsupported tag '!!ldap/acl:allow-on': only '!!ldap/acl:policy' is allowed",
+		},
+		{
+			Name:  "InvalidAlias",
+			Raw:   "dn: cn=admin\nobjectClass: alias\n",
+			Error: "invalid LDIF document at line 1: invalid alias 'cn=admin': exactly one 'aliasedObjectName' is required",
+		},
+		{
+			Name:  "AliasWithSubordinates",
+			Raw:   "dn: cn=admin\nobjectClass: alias\naliasedObjectName: cn=alice\n\ndn: cn=bob,cn=admin\n",
+			Error: "invalid LDIF document at line 1: invalid alias 'cn=admin': an alias entry cannot have subordinates",
+		},
+		{
+			Name:  "InvalidReferral",
+			Raw:   "dn: ou=legacy\nobjectClass: referral\n",
+			Error: "invalid LDIF document at line 1: invalid referral 'ou=legacy': at least one 'ref' is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			directory, err := ldifdir.NewDirectoryFromLDIF([]byte(tt.Raw))
+			assert.EqualError(t, err, tt.Error)
+			assert.Nil(t, directory)
+		})
+	}
+}
+
+func TestNewDirectoryFromLDIF_BindPasswordDirective(t *testing.T) {
+	t.Run("Value", func(t *testing.T) {
+		directory, err := ldifdir.NewDirectoryFromLDIF([]byte("" +
+			"dn: cn=alice\n" +
+			"# yaldap: !!ldap/bind:password secret\n" +
+			"userPassword: {SSHA}uxDLcix/huUTx6aCVrrVAKa5hUR5YUxEQVAhIQ==\n" +
+			"userPassword: {SSHA}another\n",
+		))
+		require.NoError(t, err)
+
+		alice := directory.BaseDN("cn=alice").(*common.Object)
+		assert.Empty(t, alice.SecretAttributes)
+
+		valid, err := alice.Bind("secret")
+		require.NoError(t, err)
+		assert.True(t, valid)
+	})
+
+	t.Run("Attribute", func(t *testing.T) {
+		directory, err := ldifdir.NewDirectoryFromLDIF([]byte("" +
+			"dn: cn=alice\n" +
+			"# yaldap: {password: !!ldap/bind:password alice}\n" +
+			"userPassword: {SSHA}another\n",
+		))
+		require.NoError(t, err)
+
+		alice := directory.BaseDN("cn=alice").(*common.Object)
+		assert.Equal(t, ldap.Attributes{"cn": {"alice"}, "password": {"alice"}, "userPassword": {"{SSHA}another"}}, alice.Attributes())
+		assert.Equal(t, []string{"password"}, alice.SecretAttributes)
+
+		valid, err := alice.Bind("alice")
+		require.NoError(t, err)
+		assert.True(t, valid)
+	})
+}
+
+func TestBackend(t *testing.T) {
+	info, err := ldap.LookupBackend("", "ldif://fixtures/directory.ldif")
+	require.NoError(t, err)
+	assert.Equal(t, "ldif", info.Name)
+
+	backend := info.New()
+	assert.EqualError(t, backend.Validate("ldif://fixtures/does-not-exist.ldif"), "unable to read LDIF file: stat fixtures/does-not-exist.ldif: no such file or directory")
+	require.NoError(t, backend.Validate("ldif://fixtures/directory.ldif"))
+
+	directory, err := backend.NewDirectory(context.Background(), "ldif://fixtures/directory.ldif")
+	require.NoError(t, err)
+	assert.NotNil(t, directory.BaseDN("cn=alice,ou=people,dc=org"))
+}
@@ -0,0 +1,216 @@
+package ldifdir
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+	"github.com/jimlambrt/gldap"
+)
+
+// lineWidth is the maximum length of an LDIF line; longer lines are folded.
+const lineWidth = 76
+
+// Export writes all entries of the given directory as LDIF content records
+// (RFC 2849), parents first. Bind secrets and ACL rules of common objects
+// (like the YAML directory ones), which cannot be described by LDIF, are
+// written as `# yaldap:` directives: they are ignored by other LDIF
+// implementations but read back by the LDIF backend.
+func Export(w io.Writer, directory ldap.Directory) error {
+	root := directory.BaseDN("")
+	if root == nil {
+		return errors.New("unable to export the directory: no root DSE found")
+	}
+
+	entries, err := root.Search(gldap.WholeSubtree, ldap.MatchAllFilter)
+	if err != nil {
+		return fmt.Errorf("unable to export the directory: %w", err)
+	}
+
+	type exported struct {
+		dn    ldap.DN
+		entry ldap.Object
+	}
+	objects := make([]exported, 0, len(entries))
+	for _, entry := range entries {
+		dn, err := ldap.ParseDN(entry.DN())
+		if err != nil {
+			return fmt.Errorf("unable to export '%s': %w", entry.DN(), err)
+		}
+		if len(dn) > 0 {
+			objects = append(objects, exported{dn: dn, entry: entry})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return lessDN(objects[i].dn, objects[j].dn) })
+
+	out := bufio.NewWriter(w)
+	writeLine(out, "version: 1")
+	if provider, ok := directory.(common.ACLPolicyProvider); ok {
+		tags, err := yamldir.ACLPolicyTags(provider.ACLPolicy())
+		if err != nil {
+			return fmt.Errorf("unable to export the ACL policy: %w", err)
+		}
+		for _, tag := range tags {
+			writeLine(out, directivePrefix+" "+tag)
+		}
+	}
+
+	for _, object := range objects {
+		directives, hidden, err := entryDirectives(object.entry)
+		if err != nil {
+			return fmt.Errorf("unable to export '%s': %w", object.entry.DN(), err)
+		}
+
+		writeLine(out, "")
+		writeLine(out, attributeLine("dn", object.entry.DN()))
+		for _, directive := range directives {
+			writeLine(out, directivePrefix+" "+directive)
+		}
+
+		attributes := object.entry.Attributes()
+		names := make([]string, 0, len(attributes))
+		for name := range attributes {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			// NOTE: object classes come first, like most LDAP servers do.
+			if isObjectClass(names[i]) != isObjectClass(names[j]) {
+				return isObjectClass(names[i])
+			}
+			return strings.ToLower(names[i]) < strings.ToLower(names[j])
+		})
+		for _, name := range names {
+			for _, value := range attributes[name] {
+				if hidden[name] != value {
+					writeLine(out, attributeLine(name, value))
+				}
+			}
+		}
+	}
+	return out.Flush()
+}
+
+// entryDirectives returns the YAML tagged values describing the bind secrets
+// and the ACL rules of the given entry. The bind password is only described
+// if it is not the single `userPassword` value of the entry; in this case,
+// the attribute value holding it is described by the directive and returned
+// as hidden, to not be written twice.
+func entryDirectives(entry ldap.Object) (directives []string, hidden map[string]string, err error) {
+	obj, ok := entry.(*common.Object)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	if obj.BindPasswords.IsSome() {
+		password := obj.BindPasswords.Unwrap()
+
+		var passwords []string
+		for name, values := range obj.Attributes() {
+			if strings.EqualFold(name, "userPassword") {
+				passwords = append(passwords, values...)
+			}
+		}
+
+		if !slices.Equal(passwords, []string{password}) {
+			holder := ""
+			for _, name := range obj.SecretAttributes {
+				if slices.Contains(obj.Attributes()[name], password) {
+					holder, hidden = name, map[string]string{name: password}
+					break
+				}
+			}
+
+			directive, err := yamldir.FormatTaggedValue(holder, "!!ldap/bind:password", password)
+			if err != nil {
+				return nil, nil, err
+			}
+			directives = append(directives, directive)
+		}
+	}
+
+	if obj.BindTOTP != nil {
+		directive, err := yamldir.FormatTaggedValue("", "!!ldap/bind:totp", obj.BindTOTP.Secret())
+		if err != nil {
+			return nil, nil, err
+		}
+		directives = append(directives, directive)
+	}
+
+	acls, err := yamldir.ACLTags(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(directives, acls...), hidden, nil
+}
+
+// attributeLine returns the LDIF line describing the given attribute value,
+// base64 encoded if it is not a safe string (RFC 2849).
+func attributeLine(name, value string) string {
+	if !isSafeString(value) {
+		return name + ":: " + base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	if value == "" {
+		return name + ":"
+	}
+	return name + ": " + value
+}
+
+// isSafeString returns true if the given value can be written as is inside an
+// LDIF file: only ASCII characters except NUL, LF and CR, not starting with a
+// space, a colon or a less-than sign and not ending with a space.
+func isSafeString(value string) bool {
+	if value == "" {
+		return true
+	}
+	if strings.ContainsAny(value[:1], " :<") || strings.HasSuffix(value, " ") {
+		return false
+	}
+
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c == 0 || c == '\n' || c == '\r' || c > 0x7F {
+			return false
+		}
+	}
+	return true
+}
+
+// writeLine writes the given LDIF line, folded if it is longer than
+// lineWidth. Lines are only folded between two UTF-8 characters.
+func writeLine(w *bufio.Writer, line string) {
+	width := lineWidth
+	for len(line) > width {
+		cut := width
+		for cut > 1 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		_, _ = w.WriteString(line[:cut] + "\n ")
+		line, width = line[cut:], lineWidth-1
+	}
+	_, _ = w.WriteString(line + "\n")
+}
+
+// isObjectClass returns true if the given attribute is `objectClass`.
+func isObjectClass(name string) bool { return strings.EqualFold(name, "objectClass") }
+
+// lessDN returns true if the entry with the first DN must be written before
+// the one with the second DN: parents come before their children, siblings
+// are sorted by their normalized RDN.
+func lessDN(lhs, rhs ldap.DN) bool {
+	for i := 1; i <= len(lhs) && i <= len(rhs); i++ {
+		l, r := lhs[len(lhs)-i].Normalize(), rhs[len(rhs)-i].Normalize()
+		if l != r {
+			return l < r
+		}
+	}
+	return len(lhs) < len(rhs)
+}
@@ -0,0 +1,106 @@
+package ldifdir_test
+
+import (
+	"bytes"
+	"testing"
+
+	ldifdir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/ldif"
+	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	directory, err := yamldir.NewDirectoryFromYAML([]byte(`
+dc:org:
+  objectClass: organization
+  ou:people:
+    objectClass: organizationalUnit
+    .#acl: !!ldap/subtree-acl:allow-read-on { dn: "ou=people,dc=org", attributes: [cn] }
+    cn:alice:
+      objectClass: [posixAccount, inetOrgPerson]
+      .#acl:
+        - !!ldap/acl:allow-on dc=org
+        - !!ldap/acl:deny-read-on { filter: (objectClass=posixGroup), attributes: [memberUid] }
+      .#totp: !!ldap/bind:totp JBSWY3DPEHPK3PXP
+      userPassword: !!ldap/bind:password alice
+      description: This description is long enough to be folded on several lines by the LDIF writer
+    cn:bob:
+      objectClass: posixAccount
+      password: !!ldap/bind:password bob
+      userPassword: "{SSHA}another"
+      sn: " Bob"
+  ou:groups:
+    cn:dev:
+      objectClass: posixGroup
+      .#acl: !!ldap/members-acl:allow-on ou=people,dc=org
+      description: Équipe de développement
+      memberUid: alice
+--- !!ldap/acl:policy
+"*": !!ldap/acl:deny-read-on { dn: dc=org, attributes: [mail] }
+`))
+	require.NoError(t, err)
+
+	buff := bytes.NewBuffer(nil)
+	require.NoError(t, ldifdir.Export(buff, directory))
+	assert.Equal(t, ""+
+		"version: 1\n"+
+		"# yaldap: !!ldap/acl:policy {'*': [!!ldap/acl:deny-read-on {dn: dc=org, attr\n"+
+		" ibutes: [mail]}]}\n"+
+		"\n"+
+		"dn: dc=org\n"+
+		"objectClass: organization\n"+
+		"dc: org\n"+
+		"\n"+
+		"dn: ou=groups,dc=org\n"+
+		"ou: groups\n"+
+		"\n"+
+		"dn: cn=dev,ou=groups,dc=org\n"+
+		"# yaldap: !!ldap/members-acl:allow-on ou=people,dc=org\n"+
+		"objectClass: posixGroup\n"+
+		"cn: dev\n"+
+		"description:: w4lxdWlwZSBkZSBkw6l2ZWxvcHBlbWVudA==\n"+
+		"memberUid: alice\n"+
+		"\n"+
+		"dn: ou=people,dc=org\n"+
+		"# yaldap: !!ldap/subtree-acl:allow-read-on {dn: 'ou=people,dc=org', attribut\n"+
+		" es: [cn]}\n"+
+		"objectClass: organizationalUnit\n"+
+		"ou: people\n"+
+		"\n"+
+		"dn: cn=alice,ou=people,dc=org\n"+
+		"# yaldap: !!ldap/bind:totp JBSWY3DPEHPK3PXP\n"+
+		"# yaldap: !!ldap/acl:allow-on dc=org\n"+
+		"# yaldap: !!ldap/acl:deny-read-on {filter: (objectClass=posixGroup), attribu\n"+
+		" tes: [memberUid]}\n"+
+		"objectClass: posixAccount\n"+
+		"objectClass: inetOrgPerson\n"+
+		"cn: alice\n"+
+		"description: This description is long enough to be folded on several lines b\n"+
+		" y the LDIF writer\n"+
+		"userPassword: alice\n"+
+		"\n"+
+		"dn: cn=bob,ou=people,dc=org\n"+
+		"# yaldap: {password: !!ldap/bind:password bob}\n"+
+		"objectClass: posixAccount\n"+
+		"cn: bob\n"+
+		"sn:: IEJvYg==\n"+
+		"userPassword: {SSHA}another\n",
+		buff.String(),
+	)
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		imported, err := ldifdir.NewDirectoryFromLDIF(buff.Bytes())
+		require.NoError(t, err)
+
+		exported := bytes.NewBuffer(nil)
+		require.NoError(t, ldifdir.Export(exported, imported))
+		assert.Equal(t, buff.String(), exported.String())
+
+		bob := imported.BaseDN("cn=bob,ou=people,dc=org")
+		valid, err := bob.Bind("bob")
+		require.NoError(t, err)
+		assert.True(t, valid)
+		assert.False(t, bob.CanReadAttribute(bob, "password"))
+	})
+}
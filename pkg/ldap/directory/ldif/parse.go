@@ -0,0 +1,187 @@
+package ldifdir
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type (
+	// record is an LDIF record (RFC 2849) describing an entry, either as a
+	// content record or as a `changetype: add` change record.
+	record struct {
+		dn         string
+		line       int
+		attributes []attribute
+		directives []directive
+	}
+
+	// attribute is an attribute value of an LDIF record.
+	attribute struct {
+		name, value string
+		line        int
+	}
+
+	// directive is a `# yaldap: <tagged value>` comment, describing what
+	// LDIF cannot (e.g. `# yaldap: !!ldap/acl:allow-on dc=org`).
+	directive struct {
+		value        string
+		line, column int
+	}
+
+	// line is a logical LDIF line, once unfolded.
+	line struct {
+		value  string
+		number int
+	}
+
+	// ParseError describes a failure occurring during the parsing of the
+	// LDIF definition.
+	ParseError struct {
+		err  error
+		line int
+	}
+)
+
+// directivePrefix is the prefix of the comments carrying a YAML tagged value,
+// ignored by other LDIF implementations.
+const directivePrefix = "# yaldap:"
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid LDIF document at line %d: %s", e.line, e.err.Error())
+}
+func (e *ParseError) Unwrap() error { return e.err }
+
+// parseLDIF parses the given LDIF definition into records. Directives found
+// outside any record are returned apart. Files referred by `file://` URLs
+// (e.g. `jpegPhoto:< file:///tmp/alice.jpg`) are read, and their path
+// appended to the given list.
+func parseLDIF(raw []byte, files *[]string) ([]record, []directive, error) {
+	var (
+		records []record
+		globals []directive
+		current *record
+		version bool
+	)
+
+	for _, line := range unfold(raw) {
+		switch {
+		case line.value == "":
+			if current != nil {
+				records = append(records, *current)
+				current = nil
+			}
+			continue
+		case strings.HasPrefix(line.value, directivePrefix):
+			value := strings.TrimLeft(line.value[len(directivePrefix):], " ")
+			directive := directive{value: value, line: line.number, column: len(line.value) - len(value) + 1}
+			if current == nil {
+				globals = append(globals, directive)
+			} else {
+				current.directives = append(current.directives, directive)
+			}
+			continue
+		case strings.HasPrefix(line.value, "#"):
+			continue
+		}
+
+		name, value, err := parseLine(line.value, files)
+		if err != nil {
+			return nil, nil, &ParseError{err: err, line: line.number}
+		}
+
+		switch {
+		case current == nil && len(records) == 0 && !version && strings.EqualFold(name, "version"):
+			if value != "1" {
+				return nil, nil, &ParseError{err: fmt.Errorf("unsupported LDIF version '%s': only version 1 is supported", value), line: line.number}
+			}
+			version = true
+		case current == nil && !strings.EqualFold(name, "dn"):
+			return nil, nil, &ParseError{err: fmt.Errorf("invalid record: expected a 'dn' line, got '%s'", name), line: line.number}
+		case current == nil:
+			current = &record{dn: value, line: line.number}
+		case strings.EqualFold(name, "control") && len(current.attributes) == 0:
+			return nil, nil, &ParseError{err: fmt.Errorf("invalid record: controls are not supported"), line: line.number}
+		case strings.EqualFold(name, "changetype") && len(current.attributes) == 0:
+			if !strings.EqualFold(value, "add") {
+				return nil, nil, &ParseError{err: fmt.Errorf("unsupported changetype '%s': only 'add' records are supported", value), line: line.number}
+			}
+		default:
+			current.attributes = append(current.attributes, attribute{name: name, value: value, line: line.number})
+		}
+	}
+
+	if current != nil {
+		records = append(records, *current)
+	}
+	return records, globals, nil
+}
+
+// unfold returns the logical lines of the given LDIF definition: lines
+// starting with a single space continue the previous line (RFC 2849 folding).
+func unfold(raw []byte) []line {
+	var lines []line
+	for number, value := range strings.Split(string(raw), "\n") {
+		value = strings.TrimSuffix(value, "\r")
+
+		if strings.HasPrefix(value, " ") && len(lines) > 0 && lines[len(lines)-1].value != "" {
+			lines[len(lines)-1].value += value[1:]
+			continue
+		}
+		lines = append(lines, line{value: value, number: number + 1})
+	}
+	return lines
+}
+
+// parseLine parses the given `<name>: <value>` line, where the value can be
+// base64 encoded (`<name>:: <base64>`) or refer to a file (`<name>:< <URL>`).
+func parseLine(raw string, files *[]string) (string, string, error) {
+	name, value, found := strings.Cut(raw, ":")
+	if !found {
+		return "", "", fmt.Errorf("invalid line '%s': must be in the form '<attribute>: <value>'", raw)
+	}
+	if !isAttributeDescription(name) {
+		return "", "", fmt.Errorf("invalid attribute description '%s'", name)
+	}
+
+	switch {
+	case strings.HasPrefix(value, ":"):
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+		if err != nil {
+			return "", "", fmt.Errorf("invalid base64 value of '%s': %w", name, err)
+		}
+		return name, string(decoded), nil
+
+	case strings.HasPrefix(value, "<"):
+		location := strings.TrimSpace(value[1:])
+		u, err := url.Parse(location)
+		if err != nil || u.Scheme != "file" {
+			return "", "", fmt.Errorf("invalid URL value of '%s': only 'file://' URLs are supported", name)
+		}
+
+		content, err := os.ReadFile(u.Path)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid URL value of '%s': %w", name, err)
+		}
+		*files = append(*files, u.Path)
+		return name, string(content), nil
+
+	default:
+		return name, strings.TrimLeft(value, " "), nil
+	}
+}
+
+// isAttributeDescription returns true if the given name is a valid attribute
+// description: an attribute type (name or OID) followed by options (e.g.
+// `cn;lang-fr`).
+func isAttributeDescription(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	return strings.IndexFunc(name, func(c rune) bool {
+		return (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' && c != ';' && c != '.'
+	}) < 0
+}
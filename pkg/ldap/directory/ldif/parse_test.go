@@ -0,0 +1,124 @@
+package ldifdir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLDIF(t *testing.T) {
+	photo := filepath.Join(t.TempDir(), "alice.jpg")
+	require.NoError(t, os.WriteFile(photo, []byte{0xFF, 0xD8, 0xFF}, 0o600))
+
+	raw := []byte("version: 1\r\n" +
+		"# yaldap: !!ldap/acl:policy {'*': !!ldap/acl:allow-on dc=org}\r\n" +
+		"\r\n" +
+		"# comment folded\r\n" +
+		"  on two lines\r\n" +
+		"dn: cn=alice,\r\n" +
+		" dc=org\r\n" +
+		"changetype: add\r\n" +
+		"#  yaldap: !!ldap/bind:password alice\r\n" +
+		"# yaldap:   !!ldap/acl:allow-on\r\n" +
+		"  dc=org\r\n" +
+		"cn:alice\r\n" +
+		"description:: w4lxdWlwZQ==\r\n" +
+		"jpegPhoto:< file://" + photo + "\r\n" +
+		"empty:\r\n" +
+		"\r\n" +
+		"\r\n" +
+		"dn:: Y249Ym9iLGRjPW9yZw==\r\n" +
+		"cn;lang-fr: bob  \r\n")
+
+	var files []string
+	records, globals, err := parseLDIF(raw, &files)
+	require.NoError(t, err)
+
+	assert.Equal(t, []directive{{value: "!!ldap/acl:policy {'*': !!ldap/acl:allow-on dc=org}", line: 2, column: 11}}, globals)
+	assert.Equal(t,
+		[]record{
+			{
+				dn:   "cn=alice,dc=org",
+				line: 6,
+				attributes: []attribute{
+					{name: "cn", value: "alice", line: 12},
+					{name: "description", value: "Équipe", line: 13},
+					{name: "jpegPhoto", value: "\xFF\xD8\xFF", line: 14},
+					{name: "empty", value: "", line: 15},
+				},
+				directives: []directive{{value: "!!ldap/acl:allow-on dc=org", line: 10, column: 13}},
+			},
+			{
+				dn:         "cn=bob,dc=org",
+				line:       18,
+				attributes: []attribute{{name: "cn;lang-fr", value: "bob  ", line: 19}},
+			},
+		},
+		records,
+	)
+	assert.Equal(t, []string{photo}, files)
+}
+
+func TestParseLDIF_Invalid(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Raw   string
+		Error string
+	}{
+		{
+			Name:  "UnsupportedVersion",
+			Raw:   "version: 2\n",
+			Error: "invalid LDIF document at line 1: unsupported LDIF version '2': only version 1 is supported",
+		},
+		{
+			Name:  "MissingDN",
+			Raw:   "cn: alice\n",
+			Error: "invalid LDIF document at line 1: invalid record: expected a 'dn' line, got 'cn'",
+		},
+		{
+			Name:  "InvalidLine",
+			Raw:   "dn: cn=alice\nalice\n",
+			Error: "invalid LDIF document at line 2: invalid line 'alice': must be in the form '<attribute>: <value>'",
+		},
+		{
+			Name:  "InvalidAttributeDescription",
+			Raw:   "dn: cn=alice\ncommon name: alice\n",
+			Error: "invalid LDIF document at line 2: invalid attribute description 'common name'",
+		},
+		{
+			Name:  "InvalidBase64",
+			Raw:   "dn: cn=alice\ncn:: alice!\n",
+			Error: "invalid LDIF document at line 2: invalid base64 value of 'cn': illegal base64 data at input byte 5",
+		},
+		{
+			Name:  "UnsupportedURL",
+			Raw:   "dn: cn=alice\njpegPhoto:< http://example.org/alice.jpg\n",
+			Error: "invalid LDIF document at line 2: invalid URL value of 'jpegPhoto': only 'file://' URLs are supported",
+		},
+		{
+			Name:  "MissingFile",
+			Raw:   "dn: cn=alice\njpegPhoto:< file:///does-not-exist.jpg\n",
+			Error: "invalid LDIF document at line 2: invalid URL value of 'jpegPhoto': open /does-not-exist.jpg: no such file or directory",
+		},
+		{
+			Name:  "Control",
+			Raw:   "dn: cn=alice\ncontrol: 1.2.840.113556.1.4.805 true\nchangetype: add\n",
+			Error: "invalid LDIF document at line 2: invalid record: controls are not supported",
+		},
+		{
+			Name:  "UnsupportedChangetype",
+			Raw:   "dn: cn=alice\nchangetype: modify\nreplace: mail\n",
+			Error: "invalid LDIF document at line 2: unsupported changetype 'modify': only 'add' records are supported",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, _, err := parseLDIF([]byte(tt.Raw), new([]string))
+			assert.EqualError(t, err, tt.Error)
+		})
+	}
+}
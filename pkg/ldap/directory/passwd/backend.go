@@ -0,0 +1,87 @@
+package passwddir
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+)
+
+// Backend serves the directory built from Unix account files (passwd, shadow
+// and group) and Apache htpasswd files.
+type Backend struct {
+	BaseDN     string `name:"base-dn" help:"DN below which all entries are created" placeholder:"DN"`
+	Shadow     string `name:"shadow" help:"Path to the shadow file holding the hashed passwords of the passwd accounts" placeholder:"PATH"`
+	Group      string `name:"group" help:"Path to the group file describing the POSIX groups" placeholder:"PATH"`
+	Htpasswd   string `name:"htpasswd" help:"Path to an Apache htpasswd file describing additional users" placeholder:"PATH"`
+	PeopleOU   string `name:"people-ou" help:"Organizational unit of the passwd accounts" default:"people"`
+	GroupsOU   string `name:"groups-ou" help:"Organizational unit of the POSIX groups" default:"groups"`
+	HtpasswdOU string `name:"htpasswd-ou" help:"Organizational unit of the htpasswd users" default:"htpasswd"`
+	ACLPolicy  string `name:"acl-policy" help:"Path to the YAML file describing the ACL policy (!!ldap/acl:policy)" placeholder:"PATH"`
+}
+
+//nolint:gochecknoinits
+func init() {
+	ldap.RegisterBackend(
+		ldap.BackendInfo{
+			Name:        "passwd",
+			Description: "Directory built from passwd, shadow, group and htpasswd files (e.g. 'passwd:///etc/passwd')",
+			Schemes:     []string{"passwd"},
+		},
+		&Backend{},
+	)
+}
+
+// Validate checks that the base DN is valid and that all given files exist.
+func (b Backend) Validate(url string) error {
+	if b.BaseDN == "" {
+		return fmt.Errorf("a base DN is required (--backend.passwd.base-dn)")
+	}
+	if _, err := ldap.ParseDN(b.BaseDN); err != nil {
+		return fmt.Errorf("invalid base DN '%s': %w", b.BaseDN, err)
+	}
+	if filePath(url) == "" && b.Htpasswd == "" {
+		return fmt.Errorf("a passwd file or an htpasswd file (--backend.passwd.htpasswd) is required")
+	}
+
+	for _, file := range []struct{ kind, path string }{
+		{"passwd", filePath(url)},
+		{"shadow", b.Shadow},
+		{"group", b.Group},
+		{"htpasswd", b.Htpasswd},
+		{"ACL policy", b.ACLPolicy},
+	} {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			return fmt.Errorf("unable to read %s file: %w", file.kind, err)
+		}
+	}
+	return nil
+}
+
+// NewDirectory creates the directory built from the passwd file located at
+// the given URL and the other given files, enforcing the password policy
+// carried by the given context.
+func (b Backend) NewDirectory(ctx context.Context, url string) (ldap.Directory, error) {
+	opts := []Option{
+		WithOrganizationalUnits(b.PeopleOU, b.GroupsOU, b.HtpasswdOU),
+		WithPasswordPolicy(common.PasswordPolicyFromContext(ctx)),
+	}
+	if b.Shadow != "" {
+		opts = append(opts, WithShadow(b.Shadow))
+	}
+	if b.Group != "" {
+		opts = append(opts, WithGroup(b.Group))
+	}
+	if b.Htpasswd != "" {
+		opts = append(opts, WithHtpasswd(b.Htpasswd))
+	}
+	if b.ACLPolicy != "" {
+		opts = append(opts, WithACLPolicyFile(b.ACLPolicy))
+	}
+	return NewDirectory(url, b.BaseDN, opts...)
+}
@@ -0,0 +1,314 @@
+package passwddir
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+	"github.com/moznion/go-optional"
+)
+
+type (
+	// directory represents the LDAP directory built from Unix account files
+	// (passwd, shadow and group) and Apache htpasswd files. It contains all
+	// entries and an index for quick node search.
+	directory struct {
+		*common.Tree
+
+		passwordPolicy *common.PasswordPolicy
+		aclPolicy      []common.ACLPolicyRule
+
+		passwd, shadow, group, htpasswd string
+		aclPolicyFile                   string
+		peopleOU, groupsOU, htpasswdOU  string
+
+		// files contains all files the directory was built from.
+		files []string
+		// accounts contains the entries created from a line of a file.
+		accounts map[*common.Object]bool
+	}
+
+	// Option customizes the directory built from the account files.
+	Option func(directory *directory)
+)
+
+// Default organizational units of the entries, below the base DN.
+const (
+	DefaultPeopleOU   = "people"
+	DefaultGroupsOU   = "groups"
+	DefaultHtpasswdOU = "htpasswd"
+)
+
+// WithShadow reads the hashed passwords and the aging information of the
+// passwd accounts from the given shadow file.
+func WithShadow(path string) Option {
+	return func(directory *directory) { directory.shadow = path }
+}
+
+// WithGroup creates a `posixGroup` entry for each group of the given group
+// file.
+func WithGroup(path string) Option {
+	return func(directory *directory) { directory.group = path }
+}
+
+// WithHtpasswd creates an `inetOrgPerson` entry for each user of the given
+// Apache htpasswd file.
+func WithHtpasswd(path string) Option {
+	return func(directory *directory) { directory.htpasswd = path }
+}
+
+// WithOrganizationalUnits changes the organizational units of the passwd
+// accounts, the groups and the htpasswd users (DefaultPeopleOU,
+// DefaultGroupsOU and DefaultHtpasswdOU by default). Empty names are
+// ignored.
+func WithOrganizationalUnits(people, groups, htpasswd string) Option {
+	return func(directory *directory) {
+		if people != "" {
+			directory.peopleOU = people
+		}
+		if groups != "" {
+			directory.groupsOU = groups
+		}
+		if htpasswd != "" {
+			directory.htpasswdOU = htpasswd
+		}
+	}
+}
+
+// WithACLPolicyFile applies the ACL policy described by the given YAML file,
+// containing a single `!!ldap/acl:policy` document, to the whole directory.
+func WithACLPolicyFile(path string) Option {
+	return func(directory *directory) { directory.aclPolicyFile = path }
+}
+
+// WithPasswordPolicy enforces the given password policy on all objects of the
+// directory.
+func WithPasswordPolicy(policy *common.PasswordPolicy) Option {
+	return func(directory *directory) { directory.passwordPolicy = policy }
+}
+
+// NewDirectory creates the directory, below the given base DN, describing the
+// accounts of the passwd file located at the given URL (e.g.
+// `passwd:///etc/passwd`) and of the files given by the options. Without
+// path (`passwd://`), only the files given by the options are used.
+func NewDirectory(url, baseDN string, opts ...Option) (ldap.Directory, error) {
+	base, err := ldap.ParseDN(baseDN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base DN '%s': %w", baseDN, err)
+	}
+
+	directory := &directory{
+		Tree:       common.NewTree(),
+		accounts:   map[*common.Object]bool{},
+		passwd:     filePath(url),
+		peopleOU:   DefaultPeopleOU,
+		groupsOU:   DefaultGroupsOU,
+		htpasswdOU: DefaultHtpasswdOU,
+	}
+	for _, opt := range opts {
+		opt(directory)
+	}
+
+	if directory.passwd != "" {
+		if err := directory.loadAccounts(base); err != nil {
+			return nil, err
+		}
+	}
+	if directory.group != "" {
+		if err := directory.loadGroups(base); err != nil {
+			return nil, err
+		}
+	}
+	if directory.htpasswd != "" {
+		if err := directory.loadHtpasswd(base); err != nil {
+			return nil, err
+		}
+	}
+	if directory.aclPolicyFile != "" {
+		if err := directory.loadACLPolicy(); err != nil {
+			return nil, err
+		}
+	}
+
+	directory.Index(directory.passwordPolicy)
+	common.ResolveACLs(directory.Root(), directory.aclPolicy)
+	return directory, nil
+}
+
+// filePath returns the path of the passwd file located at the given URL.
+func filePath(url string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(url, "passwd://"), "file://")
+}
+
+// loadAccounts creates a `posixAccount` entry for each account of the passwd
+// file, completed by the shadow file if any.
+func (d *directory) loadAccounts(base ldap.DN) error {
+	accounts, err := parsePasswd(d.passwd)
+	if err != nil {
+		return fmt.Errorf("unable to load passwd file: %w", err)
+	}
+	d.files = append(d.files, d.passwd)
+
+	shadows := map[string]shadowEntry{}
+	if d.shadow != "" {
+		entries, err := parseShadow(d.shadow)
+		if err != nil {
+			return fmt.Errorf("unable to load shadow file: %w", err)
+		}
+		d.files = append(d.files, d.shadow)
+
+		for _, entry := range entries {
+			shadows[entry.name] = entry
+		}
+	}
+
+	ou := d.organizationalUnit(base, d.peopleOU)
+	for _, account := range accounts {
+		obj, err := d.newEntry(ou, "uid", account.name, "top", "account", "posixAccount")
+		if err != nil {
+			return fmt.Errorf("unable to load passwd file: %w", err)
+		}
+
+		cn, _, _ := strings.Cut(account.gecos, ",")
+		if cn == "" {
+			cn = account.name
+		}
+		obj.AddAttribute("cn", cn)
+		obj.AddAttribute("uidNumber", account.uid)
+		obj.AddAttribute("gidNumber", account.gid)
+		obj.AddAttribute("homeDirectory", account.home)
+		if account.shell != "" {
+			obj.AddAttribute("loginShell", account.shell)
+		}
+		if account.gecos != "" {
+			obj.AddAttribute("gecos", account.gecos)
+		}
+
+		password := account.password
+		if shadow, exists := shadows[account.name]; exists {
+			obj.AddAttribute("objectClass", "shadowAccount")
+			for _, attribute := range shadowAgingAttributes {
+				if value, exists := shadow.aging[attribute]; exists {
+					obj.AddAttribute(attribute, value)
+				}
+			}
+			password = shadow.password
+		}
+		obj.BindPasswords = bindPassword(password)
+	}
+	return nil
+}
+
+// loadGroups creates a `posixGroup` entry for each group of the group file.
+func (d *directory) loadGroups(base ldap.DN) error {
+	groups, err := parseGroup(d.group)
+	if err != nil {
+		return fmt.Errorf("unable to load group file: %w", err)
+	}
+	d.files = append(d.files, d.group)
+
+	ou := d.organizationalUnit(base, d.groupsOU)
+	for _, group := range groups {
+		obj, err := d.newEntry(ou, "cn", group.name, "top", "posixGroup")
+		if err != nil {
+			return fmt.Errorf("unable to load group file: %w", err)
+		}
+
+		obj.AddAttribute("gidNumber", group.gid)
+		if len(group.members) > 0 {
+			obj.AddAttribute("memberUid", group.members...)
+		}
+	}
+	return nil
+}
+
+// loadHtpasswd creates an `inetOrgPerson` entry for each user of the htpasswd
+// file.
+func (d *directory) loadHtpasswd(base ldap.DN) error {
+	users, err := parseHtpasswd(d.htpasswd)
+	if err != nil {
+		return fmt.Errorf("unable to load htpasswd file: %w", err)
+	}
+	d.files = append(d.files, d.htpasswd)
+
+	ou := d.organizationalUnit(base, d.htpasswdOU)
+	for _, user := range users {
+		obj, err := d.newEntry(ou, "uid", user.name, "top", "person", "organizationalPerson", "inetOrgPerson")
+		if err != nil {
+			return fmt.Errorf("unable to load htpasswd file: %w", err)
+		}
+
+		obj.AddAttribute("cn", user.name)
+		obj.AddAttribute("sn", user.name)
+		obj.BindPasswords = bindPassword(user.password)
+	}
+	return nil
+}
+
+// loadACLPolicy reads the ACL policy from the ACL policy file.
+func (d *directory) loadACLPolicy() error {
+	raw, err := os.ReadFile(d.aclPolicyFile)
+	if err != nil {
+		return fmt.Errorf("unable to read ACL policy file: %w", err)
+	}
+	d.files = append(d.files, d.aclPolicyFile)
+
+	d.aclPolicy, err = yamldir.ParseACLPolicyValue(string(raw), 1, 1)
+	if err != nil {
+		return fmt.Errorf("invalid ACL policy file '%s': %w", d.aclPolicyFile, err)
+	}
+	return nil
+}
+
+// organizationalUnit returns the DN of the given organizational unit below
+// the given base DN, creating its entry if needed.
+func (d *directory) organizationalUnit(base ldap.DN, name string) ldap.DN {
+	dn := append(ldap.DN{ldap.RDN{{Type: "ou", Value: name}}}, base...)
+
+	obj := d.LookupOrCreate(dn)
+	if _, exists := obj.ImplObject.Attributes["objectClass"]; !exists {
+		obj.AddAttribute("objectClass", "top", "organizationalUnit")
+	}
+	return dn
+}
+
+// newEntry creates the entry, with the given object classes, whose RDN is
+// the given attribute and value below the given parent.
+func (d *directory) newEntry(parent ldap.DN, attribute, value string, objectClasses ...string) (*common.Object, error) {
+	dn := append(ldap.DN{ldap.RDN{{Type: attribute, Value: value}}}, parent...)
+	obj := d.LookupOrCreate(dn)
+	if d.accounts[obj] {
+		return nil, fmt.Errorf("entry '%s' is already defined", dn)
+	}
+	d.accounts[obj] = true
+	obj.AddAttribute("objectClass", objectClasses...)
+	return obj, nil
+}
+
+// bindPassword returns the bind password described by the given password
+// field of a passwd, shadow or htpasswd file. Fields without password (e.g.
+// `x` or `*`) or locked (starting with `!`) cannot be used to bind.
+func bindPassword(field string) optional.Option[string] {
+	switch {
+	case field == "", field == "x", strings.HasPrefix(field, "*"), strings.HasPrefix(field, "!"):
+		return optional.None[string]()
+	case strings.HasPrefix(field, "{"):
+		// NOTE: htpasswd files can contain RFC 2307 values (e.g. `{SHA}`).
+		return optional.Some(field)
+	default:
+		// NOTE: other values are crypt(3) hashes (e.g. `$6$`, `$2y$` or
+		//       `$apr1$`), verified through the `{CRYPT}` scheme.
+		return optional.Some("{CRYPT}" + field)
+	}
+}
+
+// ACLPolicy returns the ACL rules applying to the whole directory, read from
+// the ACL policy file.
+func (d *directory) ACLPolicy() []common.ACLPolicyRule { return d.aclPolicy }
+
+// WatchedFiles returns the passwd, shadow, group, htpasswd and ACL policy
+// files the directory was built from.
+func (d *directory) WatchedFiles() []string { return d.files }
@@ -0,0 +1,205 @@
+package passwddir_test
+
+import (
+	"testing"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	passwddir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/passwd"
+	"github.com/jimlambrt/gldap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFixtureDirectory creates the directory built from all fixture files.
+func newFixtureDirectory(t *testing.T, opts ...passwddir.Option) ldap.Directory {
+	t.Helper()
+
+	opts = append([]passwddir.Option{
+		passwddir.WithShadow("fixtures/shadow"),
+		passwddir.WithGroup("fixtures/group"),
+		passwddir.WithHtpasswd("fixtures/htpasswd"),
+		passwddir.WithACLPolicyFile("fixtures/policy.yaml"),
+	}, opts...)
+	directory, err := passwddir.NewDirectory("passwd://fixtures/passwd", "dc=example,dc=org", opts...)
+	require.NoError(t, err)
+	return directory
+}
+
+func TestNewDirectory_Fixture(t *testing.T) {
+	directory := newFixtureDirectory(t)
+
+	assert.Equal(t,
+		[]string{"fixtures/passwd", "fixtures/shadow", "fixtures/group", "fixtures/htpasswd", "fixtures/policy.yaml"},
+		directory.(ldap.Watchable).WatchedFiles(),
+	)
+
+	t.Run("uid=alice,ou=people,dc=example,dc=org", func(t *testing.T) {
+		alice := directory.BaseDN("uid=alice,ou=people,dc=example,dc=org")
+		require.NotNil(t, alice)
+
+		assert.Equal(t,
+			ldap.Attributes{
+				"objectClass":      {"top", "account", "posixAccount", "shadowAccount"},
+				"uid":              {"alice"},
+				"cn":               {"Alice Smith"},
+				"uidNumber":        {"1000"},
+				"gidNumber":        {"1000"},
+				"homeDirectory":    {"/home/alice"},
+				"loginShell":       {"/bin/bash"},
+				"gecos":            {"Alice Smith,,,"},
+				"shadowLastChange": {"19000"},
+				"shadowMin":        {"0"},
+				"shadowMax":        {"99999"},
+				"shadowWarning":    {"7"},
+			},
+			alice.Attributes(),
+		)
+
+		valid, err := alice.Bind("alice")
+		require.NoError(t, err)
+		assert.True(t, valid)
+	})
+
+	t.Run("uid=bob,ou=people,dc=example,dc=org", func(t *testing.T) {
+		bob := directory.BaseDN("uid=bob,ou=people,dc=example,dc=org")
+		require.NotNil(t, bob)
+
+		assert.Equal(t, []string{"bob"}, bob.Attributes()["cn"])
+		assert.NotContains(t, bob.Attributes(), "loginShell")
+		assert.NotContains(t, bob.Attributes(), "gecos")
+
+		// NOTE: locked passwords cannot be used to bind
+		valid, err := bob.Bind("alice")
+		require.NoError(t, err)
+		assert.False(t, valid)
+	})
+
+	t.Run("cn=users,ou=groups,dc=example,dc=org", func(t *testing.T) {
+		users := directory.BaseDN("cn=users,ou=groups,dc=example,dc=org")
+		require.NotNil(t, users)
+
+		assert.Equal(t,
+			ldap.Attributes{
+				"objectClass": {"top", "posixGroup"},
+				"cn":          {"users"},
+				"gidNumber":   {"1000"},
+				"memberUid":   {"alice", "bob"},
+			},
+			users.Attributes(),
+		)
+	})
+
+	t.Run("ou=htpasswd,dc=example,dc=org", func(t *testing.T) {
+		htpasswd := directory.BaseDN("ou=htpasswd,dc=example,dc=org")
+		require.NotNil(t, htpasswd)
+		assert.Equal(t, ldap.Attributes{"objectClass": {"top", "organizationalUnit"}, "ou": {"htpasswd"}}, htpasswd.Attributes())
+
+		for _, user := range []string{"carol", "dave", "erin"} {
+			entry := directory.BaseDN("uid=" + user + ",ou=htpasswd,dc=example,dc=org")
+			require.NotNil(t, entry, user)
+			assert.Equal(t, []string{"top", "person", "organizationalPerson", "inetOrgPerson"}, entry.Attributes()["objectClass"])
+			assert.Equal(t, []string{user}, entry.Attributes()["sn"])
+
+			valid, err := entry.Bind(user)
+			require.NoError(t, err)
+			assert.True(t, valid, user)
+		}
+	})
+
+	t.Run("ACLs", func(t *testing.T) {
+		alice := directory.BaseDN("uid=alice,ou=people,dc=example,dc=org")
+		bob := directory.BaseDN("uid=bob,ou=people,dc=example,dc=org")
+		carol := directory.BaseDN("uid=carol,ou=htpasswd,dc=example,dc=org")
+
+		assert.True(t, alice.CanSearchOn(bob))
+		assert.True(t, bob.CanSearchOn(carol))
+		assert.False(t, carol.CanSearchOn(alice))
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		entries, err := directory.BaseDN("dc=example,dc=org").Search(gldap.WholeSubtree, "(|(memberUid=alice)(uidNumber=0))")
+		require.NoError(t, err)
+
+		var dns []string
+		for _, entry := range entries {
+			dns = append(dns, entry.DN())
+		}
+		assert.ElementsMatch(t, []string{"cn=users,ou=groups,dc=example,dc=org", "uid=root,ou=people,dc=example,dc=org"}, dns)
+	})
+}
+
+func TestNewDirectory_OrganizationalUnits(t *testing.T) {
+	directory := newFixtureDirectory(t, passwddir.WithOrganizationalUnits("users", "", "users"))
+
+	assert.NotNil(t, directory.BaseDN("uid=alice,ou=users,dc=example,dc=org"))
+	assert.NotNil(t, directory.BaseDN("uid=carol,ou=users,dc=example,dc=org"))
+	assert.NotNil(t, directory.BaseDN("cn=users,ou=groups,dc=example,dc=org"))
+	assert.Nil(t, directory.BaseDN("ou=people,dc=example,dc=org"))
+}
+
+func TestNewDirectory_HtpasswdOnly(t *testing.T) {
+	directory, err := passwddir.NewDirectory("passwd://", "dc=org", passwddir.WithHtpasswd("fixtures/htpasswd"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"fixtures/htpasswd"}, directory.(ldap.Watchable).WatchedFiles())
+	assert.Nil(t, directory.BaseDN("ou=people,dc=org"))
+	assert.NotNil(t, directory.BaseDN("uid=dave,ou=htpasswd,dc=org"))
+}
+
+func TestNewDirectory_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		baseDN   string
+		opts     []passwddir.Option
+		expected string
+	}{
+		{
+			name:     "InvalidBaseDN",
+			url:      "passwd://fixtures/passwd",
+			baseDN:   "dc",
+			expected: "invalid base DN 'dc': invalid DN 'dc': missing '=' in 'dc'",
+		},
+		{
+			name:     "NoPasswdFile",
+			url:      "passwd://fixtures/does-not-exist",
+			baseDN:   "dc=org",
+			expected: "unable to load passwd file: unable to read file: open fixtures/does-not-exist: no such file or directory",
+		},
+		{
+			name:     "InvalidShadowFile",
+			url:      "passwd://fixtures/passwd",
+			baseDN:   "dc=org",
+			opts:     []passwddir.Option{passwddir.WithShadow("fixtures/group")},
+			expected: "unable to load shadow file: invalid line 2 of 'fixtures/group': invalid shadowMin 'alice,bob'",
+		},
+		{
+			name:     "DuplicatedEntry",
+			url:      "passwd://fixtures/passwd",
+			baseDN:   "dc=org",
+			opts:     []passwddir.Option{passwddir.WithHtpasswd("fixtures/passwd"), passwddir.WithOrganizationalUnits("", "", "people")},
+			expected: "unable to load htpasswd file: entry 'uid=root,ou=people,dc=org' is already defined",
+		},
+		{
+			name:     "InvalidACLPolicy",
+			url:      "passwd://fixtures/passwd",
+			baseDN:   "dc=org",
+			opts:     []passwddir.Option{passwddir.WithACLPolicyFile("fixtures/group")},
+			expected: "invalid ACL policy file 'fixtures/group': invalid YAML value: yaml: line 2: could not find expected ':'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := passwddir.NewDirectory(tt.url, tt.baseDN, tt.opts...)
+			assert.EqualError(t, err, tt.expected)
+		})
+	}
+}
+
+func TestNewDirectory_DisabledPassword(t *testing.T) {
+	directory := newFixtureDirectory(t)
+
+	root := directory.BaseDN("uid=root,ou=people,dc=example,dc=org").(*common.Object)
+	assert.True(t, root.BindPasswords.IsNone())
+}
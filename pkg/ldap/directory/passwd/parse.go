@@ -0,0 +1,162 @@
+package passwddir
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type (
+	// passwdEntry represents an account of a passwd file
+	// (`name:password:uid:gid:gecos:home:shell`).
+	passwdEntry struct {
+		name, password     string
+		uid, gid           string
+		gecos, home, shell string
+	}
+
+	// shadowEntry represents an account of a shadow file
+	// (`name:password:lastchg:min:max:warn:inactive:expire:flag`). Aging
+	// fields are indexed by their `shadowAccount` attribute name.
+	shadowEntry struct {
+		name, password string
+		aging          map[string]string
+	}
+
+	// groupEntry represents a group of a group file
+	// (`name:password:gid:members`).
+	groupEntry struct {
+		name, gid string
+		members   []string
+	}
+
+	// htpasswdEntry represents a user of an Apache htpasswd file
+	// (`name:hash`).
+	htpasswdEntry struct {
+		name, password string
+	}
+
+	// ParseError describes a failure occurring during the parsing of a line
+	// of a passwd, shadow, group or htpasswd file.
+	ParseError struct {
+		err  error
+		path string
+		line int
+	}
+)
+
+// shadowAgingAttributes lists the `shadowAccount` attributes matching the
+// fields of a shadow file, after the name and the password.
+var shadowAgingAttributes = []string{"shadowLastChange", "shadowMin", "shadowMax", "shadowWarning", "shadowInactive", "shadowExpire", "shadowFlag"}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid line %d of '%s': %s", e.line, e.path, e.err.Error())
+}
+func (e *ParseError) Unwrap() error { return e.err }
+
+// parsePasswd parses the given passwd file.
+func parsePasswd(path string) ([]passwdEntry, error) {
+	var entries []passwdEntry
+	err := parseFile(path, 7, 7, func(fields []string) error {
+		for _, id := range fields[2:4] {
+			if _, err := strconv.ParseUint(id, 10, 32); err != nil {
+				return fmt.Errorf("invalid ID '%s'", id)
+			}
+		}
+
+		entries = append(entries, passwdEntry{
+			name: fields[0], password: fields[1],
+			uid: fields[2], gid: fields[3],
+			gecos: fields[4], home: fields[5], shell: fields[6],
+		})
+		return nil
+	})
+	return entries, err
+}
+
+// parseShadow parses the given shadow file. Only the name and the password
+// are required, empty aging fields are ignored.
+func parseShadow(path string) ([]shadowEntry, error) {
+	var entries []shadowEntry
+	err := parseFile(path, 2, 9, func(fields []string) error {
+		entry := shadowEntry{name: fields[0], password: fields[1], aging: map[string]string{}}
+		for i, value := range fields[2:] {
+			if value == "" {
+				continue
+			}
+			if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+				return fmt.Errorf("invalid %s '%s'", shadowAgingAttributes[i], value)
+			}
+			entry.aging[shadowAgingAttributes[i]] = value
+		}
+
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// parseGroup parses the given group file.
+func parseGroup(path string) ([]groupEntry, error) {
+	var entries []groupEntry
+	err := parseFile(path, 4, 4, func(fields []string) error {
+		if _, err := strconv.ParseUint(fields[2], 10, 32); err != nil {
+			return fmt.Errorf("invalid ID '%s'", fields[2])
+		}
+
+		entry := groupEntry{name: fields[0], gid: fields[2]}
+		for _, member := range strings.Split(fields[3], ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				entry.members = append(entry.members, member)
+			}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// parseHtpasswd parses the given Apache htpasswd file.
+func parseHtpasswd(path string) ([]htpasswdEntry, error) {
+	var entries []htpasswdEntry
+	err := parseFile(path, 2, 2, func(fields []string) error {
+		entries = append(entries, htpasswdEntry{name: fields[0], password: fields[1]})
+		return nil
+	})
+	return entries, err
+}
+
+// parseFile calls the given function with the fields of each line of the
+// given file, separated by `:`. Empty lines, comments and NIS compatibility
+// lines (starting with `+` or `-`) are ignored. Each line must have a
+// non-empty name and between minFields and maxFields fields; the last field
+// contains all remaining separators.
+func parseFile(path string, minFields, maxFields int, fn func(fields []string) error) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read file: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if text == "" || text[0] == '#' || text[0] == '+' || text[0] == '-' {
+			continue
+		}
+
+		fields := strings.SplitN(text, ":", maxFields)
+		switch {
+		case len(fields) < minFields:
+			return &ParseError{err: fmt.Errorf("expected at least %d fields separated by ':'", minFields), path: path, line: line}
+		case fields[0] == "":
+			return &ParseError{err: fmt.Errorf("empty name"), path: path, line: line}
+		}
+		if err := fn(fields); err != nil {
+			return &ParseError{err: err, path: path, line: line}
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,130 @@
+package passwddir
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFile writes the given content inside a temporary file and returns its
+// path.
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestParsePasswd(t *testing.T) {
+	path := writeFile(t, "# comment\r\n"+
+		"\r\n"+
+		"alice:x:1000:1000:Alice Smith,,,:/home/alice:/bin/bash\r\n"+
+		"+@nis::::::\r\n"+
+		"-bob\r\n"+
+		"bob::1001:100::/home/bob:\r\n")
+
+	entries, err := parsePasswd(path)
+	require.NoError(t, err)
+	assert.Equal(t,
+		[]passwdEntry{
+			{name: "alice", password: "x", uid: "1000", gid: "1000", gecos: "Alice Smith,,,", home: "/home/alice", shell: "/bin/bash"},
+			{name: "bob", password: "", uid: "1001", gid: "100", gecos: "", home: "/home/bob", shell: ""},
+		},
+		entries,
+	)
+}
+
+func TestParseShadow(t *testing.T) {
+	path := writeFile(t, "alice:$6$salt$hash:19000:0:99999:7:::\n"+
+		"bob:!\n")
+
+	entries, err := parseShadow(path)
+	require.NoError(t, err)
+	assert.Equal(t,
+		[]shadowEntry{
+			{
+				name:     "alice",
+				password: "$6$salt$hash",
+				aging:    map[string]string{"shadowLastChange": "19000", "shadowMin": "0", "shadowMax": "99999", "shadowWarning": "7"},
+			},
+			{name: "bob", password: "!", aging: map[string]string{}},
+		},
+		entries,
+	)
+}
+
+func TestParseGroup(t *testing.T) {
+	path := writeFile(t, "root:x:0:\nusers:x:100:alice, bob\n")
+
+	entries, err := parseGroup(path)
+	require.NoError(t, err)
+	assert.Equal(t,
+		[]groupEntry{
+			{name: "root", gid: "0"},
+			{name: "users", gid: "100", members: []string{"alice", "bob"}},
+		},
+		entries,
+	)
+}
+
+func TestParseHtpasswd(t *testing.T) {
+	path := writeFile(t, "alice:$apr1$salt$hash\nbob:{SHA}hash:with:colons\n")
+
+	entries, err := parseHtpasswd(path)
+	require.NoError(t, err)
+	assert.Equal(t,
+		[]htpasswdEntry{
+			{name: "alice", password: "$apr1$salt$hash"},
+			{name: "bob", password: "{SHA}hash:with:colons"},
+		},
+		entries,
+	)
+}
+
+func TestParseFile_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		parse    func(path string) error
+		content  string
+		expected string
+	}{
+		{
+			name:     "MissingPasswdFields",
+			parse:    func(path string) error { _, err := parsePasswd(path); return err },
+			content:  "root:x:0:0\n",
+			expected: "invalid line 1 of '%s': expected at least 7 fields separated by ':'",
+		},
+		{
+			name:     "InvalidUID",
+			parse:    func(path string) error { _, err := parsePasswd(path); return err },
+			content:  "\nroot:x:zero:0:root:/root:/bin/sh\n",
+			expected: "invalid line 2 of '%s': invalid ID 'zero'",
+		},
+		{
+			name:     "EmptyName",
+			parse:    func(path string) error { _, err := parseGroup(path); return err },
+			content:  ":x:0:\n",
+			expected: "invalid line 1 of '%s': empty name",
+		},
+		{
+			name:     "InvalidShadowAging",
+			parse:    func(path string) error { _, err := parseShadow(path); return err },
+			content:  "root:*:yesterday\n",
+			expected: "invalid line 1 of '%s': invalid shadowLastChange 'yesterday'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, tt.content)
+			assert.EqualError(t, tt.parse(path), fmt.Sprintf(tt.expected, path))
+		})
+	}
+
+	_, err := parsePasswd("fixtures/does-not-exist")
+	assert.EqualError(t, err, "unable to read file: open fixtures/does-not-exist: no such file or directory")
+}
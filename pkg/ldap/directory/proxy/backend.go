@@ -0,0 +1,92 @@
+package proxydir
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+)
+
+// Backend mirrors the entries of an upstream LDAP server, with an optional
+// YAML overlay on top of them.
+type Backend struct {
+	BindDN       string        `name:"bind-dn" help:"DN of the service account used to read the upstream LDAP server" placeholder:"DN"`
+	PasswordFile []byte        `name:"password-file" help:"Path to the file containing the password of the service account" optional:"" type:"filecontent" placeholder:"PATH"`
+	Overlay      string        `name:"overlay" help:"URL of a YAML directory merged on top of the upstream entries" placeholder:"URL"`
+	CacheTTL     time.Duration `name:"cache-ttl" help:"Duration after which the upstream entries are fetched again, in the background" default:"30s"`
+	Attributes   []string      `name:"attributes" help:"Attributes fetched from the upstream server (default: the common account and group attributes)" placeholder:"ATTRIBUTE"`
+	StartTLS     bool          `name:"start-tls" help:"Secure the connections to 'ldap://' upstream servers using StartTLS" default:"false" negatable:""`
+	CAFile       []byte        `name:"ca" help:"Path to the CA file used to verify the upstream server certificate" optional:"" type:"filecontent" placeholder:"PATH"`
+}
+
+//nolint:gochecknoinits
+func init() {
+	ldap.RegisterBackend(
+		ldap.BackendInfo{
+			Name:        "proxy",
+			Description: "Mirror of an upstream LDAP server, below the base DN of the URL (e.g. 'ldap://ldap.example.org/dc=example,dc=org')",
+			Schemes:     []string{"ldap", "ldaps"},
+		},
+		&Backend{},
+	)
+}
+
+// Validate checks the upstream URL, the service account and the overlay.
+func (b Backend) Validate(url string) error {
+	if _, err := newUpstream(url); err != nil {
+		return err
+	}
+	if len(b.PasswordFile) > 0 && b.BindDN == "" {
+		return errors.New("invalid service account: a password is given without bind DN")
+	}
+	if b.StartTLS && strings.HasPrefix(url, "ldaps://") {
+		return errors.New("StartTLS cannot be used with an 'ldaps://' upstream server")
+	}
+	if len(b.CAFile) > 0 && !x509.NewCertPool().AppendCertsFromPEM(b.CAFile) {
+		return errors.New("invalid upstream CA file: no PEM certificate found")
+	}
+	if b.CacheTTL < 0 {
+		return fmt.Errorf("invalid cache TTL '%s': must be positive", b.CacheTTL)
+	}
+	if b.Overlay != "" {
+		if err := (yamldir.Backend{}).Validate(b.Overlay); err != nil {
+			return fmt.Errorf("invalid proxy overlay: %w", err)
+		}
+	}
+	return nil
+}
+
+// NewDirectory creates the directory mirroring the upstream LDAP server at the
+// given URL, with the overlay (enforcing the password policy carried by the
+// given context) on top of it.
+func (b Backend) NewDirectory(ctx context.Context, url string) (ldap.Directory, error) {
+	opts := []Option{WithCacheTTL(b.CacheTTL)}
+	if b.BindDN != "" {
+		opts = append(opts, WithServiceAccount(b.BindDN, strings.TrimSpace(string(b.PasswordFile))))
+	}
+	if len(b.Attributes) > 0 {
+		opts = append(opts, WithAttributes(b.Attributes...))
+	}
+	if b.StartTLS {
+		opts = append(opts, WithStartTLS())
+	}
+	if len(b.CAFile) > 0 {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(b.CAFile)
+		opts = append(opts, WithRootCAs(pool))
+	}
+
+	if b.Overlay != "" {
+		overlay, err := (yamldir.Backend{}).NewDirectory(ctx, b.Overlay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy overlay: %w", err)
+		}
+		opts = append(opts, WithOverlay(overlay))
+	}
+	return NewDirectory(url, opts...)
+}
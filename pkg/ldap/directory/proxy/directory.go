@@ -0,0 +1,193 @@
+package proxydir
+
+import (
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+)
+
+type (
+	// directory mirrors the entries of an upstream LDAP server, enriched by a
+	// local overlay directory. Entries are fetched again from the upstream
+	// server, in the background, once the cache expires.
+	directory struct {
+		upstream *upstream
+		overlay  ldap.Directory
+		cacheTTL time.Duration
+		logger   *slog.Logger
+
+		snapshot   atomic.Pointer[snapshot]
+		refreshing atomic.Bool
+	}
+
+	// snapshot contains the merged entries of the upstream server and the
+	// overlay at the time they were fetched.
+	snapshot struct {
+		*common.Tree
+		fetchedAt time.Time
+	}
+
+	// Option customizes the directory mirroring the upstream server.
+	Option func(directory *directory)
+)
+
+// DefaultCacheTTL is the duration during which the upstream entries are
+// served without being fetched again.
+const DefaultCacheTTL = 30 * time.Second
+
+// WithServiceAccount binds to the upstream server using the given DN and
+// password before reading its entries.
+func WithServiceAccount(dn, password string) Option {
+	return func(directory *directory) {
+		directory.upstream.bindDN = dn
+		directory.upstream.bindPassword = password
+	}
+}
+
+// WithAttributes changes the attributes fetched from the upstream server
+// (DefaultAttributes by default). The `objectClass` attribute, used by most
+// filters and ACL rules, is always fetched.
+func WithAttributes(attributes ...string) Option {
+	return func(directory *directory) {
+		if !slices.ContainsFunc(attributes, func(name string) bool { return strings.EqualFold(name, "objectClass") }) {
+			attributes = append([]string{"objectClass"}, attributes...)
+		}
+		directory.upstream.attributes = attributes
+	}
+}
+
+// WithStartTLS secures the connections to `ldap://` upstream servers using
+// the StartTLS operation.
+func WithStartTLS() Option {
+	return func(directory *directory) { directory.upstream.startTLS = true }
+}
+
+// WithRootCAs verifies the certificate of the upstream server using the
+// given certificate authorities instead of the system ones.
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(directory *directory) { directory.upstream.tlsConfig.RootCAs = pool }
+}
+
+// WithOverlay merges the entries of the given directory on top of the upstream
+// ones: new entries are added, attributes and ACL rules are appended to the
+// existing entries and its ACL policy is applied on all entries.
+// The overlay must be based on common objects (like the YAML directory).
+func WithOverlay(overlay ldap.Directory) Option {
+	return func(directory *directory) { directory.overlay = overlay }
+}
+
+// WithCacheTTL changes the duration during which the upstream entries are
+// served without being fetched again (DefaultCacheTTL by default).
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(directory *directory) { directory.cacheTTL = ttl }
+}
+
+// WithLogger changes the logger used to report upstream failures.
+func WithLogger(logger *slog.Logger) Option {
+	return func(directory *directory) { directory.logger = logger }
+}
+
+// NewDirectory creates a directory mirroring the upstream LDAP server
+// described by the given LDAP URL, where the DN is the base of the mirrored
+// entries (e.g. `ldap://ldap.example.org/dc=example,dc=org`).
+// Binds on mirrored entries are forwarded to the upstream server.
+func NewDirectory(url string, opts ...Option) (ldap.Directory, error) {
+	upstream, err := newUpstream(url)
+	if err != nil {
+		return nil, err
+	}
+
+	directory := &directory{
+		upstream: upstream,
+		cacheTTL: DefaultCacheTTL,
+		logger:   slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(directory)
+	}
+
+	if directory.overlay != nil {
+		if _, valid := directory.overlay.BaseDN("").(*common.Object); !valid {
+			return nil, fmt.Errorf("invalid overlay: only directories based on common objects are supported")
+		}
+	}
+
+	if !directory.upstream.secured() {
+		directory.logger.Warn("the connections to the upstream server are not encrypted; binds are forwarded in clear text",
+			slog.String("upstream", directory.upstream.url))
+	}
+
+	// NOTE: entries are fetched once to detect configuration issues early.
+	snapshot, err := directory.fetch()
+	if err != nil {
+		return nil, err
+	}
+	directory.snapshot.Store(snapshot)
+	return directory, nil
+}
+
+// BaseDN returns the LDAP object represented by the given DN, using the last
+// upstream entries fetched.
+func (d *directory) BaseDN(dn string) ldap.Object { return d.current().BaseDN(dn) }
+
+// WatchedFiles returns the files the overlay was built from, if any.
+func (d *directory) WatchedFiles() []string {
+	if watchable, ok := d.overlay.(ldap.Watchable); ok {
+		return watchable.WatchedFiles()
+	}
+	return nil
+}
+
+// current returns the current snapshot. Once the cache has expired, the
+// upstream entries are fetched again in the background, without blocking the
+// requests served with the current snapshot.
+func (d *directory) current() *snapshot {
+	current := d.snapshot.Load()
+	if time.Since(current.fetchedAt) >= d.cacheTTL && d.refreshing.CompareAndSwap(false, true) {
+		go d.refresh(current)
+	}
+	return current
+}
+
+// refresh replaces the given snapshot by a new one. If the upstream server
+// cannot be reached, the entries of the given snapshot are kept until the
+// cache expires again.
+func (d *directory) refresh(current *snapshot) {
+	defer d.refreshing.Store(false)
+
+	next, err := d.fetch()
+	if err != nil {
+		d.logger.Error("unable to fetch upstream entries, previous ones are kept", slog.String("error", err.Error()))
+		next = &snapshot{Tree: current.Tree, fetchedAt: time.Now()}
+	}
+	d.snapshot.Store(next)
+}
+
+// fetch reads all upstream entries and merges the overlay on top of them.
+func (d *directory) fetch() (*snapshot, error) {
+	fetchedAt := time.Now()
+	tree, err := d.upstream.entries()
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch upstream entries: %w", err)
+	}
+
+	var policy []common.ACLPolicyRule
+	if d.overlay != nil {
+		mergeObject(tree.Root(), d.overlay.BaseDN("").(*common.Object))
+		if provider, ok := d.overlay.(common.ACLPolicyProvider); ok {
+			policy = provider.ACLPolicy()
+		}
+	}
+	common.ResolveACLs(tree.Root(), policy)
+
+	// NOTE: the password policies of the overlay objects are kept.
+	tree.Index(nil)
+	return &snapshot{Tree: tree, fetchedAt: fetchedAt}, nil
+}
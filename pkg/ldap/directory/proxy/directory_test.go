@@ -0,0 +1,224 @@
+package proxydir
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/chezmoi-sh/yaldap/internal/ldap/auth"
+	yaldap "github.com/chezmoi-sh/yaldap/pkg/ldap"
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+	"github.com/jimlambrt/gldap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runUpstream runs a yaLDAP server, used as upstream server, until the end of
+// the test and returns its LDAP URL with the given base DN.
+func runUpstream(t *testing.T, addr string, baseDN string) (*gldap.Server, string) {
+	directory, err := yamldir.NewDirectoryFromYAML([]byte(`
+dc:org:
+  objectClass: domain
+  dc:example:
+    objectClass: domain
+    ou:people:
+      objectClass: organizationalUnit
+      cn:proxy:
+        objectClass: person
+        .acl: !!ldap/acl:allow-on dc=example,dc=org
+        userPassword: !!ldap/bind:password proxy
+      cn:alice:
+        objectClass: person
+        mail: alice@example.org
+        userPassword: !!ldap/bind:password alice
+      cn:bob:
+        objectClass: person
+        userPassword: !!ldap/bind:password bob
+`))
+	require.NoError(t, err)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server, err := gldap.NewServer()
+	require.NoError(t, err)
+	err = server.Router(yaldap.NewMux(logger, directory, auth.NewSessions(context.Background(), time.Minute)))
+	require.NoError(t, err)
+
+	go func() { assert.NoError(t, server.Run(addr)) }()
+	t.Cleanup(func() {
+		if server.Ready() {
+			assert.NoError(t, server.Stop())
+		}
+	})
+	require.Eventually(t, server.Ready, time.Second, time.Millisecond)
+	return server, "ldap://localhost" + addr + "/" + baseDN
+}
+
+func TestNewDirectory_InvalidUpstream(t *testing.T) {
+	_, url := runUpstream(t, ":10489", "dc=example,dc=org")
+
+	_, err := NewDirectory("http://localhost:10489")
+	assert.EqualError(t, err, "invalid upstream: invalid LDAP URL 'http://localhost:10489': unsupported scheme 'http'")
+
+	_, err = NewDirectory(url, WithServiceAccount("cn=proxy,ou=people,dc=example,dc=org", "invalid"))
+	assert.EqualError(t, err, "unable to fetch upstream entries: unable to bind the service account: LDAP Result Code 49 \"Invalid Credentials\": ")
+
+	_, err = NewDirectory("ldap://localhost:10489/dc=unknown", WithServiceAccount("cn=proxy,ou=people,dc=example,dc=org", "proxy"))
+	assert.EqualError(t, err, "unable to fetch upstream entries: base DN 'dc=unknown' not found")
+}
+
+func TestNewDirectory_WithOverlay(t *testing.T) {
+	_, url := runUpstream(t, ":10490", "dc=example,dc=org")
+
+	overlay, err := yamldir.NewDirectoryFromYAML([]byte(`
+dc:org:
+  dc:example:
+    ou:people:
+      cn:alice:
+        description: homelab administrator
+        mail: alice@example.org
+        .acl: !!ldap/acl:allow-on dc=example,dc=org
+      cn:webapp:
+        objectClass: person
+        userPassword: !!ldap/bind:password webapp
+    ou:groups:
+      cn:homelab:
+        objectClass: groupOfNames
+        member: cn=bob,ou=people,dc=example,dc=org
+        .acl: !!ldap/members-acl:allow-on ou=groups,dc=example,dc=org
+--- !!ldap/acl:policy
+"*": !!ldap/acl:allow-on self
+`))
+	require.NoError(t, err)
+
+	directory, err := NewDirectory(url,
+		WithServiceAccount("cn=proxy,ou=people,dc=example,dc=org", "proxy"),
+		WithOverlay(overlay),
+	)
+	require.NoError(t, err)
+
+	t.Run("MergedAttributes", func(t *testing.T) {
+		alice := directory.BaseDN("CN=Alice,OU=People,DC=Example,DC=Org")
+		require.NotNil(t, alice)
+		assert.Equal(t, "cn=alice,ou=people,dc=example,dc=org", alice.DN())
+		assert.Equal(t, []string{"person"}, alice.Attributes()["objectClass"])
+		assert.Equal(t, []string{"alice@example.org"}, alice.Attributes()["mail"])
+		assert.Equal(t, []string{"homelab administrator"}, alice.Attributes()["description"])
+
+		assert.NotNil(t, directory.BaseDN("cn=homelab,ou=groups,dc=example,dc=org"))
+		assert.NotNil(t, directory.BaseDN("dc=org"))
+		assert.Nil(t, directory.BaseDN("cn=charlie,ou=people,dc=example,dc=org"))
+	})
+
+	t.Run("ForwardedBind", func(t *testing.T) {
+		alice := directory.BaseDN("cn=alice,ou=people,dc=example,dc=org")
+
+		valid, err := alice.Bind("alice")
+		require.NoError(t, err)
+		assert.True(t, valid)
+
+		valid, err = alice.Bind("bob")
+		require.NoError(t, err)
+		assert.False(t, valid)
+
+		valid, err = alice.Bind("")
+		require.NoError(t, err)
+		assert.False(t, valid)
+	})
+
+	t.Run("LocalBind", func(t *testing.T) {
+		valid, err := directory.BaseDN("cn=webapp,ou=people,dc=example,dc=org").Bind("webapp")
+		require.NoError(t, err)
+		assert.True(t, valid)
+	})
+
+	t.Run("OverlayACLs", func(t *testing.T) {
+		alice := directory.BaseDN("cn=alice,ou=people,dc=example,dc=org")
+		bob := directory.BaseDN("cn=bob,ou=people,dc=example,dc=org")
+		homelab := directory.BaseDN("cn=homelab,ou=groups,dc=example,dc=org")
+
+		assert.True(t, alice.CanSearchOn(bob))
+		assert.True(t, bob.CanSearchOn(bob))
+		assert.False(t, bob.CanSearchOn(alice))
+		assert.True(t, bob.CanSearchOn(homelab))
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		entries, err := directory.BaseDN("dc=example,dc=org").Search(gldap.WholeSubtree, "(objectClass=person)")
+		require.NoError(t, err)
+
+		var dns []string
+		for _, entry := range entries {
+			dns = append(dns, entry.DN())
+		}
+		assert.ElementsMatch(t,
+			[]string{
+				"cn=proxy,ou=people,dc=example,dc=org",
+				"cn=alice,ou=people,dc=example,dc=org",
+				"cn=bob,ou=people,dc=example,dc=org",
+				"cn=webapp,ou=people,dc=example,dc=org",
+			},
+			dns,
+		)
+	})
+}
+
+func TestDirectory_CacheTTL(t *testing.T) {
+	server, url := runUpstream(t, ":10491", "ou=people,dc=example,dc=org")
+
+	directory, err := NewDirectory(url,
+		WithServiceAccount("cn=proxy,ou=people,dc=example,dc=org", "proxy"),
+		WithCacheTTL(0),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	require.NoError(t, err)
+	assert.NotNil(t, directory.BaseDN("cn=alice,ou=people,dc=example,dc=org"))
+
+	// NOTE: expired entries are served while they are fetched again in the
+	//       background.
+	fetched := lastSnapshot(directory)
+	assert.NotNil(t, directory.BaseDN("cn=alice,ou=people,dc=example,dc=org"))
+	require.Eventually(t, func() bool { return lastSnapshot(directory) != fetched }, time.Second, time.Millisecond)
+
+	// NOTE: the previous entries are kept if the upstream server is down.
+	require.NoError(t, server.Stop())
+	fetched = lastSnapshot(directory)
+	assert.NotNil(t, directory.BaseDN("cn=alice,ou=people,dc=example,dc=org"))
+	require.Eventually(t, func() bool { return lastSnapshot(directory) != fetched }, time.Second, time.Millisecond)
+	assert.Same(t, fetched.Tree, lastSnapshot(directory).Tree)
+	assert.NotNil(t, directory.BaseDN("cn=alice,ou=people,dc=example,dc=org"))
+}
+
+func TestDirectory_Attributes(t *testing.T) {
+	_, url := runUpstream(t, ":10492", "ou=people,dc=example,dc=org")
+
+	directory, err := NewDirectory(url, WithServiceAccount("cn=proxy,ou=people,dc=example,dc=org", "proxy"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice@example.org"}, directory.BaseDN("cn=alice,ou=people,dc=example,dc=org").Attributes()["mail"])
+
+	// NOTE: objectClass is always fetched.
+	directory, err = NewDirectory(url,
+		WithServiceAccount("cn=proxy,ou=people,dc=example,dc=org", "proxy"),
+		WithAttributes("cn"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t,
+		ldap.Attributes{"cn": {"alice"}, "objectClass": {"person"}},
+		directory.BaseDN("cn=alice,ou=people,dc=example,dc=org").Attributes(),
+	)
+}
+
+func TestDirectory_StartTLS(t *testing.T) {
+	_, url := runUpstream(t, ":10493", "ou=people,dc=example,dc=org")
+
+	_, err := NewDirectory(url,
+		WithServiceAccount("cn=proxy,ou=people,dc=example,dc=org", "proxy"),
+		WithStartTLS(),
+	)
+	assert.ErrorContains(t, err, "unable to fetch upstream entries: unable to start TLS: ")
+}
+
+// lastSnapshot returns the last snapshot of the given proxy directory.
+func lastSnapshot(dir ldap.Directory) *snapshot { return dir.(*directory).snapshot.Load() }
@@ -0,0 +1,79 @@
+package proxydir
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+)
+
+// mergeObject merges the given overlay object, and all objects below it, into
+// the given object: missing attribute values, objects and ACL rules are added
+// and the local bind configuration takes precedence over the upstream one.
+// Overlay objects are copied, in order to never share them between snapshots.
+func mergeObject(obj, overlay *common.Object) {
+	for name, values := range overlay.Attributes() {
+		mergeAttribute(obj, name, values)
+	}
+
+	// NOTE: only rules defined on the overlay object itself are merged; the
+	//       inherited ones are resolved again on the merged tree.
+	for _, rule := range overlay.ACLs {
+		if rule.Source == common.ACLSourceSelf {
+			obj.AddACLRule(rule)
+		}
+	}
+	if len(overlay.MemberACLs) > 0 {
+		obj.MemberACLs = append(obj.MemberACLs, overlay.MemberACLs...)
+		sort.Stable(obj.MemberACLs)
+	}
+	if len(overlay.SubtreeACLs) > 0 {
+		obj.SubtreeACLs = append(obj.SubtreeACLs, overlay.SubtreeACLs...)
+		sort.Stable(obj.SubtreeACLs)
+	}
+
+	if overlay.BindPasswords.IsSome() {
+		obj.BindPasswords = overlay.BindPasswords
+		obj.BindTOTP = overlay.BindTOTP
+		obj.PasswordPolicy = overlay.PasswordPolicy
+		obj.SecretAttributes = append(obj.SecretAttributes, overlay.SecretAttributes...)
+	}
+
+	for _, child := range overlay.SubObjects {
+		// NOTE: all DNs of the overlay are generated by its parser and are
+		//       always valid.
+		dn, _ := ldap.ParseDN(child.DN())
+
+		target, exists := obj.SubObjects[dn[0].Normalize()]
+		if !exists {
+			target = &common.Object{
+				ImplObject: common.ImplObject{
+					DN:         child.DN(),
+					Attributes: ldap.Attributes{},
+					SubObjects: map[string]*common.Object{},
+				},
+			}
+			obj.SubObjects[dn[0].Normalize()] = target
+		}
+		mergeObject(target, child)
+	}
+}
+
+// mergeAttribute adds the given values to the named attribute of the given
+// object, skipping the values already defined.
+func mergeAttribute(obj *common.Object, name string, values []string) {
+	for existing := range obj.ImplObject.Attributes {
+		if strings.EqualFold(existing, name) {
+			name = existing
+			break
+		}
+	}
+
+	for _, value := range values {
+		if !slices.Contains(obj.ImplObject.Attributes[name], value) {
+			obj.AddAttribute(name, value)
+		}
+	}
+}
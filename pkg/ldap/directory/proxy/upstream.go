@@ -0,0 +1,164 @@
+package proxydir
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"strings"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// upstream describes how to reach the upstream LDAP server.
+type upstream struct {
+	url    string
+	baseDN string
+
+	bindDN       string
+	bindPassword string
+
+	// attributes lists the attributes fetched from the upstream server.
+	attributes []string
+	// tlsConfig is used to verify the upstream server certificate, with
+	// `ldaps://` URLs or when startTLS is enabled.
+	tlsConfig *tls.Config
+	startTLS  bool
+}
+
+// DefaultAttributes lists the attributes fetched from the upstream server by
+// default: the ones describing accounts and groups, used by most LDAP clients.
+var DefaultAttributes = []string{
+	"objectClass", "cn", "sn", "givenName", "displayName", "description", "mail",
+	"uid", "uidNumber", "gidNumber", "homeDirectory", "loginShell", "gecos",
+	"member", "uniqueMember", "memberUid", "memberOf",
+	"dc", "o", "ou",
+}
+
+// upstreamPageSize is the number of entries fetched per page, in order to
+// avoid hitting the size limit of the upstream server (e.g. 1000 entries for
+// Active Directory).
+const upstreamPageSize = 500
+
+// newUpstream parses the given LDAP URL (e.g.
+// `ldap://ldap.example.org/dc=example,dc=org`) describing the upstream server
+// and the base of the mirrored entries.
+func newUpstream(rawURL string) (*upstream, error) {
+	if err := ldap.ValidateReferralURL(rawURL); err != nil {
+		return nil, fmt.Errorf("invalid upstream: %w", err)
+	}
+
+	u, _ := url.Parse(rawURL)
+	baseDN := strings.TrimPrefix(u.Path, "/")
+	u.Path, u.RawQuery = "", ""
+	return &upstream{
+		url:        u.String(),
+		baseDN:     baseDN,
+		attributes: DefaultAttributes,
+		tlsConfig:  &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12},
+	}, nil
+}
+
+// connect opens a new connection to the upstream server, secured with
+// StartTLS if enabled.
+func (u *upstream) connect() (*goldap.Conn, error) {
+	conn, err := goldap.DialURL(u.url, goldap.DialWithTLSConfig(u.tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+
+	if u.startTLS {
+		if err := conn.StartTLS(u.tlsConfig); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("unable to start TLS: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// secured returns true if the connections to the upstream server are
+// encrypted.
+func (u *upstream) secured() bool {
+	return u.startTLS || strings.HasPrefix(u.url, "ldaps://")
+}
+
+// dial opens a new connection to the upstream server, bound with the service
+// account if any.
+func (u *upstream) dial() (*goldap.Conn, error) {
+	conn, err := u.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	if u.bindDN != "" {
+		if err := conn.Bind(u.bindDN, u.bindPassword); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("unable to bind the service account: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// bind forwards the bind of the given DN to the upstream server. It returns
+// false if the credentials are rejected.
+func (u *upstream) bind(dn, password string) (bool, error) {
+	// NOTE: unauthenticated binds are always accepted by LDAP servers
+	//       (RFC 4513 §5.1.2) and must not be forwarded.
+	if password == "" {
+		return false, nil
+	}
+
+	conn, err := u.connect()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	err = conn.Bind(dn, password)
+	switch {
+	case goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return true, nil
+}
+
+// entries fetches all entries below the base DN, with only the configured
+// attributes, and returns them as a tree of objects. Mirrored entries are
+// authenticated by the upstream server.
+func (u *upstream) entries() (*common.Tree, error) {
+	conn, err := u.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	res, err := conn.SearchWithPaging(
+		goldap.NewSearchRequest(u.baseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, 0, false, "(objectClass=*)", u.attributes, nil),
+		upstreamPageSize,
+	)
+	switch {
+	case goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject):
+		return nil, fmt.Errorf("base DN '%s' not found", u.baseDN)
+	case err != nil:
+		return nil, err
+	}
+
+	tree := common.NewTree()
+	for _, entry := range res.Entries {
+		dn, err := ldap.ParseDN(entry.DN)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream entry: %w", err)
+		}
+
+		obj := tree.LookupOrCreate(dn)
+		obj.BindDelegate = u.bind
+		obj.ImplObject.Attributes = ldap.Attributes{}
+		for _, attr := range entry.Attributes {
+			obj.AddAttribute(attr.Name, attr.Values...)
+		}
+	}
+	return tree, nil
+}
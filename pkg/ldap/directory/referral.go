@@ -0,0 +1,65 @@
+package directory
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// IsReferral returns true if the given entry is a referral object (RFC 3296),
+// i.e. an entry of the `referral` object class.
+func IsReferral(entry Object) bool { return hasObjectClass(entry, "referral") }
+
+// ReferralURLs returns the LDAP URLs (`ref` attribute) of the given referral
+// object.
+func ReferralURLs(referral Object) []string {
+	var urls []string
+	for name, values := range referral.Attributes() {
+		if strings.EqualFold(name, "ref") {
+			urls = append(urls, values...)
+		}
+	}
+	return urls
+}
+
+// ValidateReferralURL returns an error if the given value is not a LDAP URL
+// (e.g. `ldap://ldap.example.org/ou=people,dc=example,dc=org`).
+func ValidateReferralURL(value string) error {
+	u, err := url.Parse(value)
+	switch {
+	case err != nil:
+		return fmt.Errorf("invalid LDAP URL '%s': %w", value, err)
+	case u.Scheme != "ldap" && u.Scheme != "ldaps":
+		return fmt.Errorf("invalid LDAP URL '%s': unsupported scheme '%s'", value, u.Scheme)
+	case u.Host == "":
+		return fmt.Errorf("invalid LDAP URL '%s': missing host", value)
+	}
+
+	if _, err := ParseDN(strings.TrimPrefix(u.Path, "/")); err != nil {
+		return fmt.Errorf("invalid LDAP URL '%s': %w", value, err)
+	}
+	return nil
+}
+
+// WithReferralHandler doesn't search the referral objects found below the
+// search base (nor their subordinates) and calls the given handler with each
+// of them instead, in order to return them as continuation references.
+func WithReferralHandler(handler func(referral Object)) SearchOption {
+	return func(opts *SearchOptions) { opts.OnReferral = handler }
+}
+
+// hasObjectClass returns true if the given entry is of the given object class.
+func hasObjectClass(entry Object, class string) bool {
+	for name, values := range entry.Attributes() {
+		if !strings.EqualFold(name, "objectClass") {
+			continue
+		}
+
+		for _, value := range values {
+			if strings.EqualFold(value, class) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package directory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateReferralURL(t *testing.T) {
+	tests := []struct {
+		URL           string
+		ExpectedError string
+	}{
+		{URL: "ldap://ldap.example.org"},
+		{URL: "ldaps://ldap.example.org:636/ou=people,dc=example,dc=org"},
+		{URL: "ldap://ldap.example.org/ou=people,dc=example,dc=org??sub"},
+		{URL: "http://ldap.example.org", ExpectedError: "invalid LDAP URL 'http://ldap.example.org': unsupported scheme 'http'"},
+		{URL: "ldap:///dc=org", ExpectedError: "invalid LDAP URL 'ldap:///dc=org': missing host"},
+		{URL: "ldap://ldap.example.org/people", ExpectedError: "invalid LDAP URL 'ldap://ldap.example.org/people': invalid DN 'people': missing '=' in 'people'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.URL, func(t *testing.T) {
+			err := ValidateReferralURL(tt.URL)
+			if tt.ExpectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.ExpectedError)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package directory
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// Watchable is implemented by directories built from local files, in
+	// order to reload them when one of these files changes.
+	Watchable interface {
+		// WatchedFiles returns the path of all files the directory was built
+		// from.
+		WatchedFiles() []string
+	}
+
+	// Acquirable is implemented by directories whose content can be
+	// replaced while requests are in progress, in order to serve a whole
+	// request from the same directory.
+	Acquirable interface {
+		// Acquire returns the directory currently served, which is kept open
+		// until the returned function is called.
+		Acquire() (Directory, func())
+	}
+
+	// ReloadableDirectory is a directory whose content can be replaced
+	// atomically, without interrupting the requests in progress.
+	ReloadableDirectory struct {
+		current atomic.Pointer[generation]
+		load    func() (Directory, error)
+
+		mu       sync.Mutex
+		onReload []func(directory Directory)
+	}
+
+	// generation is a directory served by a ReloadableDirectory; its read
+	// lock is held by all requests using it, and its write lock taken once
+	// it has been replaced, to wait for them before closing it.
+	generation struct {
+		directory Directory
+		inUse     sync.RWMutex
+	}
+)
+
+// Acquire returns the given directory, as it must be used during a whole
+// request (see Acquirable), and the function to call once the request is done.
+func Acquire(directory Directory) (Directory, func()) {
+	if acquirable, ok := directory.(Acquirable); ok {
+		return acquirable.Acquire()
+	}
+	return directory, func() {}
+}
+
+// Close releases the resources held by the given directory (e.g. an open
+// database), if it implements io.Closer.
+func Close(directory Directory) error {
+	if closer, ok := directory.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// NewReloadableDirectory creates a directory using the given function, which
+// is called again on each reload.
+func NewReloadableDirectory(load func() (Directory, error)) (*ReloadableDirectory, error) {
+	directory, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	reloadable := &ReloadableDirectory{load: load}
+	reloadable.current.Store(&generation{directory: directory})
+	return reloadable, nil
+}
+
+// BaseDN returns the LDAP object represented by the given DN inside the
+// current directory.
+func (d *ReloadableDirectory) BaseDN(dn string) Object { return d.Current().BaseDN(dn) }
+
+// Current returns the directory currently served. Requests must use Acquire
+// instead, as this directory can be closed at any time by Reload.
+func (d *ReloadableDirectory) Current() Directory { return d.current.Load().directory }
+
+// Acquire returns the directory currently served, which is not closed by
+// Reload until the returned function is called.
+func (d *ReloadableDirectory) Acquire() (Directory, func()) {
+	for {
+		// NOTE: the directory may have been replaced between the load and
+		//       the lock; it is then being closed and must not be used. The
+		//       lock is never awaited, so that a request can acquire the
+		//       directory it already uses (e.g. to persist a rehashed
+		//       password during a bind).
+		current := d.current.Load()
+		if !current.inUse.TryRLock() {
+			continue
+		}
+		if d.current.Load() == current {
+			return current.directory, current.inUse.RUnlock
+		}
+		current.inUse.RUnlock()
+	}
+}
+
+// WatchedFiles returns the files the current directory was built from, if
+// any.
+func (d *ReloadableDirectory) WatchedFiles() []string {
+	if watchable, ok := d.Current().(Watchable); ok {
+		return watchable.WatchedFiles()
+	}
+	return nil
+}
+
+// OnReload registers a function called with the new directory after each
+// successful reload.
+func (d *ReloadableDirectory) OnReload(fn func(directory Directory)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onReload = append(d.onReload, fn)
+}
+
+// Reload builds a new directory and, only if it succeeds, swaps it with the
+// current one, which is then closed (see Close) once all requests which have
+// acquired it are done. Otherwise, the current directory is kept and the
+// error is returned.
+func (d *ReloadableDirectory) Reload() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	directory, err := d.load()
+	if err != nil {
+		return err
+	}
+
+	previous := d.current.Swap(&generation{directory: directory})
+	for _, fn := range d.onReload {
+		fn(directory)
+	}
+
+	previous.inUse.Lock()
+	defer previous.inUse.Unlock()
+	return Close(previous.directory)
+}
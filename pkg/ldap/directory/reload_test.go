@@ -0,0 +1,115 @@
+package directory
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockWatchableDirectory struct {
+	id    int
+	files []string
+}
+
+func (mockWatchableDirectory) BaseDN(string) Object     { return nil }
+func (d mockWatchableDirectory) WatchedFiles() []string { return d.files }
+
+type mockClosableDirectory struct{ closed *bool }
+
+func (mockClosableDirectory) BaseDN(string) Object { return nil }
+func (d mockClosableDirectory) Close() error       { *d.closed = true; return nil }
+
+func TestNewReloadableDirectory_Invalid(t *testing.T) {
+	reloadable, err := NewReloadableDirectory(func() (Directory, error) { return nil, fmt.Errorf("invalid directory") })
+
+	assert.EqualError(t, err, "invalid directory")
+	assert.Nil(t, reloadable)
+}
+
+func TestReloadableDirectory_Reload(t *testing.T) {
+	var loads int
+	var loadErr error
+	reloadable, err := NewReloadableDirectory(func() (Directory, error) {
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		loads++
+		return mockWatchableDirectory{id: loads, files: []string{fmt.Sprintf("directory.%d.yaml", loads)}}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, mockWatchableDirectory{id: 1, files: []string{"directory.1.yaml"}}, reloadable.Current())
+	assert.Equal(t, []string{"directory.1.yaml"}, reloadable.WatchedFiles())
+
+	var reloaded []Directory
+	reloadable.OnReload(func(directory Directory) { reloaded = append(reloaded, directory) })
+
+	t.Run("Valid", func(t *testing.T) {
+		require.NoError(t, reloadable.Reload())
+
+		assert.Equal(t, mockWatchableDirectory{id: 2, files: []string{"directory.2.yaml"}}, reloadable.Current())
+		assert.Equal(t, []string{"directory.2.yaml"}, reloadable.WatchedFiles())
+		assert.Equal(t, []Directory{reloadable.Current()}, reloaded)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		// NOTE: the current directory is kept if the new one cannot be
+		//       loaded.
+		loadErr = fmt.Errorf("invalid directory")
+		assert.EqualError(t, reloadable.Reload(), "invalid directory")
+
+		assert.Equal(t, mockWatchableDirectory{id: 2, files: []string{"directory.2.yaml"}}, reloadable.Current())
+		assert.Len(t, reloaded, 1)
+	})
+}
+
+func TestReloadableDirectory_ReloadClose(t *testing.T) {
+	var closed []*bool
+	reloadable, err := NewReloadableDirectory(func() (Directory, error) {
+		closed = append(closed, new(bool))
+		return mockClosableDirectory{closed: closed[len(closed)-1]}, nil
+	})
+	require.NoError(t, err)
+
+	// NOTE: the previous directory is closed once replaced.
+	require.NoError(t, reloadable.Reload())
+	assert.True(t, *closed[0])
+	assert.False(t, *closed[1])
+
+	t.Run("Acquired", func(t *testing.T) {
+		acquired, release := reloadable.Acquire()
+		assert.Equal(t, mockClosableDirectory{closed: closed[1]}, acquired)
+
+		done := make(chan error)
+		go func() { done <- reloadable.Reload() }()
+
+		// NOTE: the new directory is served at once, but the previous one
+		//       is only closed once all requests using it are done.
+		require.Eventually(t, func() bool { return reloadable.Current() != acquired }, time.Second, time.Millisecond)
+		current, releaseCurrent := reloadable.Acquire()
+		assert.Equal(t, mockClosableDirectory{closed: closed[2]}, current)
+		releaseCurrent()
+
+		select {
+		case <-done:
+			assert.Fail(t, "the previous directory has been closed while being used")
+		case <-time.After(50 * time.Millisecond):
+		}
+		assert.False(t, *closed[1])
+
+		release()
+		require.NoError(t, <-done)
+		assert.True(t, *closed[1])
+		assert.False(t, *closed[2])
+	})
+}
+
+func TestAcquire(t *testing.T) {
+	// NOTE: directories which cannot be reloaded are returned as is.
+	dir := mockWatchableDirectory{id: 1}
+	acquired, release := Acquire(dir)
+	assert.Equal(t, dir, acquired)
+	release()
+}
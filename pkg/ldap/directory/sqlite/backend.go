@@ -0,0 +1,51 @@
+package sqlitedir
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+)
+
+// Backend serves the directory mapped from an SQLite database.
+type Backend struct {
+	Mapping string `name:"mapping" help:"Path to the YAML file mapping the database tables to LDAP entries" placeholder:"PATH"`
+}
+
+//nolint:gochecknoinits
+func init() {
+	ldap.RegisterBackend(
+		ldap.BackendInfo{
+			Name:        "sqlite",
+			Description: "Directory mapped from the tables of an SQLite database (e.g. 'sqlite:///var/lib/yaldap/directory.db')",
+			Schemes:     []string{"sqlite"},
+		},
+		&Backend{},
+	)
+}
+
+// Validate checks that the SQLite database exists and that the mapping is
+// valid.
+func (b Backend) Validate(url string) error {
+	if b.Mapping == "" {
+		return fmt.Errorf("a mapping file is required (--backend.sqlite.mapping)")
+	}
+	if _, err := os.Stat(filePath(url)); err != nil {
+		return fmt.Errorf("unable to open SQLite database: %w", err)
+	}
+	_, err := LoadMapping(b.Mapping)
+	return err
+}
+
+// NewDirectory creates the directory mapped from the SQLite database located
+// at the given URL, enforcing the password policy carried by the given
+// context.
+func (b Backend) NewDirectory(ctx context.Context, url string) (ldap.Directory, error) {
+	mapping, err := LoadMapping(b.Mapping)
+	if err != nil {
+		return nil, err
+	}
+	return NewDirectory(url, mapping, WithPasswordPolicy(common.PasswordPolicyFromContext(ctx)))
+}
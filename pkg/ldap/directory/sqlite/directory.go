@@ -0,0 +1,406 @@
+package sqlitedir
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/moznion/go-optional"
+
+	// SQLite driver, registered as `sqlite3`.
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type (
+	// directory represents the LDAP directory mapped from an SQLite database.
+	// All entries are loaded in memory, with an index for quick node search;
+	// the database is only queried again to narrow searches, as long as it
+	// has not changed since the entries were loaded.
+	directory struct {
+		*common.Tree
+
+		passwordPolicy *common.PasswordPolicy
+		aclPolicy      []common.ACLPolicyRule
+
+		path    string
+		mapping *Mapping
+
+		// conn is the connection the entries have been loaded from, kept
+		// open (and guarded by mu) to narrow searches, and version the data
+		// version of the database when loaded.
+		db      *sql.DB
+		conn    *sql.Conn
+		mu      sync.Mutex
+		version int64
+
+		// mapped contains the entries mapped from a table row, by the
+		// normalized DN of their parent.
+		mapped map[string][]*EntryMapping
+		rows   map[*common.Object]bool
+		// passwords contains the row holding the bind password of the
+		// entries mapped with a password column.
+		passwords map[*common.Object]passwordRow
+	}
+
+	// passwordRow identifies the row (and the column) holding the bind
+	// password of an entry.
+	passwordRow struct {
+		mapping *EntryMapping
+		key     string
+	}
+
+	// Option customizes the directory mapped from the SQLite database.
+	Option func(directory *directory)
+)
+
+// WithPasswordPolicy enforces the given password policy on all objects of the
+// directory.
+func WithPasswordPolicy(policy *common.PasswordPolicy) Option {
+	return func(directory *directory) { directory.passwordPolicy = policy }
+}
+
+// NewDirectory creates the directory mapped, using the given mapping, from
+// the SQLite database located at the given URL (e.g.
+// `sqlite:///var/lib/yaldap/directory.db`). The database is opened read-only
+// and kept open until the directory is closed.
+func NewDirectory(url string, mapping *Mapping, opts ...Option) (ldap.Directory, error) {
+	directory := &directory{
+		Tree:    common.NewTree(),
+		path:    filePath(url),
+		mapping: mapping,
+		mapped:  map[string][]*EntryMapping{},
+		rows:    map[*common.Object]bool{},
+
+		passwords: map[*common.Object]passwordRow{},
+	}
+	for _, opt := range opts {
+		opt(directory)
+	}
+
+	if err := directory.load(); err != nil {
+		_ = directory.Close()
+		return nil, err
+	}
+
+	directory.Index(directory.passwordPolicy)
+	for base := range directory.mapped {
+		obj := directory.Lookup(base)
+		obj.SearchIndex = func(filter *ber.Packet) (map[string]bool, bool) { return directory.candidates(obj, filter) }
+	}
+	common.ResolveACLs(directory.Root(), directory.aclPolicy)
+	return directory, nil
+}
+
+// filePath returns the path of the SQLite database located at the given URL.
+func filePath(url string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(url, "sqlite://"), "file://")
+}
+
+// open opens the SQLite database read-only.
+func (d *directory) open() (*sql.DB, error) {
+	// NOTE: SQLite creates missing databases, even when opened read-only.
+	if _, err := os.Stat(d.path); err != nil {
+		return nil, fmt.Errorf("unable to open SQLite database: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", d.path))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open SQLite database: %w", err)
+	}
+	return db, nil
+}
+
+// load opens the SQLite database, then loads all entries and the ACL policy
+// inside a single read transaction, so that they describe the same version of
+// the database.
+func (d *directory) load() error {
+	var err error
+	if d.db, err = d.open(); err != nil {
+		return err
+	}
+
+	// NOTE: the data version of an SQLite database is specific to each
+	//       connection, so the same connection is used to narrow searches.
+	if d.conn, err = d.db.Conn(context.Background()); err != nil {
+		return fmt.Errorf("unable to open SQLite database: %w", err)
+	}
+	tx, err := d.conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("unable to read SQLite database: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for i := range d.mapping.Entries {
+		if err := d.loadEntries(tx, &d.mapping.Entries[i]); err != nil {
+			return err
+		}
+	}
+	if d.mapping.ACL != nil {
+		if err := d.loadACLPolicy(tx, *d.mapping.ACL); err != nil {
+			return err
+		}
+	}
+
+	if d.version, err = dataVersion(tx); err != nil {
+		return fmt.Errorf("unable to read SQLite database: %w", err)
+	}
+	return nil
+}
+
+// snapshot starts a read transaction on the connection the entries have been
+// loaded from, and returns it only if the database has not changed since. It
+// must be called with the mutex locked.
+func (d *directory) snapshot() (*sql.Tx, bool) {
+	if d.conn == nil {
+		return nil, false
+	}
+
+	tx, err := d.conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, false
+	}
+	if version, err := dataVersion(tx); err != nil || version != d.version {
+		_ = tx.Rollback()
+		return nil, false
+	}
+	return tx, true
+}
+
+// dataVersion returns the data version of the database seen by the given
+// transaction, which changes each time another connection modifies it.
+func dataVersion(tx *sql.Tx) (int64, error) {
+	// NOTE: reading the data version does not start the read transaction,
+	//       only reading the database does.
+	var version int64
+	if _, err := tx.Exec("SELECT 1 FROM sqlite_master LIMIT 1"); err != nil {
+		return 0, err
+	}
+	if err := tx.QueryRow("PRAGMA data_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Close closes the SQLite database; searches are then no longer narrowed.
+func (d *directory) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var errs []error
+	if d.conn != nil {
+		errs = append(errs, d.conn.Close())
+		d.conn = nil
+	}
+	if d.db != nil {
+		errs = append(errs, d.db.Close())
+		d.db = nil
+	}
+	return errors.Join(errs...)
+}
+
+// loadEntries creates an entry for each row of the table described by the
+// given mapping.
+func (d *directory) loadEntries(tx *sql.Tx, mapping *EntryMapping) error {
+	base, _ := ldap.ParseDN(mapping.Base)
+
+	// NOTE: values are converted to text by SQLite, like when they are
+	//       compared by the filters pushed down to the database.
+	attributes := make([]string, 0, len(mapping.Attributes))
+	columns := []string{mapping.Key}
+	for attribute, column := range mapping.Attributes {
+		attributes = append(attributes, attribute)
+		columns = append(columns, column)
+	}
+	if mapping.Password != "" {
+		columns = append(columns, mapping.Password)
+	}
+
+	values, err := queryText(tx, fmt.Sprintf("SELECT %s FROM %s", textColumns(columns...), quoteIdentifier(mapping.Table)))
+	if err != nil {
+		return fmt.Errorf("unable to read table '%s': %w", mapping.Table, err)
+	}
+
+	joins := make([]map[string][]string, len(mapping.MultiValued))
+	for i, join := range mapping.MultiValued {
+		rows, err := queryText(tx, fmt.Sprintf("SELECT %s FROM %s", textColumns(join.Key, join.Column), quoteIdentifier(join.Table)))
+		if err != nil {
+			return fmt.Errorf("unable to read table '%s': %w", join.Table, err)
+		}
+
+		joins[i] = map[string][]string{}
+		for _, row := range rows {
+			if row[0].Valid && row[1].Valid {
+				joins[i][row[0].String] = append(joins[i][row[0].String], row[1].String)
+			}
+		}
+	}
+
+	parent, _ := ldap.NormalizeDN(mapping.Base)
+	d.mapped[parent] = append(d.mapped[parent], mapping)
+	d.LookupOrCreate(base)
+
+	rdn := 0
+	for i, attribute := range attributes {
+		if strings.EqualFold(attribute, mapping.RDN) {
+			rdn = i + 1
+		}
+	}
+
+	for _, row := range values {
+		if !row[rdn].Valid {
+			return fmt.Errorf("invalid row of table '%s': the RDN attribute '%s' is NULL", mapping.Table, mapping.RDN)
+		}
+
+		dn := append(ldap.DN{ldap.RDN{{Type: mapping.RDN, Value: row[rdn].String}}}, base...)
+		obj := d.LookupOrCreate(dn)
+		if d.rows[obj] {
+			return fmt.Errorf("entry '%s' is already defined", dn)
+		}
+		d.rows[obj] = true
+		if len(mapping.ObjectClass) > 0 {
+			obj.AddAttribute("objectClass", mapping.ObjectClass...)
+		}
+		for i, attribute := range attributes {
+			// NOTE: the RDN value is already defined by LookupOrCreate.
+			if row[i+1].Valid && i+1 != rdn {
+				obj.AddAttribute(attribute, row[i+1].String)
+			}
+		}
+		for i, join := range mapping.MultiValued {
+			if values := joins[i][row[0].String]; row[0].Valid && len(values) > 0 {
+				obj.AddAttribute(join.Attribute, values...)
+			}
+		}
+		if mapping.Password != "" && row[len(row)-1].Valid {
+			obj.BindPasswords = optional.Some(row[len(row)-1].String)
+			if row[0].Valid {
+				d.passwords[obj] = passwordRow{mapping: mapping, key: row[0].String}
+			}
+		}
+	}
+	return nil
+}
+
+// UpdateBindPassword replaces the bind password of the object identified by
+// the given DN with the given hash, inside the row it is mapped from. The
+// directory is then reloaded like after any other change of the database.
+func (d *directory) UpdateBindPassword(dn string, hash string) error {
+	normalized, err := ldap.NormalizeDN(dn)
+	if err != nil {
+		return fmt.Errorf("invalid DN '%s': %w", dn, err)
+	}
+	row, exists := d.passwords[d.Lookup(normalized)]
+	if !exists {
+		return fmt.Errorf("unable to update the bind password of '%s': the entry has no stored password", dn)
+	}
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=rw", d.path))
+	if err != nil {
+		return fmt.Errorf("unable to open SQLite database: %w", err)
+	}
+	defer db.Close()
+
+	query := fmt.Sprintf("UPDATE %s SET %s = ? WHERE CAST(%s AS TEXT) = ?",
+		quoteIdentifier(row.mapping.Table), quoteIdentifier(row.mapping.Password), quoteIdentifier(row.mapping.Key))
+	result, err := db.Exec(query, hash, row.key)
+	if err != nil {
+		return fmt.Errorf("unable to update table '%s': %w", row.mapping.Table, err)
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated != 1 {
+		return fmt.Errorf("unable to update the bind password of '%s': %d rows of table '%s' match", dn, updated, row.mapping.Table)
+	}
+	return nil
+}
+
+// loadACLPolicy reads the ACL policy from the table described by the given
+// mapping.
+func (d *directory) loadACLPolicy(tx *sql.Tx, mapping ACLMapping) error {
+	rows, err := queryText(tx, fmt.Sprintf("SELECT %s FROM %s", textColumns(mapping.Subject, mapping.Rule), quoteIdentifier(mapping.Table)))
+	if err != nil {
+		return fmt.Errorf("unable to read table '%s': %w", mapping.Table, err)
+	}
+
+	for i, row := range rows {
+		if !row[0].Valid || !row[1].Valid {
+			return fmt.Errorf("invalid row %d of table '%s': the subject and the rule are required", i+1, mapping.Table)
+		}
+
+		// NOTE: the subject is quoted because it can contain any character
+		//       (e.g. `*` or `:`), and the rule is a block mapping value
+		//       because it can contain commas.
+		subject := strings.ReplaceAll(strings.ReplaceAll(row[0].String, `\`, `\\`), `"`, `\"`)
+		policy, err := yamldir.ParseACLPolicyValue(fmt.Sprintf("!!ldap/acl:policy\n\"%s\": %s", subject, row[1].String), 1, 1)
+		if err != nil {
+			return fmt.Errorf("invalid row %d of table '%s': %w", i+1, mapping.Table, err)
+		}
+
+		for _, subject := range policy {
+			for j := range subject.Rules {
+				subject.Rules[j].Origin = fmt.Sprintf("table '%s', row %d", mapping.Table, i+1)
+			}
+		}
+		d.aclPolicy = append(d.aclPolicy, policy...)
+	}
+	return nil
+}
+
+// queryText runs the given query inside the given transaction and returns all
+// rows, whose columns are selected as text.
+func queryText(tx *sql.Tx, query string, args ...any) ([][]sql.NullString, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var values [][]sql.NullString
+	for rows.Next() {
+		row := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		values = append(values, row)
+	}
+	return values, rows.Err()
+}
+
+// textColumns returns the given columns converted to text, separated by
+// commas.
+func textColumns(columns ...string) string {
+	casts := make([]string, len(columns))
+	for i, column := range columns {
+		casts[i] = fmt.Sprintf("CAST(%s AS TEXT)", quoteIdentifier(column))
+	}
+	return strings.Join(casts, ", ")
+}
+
+// ACLPolicy returns the ACL rules applying to the whole directory, read from
+// the ACL table.
+func (d *directory) ACLPolicy() []common.ACLPolicyRule { return d.aclPolicy }
+
+// WatchedFiles returns the SQLite database, its write-ahead log (changed
+// before the database itself in WAL mode) and the mapping file.
+func (d *directory) WatchedFiles() []string {
+	files := []string{d.path, d.path + "-wal"}
+	if d.mapping.path != "" {
+		files = append(files, d.mapping.path)
+	}
+	return files
+}
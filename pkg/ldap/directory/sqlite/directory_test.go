@@ -0,0 +1,369 @@
+package sqlitedir_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/chezmoi-sh/yaldap/internal/ldap/auth"
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	sqlitedir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/sqlite"
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/jimlambrt/gldap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDatabase creates an SQLite database inside a temporary directory, using
+// the given SQL script, and returns its path.
+func newDatabase(t *testing.T, script string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "directory.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(script)
+	require.NoError(t, err)
+	return path
+}
+
+// newFixtureDirectory creates the directory mapped from the fixture database.
+func newFixtureDirectory(t *testing.T) (ldap.Directory, string) {
+	t.Helper()
+
+	script, err := os.ReadFile("fixtures/directory.sql")
+	require.NoError(t, err)
+	path := newDatabase(t, string(script))
+
+	mapping, err := sqlitedir.LoadMapping("fixtures/mapping.yaml")
+	require.NoError(t, err)
+
+	directory, err := sqlitedir.NewDirectory("sqlite://"+path, mapping)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ldap.Close(directory) })
+	return directory, path
+}
+
+func TestNewDirectory_NoDatabase(t *testing.T) {
+	mapping, err := sqlitedir.LoadMapping("fixtures/mapping.yaml")
+	require.NoError(t, err)
+
+	directory, err := sqlitedir.NewDirectory("sqlite://fixtures/does-not-exist.db", mapping)
+	assert.EqualError(t, err, "unable to open SQLite database: stat fixtures/does-not-exist.db: no such file or directory")
+	assert.Nil(t, directory)
+}
+
+func TestNewDirectory_Fixture(t *testing.T) {
+	directory, path := newFixtureDirectory(t)
+
+	assert.Equal(t, []string{path, path + "-wal", "fixtures/mapping.yaml"}, directory.(ldap.Watchable).WatchedFiles())
+
+	t.Run("uid=alice,ou=people,dc=example,dc=org", func(t *testing.T) {
+		alice, ok := directory.BaseDN("uid=alice,ou=people,dc=example,dc=org").(*common.Object)
+		require.True(t, ok)
+
+		assert.Equal(t,
+			ldap.Attributes{
+				"objectClass": {"top", "inetOrgPerson", "posixAccount"},
+				"uid":         {"alice"},
+				"cn":          {"Alice Smith"},
+				"sn":          {"Smith"},
+				"uidNumber":   {"1000"},
+				"mail":        {"alice@example.org", "alice.smith@example.org"},
+			},
+			alice.Attributes(),
+		)
+
+		valid, err := alice.Bind("alice")
+		require.NoError(t, err)
+		assert.True(t, valid)
+	})
+
+	t.Run("uid=charlie,ou=people,dc=example,dc=org", func(t *testing.T) {
+		charlie := directory.BaseDN("uid=charlie,ou=people,dc=example,dc=org")
+		require.NotNil(t, charlie)
+
+		assert.NotContains(t, charlie.Attributes(), "sn")
+		assert.NotContains(t, charlie.Attributes(), "mail")
+
+		valid, err := charlie.Bind("")
+		require.NoError(t, err)
+		assert.False(t, valid)
+	})
+
+	t.Run("cn=developers,ou=groups,dc=example,dc=org", func(t *testing.T) {
+		developers := directory.BaseDN("cn=developers,ou=groups,dc=example,dc=org")
+		require.NotNil(t, developers)
+
+		assert.ElementsMatch(t,
+			[]string{"uid=alice,ou=people,dc=example,dc=org", "uid=bob,ou=people,dc=example,dc=org"},
+			developers.Attributes()["member"],
+		)
+		assert.Equal(t, []string{"2001"}, developers.Attributes()["gidNumber"])
+	})
+
+	t.Run("ou=groups,dc=example,dc=org", func(t *testing.T) {
+		groups := directory.BaseDN("ou=groups,dc=example,dc=org")
+		require.NotNil(t, groups)
+
+		assert.Equal(t, ldap.Attributes{"objectClass": {"top", "organizationalUnit"}, "ou": {"groups"}}, groups.Attributes())
+	})
+
+	t.Run("ACLs", func(t *testing.T) {
+		alice := directory.BaseDN("uid=alice,ou=people,dc=example,dc=org")
+		bob := directory.BaseDN("uid=bob,ou=people,dc=example,dc=org")
+
+		assert.True(t, alice.CanSearchOn(bob))
+		assert.True(t, alice.CanReadAttribute(bob, "mail"))
+		assert.False(t, bob.CanSearchOn(alice))
+		assert.False(t, bob.CanReadAttribute(alice, "mail"))
+		assert.Equal(t, "table 'acl', row 1", bob.(*common.Object).ExplainACL(common.ACLRead, alice, "mail").Rule.Origin)
+	})
+}
+
+func TestDirectory_Search(t *testing.T) {
+	directory, _ := newFixtureDirectory(t)
+	people := directory.BaseDN("ou=people,dc=example,dc=org").(*common.Object)
+	require.NotNil(t, people.SearchIndex)
+
+	tests := []struct {
+		filter     string
+		candidates []string
+		expected   []string
+	}{
+		{
+			filter:     "(uid=ALICE)",
+			candidates: []string{"uid=alice"},
+			expected:   []string{"uid=alice,ou=people,dc=example,dc=org"},
+		},
+		{
+			filter:     "(&(objectClass=inetOrgPerson)(mail=bob@example.org))",
+			candidates: []string{"uid=bob"},
+			expected:   []string{"uid=bob,ou=people,dc=example,dc=org"},
+		},
+		{
+			filter:     "(|(sn=*)(uidNumber=1002))",
+			candidates: []string{"uid=alice", "uid=bob", "uid=charlie"},
+			expected:   []string{"uid=alice,ou=people,dc=example,dc=org", "uid=bob,ou=people,dc=example,dc=org", "uid=charlie,ou=people,dc=example,dc=org"},
+		},
+		{
+			filter:     "(&(objectClass=groupOfNames)(uid=alice))",
+			candidates: []string{},
+			expected:   nil,
+		},
+		{
+			filter:     "(&(cn=*Smith)(mail=*))",
+			candidates: []string{"uid=alice", "uid=bob"},
+			expected:   []string{"uid=alice,ou=people,dc=example,dc=org"},
+		},
+		{
+			// NOTE: substrings and negations cannot be pushed down
+			filter:   "(|(cn=Bob*)(!(uid=alice)))",
+			expected: []string{"ou=people,dc=example,dc=org", "uid=bob,ou=people,dc=example,dc=org", "uid=charlie,ou=people,dc=example,dc=org"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			filter, err := goldap.CompileFilter(tt.filter)
+			require.NoError(t, err)
+
+			candidates, narrowed := people.SearchIndex(filter)
+			if tt.candidates == nil {
+				assert.False(t, narrowed)
+			} else {
+				require.True(t, narrowed)
+				keys := []string{}
+				for key := range candidates {
+					keys = append(keys, key)
+				}
+				assert.ElementsMatch(t, tt.candidates, keys)
+			}
+
+			entries, err := people.Search(gldap.WholeSubtree, tt.filter)
+			require.NoError(t, err)
+			var dns []string
+			for _, entry := range entries {
+				dns = append(dns, entry.DN())
+			}
+			sort.Strings(dns)
+			assert.Equal(t, tt.expected, dns)
+		})
+	}
+
+	t.Run("DatabaseRemoved", func(t *testing.T) {
+		directory, path := newFixtureDirectory(t)
+		people := directory.BaseDN("ou=people,dc=example,dc=org").(*common.Object)
+		require.NoError(t, os.Remove(path))
+
+		// NOTE: entries are still searched in memory
+		entries, err := people.Search(gldap.SingleLevel, "(uid=alice)")
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("DatabaseChanged", func(t *testing.T) {
+		directory, path := newFixtureDirectory(t)
+		people := directory.BaseDN("ou=people,dc=example,dc=org").(*common.Object)
+
+		db, err := sql.Open("sqlite3", path)
+		require.NoError(t, err)
+		defer db.Close()
+		_, err = db.Exec("UPDATE user_emails SET email = 'robert@example.org' WHERE user_id = 1001")
+		require.NoError(t, err)
+
+		// NOTE: the filter is no longer pushed down to the database, which
+		//       differs from the entries loaded in memory.
+		filter, err := goldap.CompileFilter("(mail=bob@example.org)")
+		require.NoError(t, err)
+		_, narrowed := people.SearchIndex(filter)
+		assert.False(t, narrowed)
+
+		entries, err := people.Search(gldap.SingleLevel, "(mail=bob@example.org)")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "uid=bob,ou=people,dc=example,dc=org", entries[0].DN())
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		directory, _ := newFixtureDirectory(t)
+		people := directory.BaseDN("ou=people,dc=example,dc=org").(*common.Object)
+		require.NoError(t, ldap.Close(directory))
+
+		filter, err := goldap.CompileFilter("(uid=alice)")
+		require.NoError(t, err)
+		_, narrowed := people.SearchIndex(filter)
+		assert.False(t, narrowed)
+
+		entries, err := people.Search(gldap.SingleLevel, "(uid=alice)")
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+}
+
+func TestDirectory_UpdateBindPassword(t *testing.T) {
+	script, err := os.ReadFile("fixtures/directory.sql")
+	require.NoError(t, err)
+	path := newDatabase(t, string(script))
+	mapping, err := sqlitedir.LoadMapping("fixtures/mapping.yaml")
+	require.NoError(t, err)
+
+	policy := &common.PasswordPolicy{
+		MinStrength: common.PasswordStrong,
+		Hasher:      common.PasswordHashers["bcrypt"],
+	}
+	directory, err := sqlitedir.NewDirectory("sqlite://"+path, mapping, sqlitedir.WithPasswordPolicy(policy))
+	require.NoError(t, err)
+	require.Implements(t, (*common.PasswordStore)(nil), directory)
+	policy.Store = directory.(common.PasswordStore)
+
+	valid, err := directory.BaseDN("uid=alice,ou=people,dc=example,dc=org").Bind("alice")
+	require.NoError(t, err)
+	assert.True(t, valid)
+	sessions := auth.NewSessions(context.Background(), time.Hour)
+	require.NoError(t, sessions.NewSession(1, directory.BaseDN("uid=alice,ou=people,dc=example,dc=org")))
+
+	// NOTE: the rehashed password is stored inside the database, and read
+	//       once the directory is reloaded.
+	reloaded, err := sqlitedir.NewDirectory("sqlite://"+path, mapping)
+	require.NoError(t, err)
+	alice := reloaded.BaseDN("uid=alice,ou=people,dc=example,dc=org").(*common.Object)
+	assert.Equal(t, common.PasswordStrong, common.AnalyzePassword(alice.BindPasswords.Unwrap()).Strength)
+
+	// NOTE: the rehash doesn't change the credentials, so the session bound
+	//       before the reload is kept.
+	sessions.Refresh(reloaded)
+	require.NotNil(t, sessions.Session(1))
+	assert.Same(t, alice, sessions.Session(1).Object())
+
+	valid, err = alice.Bind("alice")
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	err = policy.Store.UpdateBindPassword("uid=charlie,ou=people,dc=example,dc=org", "charlie")
+	assert.EqualError(t, err, "unable to update the bind password of 'uid=charlie,ou=people,dc=example,dc=org': the entry has no stored password")
+}
+
+func TestNewDirectory_RowID(t *testing.T) {
+	path := newDatabase(t, `
+		CREATE TABLE users (name TEXT);
+		CREATE TABLE emails (user INTEGER, email TEXT);
+		INSERT INTO users VALUES ('alice'), ('bob');
+		INSERT INTO emails VALUES (2, 'bob@example.org');
+	`)
+	mapping, err := sqlitedir.ParseMapping([]byte(`
+entries:
+  - table: users
+    base: dc=org
+    rdn: cn
+    attributes: {cn: name}
+    multiValued: [{attribute: mail, table: emails, key: user, column: email}]
+`))
+	require.NoError(t, err)
+
+	directory, err := sqlitedir.NewDirectory("sqlite://"+path, mapping)
+	require.NoError(t, err)
+
+	assert.Equal(t, ldap.Attributes{"cn": {"bob"}, "mail": {"bob@example.org"}}, directory.BaseDN("cn=bob,dc=org").Attributes())
+
+	entries, err := directory.BaseDN("dc=org").Search(gldap.SingleLevel, "(mail=BOB@example.org)")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "cn=bob,dc=org", entries[0].DN())
+}
+
+func TestNewDirectory_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		mapping  string
+		expected string
+	}{
+		{
+			name:     "UnknownTable",
+			script:   "CREATE TABLE users (name TEXT);",
+			mapping:  "entries: [{table: people, base: dc=org, rdn: cn, attributes: {cn: name}}]",
+			expected: "unable to read table 'people': no such table: people",
+		},
+		{
+			name:     "UnknownColumn",
+			script:   "CREATE TABLE users (name TEXT);",
+			mapping:  "entries: [{table: users, base: dc=org, rdn: cn, attributes: {cn: login}}]",
+			expected: "unable to read table 'users': no such column: login",
+		},
+		{
+			name:     "NullRDN",
+			script:   "CREATE TABLE users (name TEXT); INSERT INTO users VALUES (NULL);",
+			mapping:  "entries: [{table: users, base: dc=org, rdn: cn, attributes: {cn: name}}]",
+			expected: "invalid row of table 'users': the RDN attribute 'cn' is NULL",
+		},
+		{
+			name:     "DuplicatedEntry",
+			script:   "CREATE TABLE users (name TEXT); INSERT INTO users VALUES ('alice'), ('ALICE');",
+			mapping:  "entries: [{table: users, base: dc=org, rdn: cn, attributes: {cn: name}}]",
+			expected: "entry 'cn=ALICE,dc=org' is already defined",
+		},
+		{
+			name:     "InvalidACLRule",
+			script:   "CREATE TABLE users (name TEXT); CREATE TABLE acl (subject TEXT, rule TEXT); INSERT INTO acl VALUES ('*', '!!ldap/acl:allow-on {')",
+			mapping:  "{entries: [{table: users, base: dc=org, rdn: cn, attributes: {cn: name}}], acl: {table: acl}}",
+			expected: "invalid row 1 of table 'acl': invalid YAML value: yaml: line 2: did not find expected node content",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := newDatabase(t, tt.script)
+			mapping, err := sqlitedir.ParseMapping([]byte(tt.mapping))
+			require.NoError(t, err)
+
+			_, err = sqlitedir.NewDirectory("sqlite://"+path, mapping)
+			assert.EqualError(t, err, tt.expected)
+		})
+	}
+}
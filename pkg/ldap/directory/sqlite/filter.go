@@ -0,0 +1,177 @@
+package sqlitedir
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// lowerText is the SQL expression lower-casing the column given as format
+// argument like strings.ToLower does for ASCII values: SQLite only lower-cases
+// ASCII characters, but Go also lower-cases `İ` and `K` (Kelvin sign) into
+// ASCII ones.
+const lowerText = "lower(replace(replace(CAST(%s AS TEXT), '\u0130', 'i'), '\u212A', 'k'))"
+
+// candidates returns the key of the children of the given object which may
+// match the given filter: the entries mapped from the rows selected by the
+// filter pushed down to the database, and all other children. It returns
+// false if the filter cannot be pushed down or if the database cannot be
+// read or has changed since the entries were loaded (until the directory is
+// reloaded), in order to search all children.
+func (d *directory) candidates(obj *common.Object, filter *ber.Packet) (map[string]bool, bool) {
+	parent, _ := ldap.NormalizeDN(obj.DN())
+	mappings := d.mapped[parent]
+
+	conditions := make([]string, len(mappings))
+	args := make([][]any, len(mappings))
+	for i, mapping := range mappings {
+		var pushed bool
+		if conditions[i], args[i], pushed = mapping.where(filter); !pushed {
+			return nil, false
+		}
+	}
+
+	candidates := map[string]bool{}
+	for key, child := range obj.SubObjects {
+		// NOTE: entries with subordinates are always searched, because their
+		//       subordinates may match the filter.
+		if !d.rows[child] || len(child.SubObjects) > 0 {
+			candidates[key] = true
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tx, valid := d.snapshot()
+	if !valid {
+		return nil, false
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for i, mapping := range mappings {
+		query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", textColumns(mapping.column(mapping.RDN)), quoteIdentifier(mapping.Table), conditions[i])
+		rows, err := queryText(tx, query, args[i]...)
+		if err != nil {
+			return nil, false
+		}
+
+		for _, row := range rows {
+			if row[0].Valid {
+				candidates[ldap.RDN{{Type: mapping.RDN, Value: row[0].String}}.Normalize()] = true
+			}
+		}
+	}
+	return candidates, true
+}
+
+// where translates the given filter into an SQL condition selecting at least
+// all rows whose entry matches the filter. Only equality filters (with ASCII
+// values, compared case-insensitively like LDAP does) and presence filters,
+// combined with `&` and `|`, are translated; other filters select all rows.
+// It returns false if the condition selects all rows.
+func (mapping EntryMapping) where(filter *ber.Packet) (string, []any, bool) {
+	switch filter.Tag {
+	case goldap.FilterAnd:
+		var conditions []string
+		var args []any
+		for _, child := range filter.Children {
+			// NOTE: filters that cannot be translated are ignored, selecting
+			//       more rows than needed.
+			if condition, childArgs, pushed := mapping.where(child); pushed {
+				conditions = append(conditions, condition)
+				args = append(args, childArgs...)
+			}
+		}
+		if len(conditions) == 0 {
+			return "", nil, false
+		}
+		return "(" + strings.Join(conditions, " AND ") + ")", args, true
+
+	case goldap.FilterOr:
+		conditions := []string{"0"}
+		var args []any
+		for _, child := range filter.Children {
+			condition, childArgs, pushed := mapping.where(child)
+			if !pushed {
+				return "", nil, false
+			}
+			conditions = append(conditions, condition)
+			args = append(args, childArgs...)
+		}
+		return "(" + strings.Join(conditions, " OR ") + ")", args, true
+
+	case goldap.FilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return "", nil, false
+		}
+		attribute, _ := filter.Children[0].Value.(string)
+		value, valid := filter.Children[1].Value.(string)
+		if attribute == "" || !valid || !isASCII(value) {
+			return "", nil, false
+		}
+
+		value = strings.ToLower(value)
+		hasValue := func(values []string) bool {
+			for _, v := range values {
+				if strings.ToLower(v) == value {
+					return true
+				}
+			}
+			return false
+		}
+		condition, args := mapping.match(attribute, lowerText+" = ?", []any{value}, hasValue)
+		return condition, args, true
+
+	case goldap.FilterPresent:
+		attribute, _ := filter.Value.(string)
+		if attribute == "" {
+			return "", nil, false
+		}
+		condition, args := mapping.match(attribute, "%s IS NOT NULL", nil, func(values []string) bool { return len(values) > 0 })
+		return condition, args, true
+	}
+	return "", nil, false
+}
+
+// match returns the SQL condition selecting the rows where the given
+// attribute matches the given condition (formatted with the column holding
+// the attribute), on any of its columns or join tables. The given function
+// evaluates the condition on the object classes shared by all entries.
+func (mapping EntryMapping) match(attribute, condition string, args []any, static func(values []string) bool) (string, []any) {
+	if strings.EqualFold(attribute, "objectClass") && static(mapping.ObjectClass) {
+		return "1", nil
+	}
+
+	conditions := []string{"0"}
+	var conditionArgs []any
+	for name, column := range mapping.Attributes {
+		if strings.EqualFold(name, attribute) {
+			conditions = append(conditions, fmt.Sprintf(condition, quoteIdentifier(column)))
+			conditionArgs = append(conditionArgs, args...)
+		}
+	}
+	for _, join := range mapping.MultiValued {
+		if strings.EqualFold(join.Attribute, attribute) {
+			conditions = append(conditions, fmt.Sprintf("CAST(%s AS TEXT) IN (SELECT CAST(%s AS TEXT) FROM %s WHERE %s)",
+				quoteIdentifier(mapping.Key), quoteIdentifier(join.Key), quoteIdentifier(join.Table), fmt.Sprintf(condition, quoteIdentifier(join.Column))))
+			conditionArgs = append(conditionArgs, args...)
+		}
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", conditionArgs
+}
+
+// isASCII returns true if the given value only contains ASCII characters,
+// which are lower-cased the same way by SQLite and Go.
+func isASCII(value string) bool {
+	for _, c := range value {
+		if c > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+-- Schema and data of the SQLite database used by the tests, mapped to LDAP
+-- entries by mapping.yaml.
+CREATE TABLE units (
+    name        TEXT PRIMARY KEY,
+    description TEXT
+);
+INSERT INTO units VALUES ('people', 'All users'), ('groups', NULL);
+
+CREATE TABLE users (
+    id            INTEGER PRIMARY KEY,
+    username      TEXT NOT NULL UNIQUE,
+    full_name     TEXT NOT NULL,
+    last_name     TEXT,
+    password_hash TEXT
+);
+INSERT INTO users VALUES
+    (1000, 'alice', 'Alice Smith', 'Smith', '{SHA}UisnajVr3zkBPfq+os1D4UHsyeg='),
+    (1001, 'bob', 'Bob Johnson', 'Johnson', NULL),
+    (1002, 'charlie', 'Charlie Brown', NULL, NULL);
+CREATE INDEX users_full_name ON users (lower(full_name));
+
+CREATE TABLE user_emails (
+    user_id INTEGER NOT NULL REFERENCES users (id),
+    email   TEXT NOT NULL
+);
+INSERT INTO user_emails VALUES
+    (1000, 'alice@example.org'),
+    (1000, 'alice.smith@example.org'),
+    (1001, 'bob@example.org');
+
+CREATE TABLE groups (
+    gid  INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+INSERT INTO groups VALUES (2000, 'admins'), (2001, 'developers');
+
+CREATE TABLE group_members (
+    group_id INTEGER NOT NULL REFERENCES groups (gid),
+    user_id  INTEGER NOT NULL REFERENCES users (id)
+);
+INSERT INTO group_members VALUES (2000, 1000), (2001, 1000), (2001, 1001);
+
+-- NOTE: group members are referred by DN, built by a view.
+CREATE VIEW group_member_dns AS
+    SELECT group_id, 'uid=' || username || ',ou=people,dc=example,dc=org' AS dn
+    FROM group_members JOIN users ON users.id = group_members.user_id;
+
+CREATE TABLE acl (
+    subject TEXT NOT NULL,
+    rule    TEXT NOT NULL
+);
+INSERT INTO acl VALUES
+    ('*', '!!ldap/acl:deny-read-on {dn: "ou=people,dc=example,dc=org", attributes: [mail]}'),
+    ('group:cn=admins,ou=groups,dc=example,dc=org', '!!ldap/acl:allow-on dc=example,dc=org'),
+    ('group:cn=admins,ou=groups,dc=example,dc=org', '!!ldap/acl:allow-read-on {dn: "ou=people,dc=example,dc=org", attributes: [mail], filter: "(objectClass=inetOrgPerson)"}');
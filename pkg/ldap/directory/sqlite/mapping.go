@@ -0,0 +1,185 @@
+package sqlitedir
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// Mapping describes how the tables (or views) of an SQLite database are
+	// mapped to LDAP entries.
+	Mapping struct {
+		// Entries lists the tables whose rows are mapped to entries.
+		Entries []EntryMapping `yaml:"entries"`
+		// ACL describes the table containing the ACL policy of the directory.
+		ACL *ACLMapping `yaml:"acl"`
+
+		// path is the file the mapping was loaded from, if any.
+		path string
+	}
+
+	// EntryMapping maps each row of a table (or view) to an entry, whose DN is
+	// built from its RDN column and the base DN.
+	EntryMapping struct {
+		// Table is the table (or view) whose rows are mapped to entries.
+		Table string `yaml:"table"`
+		// Base is the DN of the parent of all entries.
+		Base string `yaml:"base"`
+		// RDN is the attribute used as RDN; it must be mapped to a column.
+		RDN string `yaml:"rdn"`
+		// Key is the column identifying the rows inside the join tables
+		// (`rowid` by default).
+		Key string `yaml:"key"`
+		// ObjectClass lists the object classes of all entries.
+		ObjectClass []string `yaml:"objectClass"`
+		// Attributes maps attribute names to the column holding their value.
+		// Columns containing NULL are ignored.
+		Attributes map[string]string `yaml:"attributes"`
+		// MultiValued lists the attributes whose values come from a join
+		// table.
+		MultiValued []JoinMapping `yaml:"multiValued"`
+		// Password is the column holding the bind password (hashed like the
+		// `!!ldap/bind:password` values of the YAML directory).
+		Password string `yaml:"password"`
+	}
+
+	// JoinMapping maps the rows of a join table to the values of a
+	// multi-valued attribute.
+	JoinMapping struct {
+		// Attribute is the name of the attribute.
+		Attribute string `yaml:"attribute"`
+		// Table is the join table (or view).
+		Table string `yaml:"table"`
+		// Key is the column of the join table referring to the key of the
+		// entry.
+		Key string `yaml:"key"`
+		// Column is the column of the join table holding the values.
+		Column string `yaml:"column"`
+	}
+
+	// ACLMapping describes the table containing the ACL policy, where each
+	// row is a subject (like the keys of the YAML `!!ldap/acl:policy`
+	// documents) and an ACL rule (e.g. `!!ldap/acl:allow-on dc=org`).
+	ACLMapping struct {
+		// Table is the table (or view) containing the ACL policy.
+		Table string `yaml:"table"`
+		// Subject is the column holding the subject (`subject` by default).
+		Subject string `yaml:"subject"`
+		// Rule is the column holding the rule (`rule` by default).
+		Rule string `yaml:"rule"`
+	}
+)
+
+// LoadMapping reads the mapping described by the given YAML file. The file is
+// watched like the database.
+func LoadMapping(path string) (*Mapping, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read mapping file: %w", err)
+	}
+
+	mapping, err := ParseMapping(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mapping file '%s': %w", path, err)
+	}
+	mapping.path = path
+	return mapping, nil
+}
+
+// ParseMapping decodes the given YAML mapping and checks that it is valid.
+func ParseMapping(raw []byte) (*Mapping, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	decoder.KnownFields(true)
+
+	var mapping Mapping
+	if err := decoder.Decode(&mapping); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if len(mapping.Entries) == 0 {
+		return nil, fmt.Errorf("at least one entry mapping is required")
+	}
+	for i := range mapping.Entries {
+		if err := mapping.Entries[i].validate(); err != nil {
+			return nil, fmt.Errorf("invalid mapping of table '%s': %w", mapping.Entries[i].Table, err)
+		}
+	}
+	if mapping.ACL != nil {
+		if err := mapping.ACL.validate(); err != nil {
+			return nil, fmt.Errorf("invalid ACL mapping: %w", err)
+		}
+	}
+	return &mapping, nil
+}
+
+// validate checks the entry mapping and sets its default values.
+func (mapping *EntryMapping) validate() error {
+	switch {
+	case mapping.Table == "":
+		return fmt.Errorf("a table is required")
+	case mapping.RDN == "":
+		return fmt.Errorf("a RDN attribute is required")
+	case mapping.column(mapping.RDN) == "":
+		return fmt.Errorf("the RDN attribute '%s' must be mapped to a column", mapping.RDN)
+	}
+	if _, err := ldap.ParseDN(mapping.Base); err != nil {
+		return fmt.Errorf("invalid base: %w", err)
+	}
+	if _, err := ldap.ParseDN(mapping.RDN + "=rdn"); err != nil {
+		return fmt.Errorf("invalid RDN attribute: %w", err)
+	}
+	if mapping.Key == "" {
+		mapping.Key = "rowid"
+	}
+
+	for attribute, column := range mapping.Attributes {
+		if column == "" {
+			return fmt.Errorf("no column given for attribute '%s'", attribute)
+		}
+	}
+	for _, join := range mapping.MultiValued {
+		if join.Attribute == "" || join.Table == "" || join.Key == "" || join.Column == "" {
+			return fmt.Errorf("multi-valued attributes require an attribute, a table, a key and a column")
+		}
+	}
+	return nil
+}
+
+// column returns the column holding the given attribute, or an empty string
+// if the attribute is not mapped to a column.
+func (mapping EntryMapping) column(attribute string) string {
+	for name, column := range mapping.Attributes {
+		if strings.EqualFold(name, attribute) {
+			return column
+		}
+	}
+	return ""
+}
+
+// validate checks the ACL mapping and sets its default values.
+func (mapping *ACLMapping) validate() error {
+	if mapping.Table == "" {
+		return fmt.Errorf("a table is required")
+	}
+	if mapping.Subject == "" {
+		mapping.Subject = "subject"
+	}
+	if mapping.Rule == "" {
+		mapping.Rule = "rule"
+	}
+	return nil
+}
+
+// quoteIdentifier returns the given table or column name quoted for SQLite.
+// Backquotes are used because SQLite considers unknown identifiers quoted by
+// double quotes as strings.
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
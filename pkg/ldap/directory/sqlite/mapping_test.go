@@ -0,0 +1,74 @@
+package sqlitedir_test
+
+import (
+	"testing"
+
+	sqlitedir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMapping(t *testing.T) {
+	mapping, err := sqlitedir.LoadMapping("fixtures/mapping.yaml")
+	require.NoError(t, err)
+
+	require.Len(t, mapping.Entries, 3)
+	assert.Equal(t, "rowid", mapping.Entries[0].Key)
+	assert.Equal(t, "id", mapping.Entries[1].Key)
+	assert.Equal(t, &sqlitedir.ACLMapping{Table: "acl", Subject: "subject", Rule: "rule"}, mapping.ACL)
+
+	t.Run("NoFile", func(t *testing.T) {
+		_, err := sqlitedir.LoadMapping("fixtures/does-not-exist.yaml")
+		assert.EqualError(t, err, "unable to read mapping file: open fixtures/does-not-exist.yaml: no such file or directory")
+	})
+}
+
+func TestParseMapping_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		mapping  string
+		expected string
+	}{
+		{
+			name:     "Empty",
+			mapping:  "",
+			expected: "at least one entry mapping is required",
+		},
+		{
+			name:     "UnknownField",
+			mapping:  "entries: [{table: users, base: dc=org, rdn: cn, attributes: {cn: name}, columns: [name]}]",
+			expected: "yaml: unmarshal errors:\n  line 1: field columns not found in type sqlitedir.EntryMapping",
+		},
+		{
+			name:     "NoTable",
+			mapping:  "entries: [{base: dc=org, rdn: cn, attributes: {cn: name}}]",
+			expected: "invalid mapping of table '': a table is required",
+		},
+		{
+			name:     "UnmappedRDN",
+			mapping:  "entries: [{table: users, base: dc=org, rdn: uid, attributes: {cn: name}}]",
+			expected: "invalid mapping of table 'users': the RDN attribute 'uid' must be mapped to a column",
+		},
+		{
+			name:     "InvalidBase",
+			mapping:  "entries: [{table: users, base: dc, rdn: cn, attributes: {cn: name}}]",
+			expected: "invalid mapping of table 'users': invalid base: invalid DN 'dc': missing '=' in 'dc'",
+		},
+		{
+			name:     "IncompleteJoin",
+			mapping:  "entries: [{table: users, base: dc=org, rdn: cn, attributes: {cn: name}, multiValued: [{attribute: mail, table: emails}]}]",
+			expected: "invalid mapping of table 'users': multi-valued attributes require an attribute, a table, a key and a column",
+		},
+		{
+			name:     "NoACLTable",
+			mapping:  "{entries: [{table: users, base: dc=org, rdn: cn, attributes: {cn: name}}], acl: {subject: who}}",
+			expected: "invalid ACL mapping: a table is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := sqlitedir.ParseMapping([]byte(tt.mapping))
+			assert.EqualError(t, err, tt.expected)
+		})
+	}
+}
@@ -1,9 +1,19 @@
 package directory
 
 import (
+	"errors"
+
 	"github.com/jimlambrt/gldap"
 )
 
+// ErrInvalidFilter is returned by Object.Search when the given filter cannot
+// be parsed.
+var ErrInvalidFilter = errors.New("invalid search filter")
+
+// MatchAllFilter is a search filter matching every entry, even the ones
+// without any objectClass.
+const MatchAllFilter = "(|(objectClass=*)(!(objectClass=*)))"
+
 type (
 	// Directory contains all current LDAP object tree, accessible using a base DN.
 	Directory interface {
@@ -20,15 +30,54 @@ type (
 		// Attributes returns the list of attributes of the current object.
 		Attributes() Attributes
 		// Search searches sub objects based on the given scope and filter.
-		Search(scope gldap.Scope, filter string) ([]Object, error)
+		Search(scope gldap.Scope, filter string, opts ...SearchOption) ([]Object, error)
 
 		// Bind returns true if the current object is able to authenticate and the password is correct.
 		// It returns false if the password is wrong and optional.None if it cannot be authenticated.
 		Bind(password string) (bool, error)
-		// CanSearchOn returns true if the current object is able to perform a search on the given DN.
-		CanSearchOn(dn string) bool
+		// CanSearchOn returns true if the current object is able to perform a search on the given entry.
+		CanSearchOn(entry Object) bool
+		// CanSearchBelow returns true if the current object may be able to perform a search on
+		// at least one entry below the given entry.
+		CanSearchBelow(entry Object) bool
+		// CanProxyAs returns true if the current object is able to perform operations on
+		// behalf of the given entry (proxied authorization).
+		CanProxyAs(entry Object) bool
+		// CanReadAttribute returns true if the current object is able to read the given attribute
+		// of the given entry.
+		CanReadAttribute(entry Object, attribute string) bool
+		// CanFilterOnAttribute returns true if the current object is able to use the given attribute
+		// of the given entry inside a search filter.
+		CanFilterOnAttribute(entry Object, attribute string) bool
+		// CanCompareAttribute returns true if the current object is able to compare the given
+		// attribute of the given entry.
+		CanCompareAttribute(entry Object, attribute string) bool
 	}
 
+	// SearchOptions contains all options used to customize a search.
+	SearchOptions struct {
+		// FilterableAttribute returns true if the given attribute of the given
+		// entry can be used to evaluate the search filter. If nil, all
+		// attributes can be used.
+		FilterableAttribute func(entry Object, attribute string) bool
+		// DerefAlias returns the entry referred by the given alias entry. If
+		// nil, aliases found below the search base are not dereferenced.
+		DerefAlias func(alias Object) (Object, error)
+		// OnReferral is called with each referral object found below the
+		// search base, instead of searching it. If nil, referral objects are
+		// searched like any other object.
+		OnReferral func(referral Object)
+	}
+
+	// SearchOption customizes a search.
+	SearchOption func(opts *SearchOptions)
+
 	// Attributes represents a list of LDAP named attributes.
 	Attributes map[string][]string
 )
+
+// WithFilterableAttributes restricts the attributes used to evaluate the search
+// filter, in order to avoid leaking hidden attributes through the filter.
+func WithFilterableAttributes(filterable func(entry Object, attribute string) bool) SearchOption {
+	return func(opts *SearchOptions) { opts.FilterableAttribute = filterable }
+}
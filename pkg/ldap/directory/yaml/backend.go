@@ -0,0 +1,120 @@
+package yamldir
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"os"
+	"strings"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	"github.com/chezmoi-sh/yaldap/pkg/secrets"
+)
+
+// Backend serves the directory described by a YAML file, by a directory of
+// YAML files or by a YAML file served over HTTP(S).
+type Backend struct {
+	Values []string `name:"values" help:"Path to a YAML file containing the values given to the directory template (as '.Values'); later files override earlier ones" placeholder:"PATH"`
+	Set    []string `name:"set" help:"Value given to the directory template, overriding the values files (e.g. 'admin.uid=alice')" sep:"none" placeholder:"KEY=VALUE"`
+
+	KeyFile []string `name:"key-file" help:"Path to a file containing age identities or a PGP private key, used to decrypt SOPS files and '!!ldap/encrypted' values" env:"YALDAP_KEY_FILE" placeholder:"PATH"`
+	Key     string   `name:"key" help:"age identity used to decrypt SOPS files and '!!ldap/encrypted' values (prefer the environment variable)" env:"YALDAP_KEY" placeholder:"AGE-SECRET-KEY-1..."`
+}
+
+//nolint:gochecknoinits
+func init() {
+	ldap.RegisterBackend(
+		ldap.BackendInfo{
+			Name:        "yaml",
+			Description: "Directory described by a YAML file, a directory of YAML files or a YAML file served over HTTP(S) (e.g. 'file:///etc/yaldap/directory.yaml' or 'dir:///etc/yaldap/conf.d')",
+			Schemes:     []string{"file", "dir", "http", "https"},
+		},
+		&Backend{},
+	)
+}
+
+// Validate checks that the YAML file (or directory) and the values files
+// exist, and that all template values and decryption keys are valid. Remote
+// files are only fetched when the directory is created.
+func (b Backend) Validate(url string) error {
+	switch {
+	case isRemote(url):
+		if _, err := neturl.Parse(url); err != nil {
+			return fmt.Errorf("invalid YAML directory URL: %w", err)
+		}
+	case strings.HasPrefix(url, "dir://"):
+		info, err := os.Stat(strings.TrimPrefix(url, "dir://"))
+		if err != nil {
+			return fmt.Errorf("unable to read YAML directory: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("unable to read YAML directory: '%s' is not a directory", strings.TrimPrefix(url, "dir://"))
+		}
+	default:
+		if _, err := os.Stat(strings.TrimPrefix(url, "file://")); err != nil {
+			return fmt.Errorf("unable to read YAML directory file: %w", err)
+		}
+	}
+	for _, path := range b.Values {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("unable to read template values file: %w", err)
+		}
+	}
+	if _, err := b.keys(); err != nil {
+		return err
+	}
+	_, err := b.values()
+	return err
+}
+
+// NewDirectory creates the directory described by the YAML file (or
+// directory) located at the given URL, enforcing the password policy carried
+// by the given context.
+func (b Backend) NewDirectory(ctx context.Context, url string) (ldap.Directory, error) {
+	values, err := b.values()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := b.keys()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDirectory(url,
+		WithPasswordPolicy(common.PasswordPolicyFromContext(ctx)),
+		WithValuesFiles(b.Values...),
+		WithValues(values),
+		WithDecryptionKeys(keys),
+	)
+}
+
+// values returns the template values given by `--set`.
+func (b Backend) values() (map[string]any, error) {
+	values := map[string]any{}
+	for _, assignment := range b.Set {
+		if err := SetValue(values, assignment); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// keys returns the decryption keys given by `--key-file` and `--key`.
+func (b Backend) keys() (*secrets.Keys, error) {
+	keys, err := secrets.LoadKeys(b.KeyFile...)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.Key != "" {
+		// NOTE: the key itself must never be part of the error.
+		parsed, err := secrets.ParseKeys([]byte(b.Key))
+		if err != nil {
+			return nil, errors.New("invalid decryption key: not a valid age identity")
+		}
+		keys.Add(parsed)
+	}
+	return keys, nil
+}
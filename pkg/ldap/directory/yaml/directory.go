@@ -6,52 +6,138 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"text/template"
 
 	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
 	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	"github.com/chezmoi-sh/yaldap/pkg/secrets"
 	"gopkg.in/yaml.v3"
 )
 
 type (
 	// directory represents the current LDAP directory. It contains all entries and an index for quick node search.
 	directory struct {
-		entries *common.Object
-		index   map[string]*common.Object
+		*common.Tree
+
+		passwordPolicy *common.PasswordPolicy
+		aclPolicy      []common.ACLPolicyRule
+
+		// files contains the YAML files (or directory), the values files and
+		// all files read by their template.
+		files []string
+
+		// valuesFiles and values are given to the directory template (see
+		// WithValuesFiles and WithValues).
+		valuesFiles []string
+		values      map[string]any
+
+		// keys are used to decrypt secrets (see WithDecryptionKeys).
+		keys *secrets.Keys
 	}
+
+	// Option customizes the directory built from the YAML definition.
+	Option func(directory *directory)
 )
 
-func NewDirectory(url string) (ldap.Directory, error) {
-	url = strings.TrimPrefix(url, "file://")
-	raw, err := os.ReadFile(url)
+// WithPasswordPolicy enforces the given password policy on all objects of the
+// directory.
+func WithPasswordPolicy(policy *common.PasswordPolicy) Option {
+	return func(directory *directory) { directory.passwordPolicy = policy }
+}
+
+// NewDirectory creates the directory described by the YAML file located at
+// the given URL. If the URL is a directory, all its `*.yaml` files are loaded
+// in lexical order and merged into a single tree (see newDirectoryFromFiles).
+// HTTP(S) URLs are fetched once per call (see newDirectoryFromURL).
+func NewDirectory(url string, opts ...Option) (ldap.Directory, error) {
+	if isRemote(url) {
+		return newDirectoryFromURL(url, opts...)
+	}
+
+	url = strings.TrimPrefix(strings.TrimPrefix(url, "file://"), "dir://")
+	if info, err := os.Stat(url); err == nil && info.IsDir() {
+		return newDirectoryFromFiles(url, opts...)
+	}
+
+	loader, err := newLoader(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := loader.load(url)
+	if err != nil {
+		return nil, loader.attribute(err, url)
+	}
+
+	dir, err := newDirectory(roots, loader, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read YAML directory file: %w", err)
+		return nil, loader.attribute(err, url)
 	}
+	dir.files = loader.files
+	return dir, nil
+}
 
-	template, err := yamlDirectoryTemplate.Parse(string(raw))
+// NewDirectoryFromYAML creates the directory described by the given YAML
+// definition. Included files are resolved from the current directory.
+func NewDirectoryFromYAML(raw []byte, opts ...Option) (ldap.Directory, error) {
+	loader, err := newLoader("", opts...)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse YAML directory file: %w", err)
+		return nil, err
+	}
+	roots, err := loader.decode("", raw)
+	if err != nil {
+		return nil, loader.attribute(err, "")
 	}
 
-	buf := bytes.NewBuffer(nil)
-	err = template.Execute(buf, nil)
+	dir, err := newDirectory(roots, loader, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse YAML directory file: %w", err)
+		return nil, loader.attribute(err, "")
 	}
+	dir.files = loader.files
+	return dir, nil
+}
 
-	return NewDirectoryFromYAML(buf.Bytes())
+// templateData is the data given to the YAML directory template.
+type templateData struct {
+	// Values contains the values given to the directory (see WithValuesFiles
+	// and WithValues).
+	Values map[string]any
+	// Files gives access to the files located next to the template.
+	Files templateFiles
 }
 
-func NewDirectoryFromYAML(raw []byte) (ldap.Directory, error) {
-	directory := &directory{
-		entries: &common.Object{
-			ImplObject: common.ImplObject{
-				Attributes: ldap.Attributes{"objectClass": {"top", "yaLDAPRootDSE"}},
-				SubObjects: map[string]*common.Object{},
+// renderTemplate executes the given YAML directory template, located at the
+// given path. All files read by the template are appended to the given list,
+// in order to reload the directory when one of them changes.
+func renderTemplate(path string, raw []byte, values map[string]any, files *[]string) ([]byte, error) {
+	tpl, err := template.Must(yamlDirectoryTemplate.Clone()).
+		Funcs(template.FuncMap{
+			"readFile": func(path string) (string, error) {
+				*files = append(*files, path)
+				return readFile(path)
 			},
-		},
-		index: map[string]*common.Object{},
+		}).
+		Parse(string(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	data := templateData{
+		Values: values,
+		Files:  templateFiles{dir: filepath.Dir(path), files: files},
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := tpl.Execute(buf, data); err != nil {
+		return nil, err
 	}
+	return buf.Bytes(), nil
+}
+
+// decodeDocuments returns the root node of all non-empty YAML documents. YAML
+// syntax errors are returned as-is.
+func decodeDocuments(raw []byte) ([]*yaml.Node, error) {
+	var roots []*yaml.Node
 	dec := yaml.NewDecoder(bytes.NewReader(raw))
 
 	for {
@@ -61,7 +147,7 @@ func NewDirectoryFromYAML(raw []byte) (ldap.Directory, error) {
 		if errors.Is(err, io.EOF) {
 			break
 		} else if err != nil {
-			return nil, fmt.Errorf("invalid LDAP YAML document: %w", err)
+			return nil, err
 		}
 
 		switch {
@@ -77,16 +163,46 @@ func NewDirectoryFromYAML(raw []byte) (ldap.Directory, error) {
 				source: &document,
 			}
 		}
+		roots = append(roots, document.Content[0])
+	}
+	return roots, nil
+}
+
+// newDirectory creates the directory described by the given YAML documents,
+// using the loader which has loaded them to describe where ACL rules are
+// defined.
+func newDirectory(roots []*yaml.Node, l *loader, opts ...Option) (*directory, error) {
+	directory := &directory{
+		Tree: common.NewTree(),
+	}
+	for _, opt := range opts {
+		opt(directory)
+	}
+
+	roots, err := resolveRefs(roots)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range roots {
+		if node.Tag == aclPolicyTag {
+			policy, err := parseACLPolicy(l, node)
+			if err != nil {
+				return nil, err
+			}
+			directory.aclPolicy = append(directory.aclPolicy, policy...)
+			continue
+		}
 
-		node := document.Content[0]
 		for idx := 0; idx < len(node.Content); idx += 2 {
+			var err error
 			key, value := node.Content[idx], node.Content[idx+1]
 
 			switch value.Kind {
 			case yaml.MappingNode:
-				err = parseLDAPObject(directory.entries, key, value)
+				err = parseLDAPObject(l, directory.Root(), key, value)
 			case yaml.SequenceNode, yaml.ScalarNode:
-				err = parseLDAPAttribute(directory.entries, key, value)
+				err = parseLDAPAttribute(l, directory.Root(), key, value)
 			}
 
 			if err != nil {
@@ -95,29 +211,15 @@ func NewDirectoryFromYAML(raw []byte) (ldap.Directory, error) {
 		}
 	}
 
-	indexDirectory(directory.entries, directory.index)
+	directory.Index(directory.passwordPolicy)
+	common.ResolveACLs(directory.Root(), directory.aclPolicy)
 	return directory, nil
 }
 
-func indexDirectory(obj *common.Object, index map[string]*common.Object) {
-	index[obj.DN()] = obj
-
-	for _, obj := range obj.SubObjects {
-		indexDirectory(obj, index)
-	}
+// ACLPolicy returns the ACL rules applying to the whole directory, defined by
+// the `!!ldap/acl:policy` documents.
+func (d directory) ACLPolicy() []common.ACLPolicyRule { return d.aclPolicy }
 
-	// delete the root object from the index
-	delete(index, "")
-}
-
-func (d directory) BaseDN(dn string) ldap.Object {
-	if dn == "" {
-		return d.entries
-	}
-
-	obj, found := d.index[dn]
-	if !found {
-		return nil
-	}
-	return obj
-}
+// WatchedFiles returns the YAML files (or directory) and all files read by
+// their template.
+func (d directory) WatchedFiles() []string { return d.files }
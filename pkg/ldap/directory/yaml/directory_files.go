@@ -0,0 +1,180 @@
+package yamldir
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"gopkg.in/yaml.v3"
+)
+
+// merger merges the documents of several YAML files into a single tree.
+type merger struct {
+	root     *yaml.Node
+	policies []*yaml.Node
+	origins  map[*yaml.Node]string
+}
+
+// newDirectoryFromFiles creates the directory described by all `*.yaml` files
+// of the given directory (conf.d style). Files are rendered independently,
+// like a single YAML file, then merged in lexical order: a file can add
+// entries below objects defined by another file, but cannot define the same
+// attribute twice.
+func newDirectoryFromFiles(path string, opts ...Option) (ldap.Directory, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read YAML directory: %w", err)
+	}
+
+	// NOTE: the directory itself is watched to detect added or removed files.
+	loader, err := newLoader("", opts...)
+	if err != nil {
+		return nil, err
+	}
+	loader.files = append(loader.files, path)
+	merger := &merger{
+		root:    &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"},
+		origins: loader.origins,
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
+			continue
+		}
+
+		file := filepath.Join(path, entry.Name())
+		roots, err := loader.load(file)
+		if err != nil {
+			return nil, loader.attribute(err, file)
+		}
+		if err := merger.merge(file, roots); err != nil {
+			return nil, err
+		}
+	}
+
+	dir, err := newDirectory(append([]*yaml.Node{merger.root}, merger.policies...), loader, opts...)
+	if err != nil {
+		return nil, loader.attribute(err, "")
+	}
+	dir.files = loader.files
+	return dir, nil
+}
+
+// merge merges the given documents, coming from the given file, into the
+// current tree.
+func (m *merger) merge(file string, roots []*yaml.Node) error {
+	for _, root := range roots {
+		if root.Tag == aclPolicyTag {
+			m.policies = append(m.policies, root)
+			continue
+		}
+		if err := m.mergeMapping(file, m.root, root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeMapping merges the keys of the src mapping node into the dst one.
+// Objects defined on both sides are merged recursively; any other key defined
+// on both sides is a conflict.
+func (m *merger) mergeMapping(file string, dst, src *yaml.Node) error {
+	for i := 0; i < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+
+		// NOTE: null values are ignored by the parser and merge keys are
+		//       resolved per object, so none of them can conflict.
+		if value.Tag == "!!null" {
+			continue
+		}
+		idx := indexKey(dst, key)
+		if isMergeKey(key) || idx < 0 {
+			dst.Content = append(dst.Content, key, value)
+			continue
+		}
+
+		existingKey, existing := dst.Content[idx], dst.Content[idx+1]
+		if !isObjectNode(existing) || !isObjectNode(value) {
+			return &ParseError{
+				err: fmt.Errorf(
+					"'%s' is already defined in '%s' at line %d, column %d",
+					key.Value,
+					m.origins[existingKey],
+					existingKey.Line,
+					existingKey.Column,
+				),
+				source: key,
+				file:   file,
+			}
+		}
+
+		// NOTE: the existing node is copied before being modified, because
+		//       it can be referenced elsewhere through a YAML alias.
+		merged := *resolveAlias(existing)
+		merged.Content = slices.Clone(merged.Content)
+		m.origins[&merged] = m.origins[existing]
+		dst.Content[idx+1] = &merged
+
+		if err := m.mergeMapping(file, &merged, resolveAlias(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexKey returns the index of the given key inside the given mapping node,
+// or -1 if it is not defined.
+func indexKey(mapping, key *yaml.Node) int {
+	for i := 0; i < len(mapping.Content); i += 2 {
+		if sameKey(mapping.Content[i], key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameKey returns true if both keys define the same object (same RDN) or the
+// same attribute (case-insensitive match).
+func sameKey(a, b *yaml.Node) bool {
+	if a.Kind != yaml.ScalarNode || b.Kind != yaml.ScalarNode {
+		return false
+	}
+	if strings.EqualFold(a.Value, b.Value) {
+		return true
+	}
+
+	rdnA, rdnB := keyRDN(a.Value), keyRDN(b.Value)
+	return rdnA != "" && rdnA == rdnB
+}
+
+// keyRDN returns the normalized RDN described by the given object key, or an
+// empty string if the key is not an object key.
+func keyRDN(key string) string {
+	rdnType, rdnValue, found := strings.Cut(key, ":")
+	if !found {
+		return ""
+	}
+	return ldap.RDN{{Type: rdnType, Value: rdnValue}}.Normalize()
+}
+
+// isMergeKey returns true if the given key is a YAML merge key (`<<`).
+func isMergeKey(key *yaml.Node) bool {
+	return key.Kind == yaml.ScalarNode && key.Value == "<<" &&
+		(key.Tag == "" || key.Tag == "!" || key.Tag == "!!merge")
+}
+
+// isObjectNode returns true if the given node describes a LDAP object.
+func isObjectNode(node *yaml.Node) bool {
+	node = resolveAlias(node)
+	return node.Kind == yaml.MappingNode && !isACLTag(node.Tag)
+}
+
+// resolveAlias returns the node referenced by the given YAML alias, if any.
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
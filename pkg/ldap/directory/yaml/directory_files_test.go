@@ -0,0 +1,132 @@
+package yamldir
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/jimlambrt/gldap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDirectory_Files(t *testing.T) {
+	directory, err := NewDirectory("file://fixtures/conf.d")
+	require.NoError(t, err)
+
+	t.Run("MergedObjects", func(t *testing.T) {
+		obj := directory.BaseDN("ou=group,dc=example,dc=org")
+		require.NotNil(t, obj)
+		assert.Equal(t,
+			ldap.Attributes{
+				"ou":          {"group"},
+				"objectClass": {"organizationalUnit"},
+				"description": {"Groups of the organization"},
+			},
+			obj.Attributes(),
+		)
+
+		entries, err := directory.BaseDN("dc=org").Search(gldap.WholeSubtree, "(objectClass=*)")
+		require.NoError(t, err)
+		var dns []string
+		for _, entry := range entries {
+			dns = append(dns, entry.DN())
+		}
+		assert.ElementsMatch(t,
+			[]string{
+				"dc=org",
+				"dc=example,dc=org",
+				"ou=group,dc=example,dc=org",
+				"cn=dev,ou=group,dc=example,dc=org",
+				"ou=people,dc=example,dc=org",
+				"cn=alice,ou=people,dc=example,dc=org",
+			},
+			dns,
+		)
+	})
+
+	t.Run("TemplatedFile", func(t *testing.T) {
+		obj := directory.BaseDN("cn=alice,ou=people,dc=example,dc=org")
+		require.NotNil(t, obj)
+
+		valid, err := obj.Bind("alice")
+		require.NoError(t, err)
+		assert.True(t, valid)
+		assert.True(t, obj.CanSearchOn(directory.BaseDN("cn=dev,ou=group,dc=example,dc=org")))
+	})
+
+	t.Run("ReferenceFromAnotherFile", func(t *testing.T) {
+		obj := directory.BaseDN("cn=dev,ou=group,dc=example,dc=org")
+		require.NotNil(t, obj)
+		assert.Equal(t, []string{"cn=alice,ou=people,dc=example,dc=org"}, obj.Attributes()["member"])
+	})
+
+	t.Run("WatchedFiles", func(t *testing.T) {
+		assert.Equal(t,
+			[]string{
+				"fixtures/conf.d",
+				"fixtures/conf.d/00-base.yaml",
+				"fixtures/conf.d/10-people.yaml",
+				"fixtures/conf.d/20-groups.yaml",
+			},
+			directory.(ldap.Watchable).WatchedFiles(),
+		)
+	})
+}
+
+func TestNewDirectory_FilesScheme(t *testing.T) {
+	directory, err := NewDirectory("dir://fixtures/conf.d")
+	require.NoError(t, err)
+	assert.NotNil(t, directory.BaseDN("cn=alice,ou=people,dc=example,dc=org"))
+}
+
+func TestNewDirectory_FilesConflict(t *testing.T) {
+	directory, err := NewDirectory("fixtures/invalid/conf.d.conflict")
+
+	assert.EqualError(t, err, "invalid LDAP YAML document 'fixtures/invalid/conf.d.conflict/10-override.yaml' at line 3, column 5: 'Description' is already defined in 'fixtures/invalid/conf.d.conflict/00-base.yaml' at line 3, column 5")
+	assert.Nil(t, directory)
+}
+
+func TestNewDirectory_FilesInvalid(t *testing.T) {
+	tests := []struct {
+		Name          string
+		Content       string
+		ExpectedError string
+	}{
+		{
+			Name:          "Template",
+			Content:       "{{ for }}",
+			ExpectedError: "unable to parse YAML directory file '%s': template: LDAP YAML Directory:1: function \"for\" not defined",
+		},
+		{
+			Name:          "YAML",
+			Content:       "dc:org: [",
+			ExpectedError: "invalid LDAP YAML document '%s': yaml: line 1: did not find expected node content",
+		},
+		{
+			Name:          "RootNode",
+			Content:       "- dc:org",
+			ExpectedError: "invalid LDAP YAML document '%s' at line 1, column 1: expected a mapping node (aka. dictionary) as root node, got a sequence node (aka. list/array)",
+		},
+		{
+			Name:          "Object",
+			Content:       "dc:org:\n  dc:example:\n    cn:a:b: {}\n",
+			ExpectedError: "invalid LDAP YAML document '%s' at line 3, column 13: invalid key: 'cn:a:b' must be in the form '<type>:<name>' (e.g. 'ou:users')",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			tmp := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(tmp, "00-base.yaml"), []byte("dc:org:\n  dc:example: {}\n"), 0o600))
+			file := filepath.Join(tmp, "10-invalid.yaml")
+			require.NoError(t, os.WriteFile(file, []byte(tt.Content), 0o600))
+
+			directory, err := NewDirectory(tmp)
+			assert.EqualError(t, err, fmt.Sprintf(tt.ExpectedError, file))
+			assert.Nil(t, directory)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
 	yamldir "github.com/chezmoi-sh/yaldap/pkg/ldap/directory/yaml"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -153,7 +154,7 @@ func TestFixture_Basic(t *testing.T) {
 		isBind, err := obj.Bind("alice")
 		require.NoError(t, err)
 		assert.True(t, isBind)
-		assert.True(t, obj.CanSearchOn("dc=org"))
+		assert.True(t, obj.CanSearchOn(objectWithDN("dc=org")))
 	})
 
 	t.Run("cn=bob,ou=people,c=fr,dc=example,dc=org", func(t *testing.T) {
@@ -174,8 +175,8 @@ func TestFixture_Basic(t *testing.T) {
 		isBind, err := obj.Bind("bob")
 		require.NoError(t, err)
 		assert.True(t, isBind)
-		assert.False(t, obj.CanSearchOn("dc=org"))
-		assert.True(t, obj.CanSearchOn("ou=group,dc=example,dc=org"))
+		assert.False(t, obj.CanSearchOn(objectWithDN("dc=org")))
+		assert.True(t, obj.CanSearchOn(objectWithDN("ou=group,dc=example,dc=org")))
 	})
 
 	t.Run("cn=charlie,ou=people,c=fr,dc=example,dc=org", func(t *testing.T) {
@@ -220,9 +221,9 @@ func TestFixture_Basic(t *testing.T) {
 		isBind, err := obj.Bind("charlie")
 		require.NoError(t, err)
 		assert.True(t, isBind)
-		assert.False(t, obj.CanSearchOn("dc=org"))
-		assert.True(t, obj.CanSearchOn("ou=group,dc=example,dc=org"))
-		assert.False(t, obj.CanSearchOn("cn=owner,ou=group,dc=example,dc=org"))
+		assert.False(t, obj.CanSearchOn(objectWithDN("dc=org")))
+		assert.True(t, obj.CanSearchOn(objectWithDN("ou=group,dc=example,dc=org")))
+		assert.False(t, obj.CanSearchOn(objectWithDN("cn=owner,ou=group,dc=example,dc=org")))
 	})
 
 	t.Run("c=uk,dc=example,dc=org", func(t *testing.T) {
@@ -267,10 +268,10 @@ func TestFixture_Basic(t *testing.T) {
 		isBind, err := obj.Bind("eve")
 		require.NoError(t, err)
 		assert.False(t, isBind)
-		assert.False(t, obj.CanSearchOn("dc=org"))
-		assert.False(t, obj.CanSearchOn("ou=group,dc=example,dc=org"))
-		assert.False(t, obj.CanSearchOn("c=fr,dc=example,dc=org"))
-		assert.False(t, obj.CanSearchOn("cn=admin,ou=group,dc=example,dc=org"))
+		assert.False(t, obj.CanSearchOn(objectWithDN("dc=org")))
+		assert.False(t, obj.CanSearchOn(objectWithDN("ou=group,dc=example,dc=org")))
+		assert.False(t, obj.CanSearchOn(objectWithDN("c=fr,dc=example,dc=org")))
+		assert.False(t, obj.CanSearchOn(objectWithDN("cn=admin,ou=group,dc=example,dc=org")))
 	})
 }
 
@@ -385,7 +386,7 @@ func TestFixture_Templated(t *testing.T) {
 		isBind, err := obj.Bind("bind")
 		require.NoError(t, err)
 		assert.True(t, isBind)
-		assert.True(t, obj.CanSearchOn("dc=org"))
+		assert.True(t, obj.CanSearchOn(objectWithDN("dc=org")))
 	})
 
 	t.Run("cn=alice,ou=people,dc=example,dc=org", func(t *testing.T) {
@@ -410,8 +411,8 @@ func TestFixture_Templated(t *testing.T) {
 		isBind, err := obj.Bind("alice")
 		require.NoError(t, err)
 		assert.True(t, isBind)
-		assert.False(t, obj.CanSearchOn("dc=org"))
-		assert.True(t, obj.CanSearchOn("cn=alice,ou=people,dc=example,dc=org"))
+		assert.False(t, obj.CanSearchOn(objectWithDN("dc=org")))
+		assert.True(t, obj.CanSearchOn(objectWithDN("cn=alice,ou=people,dc=example,dc=org")))
 	})
 
 	t.Run("cn=bob,ou=people,dc=example,dc=org", func(t *testing.T) {
@@ -435,8 +436,8 @@ func TestFixture_Templated(t *testing.T) {
 		isBind, err := obj.Bind("bob")
 		require.NoError(t, err)
 		assert.True(t, isBind)
-		assert.False(t, obj.CanSearchOn("dc=org"))
-		assert.True(t, obj.CanSearchOn("cn=bob,ou=people,dc=example,dc=org"))
+		assert.False(t, obj.CanSearchOn(objectWithDN("dc=org")))
+		assert.True(t, obj.CanSearchOn(objectWithDN("cn=bob,ou=people,dc=example,dc=org")))
 	})
 
 	t.Run("cn=charlie,ou=people,dc=example,dc=org", func(t *testing.T) {
@@ -460,8 +461,8 @@ func TestFixture_Templated(t *testing.T) {
 		isBind, err := obj.Bind("charlie")
 		require.NoError(t, err)
 		assert.True(t, isBind)
-		assert.False(t, obj.CanSearchOn("dc=org"))
-		assert.True(t, obj.CanSearchOn("cn=charlie,ou=people,dc=example,dc=org"))
+		assert.False(t, obj.CanSearchOn(objectWithDN("dc=org")))
+		assert.True(t, obj.CanSearchOn(objectWithDN("cn=charlie,ou=people,dc=example,dc=org")))
 	})
 
 	t.Run("cn=eve,ou=people,dc=example,dc=org", func(t *testing.T) {
@@ -485,7 +486,12 @@ func TestFixture_Templated(t *testing.T) {
 		isBind, err := obj.Bind("eve")
 		require.NoError(t, err)
 		assert.True(t, isBind)
-		assert.False(t, obj.CanSearchOn("dc=org"))
-		assert.True(t, obj.CanSearchOn("cn=eve,ou=people,dc=example,dc=org"))
+		assert.False(t, obj.CanSearchOn(objectWithDN("dc=org")))
+		assert.True(t, obj.CanSearchOn(objectWithDN("cn=eve,ou=people,dc=example,dc=org")))
 	})
 }
+
+// objectWithDN returns an empty object with the given DN.
+func objectWithDN(dn string) *common.Object {
+	return &common.Object{ImplObject: common.ImplObject{DN: dn}}
+}
@@ -0,0 +1,72 @@
+package yamldir
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+)
+
+// remoteTimeout is the maximum duration allowed to fetch a remote YAML file.
+const remoteTimeout = 30 * time.Second
+
+// isRemote returns true if the given URL refers to a YAML file served over
+// HTTP(S).
+func isRemote(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
+
+// newDirectoryFromURL creates the directory described by the YAML file served
+// at the given HTTP(S) URL. Because remote files must never read local files,
+// they are neither rendered as templates nor allowed to include other files.
+func newDirectoryFromURL(url string, opts ...Option) (ldap.Directory, error) {
+	raw, err := fetch(url)
+	if err != nil {
+		return nil, err
+	}
+
+	loader, err := newLoader(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+	loader.remote = true
+
+	roots, err := loader.decode(url, raw)
+	if err != nil {
+		return nil, loader.attribute(err, url)
+	}
+	dir, err := newDirectory(roots, loader, opts...)
+	if err != nil {
+		return nil, loader.attribute(err, url)
+	}
+	return dir, nil
+}
+
+// fetch returns the content of the file served at the given HTTP(S) URL.
+func fetch(url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid YAML directory URL: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch YAML directory file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch YAML directory file '%s': unexpected status '%s'", url, resp.Status)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch YAML directory file '%s': %w", url, err)
+	}
+	return raw, nil
+}
@@ -0,0 +1,46 @@
+package yamldir
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDirectory_Remote(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.Dir("fixtures")))
+	mux.HandleFunc("/templated/directory.yaml", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("dc:org:\n  objectClass: [top, domain]\n  description: '{{ .Values.description }}'\n"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Run("Valid", func(t *testing.T) {
+		directory, err := NewDirectory(server.URL + "/basic.yaml")
+		require.NoError(t, err)
+		assert.NotNil(t, directory.BaseDN("cn=alice,ou=people,c=fr,dc=example,dc=org"))
+	})
+
+	t.Run("Invalid/Status", func(t *testing.T) {
+		_, err := NewDirectory(server.URL + "/unknown.yaml")
+		assert.EqualError(t, err, "unable to fetch YAML directory file '"+server.URL+"/unknown.yaml': unexpected status '404 Not Found'")
+	})
+
+	t.Run("Invalid/Include", func(t *testing.T) {
+		_, err := NewDirectory(server.URL + "/include/directory.yaml")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid '!!ldap/include' tag: remote files cannot include other files")
+	})
+
+	t.Run("NotRendered", func(t *testing.T) {
+		directory, err := NewDirectory(server.URL+"/templated/directory.yaml", WithValues(map[string]any{"description": "rendered"}))
+		require.NoError(t, err)
+		assert.Equal(t,
+			[]string{"{{ .Values.description }}"},
+			directory.BaseDN("dc=org").Attributes()["description"],
+		)
+	})
+}
@@ -2,6 +2,7 @@ package yamldir
 
 import (
 	"os"
+	"path/filepath"
 	"text/template"
 
 	"github.com/Masterminds/sprig/v3"
@@ -11,5 +12,35 @@ var yamlDirectoryTemplate = template.
 	New("LDAP YAML Directory").
 	Funcs(sprig.TxtFuncMap()).
 	Funcs(template.FuncMap{
-		"readFile": func(p string) (string, error) { s, e := os.ReadFile(p); return string(s), e },
+		"readFile": readFile,
 	})
+
+// readFile returns the content of the given file.
+func readFile(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	return string(raw), err
+}
+
+// templateFiles gives access to the files located next to a YAML directory
+// template (as `.Files`).
+type templateFiles struct {
+	dir   string
+	files *[]string
+}
+
+// Path returns the path of the given file, relative to the directory of the
+// template.
+func (f templateFiles) Path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(f.dir, name)
+}
+
+// Get returns the content of the given file, relative to the directory of the
+// template.
+func (f templateFiles) Get(name string) (string, error) {
+	path := f.Path(name)
+	*f.files = append(*f.files, path)
+	return readFile(path)
+}
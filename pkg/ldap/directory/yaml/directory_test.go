@@ -5,7 +5,9 @@ import (
 
 	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
 	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	"github.com/jimlambrt/gldap"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewDirectory_NoFile(t *testing.T) {
@@ -38,6 +40,17 @@ func TestNewDirectory_InvalidTemplate(t *testing.T) {
 	})
 }
 
+func TestNewDirectory_WatchedFiles(t *testing.T) {
+	directory, err := NewDirectory("file://fixtures/templated.yaml")
+	require.NoError(t, err)
+
+	assert.Implements(t, (*ldap.Watchable)(nil), directory)
+	assert.Equal(t,
+		[]string{"fixtures/templated.yaml", "fixtures/secrets/password.json"},
+		directory.(ldap.Watchable).WatchedFiles(),
+	)
+}
+
 func TestNewDirectoryFromYAML_ValidYAML(t *testing.T) {
 	raw := []byte(`
 ou:people:
@@ -45,26 +58,24 @@ ou:people:
     memberOf: [admin, user, h4ck3r]
     givenname: alice
 `)
-	expected := &directory{
-		entries: &common.Object{
-			ImplObject: common.ImplObject{
-				Attributes: ldap.Attributes{"objectClass": {"top", "yaLDAPRootDSE"}},
-				SubObjects: map[string]*common.Object{
-					"ou:people": {
-						ImplObject: common.ImplObject{
-							DN:         "ou=people",
-							Attributes: ldap.Attributes{"ou": {"people"}},
-							SubObjects: map[string]*common.Object{
-								"uid:alice": {
-									ImplObject: common.ImplObject{
-										DN: "uid=alice,ou=people",
-										Attributes: ldap.Attributes{
-											"uid":       {"alice"},
-											"memberOf":  {"admin", "user", "h4ck3r"},
-											"givenname": {"alice"},
-										},
-										SubObjects: map[string]*common.Object{},
+	expected := &common.Object{
+		ImplObject: common.ImplObject{
+			Attributes: ldap.Attributes{"objectClass": {"top", "yaLDAPRootDSE"}},
+			SubObjects: map[string]*common.Object{
+				"ou:people": {
+					ImplObject: common.ImplObject{
+						DN:         "ou=people",
+						Attributes: ldap.Attributes{"ou": {"people"}},
+						SubObjects: map[string]*common.Object{
+							"uid:alice": {
+								ImplObject: common.ImplObject{
+									DN: "uid=alice,ou=people",
+									Attributes: ldap.Attributes{
+										"uid":       {"alice"},
+										"memberOf":  {"admin", "user", "h4ck3r"},
+										"givenname": {"alice"},
 									},
+									SubObjects: map[string]*common.Object{},
 								},
 							},
 						},
@@ -72,44 +83,17 @@ ou:people:
 				},
 			},
 		},
-		index: map[string]*common.Object{
-			"ou=people": {
-				ImplObject: common.ImplObject{
-					DN:         "ou=people",
-					Attributes: ldap.Attributes{"ou": {"people"}},
-					SubObjects: map[string]*common.Object{
-						"uid:alice": {
-							ImplObject: common.ImplObject{
-								DN: "uid=alice,ou=people",
-								Attributes: ldap.Attributes{
-									"uid":       {"alice"},
-									"memberOf":  {"admin", "user", "h4ck3r"},
-									"givenname": {"alice"},
-								},
-								SubObjects: map[string]*common.Object{},
-							},
-						},
-					},
-				},
-			},
-			"uid=alice,ou=people": {
-				ImplObject: common.ImplObject{
-					DN: "uid=alice,ou=people",
-					Attributes: ldap.Attributes{
-						"uid":       {"alice"},
-						"memberOf":  {"admin", "user", "h4ck3r"},
-						"givenname": {"alice"},
-					},
-					SubObjects: map[string]*common.Object{},
-				},
-			},
-		},
 	}
 
 	directory, err := NewDirectoryFromYAML(raw)
 
-	assert.NoError(t, err)
-	assert.Equal(t, expected, directory)
+	require.NoError(t, err)
+	assert.Equal(t, expected, directory.BaseDN(""))
+
+	// NOTE: all objects are indexed by their normalized DN.
+	root := directory.BaseDN("").(*common.Object)
+	assert.Same(t, root.SubObjects["ou:people"], directory.BaseDN("ou=people"))
+	assert.Same(t, root.SubObjects["ou:people"].SubObjects["uid:alice"], directory.BaseDN("UID=Alice, OU=People"))
 }
 
 func TestDirectory_BaseDN(t *testing.T) {
@@ -183,9 +167,138 @@ ou:people:
 		assert.Equal(t, expected, actual)
 	})
 
+	t.Run("non-normalized DN", func(t *testing.T) {
+		actual := directory.BaseDN("UID = Alice, OU=People")
+
+		require.NotNil(t, actual)
+		assert.Equal(t, "uid=alice,ou=people", actual.DN())
+	})
+
 	t.Run("DN not found", func(t *testing.T) {
 		actual := directory.BaseDN("cn=does-not-exist")
 
 		assert.Nil(t, actual)
 	})
+
+	t.Run("invalid DN", func(t *testing.T) {
+		actual := directory.BaseDN("alice")
+
+		assert.Nil(t, actual)
+	})
+}
+
+func TestNewDirectoryFromYAML_WithPasswordPolicy(t *testing.T) {
+	raw := []byte(`
+ou:people:
+  uid:alice:
+    userPassword: !!ldap/bind:password alice
+`)
+	policy := &common.PasswordPolicy{MinStrength: common.PasswordStrong}
+
+	directory, err := NewDirectoryFromYAML(raw, WithPasswordPolicy(policy))
+	assert.NoError(t, err)
+
+	assert.Same(t, policy, directory.BaseDN("ou=people").(*common.Object).PasswordPolicy)
+	assert.Same(t, policy, directory.BaseDN("uid=alice,ou=people").(*common.Object).PasswordPolicy)
+}
+
+func TestNewDirectoryFromYAML_WithInheritedACLs(t *testing.T) {
+	raw := []byte(`
+dc:org:
+  ou:group:
+    cn:admins:
+      member: uid=alice,ou=people,dc=org
+      .#acl: !!ldap/members-acl:allow-on dc=org
+  ou:people:
+    .#acl: !!ldap/subtree-acl:allow-on ou=people,dc=org
+    uid:alice: {}
+    uid:bob:
+      .#acl: !!ldap/acl:deny-on ou=people,dc=org
+    uid:charlie: {}
+--- !!ldap/acl:policy
+group:cn=admins,ou=group,dc=org: !!ldap/acl:proxy-as ou=people,dc=org
+"*": !!ldap/acl:deny-on dc=org
+`)
+
+	directory, err := NewDirectoryFromYAML(raw)
+	require.NoError(t, err)
+
+	alice := directory.BaseDN("uid=alice,ou=people,dc=org")
+	assert.True(t, alice.CanSearchOn(directory.BaseDN("ou=group,dc=org")))
+	assert.True(t, alice.CanProxyAs(directory.BaseDN("uid=bob,ou=people,dc=org")))
+
+	bob := directory.BaseDN("uid=bob,ou=people,dc=org")
+	assert.False(t, bob.CanSearchOn(directory.BaseDN("uid=alice,ou=people,dc=org")))
+	assert.False(t, bob.CanSearchOn(directory.BaseDN("ou=group,dc=org")))
+
+	charlie := directory.BaseDN("uid=charlie,ou=people,dc=org")
+	assert.True(t, charlie.CanSearchOn(directory.BaseDN("uid=alice,ou=people,dc=org")))
+	assert.False(t, charlie.CanSearchOn(directory.BaseDN("ou=group,dc=org")))
+	assert.False(t, charlie.CanProxyAs(directory.BaseDN("uid=bob,ou=people,dc=org")))
+
+	// NOTE: subtree rules are not applied on the object defining them.
+	assert.False(t, directory.BaseDN("ou=people,dc=org").CanSearchOn(directory.BaseDN("ou=people,dc=org")))
+}
+
+func TestNewDirectoryFromYAML_WithAliases(t *testing.T) {
+	raw := []byte(`
+dc:org:
+  ou:people:
+    uid:alice:
+      objectClass: person
+  ou:engineering:
+    uid:alice: !!ldap/alias uid=alice,ou=people,dc=org
+    uid:bob:
+      objectClass: [alias, extensibleObject]
+      aliasedObjectName: uid=bob,ou=people,dc=org
+    cn:team: !!ldap/alias cn=team,ou=engineering,dc=org
+`)
+
+	directory, err := NewDirectoryFromYAML(raw)
+	require.NoError(t, err)
+
+	alias := directory.BaseDN("uid=alice,ou=engineering,dc=org")
+	require.NotNil(t, alias)
+	assert.Equal(t, ldap.Attributes{
+		"uid":               {"alice"},
+		"objectClass":       {"alias", "extensibleObject"},
+		"aliasedObjectName": {"uid=alice,ou=people,dc=org"},
+	}, alias.Attributes())
+	assert.True(t, ldap.IsAlias(alias))
+
+	target, err := ldap.DerefAlias(directory, alias)
+	require.NoError(t, err)
+	assert.Equal(t, "uid=alice,ou=people,dc=org", target.DN())
+
+	_, err = ldap.DerefAlias(directory, directory.BaseDN("uid=bob,ou=engineering,dc=org"))
+	assert.ErrorIs(t, err, ldap.ErrAliasProblem)
+	_, err = ldap.DerefAlias(directory, directory.BaseDN("cn=team,ou=engineering,dc=org"))
+	assert.EqualError(t, err, "alias problem: alias loop detected on 'cn=team,ou=engineering,dc=org'")
+
+	// NOTE: aliases found below the base are only dereferenced on demand.
+	entries, err := directory.BaseDN("ou=engineering,dc=org").Search(gldap.SingleLevel, "(objectClass=person)")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	entries, err = directory.BaseDN("ou=engineering,dc=org").Search(gldap.SingleLevel, "(objectClass=person)", ldap.WithAliasDereferencing(directory))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "uid=alice,ou=people,dc=org", entries[0].DN())
+}
+
+func TestNewDirectoryFromYAML_WithAliasLoop(t *testing.T) {
+	raw := []byte(`
+dc:org:
+  ou:people:
+    uid:alice: {}
+    ou:all: !!ldap/alias dc=org
+`)
+
+	directory, err := NewDirectoryFromYAML(raw)
+	require.NoError(t, err)
+
+	entries, err := directory.BaseDN("dc=org").Search(gldap.WholeSubtree, "(uid=alice)", ldap.WithAliasDereferencing(directory))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "uid=alice,ou=people,dc=org", entries[0].DN())
 }
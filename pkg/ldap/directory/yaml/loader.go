@@ -0,0 +1,204 @@
+package yamldir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/chezmoi-sh/yaldap/pkg/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// includeTag is the tag used to graft the content of another YAML file at the
+// position of the tagged node (e.g. `ou:people: !!ldap/include people.yaml`).
+const includeTag = "!!ldap/include"
+
+// loader loads YAML directory files and all files they include, remembering
+// the file each node comes from in order to report it on errors and in the
+// origin of ACL rules.
+type loader struct {
+	// main is the file given to NewDirectory; errors occurring inside it
+	// and ACL rules defined inside it are reported without its name.
+	main    string
+	files   []string
+	origins map[*yaml.Node]string
+	values  map[string]any
+	keys    *secrets.Keys
+
+	// including contains the files being loaded, used to detect include
+	// cycles.
+	including []string
+	// remote is true when the main file is served over HTTP(S); such files
+	// cannot include local files.
+	remote bool
+}
+
+// newLoader returns a loader whose main file is the given one, rendering
+// templates with the values given by the options.
+func newLoader(main string, opts ...Option) (*loader, error) {
+	settings := &directory{}
+	for _, opt := range opts {
+		opt(settings)
+	}
+
+	values, err := loadValues(settings.valuesFiles)
+	if err != nil {
+		return nil, err
+	}
+	mergeValues(values, settings.values)
+
+	return &loader{
+		main:    main,
+		files:   slices.Clone(settings.valuesFiles),
+		origins: map[*yaml.Node]string{},
+		values:  values,
+		keys:    settings.keys,
+	}, nil
+}
+
+// load reads, renders and decodes the given YAML file, then grafts all files
+// it includes.
+func (l *loader) load(path string) ([]*yaml.Node, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read YAML directory file: %w", err)
+	}
+	l.files = append(l.files, path)
+
+	raw, err = renderTemplate(path, raw, l.values, &l.files)
+	if err != nil {
+		if path != l.main {
+			return nil, fmt.Errorf("unable to parse YAML directory file '%s': %w", path, err)
+		}
+		return nil, fmt.Errorf("unable to parse YAML directory file: %w", err)
+	}
+	return l.decode(path, raw)
+}
+
+// decode decodes and decrypts the given YAML definition, coming from the
+// given file, then grafts all files it includes.
+func (l *loader) decode(path string, raw []byte) ([]*yaml.Node, error) {
+	roots, err := decodeDocuments(raw)
+	if err == nil {
+		roots, err = l.decrypt(raw, roots)
+	}
+	var perr *ParseError
+	switch {
+	case errors.As(err, &perr):
+		return nil, l.attribute(perr, path)
+	case err != nil && path != l.main:
+		return nil, fmt.Errorf("invalid LDAP YAML document '%s': %w", path, err)
+	case err != nil:
+		return nil, fmt.Errorf("invalid LDAP YAML document: %w", err)
+	}
+
+	l.including = append(l.including, path)
+	defer func() { l.including = l.including[:len(l.including)-1] }()
+
+	for _, root := range roots {
+		l.track(path, root)
+		if err := l.graft(path, root); err != nil {
+			return nil, err
+		}
+	}
+	return roots, nil
+}
+
+// graft replaces all nodes tagged with includeTag inside the given mapping
+// node by the content of the included file. Relative paths are resolved from
+// the directory of the including file.
+func (l *loader) graft(path string, node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 1; i < len(node.Content); i += 2 {
+		value := node.Content[i]
+		if value.Tag != includeTag {
+			if err := l.graft(path, value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if value.Kind != yaml.ScalarNode {
+			return &ParseError{
+				err:    fmt.Errorf("invalid '%s' type: only a %s is allowed", includeTag, YamlKindVerbose(yaml.ScalarNode)),
+				source: value,
+			}
+		}
+		if l.remote {
+			return &ParseError{err: fmt.Errorf("invalid '%s' tag: remote files cannot include other files", includeTag), source: value}
+		}
+
+		target := value.Value
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		if slices.Contains(l.including, target) {
+			return &ParseError{
+				err:    fmt.Errorf("invalid '%s' tag: '%s' is already being included (include cycle)", includeTag, target),
+				source: value,
+			}
+		}
+
+		roots, err := l.load(target)
+		var perr *ParseError
+		switch {
+		case errors.As(err, &perr):
+			return err
+		case err != nil:
+			return &ParseError{err: fmt.Errorf("invalid '%s' tag: %w", includeTag, err), source: value}
+		case len(roots) != 1 || roots[0].Tag == aclPolicyTag:
+			return &ParseError{
+				err:    fmt.Errorf("invalid '%s' tag: '%s' must contain exactly one document describing an object", includeTag, target),
+				source: value,
+			}
+		}
+		node.Content[i] = roots[0]
+	}
+	return nil
+}
+
+// track records the file all given nodes come from.
+func (l *loader) track(path string, node *yaml.Node) {
+	if _, tracked := l.origins[node]; tracked {
+		return
+	}
+
+	l.origins[node] = path
+	for _, child := range node.Content {
+		l.track(path, child)
+	}
+}
+
+// origin describes where the given node has been defined, naming the file it
+// comes from unless it is the main file (or the loader is nil).
+func (l *loader) origin(node *yaml.Node) string {
+	if l != nil {
+		if file, tracked := l.origins[node]; tracked && file != l.main {
+			return fmt.Sprintf("'%s' at line %d, column %d", file, node.Line, node.Column)
+		}
+	}
+	return fmt.Sprintf("line %d, column %d", node.Line, node.Column)
+}
+
+// attribute attributes the given error to the file its source node comes
+// from (or to the given file if the node is unknown), unless it is the main
+// file.
+func (l *loader) attribute(err error, path string) error {
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.file != "" {
+		return err
+	}
+
+	if origin, tracked := l.origins[perr.source]; tracked {
+		path = origin
+	}
+	if path != l.main {
+		perr.file = path
+	}
+	return err
+}
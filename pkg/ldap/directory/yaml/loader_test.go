@@ -0,0 +1,96 @@
+package yamldir
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDirectory_Include(t *testing.T) {
+	directory, err := NewDirectory("fixtures/include/directory.yaml")
+	require.NoError(t, err)
+
+	t.Run("GraftedObjects", func(t *testing.T) {
+		obj := directory.BaseDN("ou=people,dc=example,dc=org")
+		require.NotNil(t, obj)
+		assert.Equal(t, ldap.Attributes{"ou": {"people"}, "objectClass": {"organizationalUnit"}}, obj.Attributes())
+
+		obj = directory.BaseDN("cn=alice,ou=people,dc=example,dc=org")
+		require.NotNil(t, obj)
+		valid, err := obj.Bind("alice")
+		require.NoError(t, err)
+		assert.True(t, valid)
+	})
+
+	t.Run("WatchedFiles", func(t *testing.T) {
+		assert.Equal(t,
+			[]string{
+				"fixtures/include/directory.yaml",
+				"fixtures/include/people/people.yaml",
+				"fixtures/include/people/alice.yaml",
+			},
+			directory.(ldap.Watchable).WatchedFiles(),
+		)
+	})
+}
+
+func TestNewDirectory_IncludeInvalid(t *testing.T) {
+	tests := []struct {
+		Name          string
+		Files         map[string]string
+		ExpectedError string
+	}{
+		{
+			Name:          "MissingFile",
+			Files:         map[string]string{"main.yaml": "dc:org: !!ldap/include missing.yaml\n"},
+			ExpectedError: "invalid LDAP YAML document at line 1, column 9: invalid '!!ldap/include' tag: unable to read YAML directory file: open {{tmp}}/missing.yaml: no such file or directory",
+		},
+		{
+			Name:          "NotScalar",
+			Files:         map[string]string{"main.yaml": "dc:org: !!ldap/include [a.yaml]\n"},
+			ExpectedError: "invalid LDAP YAML document at line 1, column 9: invalid '!!ldap/include' type: only a scalar node (aka. primitive) is allowed",
+		},
+		{
+			Name: "Cycle",
+			Files: map[string]string{
+				"main.yaml": "dc:org: !!ldap/include org.yaml\n",
+				"org.yaml":  "dc:example: !!ldap/include org.yaml\n",
+			},
+			ExpectedError: "invalid LDAP YAML document '{{tmp}}/org.yaml' at line 1, column 13: invalid '!!ldap/include' tag: '{{tmp}}/org.yaml' is already being included (include cycle)",
+		},
+		{
+			Name: "SeveralDocuments",
+			Files: map[string]string{
+				"main.yaml": "dc:org: !!ldap/include org.yaml\n",
+				"org.yaml":  "dc:example: {}\n---\ndc:test: {}\n",
+			},
+			ExpectedError: "invalid LDAP YAML document at line 1, column 9: invalid '!!ldap/include' tag: '{{tmp}}/org.yaml' must contain exactly one document describing an object",
+		},
+		{
+			Name: "InvalidIncludedObject",
+			Files: map[string]string{
+				"main.yaml": "dc:org: !!ldap/include org.yaml\n",
+				"org.yaml":  "dc:example:\n  cn:a:b: {}\n",
+			},
+			ExpectedError: "invalid LDAP YAML document '{{tmp}}/org.yaml' at line 2, column 11: invalid key: 'cn:a:b' must be in the form '<type>:<name>' (e.g. 'ou:users')",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			tmp := t.TempDir()
+			for name, content := range tt.Files {
+				require.NoError(t, os.WriteFile(filepath.Join(tmp, name), []byte(content), 0o600))
+			}
+
+			directory, err := NewDirectory(filepath.Join(tmp, "main.yaml"))
+			assert.EqualError(t, err, strings.ReplaceAll(tt.ExpectedError, "{{tmp}}", tmp))
+			assert.Nil(t, directory)
+		})
+	}
+}
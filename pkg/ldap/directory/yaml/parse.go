@@ -11,7 +11,7 @@ import (
 )
 
 // parseLDAPObject parses a YAML mapping node into a LDAP object.
-func parseLDAPObject(parent *common.Object, key, value *yaml.Node) error {
+func parseLDAPObject(l *loader, parent *common.Object, key, value *yaml.Node) error {
 	if strings.Count(key.Value, ":") != 1 {
 		return &ParseError{
 			err: fmt.Errorf(
@@ -23,18 +23,38 @@ func parseLDAPObject(parent *common.Object, key, value *yaml.Node) error {
 	}
 
 	// extract the DN from the key
-	dn := strings.Replace(key.Value, ":", "=", 1)
-	if parent := parent.DN(); parent != "" {
-		dn = dn + "," + parent
+	rdnType, rdnValue, _ := strings.Cut(key.Value, ":")
+	rdn := ldap.RDN{{Type: rdnType, Value: rdnValue}}
+	if _, err := ldap.ParseDN(rdn.String()); err != nil {
+		return &ParseError{
+			err:    fmt.Errorf("invalid key: '%s' is not a valid RDN: %w", key.Value, err),
+			source: key,
+		}
+	}
+
+	for name, sibling := range parent.SubObjects {
+		if siblingDN, _ := ldap.ParseDN(sibling.DN()); name != key.Value && siblingDN[0].Normalize() == rdn.Normalize() {
+			return &ParseError{
+				err: fmt.Errorf(
+					"invalid key: '%s' is already defined (same RDN as '%s')",
+					key.Value,
+					name,
+				),
+				source: key,
+			}
+		}
+	}
+
+	parentDN, err := ldap.ParseDN(parent.DN())
+	if err != nil {
+		return &ParseError{err: err, source: key}
 	}
 
 	obj := &common.Object{
 		ImplObject: common.ImplObject{
-			DN:         dn,
+			DN:         append(ldap.DN{rdn}, parentDN...).String(),
 			SubObjects: map[string]*common.Object{},
-			Attributes: ldap.Attributes{
-				strings.SplitN(key.Value, ":", 2)[0]: []string{strings.SplitN(key.Value, ":", 2)[1]},
-			},
+			Attributes: ldap.Attributes{rdnType: []string{rdnValue}},
 		},
 	}
 
@@ -56,8 +76,7 @@ func parseLDAPObject(parent *common.Object, key, value *yaml.Node) error {
 
 		// if the sub-node is a 'merge' node, merge the content of the
 		// referenced node into the current node (priority merge)
-		if skey.Kind == yaml.ScalarNode && skey.Value == "<<" &&
-			(skey.Tag == "" || skey.Tag == "!" || skey.Tag == "!!merge") {
+		if isMergeKey(skey) {
 			if svalue.Kind != yaml.MappingNode {
 				return &ParseError{
 					err:    fmt.Errorf("only mapping nodes can be merged, got a %s", YamlKindVerbose(svalue.Kind)),
@@ -69,13 +88,14 @@ func parseLDAPObject(parent *common.Object, key, value *yaml.Node) error {
 			continue
 		}
 
-		switch svalue.Kind {
-		case yaml.MappingNode:
-			if err := parseLDAPObject(obj, skey, svalue); err != nil {
+		isACL := isACLTag(svalue.Tag)
+		switch {
+		case svalue.Kind == yaml.MappingNode && !isACL:
+			if err := parseLDAPObject(l, obj, skey, svalue); err != nil {
 				return err
 			}
-		case yaml.SequenceNode, yaml.ScalarNode:
-			if err := parseLDAPAttribute(obj, skey, svalue); err != nil {
+		case svalue.Kind == yaml.SequenceNode, svalue.Kind == yaml.ScalarNode, isACL:
+			if err := parseLDAPAttribute(l, obj, skey, svalue); err != nil {
 				return err
 			}
 		default:
@@ -86,17 +106,41 @@ func parseLDAPObject(parent *common.Object, key, value *yaml.Node) error {
 		seen[skey.Value] = true
 	}
 
+	if ldap.IsAlias(obj) {
+		if err := validateAlias(obj); err != nil {
+			return &ParseError{err: err, source: value}
+		}
+	}
+	if ldap.IsReferral(obj) {
+		if err := validateReferral(obj); err != nil {
+			return &ParseError{err: err, source: value}
+		}
+	}
+
 	parent.SubObjects[key.Value] = obj
 	return nil
 }
 
 // parseLDAPAttribute parses a YAML sequence or scalar node into a LDAP attribute.
-func parseLDAPAttribute(parent *common.Object, key, value *yaml.Node) error {
+func parseLDAPAttribute(l *loader, parent *common.Object, key, value *yaml.Node) error {
 	// ignore all null values
 	if value.Tag == "!!null" {
 		return nil
 	}
 
+	// NOTE: alias entries are defined like attributes, using a scalar node.
+	if value.Tag == aliasTag {
+		return parseLDAPAlias(l, parent, key, value)
+	}
+
+	// NOTE: custom tags are handled first because some of them (e.g.
+	//       attribute-level ACL rules) can be defined using mapping nodes.
+	if stop, err := handleCustomTags(l, parent, value); err != nil {
+		return err
+	} else if stop {
+		return nil
+	}
+
 	if value.Kind != yaml.ScalarNode && value.Kind != yaml.SequenceNode {
 		return &ParseError{
 			err: fmt.Errorf(
@@ -108,10 +152,9 @@ func parseLDAPAttribute(parent *common.Object, key, value *yaml.Node) error {
 		}
 	}
 
-	if stop, err := handleCustomTags(parent, value); err != nil {
-		return err
-	} else if stop {
-		return nil
+	// NOTE: attributes holding a bind password are hidden by default
+	if value.Tag == "!!ldap/bind:password" && !slices.Contains(parent.SecretAttributes, key.Value) {
+		parent.SecretAttributes = append(parent.SecretAttributes, key.Value)
 	}
 
 	for name := range parent.Attributes() {
@@ -132,7 +175,7 @@ func parseLDAPAttribute(parent *common.Object, key, value *yaml.Node) error {
 		parent.AddAttribute(key.Value, value.Value)
 	case yaml.SequenceNode:
 		for _, node := range value.Content {
-			err := parseLDAPAttribute(parent, key, node)
+			err := parseLDAPAttribute(l, parent, key, node)
 			if err != nil {
 				return err
 			}
@@ -140,3 +183,19 @@ func parseLDAPAttribute(parent *common.Object, key, value *yaml.Node) error {
 	}
 	return nil
 }
+
+// validateReferral checks that the given referral object (RFC 3296) refers to
+// at least one valid LDAP URL.
+func validateReferral(referral *common.Object) error {
+	urls := ldap.ReferralURLs(referral)
+	if len(urls) == 0 {
+		return fmt.Errorf("invalid referral: at least one 'ref' is required")
+	}
+
+	for _, url := range urls {
+		if err := ldap.ValidateReferralURL(url); err != nil {
+			return fmt.Errorf("invalid referral: %w", err)
+		}
+	}
+	return nil
+}
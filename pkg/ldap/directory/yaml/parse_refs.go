@@ -0,0 +1,220 @@
+package yamldir
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"gopkg.in/yaml.v3"
+)
+
+// refTag is the tag used to reference another object, resolved to its DN
+// when the directory is loaded (e.g. `member: !!ldap/ref ou:people/cn:alice`).
+const refTag = "!!ldap/ref"
+
+// refResolver resolves the `!!ldap/ref` values of a YAML directory
+// definition.
+type refResolver struct {
+	// dns contains the DN of all objects, indexed by their normalized form.
+	dns map[string]string
+}
+
+// resolveRefs replaces all `!!ldap/ref` values of the given documents by the
+// DN of the referenced object. A reference is either an absolute DN (e.g.
+// `cn=alice,ou=people,dc=example,dc=org`) or a path of object keys (e.g.
+// `ou:people/cn:alice`) searched below the object owning the reference, then
+// below each of its ancestors. Nodes are copied before being modified because
+// they can be shared through YAML aliases.
+func resolveRefs(roots []*yaml.Node) ([]*yaml.Node, error) {
+	resolver := &refResolver{dns: map[string]string{}}
+	for _, root := range roots {
+		if root.Tag != aclPolicyTag {
+			resolver.collect(root, ldap.DN{})
+		}
+	}
+
+	resolved := make([]*yaml.Node, len(roots))
+	for i, root := range roots {
+		if root.Tag == aclPolicyTag {
+			resolved[i] = root
+			continue
+		}
+
+		var err error
+		if resolved[i], err = resolver.object(root, ldap.DN{}); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// collect records the DN of all objects defined inside the given object.
+func (r *refResolver) collect(node *yaml.Node, dn ldap.DN) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], resolveAlias(node.Content[i+1])
+
+		switch {
+		case isMergeKey(key) && value.Kind == yaml.MappingNode:
+			r.collect(value, dn)
+		case isObjectNode(value) || value.Tag == aliasTag:
+			child, valid := childDN(key, dn)
+			if !valid {
+				continue
+			}
+
+			r.dns[child.Normalize()] = child.String()
+			if value.Kind == yaml.MappingNode {
+				r.collect(value, child)
+			}
+		}
+	}
+}
+
+// object resolves all references of the given object, returning a copy of
+// the node if any of them has been resolved.
+func (r *refResolver) object(node *yaml.Node, dn ldap.DN) (*yaml.Node, error) {
+	var content []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], resolveAlias(node.Content[i+1])
+
+		var resolved *yaml.Node
+		var err error
+		switch {
+		case isMergeKey(key) && value.Kind == yaml.MappingNode:
+			resolved, err = r.object(value, dn)
+		case isObjectNode(value):
+			child, valid := childDN(key, dn)
+			if !valid {
+				// NOTE: invalid keys are reported by the parser.
+				continue
+			}
+			resolved, err = r.object(value, child)
+		default:
+			resolved, err = r.attribute(value, dn)
+		}
+
+		switch {
+		case err != nil:
+			return nil, err
+		case resolved != value && content == nil:
+			content = slices.Clone(node.Content)
+			fallthrough
+		case content != nil:
+			content[i+1] = resolved
+		}
+	}
+
+	if content == nil {
+		return node, nil
+	}
+	copied := *node
+	copied.Content = content
+	return &copied, nil
+}
+
+// attribute resolves the references of the given attribute value, returning a
+// copy of the node if any of them has been resolved.
+func (r *refResolver) attribute(node *yaml.Node, dn ldap.DN) (*yaml.Node, error) {
+	switch {
+	case node.Tag == refTag:
+		return r.resolve(node, dn)
+	case node.Kind != yaml.SequenceNode || isACLTag(node.Tag):
+		return node, nil
+	}
+
+	var content []*yaml.Node
+	for i, value := range node.Content {
+		resolved, err := r.attribute(resolveAlias(value), dn)
+		switch {
+		case err != nil:
+			return nil, err
+		case resolved != resolveAlias(value) && content == nil:
+			content = slices.Clone(node.Content)
+			fallthrough
+		case content != nil:
+			content[i] = resolved
+		}
+	}
+
+	if content == nil {
+		return node, nil
+	}
+	copied := *node
+	copied.Content = content
+	return &copied, nil
+}
+
+// resolve returns a scalar node containing the DN of the object referenced by
+// the given node, from the object identified by the given DN.
+func (r *refResolver) resolve(node *yaml.Node, dn ldap.DN) (*yaml.Node, error) {
+	if node.Kind != yaml.ScalarNode {
+		return nil, &ParseError{
+			err:    fmt.Errorf("invalid '%s' type: only a %s is allowed", refTag, YamlKindVerbose(yaml.ScalarNode)),
+			source: node,
+		}
+	}
+
+	var candidates []ldap.DN
+	if strings.Contains(node.Value, "=") {
+		target, err := ldap.ParseDN(node.Value)
+		if err != nil {
+			return nil, &ParseError{err: fmt.Errorf("invalid '%s' tag: %w", refTag, err), source: node}
+		}
+		candidates = append(candidates, target)
+	} else {
+		var relative ldap.DN
+		for _, key := range strings.Split(node.Value, "/") {
+			child, valid := childDN(&yaml.Node{Value: key}, relative)
+			if !valid {
+				return nil, &ParseError{
+					err: fmt.Errorf(
+						"invalid '%s' tag: '%s' must be a DN or a path of keys like 'ou:people/cn:alice'",
+						refTag,
+						node.Value,
+					),
+					source: node,
+				}
+			}
+			relative = child
+		}
+
+		for base := dn; ; base = base.Parent() {
+			candidates = append(candidates, append(slices.Clone(relative), base...))
+			if len(base) == 0 {
+				break
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		if target, exists := r.dns[candidate.Normalize()]; exists {
+			return &yaml.Node{
+				Kind:   yaml.ScalarNode,
+				Tag:    "!!str",
+				Value:  target,
+				Line:   node.Line,
+				Column: node.Column,
+			}, nil
+		}
+	}
+	return nil, &ParseError{
+		err:    fmt.Errorf("invalid '%s' tag: no object found for '%s' from '%s'", refTag, node.Value, dn.String()),
+		source: node,
+	}
+}
+
+// childDN returns the DN of the object described by the given key below the
+// given DN, or false if the key is not a valid object key.
+func childDN(key *yaml.Node, parent ldap.DN) (ldap.DN, bool) {
+	if strings.Count(key.Value, ":") != 1 {
+		return nil, false
+	}
+
+	rdnType, rdnValue, _ := strings.Cut(key.Value, ":")
+	rdn := ldap.RDN{{Type: rdnType, Value: rdnValue}}
+	if _, err := ldap.ParseDN(rdn.String()); err != nil {
+		return nil, false
+	}
+	return append(ldap.DN{rdn}, parent...), true
+}
@@ -0,0 +1,91 @@
+package yamldir
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveRefs(t *testing.T) {
+	directory, err := NewDirectory("fixtures/include/directory.yaml")
+	require.NoError(t, err)
+
+	t.Run("Relative", func(t *testing.T) {
+		obj := directory.BaseDN("cn=bob,ou=people,dc=example,dc=org")
+		require.NotNil(t, obj)
+		assert.Equal(t, []string{"cn=alice,ou=people,dc=example,dc=org"}, obj.Attributes()["manager"])
+	})
+
+	t.Run("RelativeFromAncestor", func(t *testing.T) {
+		obj := directory.BaseDN("cn=dev,ou=group,dc=example,dc=org")
+		require.NotNil(t, obj)
+		assert.Equal(t,
+			[]string{"cn=alice,ou=people,dc=example,dc=org", "cn=bob,ou=people,dc=example,dc=org"},
+			obj.Attributes()["member"],
+		)
+	})
+}
+
+func TestResolveRefs_Aliases(t *testing.T) {
+	// NOTE: relative references are resolved from the object using them, even
+	//       if they are shared through YAML anchors.
+	directory, err := NewDirectoryFromYAML([]byte(`
+dc:org:
+  ou:a:
+    cn:admin: {}
+    cn:group:
+      member: &members [!!ldap/ref cn:admin]
+  ou:b:
+    cn:admin: {}
+    cn:group:
+      member: *members
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"cn=admin,ou=a,dc=org"}, directory.BaseDN("cn=group,ou=a,dc=org").Attributes()["member"])
+	assert.Equal(t, []string{"cn=admin,ou=b,dc=org"}, directory.BaseDN("cn=group,ou=b,dc=org").Attributes()["member"])
+}
+
+func TestResolveRefs_Invalid(t *testing.T) {
+	tests := []struct {
+		Name          string
+		YAML          string
+		ExpectedError string
+	}{
+		{
+			Name:          "MissingRelative",
+			YAML:          "dc:org:\n  cn:group:\n    member: !!ldap/ref ou:people/cn:alice\n",
+			ExpectedError: "invalid LDAP YAML document at line 3, column 13: invalid '!!ldap/ref' tag: no object found for 'ou:people/cn:alice' from 'cn=group,dc=org'",
+		},
+		{
+			Name:          "MissingAbsolute",
+			YAML:          "dc:org:\n  cn:group:\n    member:\n      - !!ldap/ref cn=alice,dc=org\n",
+			ExpectedError: "invalid LDAP YAML document at line 4, column 9: invalid '!!ldap/ref' tag: no object found for 'cn=alice,dc=org' from 'cn=group,dc=org'",
+		},
+		{
+			Name:          "InvalidDN",
+			YAML:          "dc:org:\n  cn:group:\n    member: !!ldap/ref cn=alice,dc\n",
+			ExpectedError: "invalid LDAP YAML document at line 3, column 13: invalid '!!ldap/ref' tag: invalid DN 'cn=alice,dc': missing '=' in 'dc'",
+		},
+		{
+			Name:          "InvalidPath",
+			YAML:          "dc:org:\n  cn:group:\n    member: !!ldap/ref alice\n",
+			ExpectedError: "invalid LDAP YAML document at line 3, column 13: invalid '!!ldap/ref' tag: 'alice' must be a DN or a path of keys like 'ou:people/cn:alice'",
+		},
+		{
+			Name:          "NotScalar",
+			YAML:          "dc:org:\n  cn:group:\n    member: !!ldap/ref [cn:alice]\n",
+			ExpectedError: "invalid LDAP YAML document at line 3, column 13: invalid '!!ldap/ref' type: only a scalar node (aka. primitive) is allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			directory, err := NewDirectoryFromYAML([]byte(tt.YAML))
+
+			assert.EqualError(t, err, tt.ExpectedError)
+			assert.Nil(t, directory)
+		})
+	}
+}
@@ -2,7 +2,11 @@ package yamldir
 
 import (
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
 	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
 	"github.com/moznion/go-optional"
 	"gopkg.in/yaml.v3"
@@ -11,7 +15,7 @@ import (
 // handleCustomTags handles custom tags that are not supported by the YAML library
 // but required to enhence some features for the LDAP directory.
 // It returns true if we should stop parsing the node, false otherwise.
-func handleCustomTags(parent *common.Object, node *yaml.Node) (bool, error) {
+func handleCustomTags(l *loader, parent *common.Object, node *yaml.Node) (bool, error) {
 	switch node.Tag {
 	case "!!ldap/bind:password":
 		if parent.BindPasswords.IsSome() {
@@ -37,31 +41,304 @@ func handleCustomTags(parent *common.Object, node *yaml.Node) (bool, error) {
 		}
 		parent.BindPasswords = optional.Some(node.Value)
 
-	case "!!ldap/acl:allow-on", "!!ldap/acl:deny-on":
-		allowed := node.Tag == "!!ldap/acl:allow-on"
-		rules := node.Content
-		if node.Kind == yaml.ScalarNode {
-			rules = []*yaml.Node{node}
-		}
-
-		for _, rule := range rules {
-			if rule.Kind != yaml.ScalarNode {
-				return false, &ParseError{
-					err: fmt.Errorf(
-						"invalid '%s' type: only a %s is allowed",
-						node.Tag,
-						YamlKindVerbose(yaml.ScalarNode),
-					),
-					source: node,
-				}
+	case "!!ldap/bind:totp":
+		if parent.BindTOTP != nil {
+			return false, &ParseError{
+				err: fmt.Errorf(
+					"invalid '%s' tag: only one %s per object is allowed",
+					node.Tag,
+					node.Tag,
+				),
+				source: node,
 			}
+		}
 
-			parent.AddACLRule(common.ACLRule{
-				DistinguishedNameSuffix: rule.Value,
-				Allowed:                 allowed,
-			})
+		if node.Kind != yaml.ScalarNode {
+			return false, &ParseError{
+				err: fmt.Errorf(
+					"invalid '%s' type: only a %s is allowed",
+					node.Tag,
+					YamlKindVerbose(yaml.ScalarNode),
+				),
+				source: node,
+			}
+		}
+
+		totp, err := common.NewTOTP(node.Value)
+		if err != nil {
+			return false, &ParseError{err: fmt.Errorf("invalid '%s' tag: %w", node.Tag, err), source: node}
+		}
+		parent.BindTOTP = totp
+		return true, nil
+
+	default:
+		family, name, _ := strings.Cut(node.Tag, ":")
+		rule, exists := aclRules[name]
+		if !exists || !slices.Contains(aclTagFamilies, family) {
+			return false, nil
+		}
+
+		rules, err := parseACLRules(l, node, rule.capability, rule.allowed)
+		if err != nil {
+			return true, err
+		}
+
+		switch family {
+		case "!!ldap/acl":
+			parent.AddACLRule(rules...)
+		case "!!ldap/members-acl":
+			parent.MemberACLs = append(parent.MemberACLs, rules...)
+			sort.Stable(parent.MemberACLs)
+		case "!!ldap/subtree-acl":
+			parent.SubtreeACLs = append(parent.SubtreeACLs, rules...)
+			sort.Stable(parent.SubtreeACLs)
 		}
 		return true, nil
 	}
 	return false, nil
 }
+
+// isACLTag returns true if the given tag defines ACL rules.
+func isACLTag(tag string) bool {
+	family, name, _ := strings.Cut(tag, ":")
+	_, exists := aclRules[name]
+	return exists && slices.Contains(aclTagFamilies, family)
+}
+
+// aclTagFamilies contains the tag prefixes used to define ACL rules, applied
+// respectively on the object itself, on all its members and on all objects
+// below it.
+var aclTagFamilies = []string{"!!ldap/acl", "!!ldap/members-acl", "!!ldap/subtree-acl"}
+
+// aclRules contains all ACL rule names (tag suffixes), with the capability
+// they grant (or deny).
+var aclRules = map[string]struct {
+	capability common.ACLCapability
+	allowed    bool
+}{
+	"allow-on":         {common.ACLSearch, true},
+	"deny-on":          {common.ACLSearch, false},
+	"proxy-as":         {common.ACLProxy, true},
+	"allow-read-on":    {common.ACLRead, true},
+	"deny-read-on":     {common.ACLRead, false},
+	"allow-filter-on":  {common.ACLFilter, true},
+	"deny-filter-on":   {common.ACLFilter, false},
+	"allow-compare-on": {common.ACLCompare, true},
+	"deny-compare-on":  {common.ACLCompare, false},
+}
+
+// parseACLRules parses the ACL rules defined by the given tagged node. Each
+// rule is either a scalar node containing the target of the rule (a DN suffix,
+// a LDAP filter like `(objectClass=posixGroup)`, `self` or `member-of`) or a
+// mapping node like `{dn: <suffix>, filter: <filter>, target: <relation>}`.
+// Attribute-level rules (read, filter and compare) also accept an
+// `attributes: [<attribute>, ...]` field.
+func parseACLRules(l *loader, node *yaml.Node, capability common.ACLCapability, allowed bool) (common.ACLRuleSet, error) {
+	rules := node.Content
+	if node.Kind != yaml.SequenceNode {
+		rules = []*yaml.Node{node}
+	}
+
+	var acls common.ACLRuleSet
+	for _, rule := range rules {
+		acl := common.ACLRule{
+			Allowed:    allowed,
+			Capability: capability,
+			Origin:     l.origin(rule),
+		}
+
+		switch rule.Kind {
+		case yaml.ScalarNode:
+			relation, isRelation := aclRelations[rule.Value]
+			switch {
+			case isRelation:
+				acl.Relation = relation
+			case strings.HasPrefix(rule.Value, "("):
+				acl.Filter = rule.Value
+			default:
+				acl.DistinguishedNameSuffix = rule.Value
+			}
+		case yaml.MappingNode:
+			if err := parseACLRuleMapping(&acl, node.Tag, rule); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, &ParseError{
+				err: fmt.Errorf(
+					"invalid '%s' type: only a %s or a %s is allowed",
+					node.Tag,
+					YamlKindVerbose(yaml.ScalarNode),
+					YamlKindVerbose(yaml.MappingNode),
+				),
+				source: node,
+			}
+		}
+
+		if err := acl.Compile(); err != nil {
+			return nil, &ParseError{err: fmt.Errorf("invalid '%s' tag: %w", node.Tag, err), source: rule}
+		}
+		acls = append(acls, acl)
+	}
+	return acls, nil
+}
+
+// aclRelations contains all relations usable as ACL rule target.
+var aclRelations = map[string]common.ACLRelation{
+	"self":      common.ACLRelationSelf,
+	"member-of": common.ACLRelationMemberOf,
+}
+
+// parseACLRuleMapping parses an ACL rule defined by a mapping node, with the
+// `dn`, `filter`, `target` and (for attribute-level rules) `attributes`
+// fields.
+func parseACLRuleMapping(acl *common.ACLRule, tag string, rule *yaml.Node) error {
+	attributeLevel := acl.Capability == common.ACLRead || acl.Capability == common.ACLFilter || acl.Capability == common.ACLCompare
+
+	for i := 0; i+1 < len(rule.Content); i += 2 {
+		key, value := rule.Content[i], rule.Content[i+1]
+
+		switch {
+		case key.Value == "dn" && value.Kind == yaml.ScalarNode:
+			acl.DistinguishedNameSuffix = value.Value
+		case key.Value == "filter" && value.Kind == yaml.ScalarNode:
+			acl.Filter = value.Value
+		case key.Value == "target" && value.Kind == yaml.ScalarNode:
+			relation, exists := aclRelations[value.Value]
+			if !exists {
+				return &ParseError{
+					err:    fmt.Errorf("invalid '%s' target '%s': only 'self' and 'member-of' are allowed", tag, value.Value),
+					source: value,
+				}
+			}
+			acl.Relation = relation
+		case key.Value == "attributes" && attributeLevel && value.Kind == yaml.ScalarNode:
+			acl.Attributes = append(acl.Attributes, value.Value)
+		case key.Value == "attributes" && attributeLevel && value.Kind == yaml.SequenceNode:
+			for _, attr := range value.Content {
+				if attr.Kind != yaml.ScalarNode {
+					return &ParseError{
+						err:    fmt.Errorf("invalid '%s' attributes: only %s are allowed", tag, YamlKindVerbose(yaml.ScalarNode)),
+						source: attr,
+					}
+				}
+				acl.Attributes = append(acl.Attributes, attr.Value)
+			}
+		case attributeLevel:
+			return &ParseError{
+				err:    fmt.Errorf("invalid '%s' field '%s': only 'dn', 'filter', 'target' and 'attributes' are allowed", tag, key.Value),
+				source: key,
+			}
+		default:
+			return &ParseError{
+				err:    fmt.Errorf("invalid '%s' field '%s': only 'dn', 'filter' and 'target' are allowed", tag, key.Value),
+				source: key,
+			}
+		}
+	}
+
+	if acl.DistinguishedNameSuffix == "" && acl.Filter == "" && acl.Relation == common.ACLRelationAny {
+		return &ParseError{err: fmt.Errorf("invalid '%s' rule: missing 'dn', 'filter' or 'target' field", tag), source: rule}
+	}
+	return nil
+}
+
+// aclPolicyTag is the tag of the root node of a document defining the ACL
+// policy of the whole directory.
+const aclPolicyTag = "!!ldap/acl:policy"
+
+// parseACLPolicy parses the given ACL policy document, where each key is a
+// policy subject and each value one or several `!!ldap/acl:<rule>` nodes.
+func parseACLPolicy(l *loader, node *yaml.Node) ([]common.ACLPolicyRule, error) {
+	var policy []common.ACLPolicyRule
+
+	for idx := 0; idx < len(node.Content); idx += 2 {
+		key, value := node.Content[idx], node.Content[idx+1]
+
+		if err := common.ValidateACLPolicySubject(key.Value); err != nil {
+			return nil, &ParseError{err: err, source: key}
+		}
+
+		nodes := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode && !isACLTag(value.Tag) {
+			nodes = value.Content
+		}
+
+		rule := common.ACLPolicyRule{Subject: key.Value}
+		for _, node := range nodes {
+			family, name, _ := strings.Cut(node.Tag, ":")
+			tag, exists := aclRules[name]
+			if family != "!!ldap/acl" || !exists {
+				return nil, &ParseError{
+					err:    fmt.Errorf("invalid ACL policy rule for '%s': only '!!ldap/acl:<rule>' tags are allowed", key.Value),
+					source: node,
+				}
+			}
+
+			rules, err := parseACLRules(l, node, tag.capability, tag.allowed)
+			if err != nil {
+				return nil, err
+			}
+			rule.Rules = append(rule.Rules, rules...)
+		}
+		policy = append(policy, rule)
+	}
+	return policy, nil
+}
+
+// aliasTag is the tag used to define an alias entry (RFC 4512 §2.6) referring
+// to the given DN (e.g. `cn:alice: !!ldap/alias cn=alice,ou=people,dc=org`).
+const aliasTag = "!!ldap/alias"
+
+// parseLDAPAlias parses a scalar node tagged with aliasTag into an alias entry,
+// using the `alias` and `extensibleObject` object classes.
+func parseLDAPAlias(l *loader, parent *common.Object, key, value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return &ParseError{
+			err: fmt.Errorf(
+				"invalid '%s' type: only a %s is allowed",
+				value.Tag,
+				YamlKindVerbose(yaml.ScalarNode),
+			),
+			source: value,
+		}
+	}
+
+	node := &yaml.Node{
+		Kind:   yaml.MappingNode,
+		Line:   value.Line,
+		Column: value.Column,
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "objectClass"},
+			{Kind: yaml.SequenceNode, Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "alias"},
+				{Kind: yaml.ScalarNode, Value: "extensibleObject"},
+			}},
+			{Kind: yaml.ScalarNode, Value: "aliasedObjectName"},
+			{Kind: yaml.ScalarNode, Value: value.Value, Line: value.Line, Column: value.Column},
+		},
+	}
+	return parseLDAPObject(l, parent, key, node)
+}
+
+// validateAlias checks that the given alias entry refers to exactly one valid
+// DN and has no subordinates.
+func validateAlias(alias *common.Object) error {
+	var names []string
+	for name, values := range alias.Attributes() {
+		if strings.EqualFold(name, "aliasedObjectName") {
+			names = append(names, values...)
+		}
+	}
+
+	switch {
+	case len(names) != 1:
+		return fmt.Errorf("invalid alias: exactly one 'aliasedObjectName' is required, got %d", len(names))
+	case len(alias.SubObjects) > 0:
+		return fmt.Errorf("invalid alias: an alias entry cannot have subordinates")
+	}
+
+	if _, err := ldap.ParseDN(names[0]); err != nil {
+		return fmt.Errorf("invalid alias: '%s' is not a valid DN: %w", names[0], err)
+	}
+	return nil
+}
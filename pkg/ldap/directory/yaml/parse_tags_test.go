@@ -15,7 +15,7 @@ func TestHandleCustomTags_BindPassword(t *testing.T) {
 		actual := &common.Object{}
 		expected := &common.Object{ImplObject: common.ImplObject{BindPasswords: optional.Some("alice")}}
 
-		stop, err := handleCustomTags(actual, yaml)
+		stop, err := handleCustomTags(nil, actual, yaml)
 
 		assert.NoError(t, err)
 		assert.False(t, stop)
@@ -27,7 +27,7 @@ func TestHandleCustomTags_BindPassword(t *testing.T) {
 		actual := &common.Object{ImplObject: common.ImplObject{BindPasswords: optional.Some("bob")}}
 		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid '!!ldap/bind:password' tag: only one !!ldap/bind:password per object is allowed"
 
-		_, err := handleCustomTags(actual, yaml)
+		_, err := handleCustomTags(nil, actual, yaml)
 		assert.EqualError(t, err, expectedErr)
 	})
 
@@ -36,7 +36,48 @@ func TestHandleCustomTags_BindPassword(t *testing.T) {
 		actual := &common.Object{}
 		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid '!!ldap/bind:password' type: only a scalar node (aka. primitive) is allowed"
 
-		_, err := handleCustomTags(actual, yaml)
+		_, err := handleCustomTags(nil, actual, yaml)
+		assert.EqualError(t, err, expectedErr)
+	})
+}
+
+func TestHandleCustomTags_BindTOTP(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		yaml := &yaml.Node{Tag: "!!ldap/bind:totp", Kind: yaml.ScalarNode, Value: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}
+		actual := &common.Object{}
+
+		stop, err := handleCustomTags(nil, actual, yaml)
+
+		assert.NoError(t, err)
+		assert.True(t, stop)
+		assert.NotNil(t, actual.BindTOTP)
+		assert.Empty(t, actual.Attributes())
+	})
+
+	t.Run("Invalid/AlreadySet", func(t *testing.T) {
+		yaml := &yaml.Node{Tag: "!!ldap/bind:totp", Kind: yaml.ScalarNode, Value: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}
+		actual := &common.Object{ImplObject: common.ImplObject{BindTOTP: &common.TOTP{}}}
+		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid '!!ldap/bind:totp' tag: only one !!ldap/bind:totp per object is allowed"
+
+		_, err := handleCustomTags(nil, actual, yaml)
+		assert.EqualError(t, err, expectedErr)
+	})
+
+	t.Run("Invalid/MultipleSecrets", func(t *testing.T) {
+		yaml := &yaml.Node{Tag: "!!ldap/bind:totp", Kind: yaml.SequenceNode}
+		actual := &common.Object{}
+		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid '!!ldap/bind:totp' type: only a scalar node (aka. primitive) is allowed"
+
+		_, err := handleCustomTags(nil, actual, yaml)
+		assert.EqualError(t, err, expectedErr)
+	})
+
+	t.Run("Invalid/Secret", func(t *testing.T) {
+		yaml := &yaml.Node{Tag: "!!ldap/bind:totp", Kind: yaml.ScalarNode, Value: "GEZDGNBV"}
+		actual := &common.Object{}
+		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid '!!ldap/bind:totp' tag: invalid TOTP secret: must be at least 80 bits long"
+
+		_, err := handleCustomTags(nil, actual, yaml)
 		assert.EqualError(t, err, expectedErr)
 	})
 }
@@ -46,10 +87,10 @@ func TestHandleCustomTags_ACLAllowOn(t *testing.T) {
 		yaml := &yaml.Node{Tag: "!!ldap/acl:allow-on", Kind: yaml.ScalarNode, Value: "ou=subgroup,dc=example,dc=org"}
 		actual := &common.Object{}
 		expected := &common.Object{ImplObject: common.ImplObject{
-			ACLs: common.ACLRuleSet{{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: true}},
+			ACLs: compiledACLs(common.ACLRuleSet{{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: true, Origin: "line 0, column 0"}}),
 		}}
 
-		stop, err := handleCustomTags(actual, yaml)
+		stop, err := handleCustomTags(nil, actual, yaml)
 
 		assert.NoError(t, err)
 		assert.True(t, stop)
@@ -67,13 +108,13 @@ func TestHandleCustomTags_ACLAllowOn(t *testing.T) {
 		}
 		actual := &common.Object{}
 		expected := &common.Object{ImplObject: common.ImplObject{
-			ACLs: common.ACLRuleSet{
-				{DistinguishedNameSuffix: "ou=othergroup,dc=example,dc=org", Allowed: true},
-				{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: true},
-			},
+			ACLs: compiledACLs(common.ACLRuleSet{
+				{DistinguishedNameSuffix: "ou=othergroup,dc=example,dc=org", Allowed: true, Origin: "line 0, column 0"},
+				{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: true, Origin: "line 0, column 0"},
+			}),
 		}}
 
-		stop, err := handleCustomTags(actual, yaml)
+		stop, err := handleCustomTags(nil, actual, yaml)
 
 		assert.NoError(t, err)
 		assert.True(t, stop)
@@ -86,13 +127,13 @@ func TestHandleCustomTags_ACLAllowOn(t *testing.T) {
 			Kind: yaml.SequenceNode,
 			Content: []*yaml.Node{
 				{Kind: yaml.ScalarNode, Value: "ou=subgroup,dc=example,dc=org"},
-				{Kind: yaml.MappingNode},
+				{Kind: yaml.SequenceNode},
 			},
 		}
 		actual := &common.Object{}
-		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid '!!ldap/acl:allow-on' type: only a scalar node (aka. primitive) is allowed"
+		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid '!!ldap/acl:allow-on' type: only a scalar node (aka. primitive) or a mapping node (aka. dictionary) is allowed"
 
-		_, err := handleCustomTags(actual, yaml)
+		_, err := handleCustomTags(nil, actual, yaml)
 		assert.EqualError(t, err, expectedErr)
 	})
 }
@@ -102,10 +143,10 @@ func TestHandleCustomTags_ACLDenyOn(t *testing.T) {
 		yaml := &yaml.Node{Tag: "!!ldap/acl:deny-on", Kind: yaml.ScalarNode, Value: "ou=subgroup,dc=example,dc=org"}
 		actual := &common.Object{}
 		expected := &common.Object{ImplObject: common.ImplObject{
-			ACLs: common.ACLRuleSet{{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: false}},
+			ACLs: compiledACLs(common.ACLRuleSet{{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: false, Origin: "line 0, column 0"}}),
 		}}
 
-		stop, err := handleCustomTags(actual, yaml)
+		stop, err := handleCustomTags(nil, actual, yaml)
 
 		assert.NoError(t, err)
 		assert.True(t, stop)
@@ -123,13 +164,13 @@ func TestHandleCustomTags_ACLDenyOn(t *testing.T) {
 		}
 		actual := &common.Object{}
 		expected := &common.Object{ImplObject: common.ImplObject{
-			ACLs: common.ACLRuleSet{
-				{DistinguishedNameSuffix: "ou=othergroup,dc=example,dc=org", Allowed: false},
-				{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: false},
-			},
+			ACLs: compiledACLs(common.ACLRuleSet{
+				{DistinguishedNameSuffix: "ou=othergroup,dc=example,dc=org", Allowed: false, Origin: "line 0, column 0"},
+				{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: false, Origin: "line 0, column 0"},
+			}),
 		}}
 
-		stop, err := handleCustomTags(actual, yaml)
+		stop, err := handleCustomTags(nil, actual, yaml)
 
 		assert.NoError(t, err)
 		assert.True(t, stop)
@@ -142,13 +183,357 @@ func TestHandleCustomTags_ACLDenyOn(t *testing.T) {
 			Kind: yaml.SequenceNode,
 			Content: []*yaml.Node{
 				{Kind: yaml.ScalarNode, Value: "ou=subgroup,dc=example,dc=org"},
-				{Kind: yaml.MappingNode},
+				{Kind: yaml.SequenceNode},
 			},
 		}
 		actual := &common.Object{}
-		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid '!!ldap/acl:deny-on' type: only a scalar node (aka. primitive) is allowed"
+		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid '!!ldap/acl:deny-on' type: only a scalar node (aka. primitive) or a mapping node (aka. dictionary) is allowed"
+
+		_, err := handleCustomTags(nil, actual, yaml)
+		assert.EqualError(t, err, expectedErr)
+	})
+}
+
+func TestHandleCustomTags_ACLProxyAs(t *testing.T) {
+	t.Run("Valid/SingleRule", func(t *testing.T) {
+		yaml := &yaml.Node{Tag: "!!ldap/acl:proxy-as", Kind: yaml.ScalarNode, Value: "ou=people,dc=example,dc=org"}
+		actual := &common.Object{}
+		expected := &common.Object{ImplObject: common.ImplObject{
+			ACLs: compiledACLs(common.ACLRuleSet{{DistinguishedNameSuffix: "ou=people,dc=example,dc=org", Allowed: true, Capability: common.ACLProxy, Origin: "line 0, column 0"}}),
+		}}
+
+		stop, err := handleCustomTags(nil, actual, yaml)
+
+		assert.NoError(t, err)
+		assert.True(t, stop)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("Invalid/MultipleTypeRules", func(t *testing.T) {
+		yaml := &yaml.Node{
+			Tag:  "!!ldap/acl:proxy-as",
+			Kind: yaml.SequenceNode,
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "ou=people,dc=example,dc=org"},
+				{Kind: yaml.SequenceNode},
+			},
+		}
+		actual := &common.Object{}
+		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid '!!ldap/acl:proxy-as' type: only a scalar node (aka. primitive) or a mapping node (aka. dictionary) is allowed"
+
+		_, err := handleCustomTags(nil, actual, yaml)
+		assert.EqualError(t, err, expectedErr)
+	})
+}
+
+func TestHandleCustomTags_ACLInvalidDN(t *testing.T) {
+	yaml := &yaml.Node{Tag: "!!ldap/acl:allow-on", Kind: yaml.ScalarNode, Value: "example.org"}
+	actual := &common.Object{}
+	expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid '!!ldap/acl:allow-on' tag: invalid DN 'example.org': missing '=' in 'example.org'"
+
+	_, err := handleCustomTags(nil, actual, yaml)
+	assert.EqualError(t, err, expectedErr)
+}
+
+func TestHandleCustomTags_ACLAttributeRules(t *testing.T) {
+	t.Run("Valid/ScalarRule", func(t *testing.T) {
+		yaml := &yaml.Node{Tag: "!!ldap/acl:deny-read-on", Kind: yaml.ScalarNode, Value: "dc=example,dc=org"}
+		actual := &common.Object{}
+		expected := &common.Object{ImplObject: common.ImplObject{
+			ACLs: compiledACLs(common.ACLRuleSet{{DistinguishedNameSuffix: "dc=example,dc=org", Allowed: false, Capability: common.ACLRead, Origin: "line 0, column 0"}}),
+		}}
+
+		stop, err := handleCustomTags(nil, actual, yaml)
+
+		assert.NoError(t, err)
+		assert.True(t, stop)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("Valid/MappingRules", func(t *testing.T) {
+		yaml := &yaml.Node{
+			Tag:  "!!ldap/acl:allow-filter-on",
+			Kind: yaml.SequenceNode,
+			Content: []*yaml.Node{
+				{Kind: yaml.MappingNode, Content: []*yaml.Node{
+					{Kind: yaml.ScalarNode, Value: "dn"},
+					{Kind: yaml.ScalarNode, Value: "ou=people,dc=example,dc=org"},
+					{Kind: yaml.ScalarNode, Value: "attributes"},
+					{Kind: yaml.SequenceNode, Content: []*yaml.Node{
+						{Kind: yaml.ScalarNode, Value: "mail"},
+						{Kind: yaml.ScalarNode, Value: "userPassword"},
+					}},
+				}},
+				{Kind: yaml.MappingNode, Content: []*yaml.Node{
+					{Kind: yaml.ScalarNode, Value: "dn"},
+					{Kind: yaml.ScalarNode, Value: "dc=org"},
+					{Kind: yaml.ScalarNode, Value: "attributes"},
+					{Kind: yaml.ScalarNode, Value: "cn"},
+				}},
+			},
+		}
+		actual := &common.Object{}
+		expected := &common.Object{ImplObject: common.ImplObject{
+			ACLs: compiledACLs(common.ACLRuleSet{
+				{DistinguishedNameSuffix: "ou=people,dc=example,dc=org", Allowed: true, Capability: common.ACLFilter, Attributes: []string{"mail", "userPassword"}, Origin: "line 0, column 0"},
+				{DistinguishedNameSuffix: "dc=org", Allowed: true, Capability: common.ACLFilter, Attributes: []string{"cn"}, Origin: "line 0, column 0"},
+			}),
+		}}
+
+		stop, err := handleCustomTags(nil, actual, yaml)
+
+		assert.NoError(t, err)
+		assert.True(t, stop)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("Invalid/MissingTarget", func(t *testing.T) {
+		yaml := &yaml.Node{
+			Tag:  "!!ldap/acl:allow-compare-on",
+			Kind: yaml.MappingNode,
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "attributes"},
+				{Kind: yaml.ScalarNode, Value: "cn"},
+			},
+		}
+		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid '!!ldap/acl:allow-compare-on' rule: missing 'dn', 'filter' or 'target' field"
+
+		_, err := handleCustomTags(nil, &common.Object{}, yaml)
+		assert.EqualError(t, err, expectedErr)
+	})
+
+	t.Run("Invalid/UnknownField", func(t *testing.T) {
+		yaml := &yaml.Node{
+			Tag:  "!!ldap/acl:allow-read-on",
+			Kind: yaml.MappingNode,
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "dn"},
+				{Kind: yaml.ScalarNode, Value: "dc=org"},
+				{Kind: yaml.ScalarNode, Value: "attrs"},
+				{Kind: yaml.ScalarNode, Value: "cn"},
+			},
+		}
+		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid '!!ldap/acl:allow-read-on' field 'attrs': only 'dn', 'filter', 'target' and 'attributes' are allowed"
+
+		_, err := handleCustomTags(nil, &common.Object{}, yaml)
+		assert.EqualError(t, err, expectedErr)
+	})
+
+	t.Run("Invalid/AttributesOnSearchRule", func(t *testing.T) {
+		yaml := &yaml.Node{
+			Tag:  "!!ldap/acl:allow-on",
+			Kind: yaml.MappingNode,
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "dn"},
+				{Kind: yaml.ScalarNode, Value: "dc=org"},
+				{Kind: yaml.ScalarNode, Value: "attributes"},
+				{Kind: yaml.ScalarNode, Value: "cn"},
+			},
+		}
+		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid '!!ldap/acl:allow-on' field 'attributes': only 'dn', 'filter' and 'target' are allowed"
 
-		_, err := handleCustomTags(actual, yaml)
+		_, err := handleCustomTags(nil, &common.Object{}, yaml)
 		assert.EqualError(t, err, expectedErr)
 	})
 }
+
+func TestHandleCustomTags_ACLInheritedRules(t *testing.T) {
+	t.Run("Valid/MembersACL", func(t *testing.T) {
+		yaml := &yaml.Node{Tag: "!!ldap/members-acl:allow-on", Kind: yaml.ScalarNode, Value: "dc=example,dc=org"}
+		actual := &common.Object{}
+		expected := &common.Object{ImplObject: common.ImplObject{
+			MemberACLs: compiledACLs(common.ACLRuleSet{{DistinguishedNameSuffix: "dc=example,dc=org", Allowed: true, Origin: "line 0, column 0"}}),
+		}}
+
+		stop, err := handleCustomTags(nil, actual, yaml)
+
+		assert.NoError(t, err)
+		assert.True(t, stop)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("Valid/SubtreeACL", func(t *testing.T) {
+		yaml := &yaml.Node{
+			Tag:  "!!ldap/subtree-acl:deny-on",
+			Kind: yaml.SequenceNode,
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "dc=org"},
+				{Kind: yaml.ScalarNode, Value: "ou=people,dc=org"},
+			},
+		}
+		actual := &common.Object{}
+		expected := &common.Object{ImplObject: common.ImplObject{
+			SubtreeACLs: compiledACLs(common.ACLRuleSet{
+				{DistinguishedNameSuffix: "ou=people,dc=org", Allowed: false, Origin: "line 0, column 0"},
+				{DistinguishedNameSuffix: "dc=org", Allowed: false, Origin: "line 0, column 0"},
+			}),
+		}}
+
+		stop, err := handleCustomTags(nil, actual, yaml)
+
+		assert.NoError(t, err)
+		assert.True(t, stop)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("Invalid/UnknownRule", func(t *testing.T) {
+		yaml := &yaml.Node{Tag: "!!ldap/subtree-acl:policy", Kind: yaml.ScalarNode, Value: "dc=org"}
+
+		stop, err := handleCustomTags(nil, &common.Object{}, yaml)
+
+		assert.NoError(t, err)
+		assert.False(t, stop)
+	})
+}
+
+func TestParseACLPolicy(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		node := &yaml.Node{
+			Tag:  "!!ldap/acl:policy",
+			Kind: yaml.MappingNode,
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "*"},
+				{Tag: "!!ldap/acl:allow-on", Kind: yaml.ScalarNode, Value: "dc=org"},
+				{Kind: yaml.ScalarNode, Value: "group:cn=admins,dc=org"},
+				{Kind: yaml.SequenceNode, Content: []*yaml.Node{
+					{Tag: "!!ldap/acl:proxy-as", Kind: yaml.ScalarNode, Value: "dc=org"},
+					{Tag: "!!ldap/acl:deny-on", Kind: yaml.SequenceNode, Content: []*yaml.Node{
+						{Kind: yaml.ScalarNode, Value: "cn=admins,dc=org"},
+					}},
+				}},
+			},
+		}
+		expected := []common.ACLPolicyRule{
+			{Subject: "*", Rules: compiledACLs(common.ACLRuleSet{{DistinguishedNameSuffix: "dc=org", Allowed: true, Origin: "line 0, column 0"}})},
+			{Subject: "group:cn=admins,dc=org", Rules: compiledACLs(common.ACLRuleSet{
+				{DistinguishedNameSuffix: "dc=org", Allowed: true, Capability: common.ACLProxy, Origin: "line 0, column 0"},
+				{DistinguishedNameSuffix: "cn=admins,dc=org", Allowed: false, Origin: "line 0, column 0"},
+			})},
+		}
+
+		policy, err := parseACLPolicy(nil, node)
+
+		assert.NoError(t, err)
+		assert.Equal(t, expected, policy)
+	})
+
+	t.Run("Invalid/Subject", func(t *testing.T) {
+		node := &yaml.Node{
+			Tag:  "!!ldap/acl:policy",
+			Kind: yaml.MappingNode,
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "group:admins"},
+				{Tag: "!!ldap/acl:allow-on", Kind: yaml.ScalarNode, Value: "dc=org"},
+			},
+		}
+		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid ACL policy subject 'group:admins': invalid DN 'admins': missing '=' in 'admins'"
+
+		_, err := parseACLPolicy(nil, node)
+		assert.EqualError(t, err, expectedErr)
+	})
+
+	t.Run("Invalid/NotAnACL", func(t *testing.T) {
+		node := &yaml.Node{
+			Tag:  "!!ldap/acl:policy",
+			Kind: yaml.MappingNode,
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "*"},
+				{Tag: "!!ldap/members-acl:allow-on", Kind: yaml.ScalarNode, Value: "dc=org"},
+			},
+		}
+		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid ACL policy rule for '*': only '!!ldap/acl:<rule>' tags are allowed"
+
+		_, err := parseACLPolicy(nil, node)
+		assert.EqualError(t, err, expectedErr)
+	})
+}
+
+func TestHandleCustomTags_ACLTargets(t *testing.T) {
+	t.Run("Valid/ScalarTargets", func(t *testing.T) {
+		yaml := &yaml.Node{
+			Tag:  "!!ldap/acl:allow-read-on",
+			Kind: yaml.SequenceNode,
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "self"},
+				{Kind: yaml.ScalarNode, Value: "member-of"},
+				{Kind: yaml.ScalarNode, Value: "(objectClass=posixGroup)"},
+			},
+		}
+		actual := &common.Object{}
+		expected := &common.Object{ImplObject: common.ImplObject{
+			ACLs: compiledACLs(common.ACLRuleSet{
+				{Allowed: true, Capability: common.ACLRead, Relation: common.ACLRelationSelf, Origin: "line 0, column 0"},
+				{Allowed: true, Capability: common.ACLRead, Relation: common.ACLRelationMemberOf, Origin: "line 0, column 0"},
+				{Allowed: true, Capability: common.ACLRead, Filter: "(objectClass=posixGroup)", Origin: "line 0, column 0"},
+			}),
+		}}
+
+		stop, err := handleCustomTags(nil, actual, yaml)
+
+		assert.NoError(t, err)
+		assert.True(t, stop)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("Valid/MappingTarget", func(t *testing.T) {
+		yaml := &yaml.Node{
+			Tag:  "!!ldap/acl:allow-on",
+			Kind: yaml.MappingNode,
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "dn"},
+				{Kind: yaml.ScalarNode, Value: "ou=group,dc=org"},
+				{Kind: yaml.ScalarNode, Value: "filter"},
+				{Kind: yaml.ScalarNode, Value: "(objectClass=posixGroup)"},
+				{Kind: yaml.ScalarNode, Value: "target"},
+				{Kind: yaml.ScalarNode, Value: "member-of"},
+			},
+		}
+		actual := &common.Object{}
+		expected := &common.Object{ImplObject: common.ImplObject{
+			ACLs: compiledACLs(common.ACLRuleSet{{
+				DistinguishedNameSuffix: "ou=group,dc=org",
+				Allowed:                 true,
+				Filter:                  "(objectClass=posixGroup)",
+				Relation:                common.ACLRelationMemberOf,
+				Origin:                  "line 0, column 0",
+			}}),
+		}}
+
+		stop, err := handleCustomTags(nil, actual, yaml)
+
+		assert.NoError(t, err)
+		assert.True(t, stop)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("Invalid/Filter", func(t *testing.T) {
+		yaml := &yaml.Node{Tag: "!!ldap/acl:allow-on", Kind: yaml.ScalarNode, Value: "(objectClass=posixGroup"}
+
+		_, err := handleCustomTags(nil, &common.Object{}, yaml)
+		assert.ErrorContains(t, err, "invalid '!!ldap/acl:allow-on' tag: invalid filter '(objectClass=posixGroup':")
+	})
+
+	t.Run("Invalid/Target", func(t *testing.T) {
+		yaml := &yaml.Node{
+			Tag:  "!!ldap/acl:allow-on",
+			Kind: yaml.MappingNode,
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "target"},
+				{Kind: yaml.ScalarNode, Value: "owner"},
+			},
+		}
+		expectedErr := "invalid LDAP YAML document at line 0, column 0: invalid '!!ldap/acl:allow-on' target 'owner': only 'self' and 'member-of' are allowed"
+
+		_, err := handleCustomTags(nil, &common.Object{}, yaml)
+		assert.EqualError(t, err, expectedErr)
+	})
+}
+
+// compiledACLs returns the given rules as they are returned by the parser,
+// with their DN suffix and filter compiled.
+func compiledACLs(rules common.ACLRuleSet) common.ACLRuleSet {
+	for i := range rules {
+		_ = rules[i].Compile()
+	}
+	return rules
+}
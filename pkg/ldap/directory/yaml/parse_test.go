@@ -27,7 +27,7 @@ func TestParseLDAPObject_Basic(t *testing.T) {
 	require.NoError(t, err)
 
 	obj := &common.Object{ImplObject: common.ImplObject{SubObjects: map[string]*common.Object{}}}
-	err = parseLDAPObject(obj, &yaml.Node{Value: "go:test"}, node.Content[0])
+	err = parseLDAPObject(nil, obj, &yaml.Node{Value: "go:test"}, node.Content[0])
 	assert.NoError(t, err)
 	assert.Equal(t, expect, obj.SubObjects["go:test"].SubObjects)
 }
@@ -67,7 +67,7 @@ ou:people:
 	require.NoError(t, err)
 
 	obj := &common.Object{ImplObject: common.ImplObject{SubObjects: map[string]*common.Object{}}}
-	err = parseLDAPObject(obj, &yaml.Node{Value: "go:test"}, node.Content[0])
+	err = parseLDAPObject(nil, obj, &yaml.Node{Value: "go:test"}, node.Content[0])
 	assert.NoError(t, err)
 	assert.Equal(t, expect, obj.SubObjects["go:test"].SubObjects)
 }
@@ -118,7 +118,7 @@ ou:people:
 	require.NoError(t, err)
 
 	obj := &common.Object{ImplObject: common.ImplObject{SubObjects: map[string]*common.Object{}}}
-	err = parseLDAPObject(obj, &yaml.Node{Value: "go:test"}, node.Content[0])
+	err = parseLDAPObject(nil, obj, &yaml.Node{Value: "go:test"}, node.Content[0])
 	assert.NoError(t, err)
 	assert.Equal(t, expect, obj.SubObjects["go:test"].SubObjects)
 }
@@ -175,7 +175,35 @@ ou:people:
 	require.NoError(t, err)
 
 	obj := &common.Object{ImplObject: common.ImplObject{SubObjects: map[string]*common.Object{}}}
-	err = parseLDAPObject(obj, &yaml.Node{Value: "go:test"}, node.Content[0])
+	err = parseLDAPObject(nil, obj, &yaml.Node{Value: "go:test"}, node.Content[0])
+	assert.NoError(t, err)
+	assert.Equal(t, expect, obj.SubObjects["go:test"].SubObjects)
+}
+
+func TestParseLDAPObject_WithAttributeACL(t *testing.T) {
+	raw := `
+uid:alice:
+  .read-acl: !!ldap/acl:deny-read-on {dn: "dc=org", attributes: [mail]}
+`
+	expect := map[string]*common.Object{
+		"uid:alice": {
+			ImplObject: common.ImplObject{
+				DN:         "uid=alice,go=test",
+				Attributes: ldap.Attributes{"uid": []string{"alice"}},
+				SubObjects: map[string]*common.Object{},
+				ACLs: compiledACLs(common.ACLRuleSet{
+					{DistinguishedNameSuffix: "dc=org", Allowed: false, Capability: common.ACLRead, Attributes: []string{"mail"}, Origin: "line 3, column 14"},
+				}),
+			},
+		},
+	}
+
+	var node yaml.Node
+	err := yaml.Unmarshal([]byte(raw), &node)
+	require.NoError(t, err)
+
+	obj := &common.Object{ImplObject: common.ImplObject{SubObjects: map[string]*common.Object{}}}
+	err = parseLDAPObject(nil, obj, &yaml.Node{Value: "go:test"}, node.Content[0])
 	assert.NoError(t, err)
 	assert.Equal(t, expect, obj.SubObjects["go:test"].SubObjects)
 }
@@ -189,7 +217,59 @@ func TestParseLDAPObject_WithInvalidKey(t *testing.T) {
 	require.NoError(t, err)
 
 	obj := &common.Object{ImplObject: common.ImplObject{SubObjects: map[string]*common.Object{}}}
-	err = parseLDAPObject(obj, &yaml.Node{Value: "go:test"}, node.Content[0])
+	err = parseLDAPObject(nil, obj, &yaml.Node{Value: "go:test"}, node.Content[0])
+	assert.EqualError(t, err, expectErr)
+}
+
+func TestParseLDAPObject_WithEscapedKey(t *testing.T) {
+	raw := "cn:Doe, John: {}"
+	expect := map[string]*common.Object{
+		"cn:Doe, John": {
+			ImplObject: common.ImplObject{
+				DN:         `cn=Doe\, John,go=test`,
+				Attributes: ldap.Attributes{"cn": []string{"Doe, John"}},
+				SubObjects: map[string]*common.Object{},
+			},
+		},
+	}
+
+	var node yaml.Node
+	err := yaml.Unmarshal([]byte(raw), &node)
+	require.NoError(t, err)
+
+	obj := &common.Object{ImplObject: common.ImplObject{SubObjects: map[string]*common.Object{}}}
+	err = parseLDAPObject(nil, obj, &yaml.Node{Value: "go:test"}, node.Content[0])
+	assert.NoError(t, err)
+	assert.Equal(t, expect, obj.SubObjects["go:test"].SubObjects)
+}
+
+func TestParseLDAPObject_WithInvalidRDN(t *testing.T) {
+	raw := "c n:alice: {}"
+	expectErr := "invalid LDAP YAML document at line 1, column 1: invalid key: 'c n:alice' is not a valid RDN: invalid DN 'c n=alice': invalid attribute type 'c n'"
+
+	var node yaml.Node
+	err := yaml.Unmarshal([]byte(raw), &node)
+	require.NoError(t, err)
+
+	obj := &common.Object{ImplObject: common.ImplObject{SubObjects: map[string]*common.Object{}}}
+	err = parseLDAPObject(nil, obj, &yaml.Node{Value: "go:test"}, node.Content[0])
+	assert.EqualError(t, err, expectErr)
+}
+
+func TestParseLDAPObject_WithDupplicateRDN(t *testing.T) {
+	raw := `
+ou:people:
+  uid:alice: {}
+  UID:Alice: {}
+`
+	expectErr := "invalid LDAP YAML document at line 4, column 3: invalid key: 'UID:Alice' is already defined (same RDN as 'uid:alice')"
+
+	var node yaml.Node
+	err := yaml.Unmarshal([]byte(raw), &node)
+	require.NoError(t, err)
+
+	obj := &common.Object{ImplObject: common.ImplObject{SubObjects: map[string]*common.Object{}}}
+	err = parseLDAPObject(nil, obj, &yaml.Node{Value: "go:test"}, node.Content[0])
 	assert.EqualError(t, err, expectErr)
 }
 
@@ -207,7 +287,7 @@ ou:people:
 	require.NoError(t, err)
 
 	obj := &common.Object{ImplObject: common.ImplObject{SubObjects: map[string]*common.Object{}}}
-	err = parseLDAPObject(obj, &yaml.Node{Value: "go:test"}, node.Content[0])
+	err = parseLDAPObject(nil, obj, &yaml.Node{Value: "go:test"}, node.Content[0])
 	assert.EqualError(t, err, expectErr)
 }
 
@@ -225,7 +305,7 @@ func TestParseLDAPAttribute_Basic(t *testing.T) {
 	require.NoError(t, err)
 
 	obj := &common.Object{}
-	err = parseLDAPAttribute(obj, node.Content[0].Content[0], node.Content[0].Content[1])
+	err = parseLDAPAttribute(nil, obj, node.Content[0].Content[0], node.Content[0].Content[1])
 	assert.NoError(t, err)
 	assert.Equal(t, expect, obj)
 }
@@ -243,7 +323,7 @@ func TestParseLDAPAttribute_WithNullValue(t *testing.T) {
 	require.NoError(t, err)
 
 	obj := &common.Object{}
-	err = parseLDAPAttribute(obj, node.Content[0].Content[0], node.Content[0].Content[1])
+	err = parseLDAPAttribute(nil, obj, node.Content[0].Content[0], node.Content[0].Content[1])
 	assert.NoError(t, err)
 	assert.Equal(t, expect, obj)
 }
@@ -257,6 +337,7 @@ func TestParseLDAPAttribute_WithBindPassword(t *testing.T) {
 			Attributes: ldap.Attributes{
 				"password": []string{"alice"},
 			},
+			SecretAttributes: []string{"password"},
 		},
 	}
 
@@ -265,7 +346,7 @@ func TestParseLDAPAttribute_WithBindPassword(t *testing.T) {
 	require.NoError(t, err)
 
 	obj := &common.Object{}
-	err = parseLDAPAttribute(obj, node.Content[0].Content[0], node.Content[0].Content[1])
+	err = parseLDAPAttribute(nil, obj, node.Content[0].Content[0], node.Content[0].Content[1])
 	assert.NoError(t, err)
 	assert.Equal(t, expect, obj)
 }
@@ -275,9 +356,9 @@ func TestParseLDAPAttribute_WithAllowedOn(t *testing.T) {
 	expect := &common.Object{
 		ImplObject: common.ImplObject{
 			DN: "",
-			ACLs: common.ACLRuleSet{
-				{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: true},
-			},
+			ACLs: compiledACLs(common.ACLRuleSet{
+				{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: true, Origin: "line 1, column 12"},
+			}),
 		},
 	}
 
@@ -286,7 +367,7 @@ func TestParseLDAPAttribute_WithAllowedOn(t *testing.T) {
 	require.NoError(t, err)
 
 	obj := &common.Object{}
-	err = parseLDAPAttribute(obj, node.Content[0].Content[0], node.Content[0].Content[1])
+	err = parseLDAPAttribute(nil, obj, node.Content[0].Content[0], node.Content[0].Content[1])
 	assert.NoError(t, err)
 	assert.Equal(t, expect, obj)
 }
@@ -296,10 +377,10 @@ func TestParseLDAPAttribute_WithMultipleAllowedOn(t *testing.T) {
 	expect := &common.Object{
 		ImplObject: common.ImplObject{
 			DN: "",
-			ACLs: common.ACLRuleSet{
-				{DistinguishedNameSuffix: "ou=othergroup,dc=example,dc=org", Allowed: true},
-				{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: true},
-			},
+			ACLs: compiledACLs(common.ACLRuleSet{
+				{DistinguishedNameSuffix: "ou=othergroup,dc=example,dc=org", Allowed: true, Origin: "line 1, column 85"},
+				{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: true, Origin: "line 1, column 52"},
+			}),
 		},
 	}
 
@@ -308,7 +389,7 @@ func TestParseLDAPAttribute_WithMultipleAllowedOn(t *testing.T) {
 	require.NoError(t, err)
 
 	obj := &common.Object{}
-	err = parseLDAPAttribute(obj, node.Content[0].Content[0], node.Content[0].Content[1])
+	err = parseLDAPAttribute(nil, obj, node.Content[0].Content[0], node.Content[0].Content[1])
 	assert.NoError(t, err)
 	assert.Equal(t, expect, obj)
 }
@@ -318,9 +399,9 @@ func TestParseLDAPAttribute_WithDeniedOn(t *testing.T) {
 	expect := &common.Object{
 		ImplObject: common.ImplObject{
 			DN: "",
-			ACLs: common.ACLRuleSet{
-				{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: false},
-			},
+			ACLs: compiledACLs(common.ACLRuleSet{
+				{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: false, Origin: "line 1, column 11"},
+			}),
 		},
 	}
 
@@ -329,7 +410,7 @@ func TestParseLDAPAttribute_WithDeniedOn(t *testing.T) {
 	require.NoError(t, err)
 
 	obj := &common.Object{}
-	err = parseLDAPAttribute(obj, node.Content[0].Content[0], node.Content[0].Content[1])
+	err = parseLDAPAttribute(nil, obj, node.Content[0].Content[0], node.Content[0].Content[1])
 	assert.NoError(t, err)
 	assert.Equal(t, expect, obj)
 }
@@ -339,10 +420,10 @@ func TestParseLDAPAttribute_WithMultipleDeniedOn(t *testing.T) {
 	expect := &common.Object{
 		ImplObject: common.ImplObject{
 			DN: "",
-			ACLs: common.ACLRuleSet{
-				{DistinguishedNameSuffix: "ou=othergroup,dc=example,dc=org", Allowed: false},
-				{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: false},
-			},
+			ACLs: compiledACLs(common.ACLRuleSet{
+				{DistinguishedNameSuffix: "ou=othergroup,dc=example,dc=org", Allowed: false, Origin: "line 1, column 83"},
+				{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: false, Origin: "line 1, column 50"},
+			}),
 		},
 	}
 
@@ -351,7 +432,7 @@ func TestParseLDAPAttribute_WithMultipleDeniedOn(t *testing.T) {
 	require.NoError(t, err)
 
 	obj := &common.Object{}
-	err = parseLDAPAttribute(obj, node.Content[0].Content[0], node.Content[0].Content[1])
+	err = parseLDAPAttribute(nil, obj, node.Content[0].Content[0], node.Content[0].Content[1])
 	assert.NoError(t, err)
 	assert.Equal(t, expect, obj)
 }
@@ -367,14 +448,15 @@ authz:
 	expect := &common.Object{
 		ImplObject: common.ImplObject{
 			DN: "",
-			ACLs: common.ACLRuleSet{
-				{DistinguishedNameSuffix: "ou=othergroup,dc=example,dc=org", Allowed: false},
-				{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: true},
-			},
+			ACLs: compiledACLs(common.ACLRuleSet{
+				{DistinguishedNameSuffix: "ou=othergroup,dc=example,dc=org", Allowed: false, Origin: "line 5, column 5"},
+				{DistinguishedNameSuffix: "ou=subgroup,dc=example,dc=org", Allowed: true, Origin: "line 4, column 5"},
+			}),
 			Attributes: ldap.Attributes{
 				"authz": []string{"alice", "other value"},
 			},
-			BindPasswords: []string{"alice"},
+			BindPasswords:    []string{"alice"},
+			SecretAttributes: []string{"authz"},
 		},
 	}
 
@@ -383,7 +465,7 @@ authz:
 	require.NoError(t, err)
 
 	obj := &common.Object{}
-	err = parseLDAPAttribute(obj, node.Content[0].Content[0], node.Content[0].Content[1])
+	err = parseLDAPAttribute(nil, obj, node.Content[0].Content[0], node.Content[0].Content[1])
 	assert.NoError(t, err)
 	assert.Equal(t, expect, obj)
 }
@@ -401,7 +483,7 @@ invalid:
 	require.NoError(t, err)
 
 	obj := &common.Object{}
-	err = parseLDAPAttribute(obj, node.Content[0].Content[0], node.Content[0].Content[1])
+	err = parseLDAPAttribute(nil, obj, node.Content[0].Content[0], node.Content[0].Content[1])
 	assert.EqualError(t, err, expectErr)
 }
 
@@ -416,12 +498,84 @@ func TestParseLDAPAttribute_WithDupplicateAttribute(t *testing.T) {
 	require.NoError(t, err)
 
 	obj := &common.Object{}
-	err = parseLDAPAttribute(obj, node.Content[0].Content[0], node.Content[0].Content[1])
+	err = parseLDAPAttribute(nil, obj, node.Content[0].Content[0], node.Content[0].Content[1])
 	require.NoError(t, err)
 
 	err = yaml.Unmarshal([]byte(rawAttr2), &node)
 	require.NoError(t, err)
 
-	err = parseLDAPAttribute(obj, node.Content[0].Content[0], node.Content[0].Content[1])
+	err = parseLDAPAttribute(nil, obj, node.Content[0].Content[0], node.Content[0].Content[1])
 	require.EqualError(t, err, expectErr)
 }
+
+func TestParseLDAPObject_WithInvalidAlias(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		expectErr string
+	}{
+		{
+			name:      "MissingAliasedObjectName",
+			raw:       "cn:alias: {objectClass: alias}",
+			expectErr: "invalid LDAP YAML document at line 1, column 11: invalid alias: exactly one 'aliasedObjectName' is required, got 0",
+		},
+		{
+			name:      "InvalidAliasedObjectName",
+			raw:       "cn:alias: !!ldap/alias alice",
+			expectErr: "invalid LDAP YAML document at line 1, column 11: invalid alias: 'alice' is not a valid DN: invalid DN 'alice': missing '=' in 'alice'",
+		},
+		{
+			name:      "WithSubordinates",
+			raw:       "cn:alias: {objectClass: alias, aliasedObjectName: cn=alice, cn:bob: {}}",
+			expectErr: "invalid LDAP YAML document at line 1, column 11: invalid alias: an alias entry cannot have subordinates",
+		},
+		{
+			name:      "NotAScalar",
+			raw:       "cn:alias: !!ldap/alias [cn=alice]",
+			expectErr: "invalid LDAP YAML document at line 1, column 11: invalid '!!ldap/alias' type: only a scalar node (aka. primitive) is allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var node yaml.Node
+			err := yaml.Unmarshal([]byte(tt.raw), &node)
+			require.NoError(t, err)
+
+			obj := &common.Object{ImplObject: common.ImplObject{SubObjects: map[string]*common.Object{}}}
+			err = parseLDAPObject(nil, obj, &yaml.Node{Value: "go:test"}, node.Content[0])
+			assert.EqualError(t, err, tt.expectErr)
+		})
+	}
+}
+
+func TestParseLDAPObject_WithInvalidReferral(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		expectErr string
+	}{
+		{
+			name:      "MissingRef",
+			raw:       "cn:referral: {objectClass: referral}",
+			expectErr: "invalid LDAP YAML document at line 1, column 14: invalid referral: at least one 'ref' is required",
+		},
+		{
+			name:      "InvalidRef",
+			raw:       "cn:referral: {objectClass: referral, ref: [ldap://ldap.example.org, https://example.org]}",
+			expectErr: "invalid LDAP YAML document at line 1, column 14: invalid referral: invalid LDAP URL 'https://example.org': unsupported scheme 'https'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var node yaml.Node
+			err := yaml.Unmarshal([]byte(tt.raw), &node)
+			require.NoError(t, err)
+
+			obj := &common.Object{ImplObject: common.ImplObject{SubObjects: map[string]*common.Object{}}}
+			err = parseLDAPObject(nil, obj, &yaml.Node{Value: "go:test"}, node.Content[0])
+			assert.EqualError(t, err, tt.expectErr)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package yamldir
+
+import (
+	"fmt"
+
+	"github.com/chezmoi-sh/yaldap/pkg/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// encryptedTag is the tag of the values encrypted with age (see `yaldap tools
+// secrets encrypt`), decrypted when the directory is loaded. The encrypted
+// value is itself a YAML value, so it can carry its own tag (e.g.
+// `!!ldap/bind:password alice`).
+const encryptedTag = "!!ldap/encrypted"
+
+// WithDecryptionKeys gives the keys used to decrypt the files encrypted by
+// SOPS and the `!!ldap/encrypted` values.
+func WithDecryptionKeys(keys *secrets.Keys) Option {
+	return func(directory *directory) { directory.keys = keys }
+}
+
+// decrypt decrypts the given documents, decoded from the given definition, if
+// they have been encrypted by SOPS, then all their `!!ldap/encrypted` values.
+func (l *loader) decrypt(raw []byte, roots []*yaml.Node) ([]*yaml.Node, error) {
+	if secrets.IsSOPS(roots) {
+		plaintext, err := secrets.DecryptSOPS(raw, l.keys)
+		if err != nil {
+			return nil, err
+		}
+		if roots, err = decodeDocuments(plaintext); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, root := range roots {
+		if err := decryptValues(root, l.keys); err != nil {
+			return nil, err
+		}
+	}
+	return roots, nil
+}
+
+// decryptValues replaces, in place, all `!!ldap/encrypted` values of the
+// given node by their decrypted value.
+func decryptValues(node *yaml.Node, keys *secrets.Keys) error {
+	if node.Tag != encryptedTag {
+		for _, child := range node.Content {
+			if err := decryptValues(child, keys); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if node.Kind != yaml.ScalarNode {
+		return &ParseError{
+			err:    fmt.Errorf("invalid '%s' type: only a %s is allowed", encryptedTag, YamlKindVerbose(yaml.ScalarNode)),
+			source: node,
+		}
+	}
+
+	plaintext, err := secrets.DecryptValue(node.Value, keys)
+	if err != nil {
+		return &ParseError{err: fmt.Errorf("invalid '%s' tag: %w", encryptedTag, err), source: node}
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(plaintext, &document); err != nil {
+		return &ParseError{err: fmt.Errorf("invalid '%s' tag: invalid decrypted value: %w", encryptedTag, err), source: node}
+	}
+	if len(document.Content) != 1 {
+		return &ParseError{err: fmt.Errorf("invalid '%s' tag: the decrypted value is empty", encryptedTag), source: node}
+	}
+
+	// NOTE: the node is replaced in place, so YAML aliases referencing it
+	//       also get the decrypted value, and errors are reported at the
+	//       position of the encrypted value.
+	value := document.Content[0]
+	relocate(value, node.Line, node.Column)
+	value.Anchor = node.Anchor
+	*node = *value
+	return decryptValues(node, keys)
+}
+
+// relocate moves the given node and all its children to the given position.
+func relocate(node *yaml.Node, line, column int) {
+	node.Line, node.Column = line, column
+	for _, child := range node.Content {
+		relocate(child, line, column)
+	}
+}
+
+// RotateSecrets encrypts again, in place, all `!!ldap/encrypted` values of
+// the given YAML documents for the given recipients, decrypting them using
+// the given keys. It returns the number of re-encrypted values. Files
+// encrypted by SOPS must be rotated using secrets.RotateSOPS.
+func RotateSecrets(roots []*yaml.Node, keys *secrets.Keys, recipients ...*secrets.Recipient) (int, error) {
+	count := 0
+
+	var rotate func(node *yaml.Node) error
+	rotate = func(node *yaml.Node) error {
+		if node.Tag != encryptedTag || node.Kind != yaml.ScalarNode {
+			for _, child := range node.Content {
+				if err := rotate(child); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		plaintext, err := secrets.DecryptValue(node.Value, keys)
+		if err != nil {
+			return fmt.Errorf("unable to decrypt the value at line %d, column %d: %w", node.Line, node.Column, err)
+		}
+		if node.Value, err = secrets.EncryptValue(plaintext, recipients...); err != nil {
+			return err
+		}
+		count++
+		return nil
+	}
+
+	for _, root := range roots {
+		if err := rotate(root); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
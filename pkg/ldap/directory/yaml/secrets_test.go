@@ -0,0 +1,172 @@
+package yamldir
+
+import (
+	"testing"
+
+	"github.com/chezmoi-sh/yaldap/pkg/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// fixtureKeys returns the keys used to encrypt the fixtures.
+func fixtureKeys(t *testing.T) *secrets.Keys {
+	keys, err := secrets.LoadKeys("fixtures/secrets/age.key")
+	require.NoError(t, err)
+	return keys
+}
+
+func TestNewDirectory_SOPS(t *testing.T) {
+	directory, err := NewDirectory("fixtures/secrets/sops.yaml", WithDecryptionKeys(fixtureKeys(t)))
+	require.NoError(t, err)
+
+	obj := directory.BaseDN("cn=alice,dc=org")
+	require.NotNil(t, obj)
+	assert.Equal(t, []string{"posixAccount"}, obj.Attributes()["objectClass"])
+	assert.Equal(t, []string{"1000"}, obj.Attributes()["uidNumber"])
+	assert.Equal(t, []string{"alice"}, obj.Attributes()["userPassword"])
+	assert.Equal(t, []string{"Alice"}, obj.Attributes()["description_unencrypted"])
+	assert.Nil(t, directory.BaseDN("cn=sops"))
+
+	t.Run("PGPKey", func(t *testing.T) {
+		keys, err := secrets.LoadKeys("fixtures/secrets/pgp.key")
+		require.NoError(t, err)
+
+		directory, err := NewDirectory("fixtures/secrets/sops.pgp.yaml", WithDecryptionKeys(keys))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"alice"}, directory.BaseDN("cn=alice,dc=org").Attributes()["userPassword"])
+	})
+
+	t.Run("KeyGroups", func(t *testing.T) {
+		keys, err := secrets.LoadKeys("fixtures/secrets/age.key", "fixtures/secrets/pgp.key")
+		require.NoError(t, err)
+
+		directory, err := NewDirectory("fixtures/secrets/sops.key-groups.yaml", WithDecryptionKeys(keys))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"alice"}, directory.BaseDN("cn=alice,dc=org").Attributes()["userPassword"])
+
+		_, err = NewDirectory("fixtures/secrets/sops.key-groups.yaml", WithDecryptionKeys(fixtureKeys(t)))
+		assert.EqualError(t, err, "invalid LDAP YAML document: unable to decrypt SOPS data key: Error getting data key: 2 successful groups required, got 1")
+	})
+
+	t.Run("NoKey", func(t *testing.T) {
+		_, err := NewDirectory("fixtures/secrets/sops.yaml")
+		assert.EqualError(t, err, "invalid LDAP YAML document: unable to decrypt SOPS data key: Error getting data key: 0 successful groups required, got 0")
+	})
+}
+
+func TestNewDirectory_Encrypted(t *testing.T) {
+	directory, err := NewDirectory("fixtures/secrets/encrypted.yaml", WithDecryptionKeys(fixtureKeys(t)))
+	require.NoError(t, err)
+
+	alice := directory.BaseDN("cn=alice,dc=org")
+	require.NotNil(t, alice)
+	valid, err := alice.Bind("alice")
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	bob := directory.BaseDN("cn=bob,dc=org")
+	require.NotNil(t, bob)
+	assert.Equal(t, []string{"JBSWY3DPEHPK3PXP"}, bob.Attributes()["description"])
+}
+
+func TestNewDirectoryFromYAML_Encrypted(t *testing.T) {
+	keys := fixtureKeys(t)
+	encrypt := func(value string) string {
+		encrypted, err := secrets.EncryptValue([]byte(value), keys.Identities[0].Recipient())
+		require.NoError(t, err)
+		return encrypted
+	}
+
+	t.Run("Alias", func(t *testing.T) {
+		directory, err := NewDirectoryFromYAML(
+			[]byte("dc:org:\n  description: &desc !!ldap/encrypted "+encrypt("[Organization, Example]")+"\n  cn:alice:\n    description: *desc\n"),
+			WithDecryptionKeys(keys),
+		)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"Organization", "Example"}, directory.BaseDN("dc=org").Attributes()["description"])
+		assert.Equal(t, []string{"Organization", "Example"}, directory.BaseDN("cn=alice,dc=org").Attributes()["description"])
+	})
+
+	other, err := secrets.GenerateIdentity()
+	require.NoError(t, err)
+
+	tests := []struct {
+		Name          string
+		YAML          string
+		Keys          *secrets.Keys
+		ExpectedError string
+	}{
+		{
+			Name:          "NoKey",
+			YAML:          "dc:org:\n  description: !!ldap/encrypted " + encrypt("alice") + "\n",
+			ExpectedError: "invalid LDAP YAML document at line 2, column 16: invalid '!!ldap/encrypted' tag: no age identity available",
+		},
+		{
+			Name:          "WrongKey",
+			YAML:          "dc:org:\n  description: !!ldap/encrypted " + encrypt("alice") + "\n",
+			Keys:          &secrets.Keys{Identities: []*secrets.Identity{other}},
+			ExpectedError: "invalid LDAP YAML document at line 2, column 16: invalid '!!ldap/encrypted' tag: no age identity matches any of the recipients",
+		},
+		{
+			Name:          "NotScalar",
+			YAML:          "dc:org:\n  description: !!ldap/encrypted [a, b]\n",
+			Keys:          keys,
+			ExpectedError: "invalid LDAP YAML document at line 2, column 16: invalid '!!ldap/encrypted' type: only a scalar node (aka. primitive) is allowed",
+		},
+		{
+			Name:          "InvalidDecryptedValue",
+			YAML:          "dc:org:\n  description: !!ldap/encrypted " + encrypt("[a, b") + "\n",
+			Keys:          keys,
+			ExpectedError: "invalid LDAP YAML document at line 2, column 16: invalid '!!ldap/encrypted' tag: invalid decrypted value: yaml: line 1: did not find expected ',' or ']'",
+		},
+		{
+			Name:          "EmptyDecryptedValue",
+			YAML:          "dc:org:\n  description: !!ldap/encrypted " + encrypt("") + "\n",
+			Keys:          keys,
+			ExpectedError: "invalid LDAP YAML document at line 2, column 16: invalid '!!ldap/encrypted' tag: the decrypted value is empty",
+		},
+		{
+			Name:          "InvalidDecryptedObject",
+			YAML:          "dc:org:\n  cn:alice: !!ldap/encrypted " + encrypt("{cn:a:b: {}}") + "\n",
+			Keys:          keys,
+			ExpectedError: "invalid LDAP YAML document at line 2, column 13: invalid key: 'cn:a:b' must be in the form '<type>:<name>' (e.g. 'ou:users')",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := NewDirectoryFromYAML([]byte(tt.YAML), WithDecryptionKeys(tt.Keys))
+			assert.EqualError(t, err, tt.ExpectedError)
+		})
+	}
+}
+
+func TestRotateSecrets(t *testing.T) {
+	keys := fixtureKeys(t)
+	rotated, err := secrets.GenerateIdentity()
+	require.NoError(t, err)
+
+	directory, err := NewDirectory("fixtures/secrets/encrypted.yaml", WithDecryptionKeys(keys))
+	require.NoError(t, err)
+
+	raw, err := readFile("fixtures/secrets/encrypted.yaml")
+	require.NoError(t, err)
+	var document yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(raw), &document))
+
+	count, err := RotateSecrets(document.Content, keys, rotated.Recipient())
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	out, err := yaml.Marshal(&document)
+	require.NoError(t, err)
+
+	_, err = NewDirectoryFromYAML(out, WithDecryptionKeys(keys))
+	assert.Error(t, err)
+
+	rotatedDirectory, err := NewDirectoryFromYAML(out, WithDecryptionKeys(&secrets.Keys{Identities: []*secrets.Identity{rotated}}))
+	require.NoError(t, err)
+	assert.Equal(t, directory.BaseDN("cn=alice,dc=org"), rotatedDirectory.BaseDN("cn=alice,dc=org"))
+}
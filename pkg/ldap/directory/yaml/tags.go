@@ -0,0 +1,223 @@
+package yamldir
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	"gopkg.in/yaml.v3"
+)
+
+// ParseTaggedValue decodes the given YAML value, tagged with a bind tag
+// (`!!ldap/bind:password` or `!!ldap/bind:totp`) or an ACL tag (e.g.
+// `!!ldap/acl:allow-on dc=org`), and applies it on the given object like if
+// it was defined inside its YAML definition. The bind password can also be
+// given with the attribute holding it (e.g. `{password: !!ldap/bind:password
+// alice}`). The line and the column of the value inside its own file are used
+// as origin of the ACL rules.
+// It is used by other formats to carry what only the YAML format describes.
+func ParseTaggedValue(obj *common.Object, raw string, line, column int) error {
+	node, err := decodeTaggedValue(raw, line, column)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case node.Kind == yaml.MappingNode && len(node.Content) == 2 && node.Content[1].Tag == "!!ldap/bind:password":
+		return unwrapParseError(parseLDAPAttribute(nil, obj, node.Content[0], node.Content[1]))
+	case node.Tag == "!!ldap/bind:password", node.Tag == "!!ldap/bind:totp", isACLTag(node.Tag):
+		_, err = handleCustomTags(nil, obj, node)
+		return unwrapParseError(err)
+	default:
+		return fmt.Errorf("unsupported tag '%s': only bind and ACL tags are allowed", node.Tag)
+	}
+}
+
+// ParseACLPolicyValue decodes the given YAML value, tagged with
+// `!!ldap/acl:policy`, into ACL policy rules (e.g. `!!ldap/acl:policy {"*":
+// !!ldap/acl:allow-on dc=org}`).
+func ParseACLPolicyValue(raw string, line, column int) ([]common.ACLPolicyRule, error) {
+	node, err := decodeTaggedValue(raw, line, column)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case node.Tag != aclPolicyTag:
+		return nil, fmt.Errorf("unsupported tag '%s': only '%s' is allowed", node.Tag, aclPolicyTag)
+	case node.Kind != yaml.MappingNode:
+		return nil, fmt.Errorf("invalid '%s' type: only a %s is allowed", aclPolicyTag, YamlKindVerbose(yaml.MappingNode))
+	}
+	policy, err := parseACLPolicy(nil, node)
+	return policy, unwrapParseError(err)
+}
+
+// ACLTags returns the tagged YAML values describing the ACL rules defined on
+// the given object (e.g. `!!ldap/acl:allow-on dc=org`), its members and its
+// subtree, each on a single line. Inherited rules are ignored.
+func ACLTags(obj *common.Object) ([]string, error) {
+	var tags []string
+	for _, set := range []struct {
+		family string
+		rules  common.ACLRuleSet
+	}{
+		{"!!ldap/acl", obj.ACLs},
+		{"!!ldap/members-acl", obj.MemberACLs},
+		{"!!ldap/subtree-acl", obj.SubtreeACLs},
+	} {
+		for _, rule := range set.rules {
+			if rule.Source != common.ACLSourceSelf {
+				continue
+			}
+
+			node, err := ACLRuleNode(set.family, rule)
+			if err != nil {
+				return nil, err
+			}
+			tag, err := marshalInline(node)
+			if err != nil {
+				return nil, err
+			}
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// ACLPolicyTags returns the tagged YAML values describing the given ACL
+// policy, one per subject, each on a single line.
+func ACLPolicyTags(policy []common.ACLPolicyRule) ([]string, error) {
+	tags := make([]string, 0, len(policy))
+	for _, rule := range policy {
+		rules := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, acl := range rule.Rules {
+			node, err := ACLRuleNode("!!ldap/acl", acl)
+			if err != nil {
+				return nil, err
+			}
+			rules.Content = append(rules.Content, node)
+		}
+
+		tag, err := marshalInline(&yaml.Node{
+			Kind:    yaml.MappingNode,
+			Tag:     aclPolicyTag,
+			Style:   yaml.FlowStyle,
+			Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: rule.Subject}, rules},
+		})
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// FormatTaggedValue returns the given value, tagged with the given tag,
+// encoded on a single line (e.g. `!!ldap/bind:totp JBSWY3DPEHPK3PXP`). If an
+// attribute is given, the value is described as the value of this attribute
+// (e.g. `{password: !!ldap/bind:password alice}`).
+func FormatTaggedValue(attribute, tag, value string) (string, error) {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+	if strings.ContainsAny(value, "\r\n") {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+
+	if attribute != "" {
+		node = &yaml.Node{
+			Kind:    yaml.MappingNode,
+			Style:   yaml.FlowStyle,
+			Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: attribute}, node},
+		}
+	}
+	return marshalInline(node)
+}
+
+// ACLRuleNode returns the YAML node, tagged with the given tag family,
+// describing the given ACL rule. Rules only defined by a DN suffix, a filter
+// or a relation are described by a scalar node, the others by a mapping node.
+func ACLRuleNode(family string, rule common.ACLRule) (*yaml.Node, error) {
+	var tag string
+	for name, def := range aclRules {
+		if def.capability == rule.Capability && def.allowed == rule.Allowed {
+			tag = family + ":" + name
+		}
+	}
+	if tag == "" {
+		return nil, fmt.Errorf("unsupported ACL rule on '%s': no tag describes it", rule.DistinguishedNameSuffix)
+	}
+
+	var relation string
+	for name, value := range aclRelations {
+		if value == rule.Relation {
+			relation = name
+		}
+	}
+
+	switch {
+	case len(rule.Attributes) > 0:
+		// NOTE: attributes can only be given using a mapping node.
+	case rule.Filter == "" && rule.Relation == common.ACLRelationAny:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: rule.DistinguishedNameSuffix}, nil
+	case rule.DistinguishedNameSuffix == "" && rule.Relation == common.ACLRelationAny:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: rule.Filter}, nil
+	case rule.DistinguishedNameSuffix == "" && rule.Filter == "":
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: relation}, nil
+	}
+
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: tag, Style: yaml.FlowStyle}
+	field := func(key string, value *yaml.Node) {
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	}
+	if rule.DistinguishedNameSuffix != "" {
+		field("dn", &yaml.Node{Kind: yaml.ScalarNode, Value: rule.DistinguishedNameSuffix})
+	}
+	if rule.Filter != "" {
+		field("filter", &yaml.Node{Kind: yaml.ScalarNode, Value: rule.Filter})
+	}
+	if rule.Relation != common.ACLRelationAny {
+		field("target", &yaml.Node{Kind: yaml.ScalarNode, Value: relation})
+	}
+	if len(rule.Attributes) > 0 {
+		attributes := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, attribute := range rule.Attributes {
+			attributes.Content = append(attributes.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: attribute})
+		}
+		field("attributes", attributes)
+	}
+	return node, nil
+}
+
+// decodeTaggedValue decodes the given YAML value, moved to the given position.
+func decodeTaggedValue(raw string, line, column int) (*yaml.Node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(raw), &document); err != nil {
+		return nil, fmt.Errorf("invalid YAML value: %w", err)
+	}
+	if len(document.Content) != 1 {
+		return nil, errors.New("invalid YAML value: the value is empty")
+	}
+
+	node := document.Content[0]
+	relocate(node, line, column)
+	return node, nil
+}
+
+// marshalInline encodes the given YAML node on a single line.
+func marshalInline(node *yaml.Node) (string, error) {
+	raw, err := yaml.Marshal(node)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(raw), "\n"), nil
+}
+
+// unwrapParseError returns the error described by the given ParseError, in
+// order to report it with the position of the value inside its own format.
+func unwrapParseError(err error) error {
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		return perr.err
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package yamldir
+
+import (
+	"testing"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTaggedValue(t *testing.T) {
+	obj := &common.Object{ImplObject: common.ImplObject{Attributes: ldap.Attributes{}}}
+
+	require.NoError(t, ParseTaggedValue(obj, "!!ldap/bind:totp JBSWY3DPEHPK3PXP", 1, 1))
+	require.NoError(t, ParseTaggedValue(obj, "{password: !!ldap/bind:password alice}", 2, 11))
+	require.NoError(t, ParseTaggedValue(obj, "!!ldap/acl:allow-on dc=org", 3, 11))
+
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", obj.BindTOTP.Secret())
+	assert.Equal(t, "alice", obj.BindPasswords.Unwrap())
+	assert.Equal(t, ldap.Attributes{"password": {"alice"}}, obj.Attributes())
+	assert.Equal(t, []string{"password"}, obj.SecretAttributes)
+	require.Len(t, obj.ACLs, 1)
+	assert.Equal(t, "line 3, column 11", obj.ACLs[0].Origin)
+}
+
+func TestParseTaggedValue_Invalid(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Raw   string
+		Error string
+	}{
+		{Name: "UnsupportedTag", Raw: "!!ldap/alias cn=bob", Error: "unsupported tag '!!ldap/alias': only bind and ACL tags are allowed"},
+		{Name: "UnsupportedAttribute", Raw: "{password: alice}", Error: "unsupported tag '!!map': only bind and ACL tags are allowed"},
+		{Name: "Empty", Raw: "", Error: "invalid YAML value: the value is empty"},
+		{Name: "InvalidYAML", Raw: "{", Error: "invalid YAML value: yaml: line 1: did not find expected node content"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			err := ParseTaggedValue(&common.Object{}, tt.Raw, 1, 1)
+			assert.EqualError(t, err, tt.Error)
+		})
+	}
+}
+
+func TestParseACLPolicyValue(t *testing.T) {
+	policy, err := ParseACLPolicyValue("!!ldap/acl:policy {'*': !!ldap/acl:allow-on dc=org}", 1, 11)
+	require.NoError(t, err)
+	require.Len(t, policy, 1)
+	assert.Equal(t, "*", policy[0].Subject)
+
+	_, err = ParseACLPolicyValue("!!ldap/acl:allow-on dc=org", 1, 11)
+	assert.EqualError(t, err, "unsupported tag '!!ldap/acl:allow-on': only '!!ldap/acl:policy' is allowed")
+
+	_, err = ParseACLPolicyValue("!!ldap/acl:policy dc=org", 1, 11)
+	assert.EqualError(t, err, "invalid '!!ldap/acl:policy' type: only a mapping node (aka. dictionary) is allowed")
+}
+
+func TestACLTags(t *testing.T) {
+	tags := []string{
+		"!!ldap/acl:allow-read-on {dn: dc=org, filter: (cn=alice), attributes: [mail, cn]}",
+		"!!ldap/acl:allow-on dc=org",
+		"!!ldap/acl:deny-on (objectClass=posixGroup)",
+		"!!ldap/members-acl:allow-on self",
+		"!!ldap/subtree-acl:deny-compare-on {dn: dc=org, target: self}",
+	}
+
+	obj := &common.Object{}
+	for i, tag := range tags {
+		require.NoError(t, ParseTaggedValue(obj, tag, i+1, 1))
+	}
+
+	actual, err := ACLTags(obj)
+	require.NoError(t, err)
+	assert.Equal(t, tags, actual)
+}
+
+func TestACLPolicyTags(t *testing.T) {
+	tag := "!!ldap/acl:policy {'*': [!!ldap/acl:deny-read-on {dn: dc=org, attributes: [mail]}]}"
+	policy, err := ParseACLPolicyValue(tag, 1, 1)
+	require.NoError(t, err)
+
+	actual, err := ACLPolicyTags(policy)
+	require.NoError(t, err)
+	assert.Equal(t, []string{tag}, actual)
+}
+
+func TestFormatTaggedValue(t *testing.T) {
+	tests := []struct {
+		Name      string
+		Attribute string
+		Value     string
+		Expected  string
+	}{
+		{Name: "Value", Value: "alice", Expected: "!!ldap/bind:password alice"},
+		{Name: "Multiline", Value: "alice\nbob", Expected: `!!ldap/bind:password "alice\nbob"`},
+		{Name: "Attribute", Attribute: "password", Value: "alice", Expected: "{password: !!ldap/bind:password alice}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			actual, err := FormatTaggedValue(tt.Attribute, "!!ldap/bind:password", tt.Value)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Expected, actual)
+		})
+	}
+}
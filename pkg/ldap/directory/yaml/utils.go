@@ -10,9 +10,15 @@ import (
 type ParseError struct {
 	err    error
 	source *yaml.Node
+	// file is the YAML file containing the source node, only set when
+	// several files are loaded.
+	file string
 }
 
 func (e *ParseError) Error() string {
+	if e.file != "" {
+		return fmt.Sprintf("invalid LDAP YAML document '%s' at line %d, column %d: %s", e.file, e.source.Line, e.source.Column, e.err.Error())
+	}
 	return fmt.Sprintf("invalid LDAP YAML document at line %d, column %d: %s", e.source.Line, e.source.Column, e.err.Error())
 }
 func (e *ParseError) Unwrap() error { return e.err }
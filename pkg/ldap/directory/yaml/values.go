@@ -0,0 +1,100 @@
+package yamldir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WithValuesFiles gives the values defined by the given YAML files to the
+// directory template (as `.Values`). Files are merged in order, later files
+// overriding the values of earlier ones, and are watched like the directory
+// files.
+func WithValuesFiles(paths ...string) Option {
+	return func(directory *directory) { directory.valuesFiles = append(directory.valuesFiles, paths...) }
+}
+
+// WithValues gives the given values to the directory template (as
+// `.Values`). They override the values read from files (see WithValuesFiles).
+func WithValues(values map[string]any) Option {
+	return func(directory *directory) {
+		if directory.values == nil {
+			directory.values = map[string]any{}
+		}
+		mergeValues(directory.values, values)
+	}
+}
+
+// SetValue sets the value described by the given `key=value` assignment
+// inside the given values, where the key can be a dotted path of nested
+// values (e.g. `admin.uid=alice`). Values are always set as strings.
+func SetValue(values map[string]any, assignment string) error {
+	key, value, found := strings.Cut(assignment, "=")
+	if !found {
+		return fmt.Errorf("invalid template value '%s': missing '=' between key and value", assignment)
+	}
+
+	path := strings.Split(key, ".")
+	for _, name := range path {
+		if name == "" {
+			return fmt.Errorf("invalid template value '%s': '%s' is not a valid key", assignment, key)
+		}
+	}
+
+	for _, name := range path[:len(path)-1] {
+		nested, isMap := values[name].(map[string]any)
+		if !isMap {
+			nested = map[string]any{}
+			values[name] = nested
+		}
+		values = nested
+	}
+	values[path[len(path)-1]] = value
+	return nil
+}
+
+// loadValues returns the values read from the given YAML files, merged in
+// order.
+func loadValues(paths []string) (map[string]any, error) {
+	values := map[string]any{}
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read template values file: %w", err)
+		}
+
+		var file map[string]any
+		if err := yaml.Unmarshal(raw, &file); err != nil {
+			var terr *yaml.TypeError
+			if errors.As(err, &terr) {
+				return nil, fmt.Errorf("invalid template values file '%s': expected a %s as root node", path, YamlKindVerbose(yaml.MappingNode))
+			}
+			return nil, fmt.Errorf("invalid template values file '%s': %w", path, err)
+		}
+		mergeValues(values, file)
+	}
+	return values, nil
+}
+
+// mergeValues merges the src values into the dst ones. Nested values are
+// merged recursively; any other value of src overrides the dst one.
+func mergeValues(dst, src map[string]any) {
+	for key, value := range src {
+		nested, isMap := value.(map[string]any)
+		existing, exists := dst[key].(map[string]any)
+		if !isMap || !exists {
+			dst[key] = value
+			continue
+		}
+
+		// NOTE: the existing map is copied before being modified, because
+		//       it can be shared with the values given by the caller.
+		merged := make(map[string]any, len(existing))
+		mergeValues(merged, existing)
+		mergeValues(merged, nested)
+		dst[key] = merged
+	}
+}
@@ -0,0 +1,203 @@
+package yamldir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDirectory_WithValues(t *testing.T) {
+	tests := []struct {
+		Name             string
+		Options          []Option
+		ExpectedDN       string
+		ExpectedPassword string
+		ExpectedFiles    []string
+	}{
+		{
+			Name:             "ValuesFile",
+			Options:          []Option{WithValuesFiles("fixtures/values/values.yaml")},
+			ExpectedDN:       "cn=alice,ou=people,dc=staging,dc=org",
+			ExpectedPassword: "staging",
+			ExpectedFiles: []string{
+				"fixtures/values/values.yaml",
+				"fixtures/values/directory.yaml",
+				"fixtures/values/secrets/staging.password",
+			},
+		},
+		{
+			Name:             "OverriddenValuesFile",
+			Options:          []Option{WithValuesFiles("fixtures/values/values.yaml", "fixtures/values/production.yaml")},
+			ExpectedDN:       "cn=alice,ou=people,dc=example,dc=org",
+			ExpectedPassword: "production",
+			ExpectedFiles: []string{
+				"fixtures/values/values.yaml",
+				"fixtures/values/production.yaml",
+				"fixtures/values/directory.yaml",
+				"fixtures/values/secrets/production.password",
+			},
+		},
+		{
+			Name: "OverriddenValues",
+			Options: []Option{
+				WithValues(map[string]any{"admin": map[string]any{"uid": "bob"}}),
+				WithValuesFiles("fixtures/values/values.yaml"),
+			},
+			ExpectedDN:       "cn=bob,ou=people,dc=staging,dc=org",
+			ExpectedPassword: "staging",
+			ExpectedFiles: []string{
+				"fixtures/values/values.yaml",
+				"fixtures/values/directory.yaml",
+				"fixtures/values/secrets/staging.password",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			directory, err := NewDirectory("fixtures/values/directory.yaml", tt.Options...)
+			require.NoError(t, err)
+
+			obj := directory.BaseDN(tt.ExpectedDN)
+			require.NotNil(t, obj)
+			valid, err := obj.Bind(tt.ExpectedPassword)
+			require.NoError(t, err)
+			assert.True(t, valid)
+
+			assert.Equal(t, tt.ExpectedFiles, directory.(ldap.Watchable).WatchedFiles())
+		})
+	}
+}
+
+func TestNewDirectory_WithInvalidValues(t *testing.T) {
+	tmp := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "invalid.yaml"), []byte("key: [value"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "list.yaml"), []byte("- value"), 0o600))
+
+	tests := []struct {
+		Name          string
+		File          string
+		ExpectedError string
+	}{
+		{
+			Name:          "MissingFile",
+			File:          filepath.Join(tmp, "missing.yaml"),
+			ExpectedError: "unable to read template values file: open " + filepath.Join(tmp, "missing.yaml") + ": no such file or directory",
+		},
+		{
+			Name:          "InvalidYAML",
+			File:          filepath.Join(tmp, "invalid.yaml"),
+			ExpectedError: "invalid template values file '" + filepath.Join(tmp, "invalid.yaml") + "': yaml: line 1: did not find expected ',' or ']'",
+		},
+		{
+			Name:          "NotMapping",
+			File:          filepath.Join(tmp, "list.yaml"),
+			ExpectedError: "invalid template values file '" + filepath.Join(tmp, "list.yaml") + "': expected a mapping node (aka. dictionary) as root node",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := NewDirectory("fixtures/values/directory.yaml", WithValuesFiles(tt.File))
+			assert.EqualError(t, err, tt.ExpectedError)
+		})
+	}
+}
+
+func TestNewDirectory_WithFiles(t *testing.T) {
+	tmp := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(tmp, "secrets"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "secrets", "description"), []byte("Organization\n"), 0o600))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(tmp, "directory.yaml"),
+		[]byte("dc:org:\n  description: {{ .Files.Get \"secrets/description\" | trim }}\n  path: {{ .Files.Path \"secrets\" }}\n"),
+		0o600,
+	))
+
+	directory, err := NewDirectory(filepath.Join(tmp, "directory.yaml"))
+	require.NoError(t, err)
+
+	obj := directory.BaseDN("dc=org")
+	require.NotNil(t, obj)
+	assert.Equal(t, []string{"Organization"}, obj.Attributes()["description"])
+	assert.Equal(t, []string{filepath.Join(tmp, "secrets")}, obj.Attributes()["path"])
+	assert.Equal(t,
+		[]string{filepath.Join(tmp, "directory.yaml"), filepath.Join(tmp, "secrets", "description")},
+		directory.(ldap.Watchable).WatchedFiles(),
+	)
+}
+
+func TestSetValue(t *testing.T) {
+	tests := []struct {
+		Name           string
+		Assignments    []string
+		ExpectedValues map[string]any
+		ExpectedError  string
+	}{
+		{
+			Name:           "SimpleKey",
+			Assignments:    []string{"domain=example.org"},
+			ExpectedValues: map[string]any{"domain": "example.org"},
+		},
+		{
+			Name:        "DottedKeys",
+			Assignments: []string{"admin.uid=alice", "admin.dn=cn=alice,dc=org", "admin.uid=bob"},
+			ExpectedValues: map[string]any{
+				"admin": map[string]any{"uid": "bob", "dn": "cn=alice,dc=org"},
+			},
+		},
+		{
+			Name:           "OverriddenValue",
+			Assignments:    []string{"admin=alice", "admin.uid=bob"},
+			ExpectedValues: map[string]any{"admin": map[string]any{"uid": "bob"}},
+		},
+		{
+			Name:          "MissingValue",
+			Assignments:   []string{"admin"},
+			ExpectedError: "invalid template value 'admin': missing '=' between key and value",
+		},
+		{
+			Name:          "EmptyKey",
+			Assignments:   []string{"admin..uid=alice"},
+			ExpectedError: "invalid template value 'admin..uid=alice': 'admin..uid' is not a valid key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			values := map[string]any{}
+			var err error
+			for _, assignment := range tt.Assignments {
+				if err = SetValue(values, assignment); err != nil {
+					break
+				}
+			}
+
+			if tt.ExpectedError != "" {
+				assert.EqualError(t, err, tt.ExpectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.ExpectedValues, values)
+		})
+	}
+}
+
+func TestMergeValues(t *testing.T) {
+	shared := map[string]any{"uid": "alice"}
+	values := map[string]any{"admin": shared, "domain": "example.org"}
+
+	mergeValues(values, map[string]any{"admin": map[string]any{"dn": "cn=alice,dc=org"}, "domain": "example.com"})
+	assert.Equal(t,
+		map[string]any{
+			"admin":  map[string]any{"uid": "alice", "dn": "cn=alice,dc=org"},
+			"domain": "example.com",
+		},
+		values,
+	)
+	assert.Equal(t, map[string]any{"uid": "alice"}, shared)
+}
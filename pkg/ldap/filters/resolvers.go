@@ -1,6 +1,7 @@
 package filters
 
 import (
+	"errors"
 	"fmt"
 
 	ldap "github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
@@ -15,6 +16,10 @@ func init() {
 
 var berFilterResolvers = map[ber.Tag]BerFilterExpressionResolver{}
 
+// ErrNotImplemented is returned when a filter expression is not supported
+// (e.g. extensible match).
+var ErrNotImplemented = errors.New("not implemented")
+
 // Match uses the given filter to check if the current entry matches it.
 func Match(object ldap.Object, filter *ber.Packet) (bool, error) {
 	return berFilterResolvers[filter.Tag].Resolve(object, filter)
@@ -37,7 +42,7 @@ func (resolver BerFilterExpressionResolver) Resolve(object ldap.Object, filter *
 	if resolver.resolve == nil {
 		return false, &Error{
 			filter.Tag,
-			fmt.Errorf("not implemented"),
+			ErrNotImplemented,
 		}
 	}
 	return resolver.resolve(object, filter)
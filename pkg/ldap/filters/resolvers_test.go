@@ -55,5 +55,6 @@ func TestBerFilterExpressionResolver_Resolve(t *testing.T) {
 		resolver := filters.BerFilterExpressionResolver{}
 		_, err := resolver.Resolve(object, &ber.Packet{Identifier: ber.Identifier{Tag: 0xFFFFFFFFFFFFFFFF}})
 		require.EqualError(t, err, "invalid `<unknown>` filter: not implemented")
+		assert.ErrorIs(t, err, filters.ErrNotImplemented)
 	})
 }
@@ -1,32 +1,61 @@
 package ldap
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"strings"
 
 	"github.com/chezmoi-sh/yaldap/internal/ldap/auth"
 	"github.com/chezmoi-sh/yaldap/pkg/ldap/directory"
+	"github.com/chezmoi-sh/yaldap/pkg/ldap/filters"
 	"github.com/chezmoi-sh/yaldap/pkg/utils"
+	goldap "github.com/go-ldap/ldap/v3"
 	"github.com/jimlambrt/gldap"
 	"golang.org/x/exp/slices"
 )
 
-// server is a ldap server that uses a Directory to accept and perform search.
-type server struct {
-	sessions  *auth.Sessions
-	directory directory.Directory
+type (
+	// server is a ldap server that uses a Directory to accept and perform search.
+	server struct {
+		sessions  *auth.Sessions
+		directory directory.Directory
 
-	logger *slog.Logger
-}
+		bindNameResolvers     []BindNameResolver
+		hideUnauthorizedBases bool
+		defaultReferrals      []string
+
+		logger *slog.Logger
+	}
+
+	// MuxOption customizes the LDAP server created by NewMux.
+	MuxOption func(server *server)
+
+	// BindNameResolver describes how to resolve a bind name that is not a DN
+	// (e.g. `alice` or `alice@example.org`) into the DN of a directory entry.
+	BindNameResolver struct {
+		// BaseDN is the DN under which the entry is searched.
+		BaseDN string
+		// Filter is the LDAP filter used to search the entry, where all `%s`
+		// are replaced by the escaped bind name (e.g. `(uid=%s)`).
+		Filter string
+	}
+)
+
+// ControlTypeProxiedAuthorization is the OID of the proxied authorization
+// control - https://tools.ietf.org/html/rfc4370
+const ControlTypeProxiedAuthorization = "2.16.840.1.113730.3.4.18"
 
 // NewMux creates a new LDAP server.
-func NewMux(logger *slog.Logger, directory directory.Directory, sessions *auth.Sessions) *gldap.Mux {
+func NewMux(logger *slog.Logger, directory directory.Directory, sessions *auth.Sessions, opts ...MuxOption) *gldap.Mux {
 	server := &server{
 		logger:    logger,
 		sessions:  sessions,
 		directory: directory,
 	}
+	for _, opt := range opts {
+		opt(server)
+	}
 	mux, _ := gldap.NewMux()
 
 	_ = mux.Bind(server.bind)
@@ -39,8 +68,41 @@ func NewMux(logger *slog.Logger, directory directory.Directory, sessions *auth.S
 	return mux
 }
 
+// WithBindNameResolvers allows clients to bind using a name that is not a DN
+// (e.g. `alice` or `alice@example.org`), resolved using the given resolvers.
+func WithBindNameResolvers(resolvers ...BindNameResolver) MuxOption {
+	return func(server *server) { server.bindNameResolvers = append(server.bindNameResolvers, resolvers...) }
+}
+
+// WithHiddenUnauthorizedBases makes search bases the identity is not allowed
+// to see indistinguishable from missing ones: both are rejected with a
+// noSuchObject result instead of insufficientAccessRights for the former.
+func WithHiddenUnauthorizedBases(enabled bool) MuxOption {
+	return func(server *server) { server.hideUnauthorizedBases = enabled }
+}
+
+// WithDefaultReferrals refers searches whose base DN is outside all naming
+// contexts of the directory to the given LDAP URLs, instead of returning a
+// noSuchObject result.
+func WithDefaultReferrals(urls ...string) MuxOption {
+	return func(server *server) { server.defaultReferrals = append(server.defaultReferrals, urls...) }
+}
+
+// acquire returns a copy of the server using the directory currently served
+// during the whole request (see directory.Acquire), and the function to call
+// once the request is done.
+func (s *server) acquire() (*server, func()) {
+	dir, release := directory.Acquire(s.directory)
+	acquired := *s
+	acquired.directory = dir
+	return &acquired, release
+}
+
 // bind implements the LDAP bind mechanism to authenticate someone to perform a search.
 func (s *server) bind(w *gldap.ResponseWriter, req *gldap.Request) {
+	s, release := s.acquire()
+	defer release()
+
 	log := s.logger.With(
 		slog.String("method", "bind"),
 		slog.Group("session",
@@ -55,12 +117,26 @@ func (s *server) bind(w *gldap.ResponseWriter, req *gldap.Request) {
 	msg, err := req.GetSimpleBindMessage()
 	if err != nil {
 		log.Error("unable to get simple bind message", slog.String("error", err.Error()))
-		resp.SetResultCode(gldap.ResultLocalError)
+		resp.SetResultCode(gldap.ResultProtocolError)
 		resp.SetDiagnosticMessage(err.Error())
 		return
 	}
 
-	obj := s.directory.BaseDN(msg.UserName)
+	if msg.UserName == "" && msg.Password == "" {
+		log.Error("anonymous bind is not supported")
+		resp.SetResultCode(gldap.ResultInappropriateAuthentication)
+		resp.SetDiagnosticMessage("anonymous bind is not supported")
+		return
+	}
+
+	obj, err := s.resolveBindName(msg.UserName)
+	if err != nil {
+		log.Error("unable to resolve username", slog.String("username", msg.UserName), slog.String("error", err.Error()))
+		resp.SetResultCode(gldap.ResultInvalidCredentials)
+		// NOTE: we don't want to give any information about the user existence
+		//       in order to avoid any bruteforce attack.
+		return
+	}
 	if obj == nil {
 		log.Error("unable to find username", slog.String("username", msg.UserName))
 		resp.SetResultCode(gldap.ResultInvalidCredentials)
@@ -95,6 +171,107 @@ func (s *server) bind(w *gldap.ResponseWriter, req *gldap.Request) {
 	resp.SetResultCode(gldap.ResultSuccess)
 }
 
+// resolveBindName returns the directory entry matching the given bind name.
+// The bind name is first used as a DN and, if no entry is found, resolved
+// through all bind name resolvers, in order. It returns an error if a
+// resolver matches several entries.
+func (s *server) resolveBindName(name string) (directory.Object, error) {
+	if obj := s.directory.BaseDN(name); obj != nil || name == "" {
+		return obj, nil
+	}
+
+	for _, resolver := range s.bindNameResolvers {
+		base := s.directory.BaseDN(resolver.BaseDN)
+		if base == nil {
+			continue
+		}
+
+		filter := strings.ReplaceAll(resolver.Filter, "%s", goldap.EscapeFilter(name))
+		entries, err := base.Search(gldap.WholeSubtree, filter)
+		switch {
+		case err != nil:
+			return nil, err
+		case len(entries) > 1:
+			return nil, fmt.Errorf("ambiguous username: %d entries match %s under '%s'", len(entries), filter, resolver.BaseDN)
+		case len(entries) == 1:
+			return entries[0], nil
+		}
+	}
+	return nil, nil
+}
+
+// proxiedIdentity returns the identity used to evaluate an operation: the
+// bound object itself or, if the proxied authorization control is used, the
+// target identity if the bound object is allowed to act on its behalf.
+func (s *server) proxiedIdentity(obj directory.Object, controls []gldap.Control) (directory.Object, error) {
+	idx := slices.IndexFunc(controls, func(c gldap.Control) bool {
+		return c.GetControlType() == ControlTypeProxiedAuthorization
+	})
+	if idx < 0 {
+		return obj, nil
+	}
+
+	var authzID string
+	if control, ok := controls[idx].(*gldap.ControlString); ok {
+		authzID = control.ControlValue
+	}
+
+	var target directory.Object
+	switch {
+	case authzID == "":
+		return nil, fmt.Errorf("anonymous proxied authorization is not supported")
+	case strings.HasPrefix(authzID, "dn:"):
+		target = s.directory.BaseDN(strings.TrimPrefix(authzID, "dn:"))
+	case strings.HasPrefix(authzID, "u:"):
+		var err error
+		target, err = s.resolveBindName(strings.TrimPrefix(authzID, "u:"))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid authorization identity '%s'", authzID)
+	}
+
+	// NOTE: unknown identities and forbidden ones are not distinguished in
+	//       order to avoid leaking the existence of an entry.
+	if target == nil || !obj.CanProxyAs(target) {
+		return nil, fmt.Errorf("not allowed to proxy as '%s'", authzID)
+	}
+	return target, nil
+}
+
+// authorizeProxy rejects the request with an authorization denied result if
+// it uses the proxied authorization control without being allowed to.
+// It returns true if the request has been rejected.
+func (s *server) authorizeProxy(log *slog.Logger, w *gldap.ResponseWriter, req *gldap.Request, applicationCode int, controls []gldap.Control) bool {
+	if !slices.ContainsFunc(controls, func(c gldap.Control) bool {
+		return c.GetControlType() == ControlTypeProxiedAuthorization
+	}) {
+		return false
+	}
+	s, release := s.acquire()
+	defer release()
+
+	var err error
+	session := s.sessions.Session(req.ConnectionID())
+	if session == nil {
+		err = fmt.Errorf("session not found or expired")
+	} else {
+		_, err = s.proxiedIdentity(session.Object(), controls)
+	}
+	if err == nil {
+		return false
+	}
+
+	log.Error("proxied authorization denied", slog.String("error", err.Error()))
+	_ = w.Write(req.NewResponse(
+		gldap.WithApplicationCode(applicationCode),
+		gldap.WithResponseCode(gldap.ResultAuthorizationDenied),
+		gldap.WithDiagnosticMessage(err.Error()),
+	))
+	return true
+}
+
 func (s *server) unbind(_ *gldap.ResponseWriter, req *gldap.Request) {
 	log := s.logger.With(
 		slog.String("method", "unbind"),
@@ -116,6 +293,9 @@ func (s *server) unbind(_ *gldap.ResponseWriter, req *gldap.Request) {
 
 // Search implements the LDAP search mechanism.
 func (s *server) search(w *gldap.ResponseWriter, req *gldap.Request) {
+	s, release := s.acquire()
+	defer release()
+
 	log := s.logger.With(
 		slog.String("method", "search"),
 		slog.Group("session",
@@ -130,7 +310,7 @@ func (s *server) search(w *gldap.ResponseWriter, req *gldap.Request) {
 	msg, err := req.GetSearchMessage()
 	if err != nil {
 		log.Error("unable to get search message", slog.String("error", err.Error()))
-		resp.SetResultCode(gldap.ResultParamError)
+		resp.SetResultCode(gldap.ResultProtocolError)
 		resp.SetDiagnosticMessage(err.Error())
 		return
 	}
@@ -138,41 +318,110 @@ func (s *server) search(w *gldap.ResponseWriter, req *gldap.Request) {
 		slog.String("base_dn", msg.BaseDN),
 		slog.String("filter", msg.Filter),
 		slog.String("scope", utils.LDAPScopes[msg.Scope]),
+		slog.String("deref_aliases", goldap.DerefMap[msg.DerefAliases]),
 		slog.Any("attributes", msg.Attributes),
 	))
 
 	session := s.sessions.Session(req.ConnectionID())
 	if session == nil {
 		log.Error("session not found or expired")
+		resp.SetResultCode(gldap.ResultInsufficientAccessRights)
+		resp.SetDiagnosticMessage("anonymous search is not allowed")
+		return
+	}
+	log = log.With(slog.String("bind_dn", session.Object().DN()))
+
+	obj, err := s.proxiedIdentity(session.Object(), msg.Controls)
+	if err != nil {
+		log.Error("proxied authorization denied", slog.String("error", err.Error()))
 		resp.SetResultCode(gldap.ResultAuthorizationDenied)
+		resp.SetDiagnosticMessage(err.Error())
 		return
 	}
-	obj := session.Object()
-	log = log.With(slog.String("bind_dn", obj.DN()))
+	if obj.DN() != session.Object().DN() {
+		log = log.With(slog.String("proxied_dn", obj.DN()))
+	}
 
-	baseDn := s.directory.BaseDN(msg.BaseDN)
+	// NOTE: referral objects are managed like any other object when the
+	//       ManageDsaIT control is used (RFC 3296). Otherwise, because gldap
+	//       can send neither the referral field of a result nor search result
+	//       references (RFC 4511 §4.1.10 and §4.5.3), searches based on them
+	//       (or outside all naming contexts, with default referrals) are
+	//       rejected with unwillingToPerform and the ones below are skipped.
+	manageDsaIT := slices.ContainsFunc(msg.Controls, func(c gldap.Control) bool {
+		return c.GetControlType() == gldap.ControlTypeManageDsaIT
+	})
+	if !manageDsaIT {
+		if referral, urls := s.searchReferral(obj, msg.BaseDN); len(urls) > 0 {
+			log.Error("base DN is referred", slog.Any("referrals", urls))
+			resp.SetResultCode(gldap.ResultUnwillingToPerform)
+			resp.SetMatchedDN(referral)
+			resp.SetDiagnosticMessage(unsupportedReferralMessage(referral, urls))
+			return
+		}
+	}
+
+	baseDn, code, matchedDN := s.searchBase(obj, msg.BaseDN)
 	if baseDn == nil {
-		log.Error("unable to find base DN")
-		resp.SetResultCode(gldap.ResultNoSuchObject)
+		log.Error("unable to use base DN", slog.String("result", gldap.ResultCodeMap[uint16(code)]), slog.String("matched_dn", matchedDN))
+		resp.SetResultCode(code)
+		resp.SetMatchedDN(matchedDN)
 		return
 	}
 
-	entries, err := baseDn.Search(msg.Scope, msg.Filter)
+	var references []string
+	opts := []directory.SearchOption{directory.WithFilterableAttributes(obj.CanFilterOnAttribute)}
+	if !manageDsaIT {
+		opts = append(opts, directory.WithReferralHandler(func(referral directory.Object) {
+			if isVisible(obj, referral) {
+				references = append(references, referral.DN())
+			}
+		}))
+	}
+	switch msg.DerefAliases {
+	case goldap.DerefFindingBaseObj:
+		baseDn, code, err = s.derefSearchBase(obj, baseDn)
+	case goldap.DerefInSearching:
+		opts = append(opts, directory.WithAliasDereferencing(s.directory))
+	case goldap.DerefAlways:
+		baseDn, code, err = s.derefSearchBase(obj, baseDn)
+		opts = append(opts, directory.WithAliasDereferencing(s.directory))
+	}
+	if err != nil {
+		log.Error("unable to dereference base DN", slog.String("error", err.Error()))
+		resp.SetResultCode(code)
+		resp.SetDiagnosticMessage(err.Error())
+		resp.SetMatchedDN(baseDn.DN())
+		return
+	}
+
+	// NOTE: the filter is only evaluated on attributes the identity can filter
+	//       on, in order to avoid leaking hidden attributes (e.g.
+	//       `(userPassword=*)` probing).
+	entries, err := baseDn.Search(msg.Scope, msg.Filter, opts...)
 	if err != nil {
 		log.Error("unable to search", slog.String("error", err.Error()))
-		resp.SetResultCode(gldap.ResultOperationsError)
+		resp.SetResultCode(searchResultCode(err))
 		resp.SetDiagnosticMessage(err.Error())
 		return
 	}
 
+	if len(references) > 0 {
+		log.Warn("referral objects found inside the search scope are skipped", slog.Any("referrals", references))
+	}
+
 	var count int
 	for _, entry := range entries {
-		if obj.CanSearchOn(entry.DN()) {
+		if obj.CanSearchOn(entry) {
 			resp := req.NewSearchResponseEntry(entry.DN())
 			attrs := entry.Attributes()
 
 			// Filter attributes if needed
 			for attr, values := range attrs {
+				if !obj.CanReadAttribute(entry, attr) {
+					continue
+				}
+
 				if len(msg.Attributes) == 0 || slices.ContainsFunc(
 					msg.Attributes,
 					func(s string) bool { return strings.EqualFold(s, attr) },
@@ -189,6 +438,106 @@ func (s *server) search(w *gldap.ResponseWriter, req *gldap.Request) {
 	resp.SetResultCode(gldap.ResultSuccess)
 }
 
+// searchReferral returns the DN of the referral object, visible by the given
+// identity, at or above the given search base with its LDAP URLs. If the base
+// is outside all naming contexts, the default referrals are returned.
+func (s *server) searchReferral(obj directory.Object, baseDN string) (string, []string) {
+	dn, err := directory.ParseDN(baseDN)
+	if err != nil || len(dn) == 0 {
+		return "", nil
+	}
+
+	for parent := dn; len(parent) > 0; parent = parent.Parent() {
+		entry := s.directory.BaseDN(parent.String())
+		switch {
+		case entry == nil:
+			continue
+		case directory.IsReferral(entry) && isVisible(obj, entry):
+			return entry.DN(), directory.ReferralURLs(entry)
+		default:
+			return "", nil
+		}
+	}
+	return "", s.defaultReferrals
+}
+
+// unsupportedReferralMessage returns the diagnostic message sent when a search
+// is based on the given referral object (or outside all naming contexts if
+// empty), referring to the given LDAP URLs.
+func unsupportedReferralMessage(dn string, urls []string) string {
+	if dn == "" {
+		return fmt.Sprintf("the base DN is outside all naming contexts and referrals are not supported; search it on %s", strings.Join(urls, " "))
+	}
+	return fmt.Sprintf("'%s' is a referral object and referrals are not supported; use the ManageDsaIT control to search it", dn)
+}
+
+// searchBase returns the entry used as base of a search made by the given
+// identity. If this entry cannot be used, it returns the result code to send
+// back and, when the entry is missing (or hidden), the DN of its nearest
+// ancestor visible by the identity (aka. matchedDN).
+func (s *server) searchBase(obj directory.Object, baseDN string) (directory.Object, int, string) {
+	dn, err := directory.ParseDN(baseDN)
+	if err != nil {
+		return nil, gldap.ResultInvalidDNSyntax, ""
+	}
+
+	base := s.directory.BaseDN(baseDN)
+	switch {
+	case base != nil && isVisible(obj, base):
+		return base, gldap.ResultSuccess, ""
+	case base != nil && !s.hideUnauthorizedBases:
+		return nil, gldap.ResultInsufficientAccessRights, ""
+	}
+
+	// NOTE: only visible ancestors are returned as matchedDN in order to
+	//       avoid leaking the existence of hidden entries.
+	for parent := dn.Parent(); len(parent) > 0; parent = parent.Parent() {
+		if entry := s.directory.BaseDN(parent.String()); entry != nil && isVisible(obj, entry) {
+			return nil, gldap.ResultNoSuchObject, entry.DN()
+		}
+	}
+	return nil, gldap.ResultNoSuchObject, ""
+}
+
+// derefSearchBase dereferences the given search base if it is an alias. If the
+// alias cannot be dereferenced, it returns the base itself with the result
+// code to send back.
+func (s *server) derefSearchBase(obj directory.Object, base directory.Object) (directory.Object, int, error) {
+	target, err := directory.DerefAlias(s.directory, base)
+	switch {
+	case err != nil:
+		return base, gldap.ResultAliasProblem, err
+	case isVisible(obj, target):
+		return target, gldap.ResultSuccess, nil
+	case s.hideUnauthorizedBases:
+		// NOTE: aliases referring to hidden entries must not be
+		//       distinguishable from the ones referring to missing entries.
+		return base, gldap.ResultAliasProblem, fmt.Errorf("%w: alias '%s' names no object", directory.ErrAliasProblem, base.DN())
+	default:
+		return base, gldap.ResultAliasDereferencingProblem, fmt.Errorf("not allowed to dereference alias '%s'", base.DN())
+	}
+}
+
+// isVisible returns true if the given identity can search on the given entry
+// or on at least one entry below it.
+func isVisible(obj directory.Object, entry directory.Object) bool {
+	return obj.CanSearchOn(entry) || obj.CanSearchBelow(entry)
+}
+
+// searchResultCode returns the result code matching the given search error.
+func searchResultCode(err error) int {
+	var filterErr *filters.Error
+
+	switch {
+	case errors.Is(err, filters.ErrNotImplemented):
+		return gldap.ResultUnwillingToPerform
+	case errors.Is(err, directory.ErrInvalidFilter), errors.As(err, &filterErr):
+		return gldap.ResultProtocolError
+	default:
+		return gldap.ResultOperationsError
+	}
+}
+
 // add implements the LDAP add mechanism.
 func (s *server) add(w *gldap.ResponseWriter, req *gldap.Request) {
 	log := s.logger.With(
@@ -198,6 +547,10 @@ func (s *server) add(w *gldap.ResponseWriter, req *gldap.Request) {
 			slog.Int("request_id", req.ID),
 		),
 	)
+
+	if msg, err := req.GetAddMessage(); err == nil && s.authorizeProxy(log, w, req, gldap.ApplicationAddResponse, msg.Controls) {
+		return
+	}
 	log.Warn("operation is not supported")
 
 	resp := req.NewResponse(
@@ -217,6 +570,10 @@ func (s *server) modify(w *gldap.ResponseWriter, req *gldap.Request) {
 			slog.Int("request_id", req.ID),
 		),
 	)
+
+	if msg, err := req.GetModifyMessage(); err == nil && s.authorizeProxy(log, w, req, gldap.ApplicationModifyResponse, msg.Controls) {
+		return
+	}
 	log.Warn("operation is not supported")
 
 	resp := req.NewResponse(
@@ -236,6 +593,10 @@ func (s *server) del(w *gldap.ResponseWriter, req *gldap.Request) {
 			slog.Int("request_id", req.ID),
 		),
 	)
+
+	if msg, err := req.GetDeleteMessage(); err == nil && s.authorizeProxy(log, w, req, gldap.ApplicationDelResponse, msg.Controls) {
+		return
+	}
 	log.Warn("operation is not supported")
 
 	resp := req.NewResponse(
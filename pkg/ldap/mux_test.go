@@ -61,13 +61,38 @@ dc:org:
   
   dc:example2:
     objectClass: organization
+
+    ou:people:
+      cn:dave:
+        mail: dave@example.org
+        userpassword: !!ldap/bind:password dave
+
+      cn:erin:
+        mail: shared@example.org
+        userpassword: !!ldap/bind:password erin
+
+      cn:frank:
+        mail: shared@example.org
+        userpassword: !!ldap/bind:password frank
+
+      cn:webapp:
+        .acl:
+          - !!ldap/acl:allow-on ou=people,dc=example2,dc=org
+          - !!ldap/acl:proxy-as ou=people,dc=example,dc=org
+          - !!ldap/acl:allow-read-on {dn: "ou=people,dc=example2,dc=org", attributes: [userpassword]}
+        userpassword: !!ldap/bind:password webapp
 `))
 	suite.Require().NoError(err)
 
 	suite.Server, err = gldap.NewServer()
 	suite.Require().NoError(err)
 
-	err = suite.Server.Router(ldap.NewMux(logger, directory, sessions))
+	err = suite.Server.Router(ldap.NewMux(logger, directory, sessions,
+		ldap.WithBindNameResolvers(
+			ldap.BindNameResolver{BaseDN: "ou=people,dc=example,dc=org", Filter: "(cn=%s)"},
+			ldap.BindNameResolver{BaseDN: "dc=org", Filter: "(mail=%s)"},
+		),
+	))
 	suite.Require().NoError(err)
 
 	go func() {
@@ -100,6 +125,15 @@ func (suite *LDAPTestSuite) TestMux_Bind() {
 		assert.NoError(t, err)
 	})
 
+	suite.T().Run("SuccessfulBindWithNonNormalizedDN", func(t *testing.T) {
+		conn, err := suite.DialLDAP()
+		suite.Require().NoError(err)
+		defer conn.Close()
+
+		err = conn.Bind("CN=Alice, OU=People, DC=Example, DC=Org", "alice")
+		assert.NoError(t, err)
+	})
+
 	suite.T().Run("SuccessfulAnonymousBind", func(t *testing.T) {
 		conn, err := suite.DialLDAP()
 		suite.Require().NoError(err)
@@ -127,6 +161,51 @@ func (suite *LDAPTestSuite) TestMux_Bind() {
 		assert.EqualError(t, err, "LDAP Result Code 49 \"Invalid Credentials\": ")
 	})
 
+	suite.T().Run("SuccessfulBindByUsername", func(t *testing.T) {
+		conn, err := suite.DialLDAP()
+		suite.Require().NoError(err)
+		defer conn.Close()
+
+		err = conn.Bind("alice", "alice")
+		require.NoError(t, err)
+
+		// NOTE: the session must be bound to the resolved entry
+		res, err := conn.Search(&goldap.SearchRequest{
+			BaseDN: "dc=org",
+			Scope:  goldap.ScopeWholeSubtree,
+			Filter: "(cn=charlie)",
+		})
+		require.NoError(t, err)
+		assert.Len(t, res.Entries, 1)
+	})
+
+	suite.T().Run("SuccessfulBindByEmail", func(t *testing.T) {
+		conn, err := suite.DialLDAP()
+		suite.Require().NoError(err)
+		defer conn.Close()
+
+		err = conn.Bind("dave@example.org", "dave")
+		assert.NoError(t, err)
+	})
+
+	suite.T().Run("AmbiguousUsername", func(t *testing.T) {
+		conn, err := suite.DialLDAP()
+		suite.Require().NoError(err)
+		defer conn.Close()
+
+		err = conn.Bind("shared@example.org", "erin")
+		assert.EqualError(t, err, "LDAP Result Code 49 \"Invalid Credentials\": ")
+	})
+
+	suite.T().Run("UnresolvedUsername", func(t *testing.T) {
+		conn, err := suite.DialLDAP()
+		suite.Require().NoError(err)
+		defer conn.Close()
+
+		err = conn.Bind("*", "alice")
+		assert.EqualError(t, err, "LDAP Result Code 49 \"Invalid Credentials\": ")
+	})
+
 	suite.T().Run("NoPasswordDefined", func(t *testing.T) {
 		conn, err := suite.DialLDAP()
 		suite.Require().NoError(err)
@@ -135,6 +214,15 @@ func (suite *LDAPTestSuite) TestMux_Bind() {
 		err = conn.UnauthenticatedBind("cn=charlie,ou=people,dc=example,dc=org")
 		assert.EqualError(t, err, "LDAP Result Code 49 \"Invalid Credentials\": ")
 	})
+
+	suite.T().Run("AnonymousBind", func(t *testing.T) {
+		conn, err := suite.DialLDAP()
+		suite.Require().NoError(err)
+		defer conn.Close()
+
+		err = conn.UnauthenticatedBind("")
+		assert.EqualError(t, err, "LDAP Result Code 48 \"Inappropriate Authentication\": anonymous bind is not supported")
+	})
 }
 
 func (suite *LDAPTestSuite) TestMux_Unbind() {
@@ -169,7 +257,7 @@ func (suite *LDAPTestSuite) TestMux_Search() {
 			Scope:  goldap.ScopeWholeSubtree,
 			Filter: "(cn=alice)",
 		})
-		assert.EqualError(t, err, "LDAP Result Code 123 \"Authorization Denied\": ")
+		assert.EqualError(t, err, "LDAP Result Code 50 \"Insufficient Access Rights\": anonymous search is not allowed")
 	})
 
 	// Bind as alice
@@ -189,9 +277,8 @@ func (suite *LDAPTestSuite) TestMux_Search() {
 				{
 					DN: "cn=alice,ou=people,dc=example,dc=org",
 					Attributes: map[string][]string{
-						"cn":           {"alice"},
-						"objectClass":  {"person"},
-						"userpassword": {"alice"},
+						"cn":          {"alice"},
+						"objectClass": {"person"},
 					},
 				},
 			},
@@ -216,9 +303,8 @@ func (suite *LDAPTestSuite) TestMux_Search() {
 				{
 					DN: "cn=alice,ou=people,dc=example,dc=org",
 					Attributes: map[string][]string{
-						"cn":           {"alice"},
-						"objectClass":  {"person"},
-						"userpassword": {"alice"},
+						"cn":          {"alice"},
+						"objectClass": {"person"},
 					},
 				},
 				{
@@ -249,9 +335,8 @@ func (suite *LDAPTestSuite) TestMux_Search() {
 				{
 					DN: "cn=alice,ou=people,dc=example,dc=org",
 					Attributes: map[string][]string{
-						"cn":           {"alice"},
-						"objectClass":  {"person"},
-						"userpassword": {"alice"},
+						"cn":          {"alice"},
+						"objectClass": {"person"},
 					},
 				},
 				{
@@ -266,6 +351,33 @@ func (suite *LDAPTestSuite) TestMux_Search() {
 		)
 	})
 
+	suite.T().Run("NonNormalizedBaseDN", func(t *testing.T) {
+		req := goldap.NewSearchRequest("OU=People, DC=Example, DC=Org", goldap.ScopeWholeSubtree, 0, 0, 0, false, "(cn=alice)", nil, nil)
+		res, err := conn.Search(req)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"cn=alice,ou=people,dc=example,dc=org"}, ResponseEntriesHelper(res.Entries).DNs())
+	})
+
+	suite.T().Run("HiddenBindPassword", func(t *testing.T) {
+		req := goldap.NewSearchRequest("dc=org", goldap.ScopeWholeSubtree, 0, 0, 0, false, "(cn=alice)", []string{"userpassword"}, nil)
+		res, err := conn.Search(req)
+		require.NoError(t, err)
+
+		require.Len(t, res.Entries, 1)
+		assert.Empty(t, res.Entries[0].Attributes)
+	})
+
+	suite.T().Run("HiddenBindPasswordProbing", func(t *testing.T) {
+		for _, filter := range []string{"(userpassword=*)", "(userpassword=alice)", "(userpassword=a*)"} {
+			req := goldap.NewSearchRequest("dc=org", goldap.ScopeWholeSubtree, 0, 0, 0, false, filter, nil, nil)
+			res, err := conn.Search(req)
+			require.NoError(t, err)
+
+			assert.Empty(t, res.Entries, filter)
+		}
+	})
+
 	suite.T().Run("InvalidDN", func(t *testing.T) {
 		req := goldap.NewSearchRequest("dc=alice", goldap.ScopeWholeSubtree, 0, 0, 0, false, "(cn=alice)", nil, nil)
 		_, err := conn.Search(req)
@@ -273,6 +385,30 @@ func (suite *LDAPTestSuite) TestMux_Search() {
 		assert.EqualError(t, err, "LDAP Result Code 32 \"No Such Object\": ")
 	})
 
+	suite.T().Run("UnknownBaseDN", func(t *testing.T) {
+		req := goldap.NewSearchRequest("cn=eve,ou=people,dc=example,dc=org", goldap.ScopeWholeSubtree, 0, 0, 0, false, "(cn=*)", nil, nil)
+		_, err := conn.Search(req)
+
+		var ldapErr *goldap.Error
+		require.ErrorAs(t, err, &ldapErr)
+		assert.Equal(t, uint16(goldap.LDAPResultNoSuchObject), ldapErr.ResultCode)
+		assert.Equal(t, "ou=people,dc=example,dc=org", ldapErr.MatchedDN)
+	})
+
+	suite.T().Run("UnauthorizedBaseDN", func(t *testing.T) {
+		req := goldap.NewSearchRequest("cn=bob,ou=people,dc=example,dc=org", goldap.ScopeWholeSubtree, 0, 0, 0, false, "(cn=*)", nil, nil)
+		_, err := conn.Search(req)
+
+		assert.EqualError(t, err, "LDAP Result Code 50 \"Insufficient Access Rights\": ")
+	})
+
+	suite.T().Run("MalformedBaseDN", func(t *testing.T) {
+		req := goldap.NewSearchRequest("people", goldap.ScopeWholeSubtree, 0, 0, 0, false, "(cn=*)", nil, nil)
+		_, err := conn.Search(req)
+
+		assert.EqualError(t, err, "LDAP Result Code 34 \"Invalid DN Syntax\": ")
+	})
+
 	suite.T().Run("InvalidScope", func(t *testing.T) {
 		req := goldap.NewSearchRequest("dc=org", goldap.ScopeSingleLevel, 0, 0, 0, false, "(cn=alice)", nil, nil)
 		res, err := conn.Search(req)
@@ -282,6 +418,98 @@ func (suite *LDAPTestSuite) TestMux_Search() {
 	})
 }
 
+func (suite *LDAPTestSuite) TestMux_ProxiedAuthorization() {
+	conn, err := suite.DialLDAP()
+	suite.Require().NoError(err)
+	defer conn.Close()
+
+	err = conn.Bind("cn=webapp,ou=people,dc=example2,dc=org", "webapp")
+	suite.Require().NoError(err)
+
+	search := func(authzID string) (*goldap.SearchResult, error) {
+		req := goldap.NewSearchRequest("dc=org", goldap.ScopeWholeSubtree, 0, 0, 0, false, "(cn=*)", []string{"cn"}, nil)
+		if authzID != "" {
+			req.Controls = append(req.Controls, goldap.NewControlString(ldap.ControlTypeProxiedAuthorization, true, authzID))
+		}
+		return conn.Search(req)
+	}
+
+	suite.T().Run("WithoutControl", func(t *testing.T) {
+		res, err := search("")
+		require.NoError(t, err)
+
+		assert.ElementsMatch(t,
+			[]string{
+				"cn=dave,ou=people,dc=example2,dc=org",
+				"cn=erin,ou=people,dc=example2,dc=org",
+				"cn=frank,ou=people,dc=example2,dc=org",
+				"cn=webapp,ou=people,dc=example2,dc=org",
+			},
+			ResponseEntriesHelper(res.Entries).DNs(),
+		)
+	})
+
+	suite.T().Run("ReadAllowedBindPassword", func(t *testing.T) {
+		req := goldap.NewSearchRequest("dc=org", goldap.ScopeWholeSubtree, 0, 0, 0, false, "(cn=dave)", []string{"userpassword"}, nil)
+		res, err := conn.Search(req)
+		require.NoError(t, err)
+
+		require.Len(t, res.Entries, 1)
+		assert.Equal(t, []string{"dave"}, res.Entries[0].GetAttributeValues("userpassword"))
+	})
+
+	suite.T().Run("ProxiedAsDN", func(t *testing.T) {
+		res, err := search("dn:cn=alice,ou=people,dc=example,dc=org")
+		require.NoError(t, err)
+
+		// NOTE: the search must be evaluated with the ACLs of alice
+		assert.ElementsMatch(t,
+			[]string{
+				"cn=alice,ou=people,dc=example,dc=org",
+				"cn=charlie,ou=people,dc=example,dc=org",
+			},
+			ResponseEntriesHelper(res.Entries).DNs(),
+		)
+	})
+
+	suite.T().Run("ProxiedAsUsername", func(t *testing.T) {
+		res, err := search("u:alice")
+		require.NoError(t, err)
+		assert.Len(t, res.Entries, 2)
+	})
+
+	suite.T().Run("ProxiedAsForbiddenDN", func(t *testing.T) {
+		_, err := search("dn:cn=dave,ou=people,dc=example2,dc=org")
+		assert.EqualError(t, err, "LDAP Result Code 123 \"Authorization Denied\": not allowed to proxy as 'dn:cn=dave,ou=people,dc=example2,dc=org'")
+	})
+
+	suite.T().Run("ProxiedAsUnknownDN", func(t *testing.T) {
+		_, err := search("dn:cn=eve,ou=people,dc=example,dc=org")
+		assert.EqualError(t, err, "LDAP Result Code 123 \"Authorization Denied\": not allowed to proxy as 'dn:cn=eve,ou=people,dc=example,dc=org'")
+	})
+
+	suite.T().Run("InvalidAuthorizationIdentity", func(t *testing.T) {
+		_, err := search("alice")
+		assert.EqualError(t, err, "LDAP Result Code 123 \"Authorization Denied\": invalid authorization identity 'alice'")
+	})
+
+	suite.T().Run("ProxiedAdd", func(t *testing.T) {
+		req := goldap.NewAddRequest("cn=alice,ou=people,dc=example,dc=org", []goldap.Control{
+			goldap.NewControlString(ldap.ControlTypeProxiedAuthorization, true, "dn:cn=alice,ou=people,dc=example,dc=org"),
+		})
+		err := conn.Add(req)
+		assert.EqualError(t, err, "LDAP Result Code 53 \"Unwilling To Perform\": yaLDAP only support Bind and Search operations")
+	})
+
+	suite.T().Run("ProxiedDeleteAsForbiddenDN", func(t *testing.T) {
+		req := goldap.NewDelRequest("cn=alice,ou=people,dc=example,dc=org", []goldap.Control{
+			goldap.NewControlString(ldap.ControlTypeProxiedAuthorization, true, "dn:cn=dave,ou=people,dc=example2,dc=org"),
+		})
+		err := conn.Del(req)
+		assert.EqualError(t, err, "LDAP Result Code 123 \"Authorization Denied\": not allowed to proxy as 'dn:cn=dave,ou=people,dc=example2,dc=org'")
+	})
+}
+
 func (suite *LDAPTestSuite) TestMux_Add() {
 	conn, err := suite.DialLDAP()
 	suite.Require().NoError(err)
@@ -329,6 +557,35 @@ func (suite *LDAPTestSuite) TestMux_Delete() {
 
 func TestLDAPSuite(t *testing.T) { suite.Run(t, new(LDAPTestSuite)) }
 
+func TestMux_HiddenUnauthorizedBases(t *testing.T) {
+	conn := dialTestMux(t, ":10390", `
+dc:org:
+  ou:people:
+    cn:alice:
+      .acl:
+        - !!ldap/acl:allow-on ou=people,dc=org
+        - !!ldap/acl:deny-on cn=bob,ou=people,dc=org
+      userpassword: !!ldap/bind:password alice
+
+    cn:bob:
+      objectClass: person
+`, ldap.WithHiddenUnauthorizedBases(true))
+
+	err := conn.Bind("cn=alice,ou=people,dc=org", "alice")
+	require.NoError(t, err)
+
+	// NOTE: hidden and missing bases must not be distinguishable.
+	for _, baseDN := range []string{"cn=bob,ou=people,dc=org", "cn=eve,ou=people,dc=org"} {
+		req := goldap.NewSearchRequest(baseDN, goldap.ScopeWholeSubtree, 0, 0, 0, false, "(objectClass=*)", nil, nil)
+		_, err := conn.Search(req)
+
+		var ldapErr *goldap.Error
+		require.ErrorAs(t, err, &ldapErr, baseDN)
+		assert.EqualError(t, err, "LDAP Result Code 32 \"No Such Object\": ", baseDN)
+		assert.Equal(t, "ou=people,dc=org", ldapErr.MatchedDN, baseDN)
+	}
+}
+
 func (r ResponseEntryHelper) Unwrap() ResponseEntryExpectation {
 	expect := ResponseEntryExpectation{
 		DN:         r.DN,
@@ -348,3 +605,204 @@ func (r ResponseEntriesHelper) Unwrap() ResponseEntriesExpectation {
 	}
 	return expect
 }
+
+func (r ResponseEntriesHelper) DNs() []string {
+	dns := []string{}
+	for _, entry := range r {
+		dns = append(dns, entry.DN)
+	}
+	return dns
+}
+
+func TestMux_AliasDereferencing(t *testing.T) {
+	conn := dialTestMux(t, ":10391", `
+dc:org:
+  ou:people:
+    cn:alice:
+      .acl:
+        - !!ldap/acl:allow-on dc=org
+        - !!ldap/acl:deny-on ou=secret,dc=org
+      objectClass: person
+      userpassword: !!ldap/bind:password alice
+    cn:bob:
+      objectClass: person
+
+  ou:teams:
+    ou:engineering: !!ldap/alias ou=people,dc=org
+    cn:bob: !!ldap/alias cn=bob,ou=people,dc=org
+    cn:ghost: !!ldap/alias cn=ghost,ou=people,dc=org
+    cn:secret: !!ldap/alias cn=charlie,ou=secret,dc=org
+
+  ou:secret:
+    cn:charlie:
+      objectClass: person
+`)
+
+	err := conn.Bind("cn=alice,ou=people,dc=org", "alice")
+	require.NoError(t, err)
+
+	search := func(baseDN string, scope, deref int, filter string) (*goldap.SearchResult, error) {
+		return conn.Search(goldap.NewSearchRequest(baseDN, scope, deref, 0, 0, false, filter, []string{"cn"}, nil))
+	}
+
+	t.Run("NeverDerefAliases", func(t *testing.T) {
+		res, err := search("ou=teams,dc=org", goldap.ScopeSingleLevel, goldap.NeverDerefAliases, "(objectClass=alias)")
+		require.NoError(t, err)
+
+		assert.ElementsMatch(t,
+			[]string{
+				"ou=engineering,ou=teams,dc=org",
+				"cn=bob,ou=teams,dc=org",
+				"cn=ghost,ou=teams,dc=org",
+				"cn=secret,ou=teams,dc=org",
+			},
+			ResponseEntriesHelper(res.Entries).DNs(),
+		)
+	})
+
+	t.Run("DerefInSearching", func(t *testing.T) {
+		res, err := search("ou=teams,dc=org", goldap.ScopeSingleLevel, goldap.DerefInSearching, "(objectClass=person)")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cn=bob,ou=people,dc=org"}, ResponseEntriesHelper(res.Entries).DNs())
+
+		// NOTE: dereferenced entries are returned only once and only if
+		//       they are visible.
+		res, err = search("ou=teams,dc=org", goldap.ScopeWholeSubtree, goldap.DerefInSearching, "(objectClass=person)")
+		require.NoError(t, err)
+		assert.ElementsMatch(t,
+			[]string{"cn=alice,ou=people,dc=org", "cn=bob,ou=people,dc=org"},
+			ResponseEntriesHelper(res.Entries).DNs(),
+		)
+
+		// NOTE: the base is never dereferenced in this mode.
+		res, err = search("cn=bob,ou=teams,dc=org", goldap.ScopeBaseObject, goldap.DerefInSearching, "(objectClass=*)")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cn=bob,ou=teams,dc=org"}, ResponseEntriesHelper(res.Entries).DNs())
+	})
+
+	t.Run("DerefFindingBaseObj", func(t *testing.T) {
+		res, err := search("cn=bob,ou=teams,dc=org", goldap.ScopeBaseObject, goldap.DerefFindingBaseObj, "(objectClass=*)")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cn=bob,ou=people,dc=org"}, ResponseEntriesHelper(res.Entries).DNs())
+
+		// NOTE: aliases below the base are not dereferenced in this mode.
+		res, err = search("ou=teams,dc=org", goldap.ScopeSingleLevel, goldap.DerefFindingBaseObj, "(objectClass=person)")
+		require.NoError(t, err)
+		assert.Empty(t, res.Entries)
+	})
+
+	t.Run("DerefAlways", func(t *testing.T) {
+		res, err := search("ou=engineering,ou=teams,dc=org", goldap.ScopeSingleLevel, goldap.DerefAlways, "(objectClass=person)")
+		require.NoError(t, err)
+		assert.ElementsMatch(t,
+			[]string{"cn=alice,ou=people,dc=org", "cn=bob,ou=people,dc=org"},
+			ResponseEntriesHelper(res.Entries).DNs(),
+		)
+	})
+
+	t.Run("DanglingAlias", func(t *testing.T) {
+		_, err := search("cn=ghost,ou=teams,dc=org", goldap.ScopeBaseObject, goldap.DerefAlways, "(objectClass=*)")
+
+		var ldapErr *goldap.Error
+		require.ErrorAs(t, err, &ldapErr)
+		assert.EqualError(t, err, "LDAP Result Code 33 \"Alias Problem\": alias problem: alias 'cn=ghost,ou=teams,dc=org' names no object")
+		assert.Equal(t, "cn=ghost,ou=teams,dc=org", ldapErr.MatchedDN)
+	})
+
+	t.Run("UnauthorizedAlias", func(t *testing.T) {
+		_, err := search("cn=secret,ou=teams,dc=org", goldap.ScopeBaseObject, goldap.DerefAlways, "(objectClass=*)")
+		assert.EqualError(t, err, "LDAP Result Code 36 \"Alias Dereferencing Problem\": not allowed to dereference alias 'cn=secret,ou=teams,dc=org'")
+	})
+}
+
+func TestMux_Referrals(t *testing.T) {
+	conn := dialTestMux(t, ":10392", `
+dc:org:
+  ou:people:
+    cn:alice:
+      .acl: !!ldap/acl:allow-on dc=org
+      objectClass: person
+      userpassword: !!ldap/bind:password alice
+  ou:legacy:
+    objectClass: [referral, extensibleObject]
+    ref: ldap://legacy.example.org/ou=legacy,dc=org
+`, ldap.WithDefaultReferrals("ldap://root.example.org"))
+
+	err := conn.Bind("cn=alice,ou=people,dc=org", "alice")
+	require.NoError(t, err)
+
+	manageDsaIT := []goldap.Control{goldap.NewControlManageDsaIT(true)}
+	search := func(baseDN string, controls []goldap.Control) (*goldap.SearchResult, error) {
+		return conn.Search(goldap.NewSearchRequest(baseDN, goldap.ScopeWholeSubtree, 0, 0, 0, false, "(objectClass=*)", []string{"ou"}, controls))
+	}
+
+	t.Run("ReferredBaseDN", func(t *testing.T) {
+		for _, baseDN := range []string{"ou=legacy,dc=org", "cn=bob,ou=legacy,dc=org"} {
+			_, err := search(baseDN, nil)
+
+			var ldapErr *goldap.Error
+			require.ErrorAs(t, err, &ldapErr, baseDN)
+			assert.EqualError(t, err, "LDAP Result Code 53 \"Unwilling To Perform\": 'ou=legacy,dc=org' is a referral object and referrals are not supported; use the ManageDsaIT control to search it", baseDN)
+			assert.Equal(t, "ou=legacy,dc=org", ldapErr.MatchedDN, baseDN)
+		}
+	})
+
+	t.Run("ContinuationReference", func(t *testing.T) {
+		// NOTE: search result references cannot be sent, so referral
+		//       objects inside the search scope are skipped.
+		res, err := search("dc=org", nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cn=alice,ou=people,dc=org"}, ResponseEntriesHelper(res.Entries).DNs())
+		assert.Empty(t, res.Referrals)
+
+		res, err = search("dc=org", manageDsaIT)
+		require.NoError(t, err)
+		assert.ElementsMatch(t,
+			[]string{"cn=alice,ou=people,dc=org", "ou=legacy,dc=org"},
+			ResponseEntriesHelper(res.Entries).DNs(),
+		)
+	})
+
+	t.Run("ManageDsaIT", func(t *testing.T) {
+		res, err := search("ou=legacy,dc=org", manageDsaIT)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ou=legacy,dc=org"}, ResponseEntriesHelper(res.Entries).DNs())
+
+		_, err = search("cn=bob,ou=legacy,dc=org", manageDsaIT)
+		assert.EqualError(t, err, "LDAP Result Code 32 \"No Such Object\": ")
+	})
+
+	t.Run("DefaultReferral", func(t *testing.T) {
+		_, err := search("dc=com", nil)
+		assert.EqualError(t, err, "LDAP Result Code 53 \"Unwilling To Perform\": the base DN is outside all naming contexts and referrals are not supported; search it on ldap://root.example.org")
+
+		// NOTE: bases inside a naming context are not referred.
+		_, err = search("ou=groups,dc=org", nil)
+		assert.EqualError(t, err, "LDAP Result Code 32 \"No Such Object\": ")
+	})
+}
+
+// dialTestMux runs a LDAP server, listening on the given address and using
+// the given YAML directory, until the end of the test and returns a
+// connection to it.
+func dialTestMux(t *testing.T, addr string, raw string, opts ...ldap.MuxOption) *goldap.Conn {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sessions := auth.NewSessions(context.Background(), time.Minute)
+
+	directory, err := yamldir.NewDirectoryFromYAML([]byte(raw))
+	require.NoError(t, err)
+
+	server, err := gldap.NewServer()
+	require.NoError(t, err)
+	err = server.Router(ldap.NewMux(logger, directory, sessions, opts...))
+	require.NoError(t, err)
+
+	go func() { assert.NoError(t, server.Run(addr)) }()
+	t.Cleanup(func() { assert.NoError(t, server.Stop()) })
+	require.Eventually(t, server.Ready, time.Second, time.Millisecond)
+
+	conn, err := goldap.DialURL("ldap://localhost" + addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
@@ -0,0 +1,95 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+)
+
+// This file exposes the subset of age (see https://age-encryption.org/v1)
+// used by yaLDAP: X25519 recipients and identities. Other recipient types
+// (scrypt, SSH keys, plugins) are not supported.
+
+type (
+	// Identity is an age X25519 private key (`AGE-SECRET-KEY-1...`).
+	Identity = age.X25519Identity
+
+	// Recipient is an age X25519 public key (`age1...`).
+	Recipient = age.X25519Recipient
+)
+
+// GenerateIdentity generates a new random age identity.
+func GenerateIdentity() (*Identity, error) {
+	return age.GenerateX25519Identity()
+}
+
+// ParseIdentity parses the given age identity (`AGE-SECRET-KEY-1...`).
+func ParseIdentity(s string) (*Identity, error) {
+	identity, err := age.ParseX25519Identity(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age identity: %w", err)
+	}
+	return identity, nil
+}
+
+// ParseRecipient parses the given age recipient (`age1...`).
+func ParseRecipient(s string) (*Recipient, error) {
+	recipient, err := age.ParseX25519Recipient(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient '%s': %w", s, err)
+	}
+	return recipient, nil
+}
+
+// Encrypt encrypts the given plaintext for all given recipients, using the
+// binary age format.
+func Encrypt(plaintext []byte, recipients ...*Recipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no age recipient given")
+	}
+
+	ageRecipients := make([]age.Recipient, 0, len(recipients))
+	for _, recipient := range recipients {
+		ageRecipients = append(ageRecipients, recipient)
+	}
+
+	ciphertext := bytes.NewBuffer(nil)
+	w, err := age.Encrypt(ciphertext, ageRecipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return ciphertext.Bytes(), nil
+}
+
+// Decrypt decrypts the given binary age file using the first identity able
+// to do it.
+func Decrypt(ciphertext []byte, identities ...*Identity) ([]byte, error) {
+	ageIdentities := make([]age.Identity, 0, len(identities))
+	for _, identity := range identities {
+		ageIdentities = append(ageIdentities, identity)
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(ciphertext), ageIdentities...)
+	var noMatch *age.NoIdentityMatchError
+	switch {
+	case errors.As(err, &noMatch):
+		return nil, errors.New("no age identity matches any of the recipients")
+	case err != nil:
+		return nil, fmt.Errorf("invalid age file: %w", err)
+	}
+
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age file: %w", err)
+	}
+	return plaintext, nil
+}
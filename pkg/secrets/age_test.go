@@ -0,0 +1,93 @@
+package secrets
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgeKeys(t *testing.T) {
+	identity, err := GenerateIdentity()
+	require.NoError(t, err)
+	assert.Regexp(t, `^AGE-SECRET-KEY-1[02-9AC-HJ-NP-Z]{58}$`, identity.String())
+	assert.Regexp(t, `^age1[02-9ac-hj-np-z]{58}$`, identity.Recipient().String())
+
+	parsed, err := ParseIdentity(identity.String())
+	require.NoError(t, err)
+	assert.Equal(t, identity, parsed)
+
+	recipient, err := ParseRecipient(identity.Recipient().String())
+	require.NoError(t, err)
+	assert.Equal(t, identity.Recipient(), recipient)
+
+	_, err = ParseIdentity(identity.Recipient().String())
+	assert.ErrorContains(t, err, "invalid age identity: ")
+	_, err = ParseRecipient(identity.String())
+	assert.ErrorContains(t, err, "invalid age recipient '"+identity.String()+"': ")
+	_, err = ParseRecipient("age1invalid")
+	assert.ErrorContains(t, err, "invalid age recipient 'age1invalid': ")
+
+	t.Run("KnownVector", func(t *testing.T) {
+		// NOTE: test key of the age test suite.
+		identity, err := ParseIdentity("AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX")
+		require.NoError(t, err)
+		assert.Equal(t, "age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj", identity.Recipient().String())
+	})
+}
+
+func TestAgeEncryptDecrypt(t *testing.T) {
+	alice, err := GenerateIdentity()
+	require.NoError(t, err)
+	bob, err := GenerateIdentity()
+	require.NoError(t, err)
+	eve, err := GenerateIdentity()
+	require.NoError(t, err)
+
+	tests := []struct {
+		Name      string
+		Plaintext []byte
+	}{
+		{Name: "Empty", Plaintext: []byte{}},
+		{Name: "Small", Plaintext: []byte("!!ldap/bind:password alice")},
+		{Name: "SeveralChunks", Plaintext: bytes.Repeat([]byte{'a'}, 2*64*1024+42)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			ciphertext, err := Encrypt(tt.Plaintext, alice.Recipient(), bob.Recipient())
+			require.NoError(t, err)
+			assert.True(t, bytes.HasPrefix(ciphertext, []byte("age-encryption.org/v1\n-> X25519 ")))
+
+			plaintext, err := Decrypt(ciphertext, bob)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Plaintext, plaintext)
+
+			plaintext, err = Decrypt(ciphertext, eve, alice)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Plaintext, plaintext)
+
+			_, err = Decrypt(ciphertext, eve)
+			assert.EqualError(t, err, "no age identity matches any of the recipients")
+		})
+	}
+
+	t.Run("Tampered", func(t *testing.T) {
+		ciphertext, err := Encrypt([]byte("secret"), alice.Recipient())
+		require.NoError(t, err)
+
+		tampered := bytes.Clone(ciphertext)
+		tampered[len(tampered)-1] ^= 0x01
+		_, err = Decrypt(tampered, alice)
+		assert.ErrorContains(t, err, "invalid age file: ")
+
+		_, err = Decrypt([]byte("age-encryption.org/v2\n"), alice)
+		assert.ErrorContains(t, err, "invalid age file: ")
+	})
+
+	t.Run("NoRecipient", func(t *testing.T) {
+		_, err := Encrypt([]byte("secret"))
+		assert.EqualError(t, err, "no age recipient given")
+	})
+}
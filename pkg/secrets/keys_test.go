@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// armoredPGPKey returns the armored private key of the given entity.
+func armoredPGPKey(t *testing.T, entity *openpgp.Entity) []byte {
+	buf := bytes.NewBuffer(nil)
+	w, err := armor.Encode(buf, openpgp.PrivateKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.SerializePrivate(w, nil))
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestParseKeys(t *testing.T) {
+	identity, err := GenerateIdentity()
+	require.NoError(t, err)
+
+	t.Run("AgeIdentities", func(t *testing.T) {
+		keys, err := ParseKeys([]byte("# created: 2024-01-01T00:00:00Z\n# public key: " + identity.Recipient().String() + "\n" + identity.String() + "\n\n"))
+		require.NoError(t, err)
+		assert.Equal(t, []*Identity{identity}, keys.Identities)
+		assert.Empty(t, keys.PGP)
+	})
+
+	t.Run("InvalidAgeIdentity", func(t *testing.T) {
+		_, err := ParseKeys([]byte("# comment\nAGE-SECRET-KEY-1INVALID\n"))
+		assert.ErrorContains(t, err, "line 2: invalid age identity: ")
+	})
+
+	t.Run("NoKey", func(t *testing.T) {
+		_, err := ParseKeys([]byte("# comment\n"))
+		assert.EqualError(t, err, "no key found")
+	})
+
+	t.Run("PGPKey", func(t *testing.T) {
+		entity, err := openpgp.NewEntity("yaLDAP", "", "yaldap@example.org", nil)
+		require.NoError(t, err)
+
+		keys, err := ParseKeys(armoredPGPKey(t, entity))
+		require.NoError(t, err)
+		require.Len(t, keys.PGP, 1)
+		assert.Equal(t, entity.PrimaryKey.Fingerprint, keys.PGP[0].PrimaryKey.Fingerprint)
+		assert.Empty(t, keys.Identities)
+	})
+
+	t.Run("LoadKeys", func(t *testing.T) {
+		tmp := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, "key.txt"), []byte(identity.String()+"\n"), 0o600))
+
+		keys, err := LoadKeys(filepath.Join(tmp, "key.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, []*Identity{identity}, keys.Identities)
+
+		_, err = LoadKeys(filepath.Join(tmp, "missing.txt"))
+		assert.EqualError(t, err, "unable to read key file: open "+filepath.Join(tmp, "missing.txt")+": no such file or directory")
+	})
+}
+
+func TestEncryptDecryptValue(t *testing.T) {
+	identity, err := GenerateIdentity()
+	require.NoError(t, err)
+	other, err := GenerateIdentity()
+	require.NoError(t, err)
+
+	value, err := EncryptValue([]byte("!!ldap/bind:password alice"), identity.Recipient())
+	require.NoError(t, err)
+	assert.NotContains(t, value, "\n")
+
+	plaintext, err := DecryptValue(value, &Keys{Identities: []*Identity{other, identity}})
+	require.NoError(t, err)
+	assert.Equal(t, "!!ldap/bind:password alice", string(plaintext))
+
+	_, err = DecryptValue(value, &Keys{Identities: []*Identity{other}})
+	assert.EqualError(t, err, "no age identity matches any of the recipients")
+	_, err = DecryptValue(value, nil)
+	assert.EqualError(t, err, "no age identity available")
+	_, err = DecryptValue("not base64", &Keys{Identities: []*Identity{identity}})
+	assert.ErrorContains(t, err, "invalid encrypted value: ")
+}
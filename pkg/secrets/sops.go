@@ -0,0 +1,249 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/aes"
+	sopsage "github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/keyservice"
+	sopsyaml "github.com/getsops/sops/v3/stores/yaml"
+	"gopkg.in/yaml.v3"
+)
+
+// This file decrypts (and rotates) YAML files encrypted by SOPS (see
+// https://github.com/getsops/sops), like `decrypt.DataWithFormat` does, except
+// that the data key is decrypted with the age identities and PGP keys given to
+// yaLDAP instead of the ones found in the environment. Other key sources
+// (cloud KMS, Vault) are delegated to the SOPS local key service and key
+// groups are handled by SOPS itself.
+
+// sopsMetadataKey is the root key containing the SOPS metadata.
+const sopsMetadataKey = "sops"
+
+// IsSOPS returns true if the given YAML documents have been encrypted by
+// SOPS.
+func IsSOPS(roots []*yaml.Node) bool {
+	for _, root := range roots {
+		metadata := mappingValue(root, sopsMetadataKey)
+		if metadata != nil && metadata.Kind == yaml.MappingNode && mappingValue(metadata, "mac") != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// DecryptSOPS decrypts the given YAML file encrypted by SOPS, verifying its
+// MAC, and returns it without the SOPS metadata. Like SOPS, the decrypted
+// file keeps neither the YAML tags nor the anchors of the original one.
+func DecryptSOPS(raw []byte, keys *Keys) ([]byte, error) {
+	store := &sopsyaml.Store{}
+	tree, err := openSOPS(store, raw, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := store.EmitPlainFile(tree.Branches)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt SOPS file: %w", err)
+	}
+	return plaintext, nil
+}
+
+// RotateSOPS decrypts the given YAML file encrypted by SOPS, then encrypts it
+// again with a new data key, only available to the given age recipients (all
+// other key sources are removed). It returns the rotated file and the number
+// of re-encrypted values.
+func RotateSOPS(raw []byte, keys *Keys, recipients ...*Recipient) ([]byte, int, error) {
+	if len(recipients) == 0 {
+		return nil, 0, errors.New("no age recipient given")
+	}
+
+	store := &sopsyaml.Store{}
+	tree, err := openSOPS(store, raw, keys)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	group := make(sops.KeyGroup, 0, len(recipients))
+	for _, recipient := range recipients {
+		key, err := sopsage.MasterKeyFromRecipient(recipient.String())
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid age recipient '%s': %w", recipient, err)
+		}
+		group = append(group, key)
+	}
+	tree.Metadata.KeyGroups = []sops.KeyGroup{group}
+	tree.Metadata.ShamirThreshold = 0
+
+	dataKey, errs := tree.GenerateDataKeyWithKeyServices(keys.services())
+	if len(errs) > 0 {
+		return nil, 0, fmt.Errorf("unable to encrypt SOPS data key: %w", errors.Join(errs...))
+	}
+
+	cipher := aes.NewCipher()
+	mac, err := tree.Encrypt(dataKey, cipher)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to encrypt SOPS file: %w", err)
+	}
+	tree.Metadata.LastModified = time.Now().UTC()
+	tree.Metadata.MessageAuthenticationCode, err = cipher.Encrypt(mac, dataKey, tree.Metadata.LastModified.Format(time.RFC3339))
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to encrypt SOPS file: %w", err)
+	}
+
+	rotated, err := store.EmitEncryptedFile(*tree)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to encrypt SOPS file: %w", err)
+	}
+	return rotated, countEncrypted(tree.Branches), nil
+}
+
+// openSOPS loads the given YAML file encrypted by SOPS, then decrypts its
+// data key and its values, verifying its MAC.
+func openSOPS(store sops.Store, raw []byte, keys *Keys) (*sops.Tree, error) {
+	tree, err := store.LoadEncryptedFile(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SOPS file: %w", err)
+	}
+
+	dataKey, err := tree.Metadata.GetDataKeyWithKeyServices(keys.services())
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt SOPS data key: %w", err)
+	}
+
+	cipher := aes.NewCipher()
+	mac, err := tree.Decrypt(dataKey, cipher)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt SOPS file: %w", err)
+	}
+	expected, err := cipher.Decrypt(tree.Metadata.MessageAuthenticationCode, dataKey, tree.Metadata.LastModified.Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SOPS file: unable to decrypt the MAC: %w", err)
+	}
+	if mac != expected {
+		return nil, errors.New("invalid SOPS file: MAC mismatch (the file has been modified)")
+	}
+	return &tree, nil
+}
+
+// countEncrypted returns the number of encrypted values of the given
+// branches.
+func countEncrypted(branches sops.TreeBranches) int {
+	var count func(value any) int
+	count = func(value any) int {
+		switch value := value.(type) {
+		case sops.TreeBranch:
+			n := 0
+			for _, item := range value {
+				n += count(item.Value)
+			}
+			return n
+		case []any:
+			n := 0
+			for _, item := range value {
+				n += count(item)
+			}
+			return n
+		case string:
+			if strings.HasPrefix(value, "ENC[") {
+				return 1
+			}
+		}
+		return 0
+	}
+
+	n := 0
+	for _, branch := range branches {
+		n += count(branch)
+	}
+	return n
+}
+
+// services returns the SOPS key services decrypting the data key with the
+// keys.
+func (k *Keys) services() []keyservice.KeyServiceClient {
+	return []keyservice.KeyServiceClient{keyservice.NewCustomLocalClient(keyServer{keys: k})}
+}
+
+// keyServer is a SOPS key service decrypting the age and PGP data keys with
+// the keys given to yaLDAP; all other requests are served by the SOPS local
+// key service.
+type keyServer struct {
+	keyservice.Server
+	keys *Keys
+}
+
+// Decrypt decrypts the data key of the given request.
+func (s keyServer) Decrypt(ctx context.Context, req *keyservice.DecryptRequest) (*keyservice.DecryptResponse, error) {
+	var (
+		plaintext []byte
+		err       error
+	)
+	switch key := req.GetKey().GetKeyType().(type) {
+	case *keyservice.Key_AgeKey:
+		plaintext, err = s.decryptAge(key.AgeKey.GetRecipient(), req.GetCiphertext())
+	case *keyservice.Key_PgpKey:
+		plaintext, err = s.decryptPGP(req.GetCiphertext())
+	default:
+		return s.Server.Decrypt(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &keyservice.DecryptResponse{Plaintext: plaintext}, nil
+}
+
+// decryptAge decrypts the given armored data key with the age identities.
+func (s keyServer) decryptAge(recipient string, ciphertext []byte) ([]byte, error) {
+	if s.keys == nil || len(s.keys.Identities) == 0 {
+		return nil, errors.New("no age identity available")
+	}
+
+	identities := make(sopsage.ParsedIdentities, 0, len(s.keys.Identities))
+	for _, identity := range s.keys.Identities {
+		identities = append(identities, identity)
+	}
+	key := &sopsage.MasterKey{Recipient: recipient}
+	key.SetEncryptedDataKey(ciphertext)
+	identities.ApplyToMasterKey(key)
+	return key.Decrypt()
+}
+
+// decryptPGP decrypts the given armored data key with the PGP keys.
+func (s keyServer) decryptPGP(ciphertext []byte) ([]byte, error) {
+	if s.keys == nil || len(s.keys.PGP) == 0 {
+		return nil, errors.New("no PGP key available")
+	}
+
+	block, err := armor.Decode(strings.NewReader(string(ciphertext)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PGP message: %w", err)
+	}
+	details, err := openpgp.ReadMessage(block.Body, s.keys.PGP, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt PGP message: %w", err)
+	}
+	return io.ReadAll(details.UnverifiedBody)
+}
+
+// mappingValue returns the value of the given key inside the given mapping
+// node, or nil if it is not defined.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
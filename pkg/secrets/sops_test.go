@@ -0,0 +1,140 @@
+package secrets
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// NOTE: these fixtures have been encrypted by `sops` 3.8.1.
+const sopsFixtures = "../ldap/directory/yaml/fixtures/secrets/"
+
+const sopsPlaintext = `dc:org:
+  objectClass: [top, domain]
+  cn:alice:
+    objectClass: posixAccount
+    uid: alice
+    uidNumber: 1000
+    userPassword: alice
+    description_unencrypted: Alice
+`
+
+// sopsFixture returns the content of the given SOPS fixture.
+func sopsFixture(t *testing.T, name string) []byte {
+	raw, err := os.ReadFile(sopsFixtures + name)
+	require.NoError(t, err)
+	return raw
+}
+
+// sopsKeys returns the keys used to encrypt the SOPS fixtures.
+func sopsKeys(t *testing.T, names ...string) *Keys {
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		paths = append(paths, sopsFixtures+name)
+	}
+	keys, err := LoadKeys(paths...)
+	require.NoError(t, err)
+	return keys
+}
+
+// decodeYAML decodes the given YAML definition.
+func decodeYAML(t *testing.T, raw []byte) any {
+	var value any
+	require.NoError(t, yaml.Unmarshal(raw, &value))
+	return value
+}
+
+func TestIsSOPS(t *testing.T) {
+	var document yaml.Node
+	require.NoError(t, yaml.Unmarshal(sopsFixture(t, "sops.yaml"), &document))
+	assert.True(t, IsSOPS(document.Content))
+
+	require.NoError(t, yaml.Unmarshal([]byte(sopsPlaintext), &document))
+	assert.False(t, IsSOPS(document.Content))
+}
+
+func TestDecryptSOPS(t *testing.T) {
+	expected := decodeYAML(t, []byte(sopsPlaintext))
+
+	tests := []struct {
+		Name          string
+		File          string
+		Keys          *Keys
+		ExpectedError string
+	}{
+		{Name: "AgeKey", File: "sops.yaml", Keys: sopsKeys(t, "age.key")},
+		{Name: "PGPKey", File: "sops.pgp.yaml", Keys: sopsKeys(t, "pgp.key")},
+		{Name: "KeyGroups", File: "sops.key-groups.yaml", Keys: sopsKeys(t, "age.key", "pgp.key")},
+		{
+			Name:          "KeyGroups/MissingGroup",
+			File:          "sops.key-groups.yaml",
+			Keys:          sopsKeys(t, "age.key"),
+			ExpectedError: "unable to decrypt SOPS data key: Error getting data key: 2 successful groups required, got 1",
+		},
+		{
+			Name:          "NoKey",
+			File:          "sops.yaml",
+			ExpectedError: "unable to decrypt SOPS data key: Error getting data key: 0 successful groups required, got 0",
+		},
+		{
+			Name:          "WrongKey",
+			File:          "sops.yaml",
+			Keys:          sopsKeys(t, "pgp.key"),
+			ExpectedError: "unable to decrypt SOPS data key: Error getting data key: 0 successful groups required, got 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			plaintext, err := DecryptSOPS(sopsFixture(t, tt.File), tt.Keys)
+			if tt.ExpectedError != "" {
+				assert.EqualError(t, err, tt.ExpectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, expected, decodeYAML(t, plaintext))
+		})
+	}
+
+	t.Run("ModifiedUnencryptedValue", func(t *testing.T) {
+		raw := strings.Replace(string(sopsFixture(t, "sops.yaml")), "description_unencrypted: Alice", "description_unencrypted: Eve", 1)
+
+		_, err := DecryptSOPS([]byte(raw), sopsKeys(t, "age.key"))
+		assert.EqualError(t, err, "invalid SOPS file: MAC mismatch (the file has been modified)")
+	})
+
+	t.Run("MovedEncryptedValue", func(t *testing.T) {
+		raw := strings.Replace(string(sopsFixture(t, "sops.yaml")), "uidNumber:", "gidNumber:", 1)
+
+		_, err := DecryptSOPS([]byte(raw), sopsKeys(t, "age.key"))
+		assert.ErrorContains(t, err, "unable to decrypt SOPS file: ")
+	})
+}
+
+func TestRotateSOPS(t *testing.T) {
+	rotated, err := GenerateIdentity()
+	require.NoError(t, err)
+	keys := sopsKeys(t, "age.key", "pgp.key")
+
+	raw, count, err := RotateSOPS(sopsFixture(t, "sops.key-groups.yaml"), keys, rotated.Recipient())
+	require.NoError(t, err)
+	assert.Equal(t, 6, count)
+	assert.NotContains(t, string(raw), "BEGIN PGP MESSAGE")
+	assert.Contains(t, string(raw), "recipient: "+rotated.Recipient().String())
+
+	_, err = DecryptSOPS(raw, keys)
+	assert.Error(t, err)
+
+	plaintext, err := DecryptSOPS(raw, &Keys{Identities: []*Identity{rotated}})
+	require.NoError(t, err)
+	assert.Equal(t, decodeYAML(t, []byte(sopsPlaintext)), decodeYAML(t, plaintext))
+
+	t.Run("NoRecipient", func(t *testing.T) {
+		_, _, err := RotateSOPS(sopsFixture(t, "sops.yaml"), keys)
+		assert.EqualError(t, err, "no age recipient given")
+	})
+}